@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+// handleMediaGC removes media files no stored message references. The
+// min_age query parameter (a Go duration such as "10m") overrides the
+// configured safety age for files that may still be in flight. It answers
+// 409 when no stored media path lies in the media directory.
+func (s *Server) handleMediaGC(w http.ResponseWriter, r *http.Request) {
+	minAge := s.MediaGCMinAge
+	if v := r.URL.Query().Get("min_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, "min_age must be a non-negative duration such as 10m")
+			return
+		}
+		minAge = d
+	}
+
+	res, err := s.Client.CollectMediaGarbage(s.Store, minAge)
+	if errors.Is(err, bridge.ErrMediaDirMismatch) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleDBMaintenance checkpoints the WAL and, with ?vacuum=true, returns
+// free pages to the filesystem. It reports database sizes before and after.
+// Being asked for explicitly, it runs a full VACUUM whatever the size of
+// the database; a client that disconnects interrupts it.
+func (s *Server) handleDBMaintenance(w http.ResponseWriter, r *http.Request) {
+	vacuum, _ := strconv.ParseBool(r.URL.Query().Get("vacuum"))
+
+	rep, err := s.Store.Maintain(r.Context(), vacuum, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// handleShutdown starts a graceful shutdown of the bridge and answers 202
+// straight away, as the server is about to go away.
+func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if s.Shutdown == nil {
+		writeError(w, http.StatusServiceUnavailable, "shutdown is not available")
+		return
+	}
+	s.Log.Info("shutdown requested over the API", "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "shutting_down"})
+	s.Shutdown()
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// backupInfo describes one file in the backups directory.
+type backupInfo struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	CreatedAt int64  `json:"created_at"` // unix seconds
+}
+
+func (s *Server) backupDir() string {
+	return filepath.Join(s.DataDir, "backups")
+}
+
+// handleBackup snapshots the message database into data_dir/backups and,
+// with ?media=true, archives the media directory next to it.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	withMedia, _ := strconv.ParseBool(r.URL.Query().Get("media"))
+
+	dir := s.backupDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, "create backup directory: "+err.Error())
+		return
+	}
+
+	stamp := backupStamp(dir, time.Now())
+	dbFile := filepath.Join(dir, "messages-"+stamp+".db")
+	if err := s.Store.Backup(dbFile); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	files := []string{dbFile}
+
+	if withMedia {
+		mediaFile := filepath.Join(dir, "media-"+stamp+".tar.gz")
+		if err := writeTarGz(mediaFile, s.Client.MediaDir()); err != nil {
+			writeError(w, http.StatusInternalServerError, "archive media: "+err.Error())
+			return
+		}
+		files = append(files, mediaFile)
+	}
+
+	result := make([]backupInfo, 0, len(files))
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			result = append(result, newBackupInfo(f, info))
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// backupStamp names the backup files taken at t: its UTC time to the
+// millisecond, with a counter appended if files of that name exist, so
+// that backups in quick succession do not collide.
+func backupStamp(dir string, t time.Time) string {
+	base := t.UTC().Format("20060102-150405.000")
+	stamp := base
+	for n := 2; ; n++ {
+		_, errDB := os.Stat(filepath.Join(dir, "messages-"+stamp+".db"))
+		_, errMedia := os.Stat(filepath.Join(dir, "media-"+stamp+".tar.gz"))
+		if os.IsNotExist(errDB) && os.IsNotExist(errMedia) {
+			return stamp
+		}
+		stamp = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// handleListBackups lists the files in the backups directory, newest first.
+func (s *Server) handleListBackups(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(s.backupDir())
+	if err != nil && !os.IsNotExist(err) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	backups := []backupInfo{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, newBackupInfo(filepath.Join(s.backupDir(), e.Name()), info))
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt > backups[j].CreatedAt })
+
+	writeJSON(w, http.StatusOK, backups)
+}
+
+func newBackupInfo(path string, info fs.FileInfo) backupInfo {
+	return backupInfo{
+		Name:      info.Name(),
+		Path:      path,
+		Size:      info.Size(),
+		CreatedAt: info.ModTime().Unix(),
+	}
+}
+
+// writeTarGz archives the regular files under dir into a gzip-compressed tar
+// at dst. A missing dir produces an empty archive.
+func writeTarGz(dst, dir string) (err error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = "media/" + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
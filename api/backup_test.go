@@ -0,0 +1,31 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupStampUnique(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 123e6, time.UTC)
+
+	first := backupStamp(dir, now)
+	if first != "20260301-120000.123" {
+		t.Fatalf("stamp = %q", first)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "messages-"+first+".db"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	second := backupStamp(dir, now)
+	if second != first+"-2" {
+		t.Fatalf("stamp after a collision = %q, want %q", second, first+"-2")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "media-"+second+".tar.gz"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if third := backupStamp(dir, now); third != first+"-3" {
+		t.Fatalf("stamp after a media collision = %q, want %q", third, first+"-3")
+	}
+}
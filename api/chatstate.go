@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+// appStateGuidance follows the error of a failed app state patch.
+const appStateGuidance = "; WhatsApp may not have finished syncing account settings to this device yet: keep the phone online, wait a minute and retry, or re-link if it persists"
+
+// handleArchiveChat archives a chat on all devices of the account.
+func (s *Server) handleArchiveChat(w http.ResponseWriter, r *http.Request) {
+	s.setChatArchived(w, r, true)
+}
+
+// handleUnarchiveChat moves an archived chat back into the chat list.
+func (s *Server) handleUnarchiveChat(w http.ResponseWriter, r *http.Request) {
+	s.setChatArchived(w, r, false)
+}
+
+func (s *Server) setChatArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	jid, ok := s.chatJID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Client.ArchiveChat(r.Context(), jid, archived, s.Store); err != nil {
+		writeChatStateError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jid": jid, "archived": archived})
+}
+
+type muteRequest struct {
+	Duration string `json:"duration"` // e.g. 8h, 1w or always
+}
+
+// handleMuteChat mutes a chat on all devices of the account, for a
+// duration or indefinitely.
+func (s *Server) handleMuteChat(w http.ResponseWriter, r *http.Request) {
+	var req muteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return
+	}
+	until, err := muteUntil(req.Duration, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.setChatMuted(w, r, until)
+}
+
+// handleUnmuteChat unmutes a chat on all devices of the account.
+func (s *Server) handleUnmuteChat(w http.ResponseWriter, r *http.Request) {
+	s.setChatMuted(w, r, 0)
+}
+
+func (s *Server) setChatMuted(w http.ResponseWriter, r *http.Request, until int64) {
+	jid, ok := s.chatJID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Client.MuteChat(r.Context(), jid, until, s.Store); err != nil {
+		writeChatStateError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jid": jid, "muted_until": until})
+}
+
+// chatJID normalizes the chat named in the URL, so that a phone number
+// finds the same chat as its JID. It answers 400 and returns false if the
+// chat is no valid JID or number.
+func (s *Server) chatJID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	jid, err := s.Client.ChatJID(chi.URLParam(r, "jid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return jid, true
+}
+
+// muteUntil returns the MuteChat until value for a mute duration: always,
+// a number of days or weeks such as 3d or 1w, or a Go duration such as 8h.
+func muteUntil(duration string, now time.Time) (int64, error) {
+	duration = strings.TrimSpace(duration)
+	if duration == "always" {
+		return bridge.MuteForever, nil
+	}
+	var d time.Duration
+	var err error
+	switch {
+	case strings.HasSuffix(duration, "w"), strings.HasSuffix(duration, "d"):
+		unit := 24 * time.Hour
+		if strings.HasSuffix(duration, "w") {
+			unit *= 7
+		}
+		var n int64
+		n, err = strconv.ParseInt(duration[:len(duration)-1], 10, 64)
+		if err == nil && n > math.MaxInt64/int64(unit) {
+			return 0, errors.New(`duration is too long; use "always" to mute indefinitely`)
+		}
+		d = time.Duration(n) * unit
+	default:
+		d, err = time.ParseDuration(duration)
+	}
+	if err != nil || d <= 0 {
+		return 0, errors.New(`duration must be "always" or a positive duration such as 8h, 3d or 1w`)
+	}
+	return now.Add(d).Unix(), nil
+}
+
+type chatStateRequest struct {
+	Archived   *bool  `json:"archived"`
+	Pinned     *bool  `json:"pinned"`
+	MutedUntil *int64 `json:"muted_until"` // unix seconds; -1 = indefinitely, 0 = unmute
+}
+
+// handleUpdateChat changes any of a chat's archived, pinned and muted
+// state and answers with the chat as stored afterwards. Changes are made
+// one at a time; if one fails, the earlier ones stay applied.
+func (s *Server) handleUpdateChat(w http.ResponseWriter, r *http.Request) {
+	var req chatStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return
+	}
+	if req.Archived == nil && req.Pinned == nil && req.MutedUntil == nil {
+		writeError(w, http.StatusBadRequest, "archived, pinned or muted_until is required")
+		return
+	}
+	if req.Archived != nil && req.Pinned != nil && *req.Archived && *req.Pinned {
+		writeError(w, http.StatusBadRequest, "an archived chat cannot be pinned")
+		return
+	}
+	if req.MutedUntil != nil {
+		until := *req.MutedUntil
+		if until != 0 && until != bridge.MuteForever && until <= time.Now().Unix() {
+			writeError(w, http.StatusBadRequest, "muted_until must be a future unix time, -1 (indefinitely) or 0 (unmute)")
+			return
+		}
+	}
+
+	jid, ok := s.chatJID(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	if req.Archived != nil {
+		err = s.Client.ArchiveChat(r.Context(), jid, *req.Archived, s.Store)
+	}
+	if err == nil && req.Pinned != nil {
+		err = s.Client.PinChat(r.Context(), jid, *req.Pinned, s.Store)
+	}
+	if err == nil && req.MutedUntil != nil {
+		err = s.Client.MuteChat(r.Context(), jid, *req.MutedUntil, s.Store)
+	}
+	if err != nil {
+		writeChatStateError(w, err)
+		return
+	}
+
+	chat, err := s.Store.GetChat(jid)
+	if err == nil && chat != nil {
+		chat.Labels, err = s.Store.GetChatLabels(chat.JID)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if chat == nil {
+		writeError(w, http.StatusNotFound, "chat not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, chat)
+}
+
+// writeChatStateError answers a failed chat state change: 409 with advice
+// when the app state could not be patched, 502 for anything else.
+func writeChatStateError(w http.ResponseWriter, err error) {
+	if errors.Is(err, bridge.ErrAppState) {
+		writeError(w, http.StatusConflict, err.Error()+appStateGuidance)
+		return
+	}
+	writeError(w, http.StatusBadGateway, err.Error())
+}
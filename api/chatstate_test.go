@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+func TestMuteUntil(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	for _, c := range []struct {
+		duration string
+		want     int64 // 0 for an error
+	}{
+		{"always", bridge.MuteForever},
+		{" 8h ", now.Add(8 * time.Hour).Unix()},
+		{"90m", now.Add(90 * time.Minute).Unix()},
+		{"3d", now.Add(72 * time.Hour).Unix()},
+		{"1w", now.Add(7 * 24 * time.Hour).Unix()},
+		{"15250w", now.Add(15250 * 7 * 24 * time.Hour).Unix()},
+		{"15251w", 0}, // overflows time.Duration
+		{"106751d", now.Add(106751 * 24 * time.Hour).Unix()},
+		{"106752d", 0},
+		{"9223372036854775807d", 0},
+		{"99999999999999999999w", 0},
+		{"0d", 0},
+		{"-1w", 0},
+		{"-8h", 0},
+		{"0s", 0},
+		{"d", 0},
+		{"1y", 0},
+		{"", 0},
+	} {
+		got, err := muteUntil(c.duration, now)
+		if c.want == 0 {
+			if err == nil {
+				t.Errorf("%q: got %d, want an error", c.duration, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("%q: got %d, %v, want %d", c.duration, got, err, c.want)
+		}
+	}
+}
+
+func TestChatStateRejectsMalformedJID(t *testing.T) {
+	h := NewRouter(newTestServer(t))
+	const jid = "123:abc@s.whatsapp.net"
+	for _, c := range []struct{ method, path, body string }{
+		{http.MethodPatch, "/chats/" + jid, `{"archived": true}`},
+		{http.MethodPost, "/chats/" + jid + "/archive", ""},
+		{http.MethodPost, "/chats/" + jid + "/mute", `{"duration": "8h"}`},
+		{http.MethodPost, "/chats/" + jid + "/unmute", ""},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: got %d, want 400: %s", c.method, c.path, rec.Code, rec.Body)
+		}
+	}
+}
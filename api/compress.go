@@ -0,0 +1,40 @@
+package api
+
+import (
+	"compress/flate"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// compressibleTypes are the response content types worth compressing: JSON
+// listings, exports, HTML pages and the Swagger UI assets. Media is already compressed, and the
+// event stream is left alone so that events are not held back.
+var compressibleTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/csv",
+	"text/plain",
+	"text/html",
+	"text/css",
+	"text/javascript",
+}
+
+// compressMiddleware compresses responses of compressibleTypes with gzip or
+// deflate, as the client's Accept-Encoding allows. Stored media is served
+// as is, whatever its type, because it answers Range requests with byte
+// offsets into the file.
+func compressMiddleware() func(http.Handler) http.Handler {
+	compressor := middleware.NewCompressor(flate.DefaultCompression, compressibleTypes...)
+	return func(next http.Handler) http.Handler {
+		compressed := compressor.Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/media/") || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	body := `{"messages":[` + strings.Repeat(`{"content":"hello there"},`, 200) + `{}]}`
+	h := compressMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/media/") {
+			w.Header().Set("Content-Type", "text/plain")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		io.WriteString(w, body)
+	}))
+	serve := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		rec := serve("/messages", "gzip")
+		if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Content-Encoding %q, want gzip", got)
+		}
+		if rec.Body.Len() >= len(body) {
+			t.Errorf("compressed body is %d bytes, not smaller than %d", rec.Body.Len(), len(body))
+		}
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != body {
+			t.Errorf("decompressed body differs from the original")
+		}
+	})
+
+	t.Run("identity without Accept-Encoding", func(t *testing.T) {
+		rec := serve("/messages", "")
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Content-Encoding %q, want none", got)
+		}
+		if rec.Body.String() != body {
+			t.Errorf("body differs from the original")
+		}
+	})
+
+	t.Run("media served as is", func(t *testing.T) {
+		rec := serve("/media/ABC", "gzip")
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Content-Encoding %q, want none", got)
+		}
+		if rec.Body.String() != body {
+			t.Errorf("body differs from the original")
+		}
+	})
+}
@@ -1,41 +1,130 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/openclaw/whatsapp/bridge"
 	"github.com/openclaw/whatsapp/store"
 )
 
+// contactSyncTimeout bounds how long POST /contacts/sync waits for WhatsApp.
+const contactSyncTimeout = 30 * time.Second
+
 type contact struct {
 	JID  string `json:"jid"`
 	Name string `json:"name"`
+
+	// Phone is the number in international format, from the JID or, for
+	// LID contacts, WhatsApp's LID mapping; empty when unknown.
+	Phone        string `json:"phone,omitempty"`
+	PushName     string `json:"push_name,omitempty"`
+	FullName     string `json:"full_name,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
+	VerifiedName string `json:"verified_name,omitempty"` // only with ?verified=true
+	IsBusiness   bool   `json:"is_business"`
+
+	// Matched names the fields a ?q= search matched, for highlighting.
+	Matched []string `json:"matched,omitempty"`
 }
 
 func (s *Server) handleGetChats(w http.ResponseWriter, r *http.Request) {
-	limit := queryInt(r, "limit", 50)
+	page := store.Page{
+		Limit:  queryInt(r, "limit", 50),
+		Offset: queryInt(r, "offset", 0),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	filter := store.ChatFilter{Label: r.URL.Query().Get("label")}
+	if v := r.URL.Query().Get("archived"); v != "" {
+		archived, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "archived must be true or false")
+			return
+		}
+		filter.Archived = &archived
+	}
 
-	chats, err := s.Store.GetChats(limit)
+	chats, next, err := s.Store.GetChats(page, filter)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if err := s.Store.LoadChatLabels(chats); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	if chats == nil {
 		chats = []store.Chat{}
 	}
 
+	if wantsEnvelope(r) {
+		writeEnvelope(w, r, envelope{Items: chats, NextCursor: next, Limit: page.Limit, Offset: page.Offset})
+		return
+	}
 	writeJSON(w, http.StatusOK, chats)
 }
 
+type chatLabelsRequest struct {
+	Labels []string `json:"labels"`
+}
+
+// handleSetChatLabels replaces the labels of a chat.
+func (s *Server) handleSetChatLabels(w http.ResponseWriter, r *http.Request) {
+	var req chatLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Labels == nil {
+		writeBodyError(w, err, `body must be {"labels": [...]}`)
+		return
+	}
+
+	if _, err := store.NormalizeLabels(req.Labels); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	jid := chi.URLParam(r, "jid")
+	labels, err := s.Store.SetChatLabels(jid, req.Labels)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jid": jid, "labels": labels})
+}
+
+// handleGetContacts lists the contacts of the linked account, sorted by
+// name and then JID. ?q= keeps those whose names or number contain it,
+// ignoring case, and reports which fields matched; ?limit= and ?offset=
+// page the result (all contacts by default).
 func (s *Server) handleGetContacts(w http.ResponseWriter, r *http.Request) {
 	wc := s.Client.GetClient()
 	if wc == nil {
 		writeError(w, http.StatusServiceUnavailable, "client not connected")
 		return
 	}
+	limit := queryInt(r, "limit", 0)
+	offset := queryInt(r, "offset", 0)
 
 	contactStore := wc.Store.Contacts
 	if contactStore == nil {
-		writeJSON(w, http.StatusOK, []contact{})
+		total := 0
+		writeContacts(w, r, envelope{Items: []contact{}, Total: &total, Limit: limit, Offset: offset})
 		return
 	}
 
@@ -45,6 +134,8 @@ func (s *Server) handleGetContacts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	jids := make(map[string]types.JID, len(contacts))
 	result := make([]contact, 0, len(contacts))
 	for jid, info := range contacts {
 		name := info.PushName
@@ -54,11 +145,210 @@ func (s *Server) handleGetContacts(w http.ResponseWriter, r *http.Request) {
 		if name == "" {
 			name = info.BusinessName
 		}
-		result = append(result, contact{
-			JID:  jid.String(),
-			Name: name,
+		c := contact{
+			JID:          jid.String(),
+			Name:         name,
+			Phone:        contactPhone(r.Context(), wc, jid),
+			PushName:     info.PushName,
+			FullName:     info.FullName,
+			BusinessName: info.BusinessName,
+		}
+		if q != "" {
+			if c.Matched = c.match(q); c.Matched == nil {
+				continue
+			}
+		}
+		c.IsBusiness = c.BusinessName != ""
+		jids[c.JID] = jid
+		result = append(result, c)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return contactBefore(result[i].Name, result[i].JID, result[j].Name, result[j].JID)
+	})
+
+	// A cursor holds the name and JID of the last contact of the previous
+	// page; the page starts after it, even if that contact has since gone.
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		keys, err := decodeKeyCursor(c, "contacts", 2)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		offset = sort.Search(len(result), func(i int) bool {
+			return contactBefore(keys[0], keys[1], result[i].Name, result[i].JID)
 		})
 	}
 
-	writeJSON(w, http.StatusOK, result)
+	total := len(result)
+	page := result[min(offset, total):]
+	if limit > 0 && limit < len(page) {
+		page = page[:limit]
+	}
+	var next string
+	if n := len(page); n > 0 && offset+n < total {
+		next = encodeKeyCursor("contacts", page[n-1].Name, page[n-1].JID)
+	}
+
+	// Verified names cost requests to WhatsApp, so only the page is looked up.
+	if ok, _ := strconv.ParseBool(r.URL.Query().Get("verified")); ok {
+		lookup := make([]types.JID, 0, len(page))
+		for _, c := range page {
+			if jid := jids[c.JID]; jid.Server == types.DefaultUserServer {
+				lookup = append(lookup, jid)
+			}
+		}
+		verified, err := s.Client.VerifiedNames(r.Context(), lookup)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		for i := range page {
+			page[i].VerifiedName = verified[jids[page[i].JID]]
+			page[i].IsBusiness = page[i].IsBusiness || page[i].VerifiedName != ""
+		}
+	}
+
+	writeContacts(w, r, envelope{Items: page, NextCursor: next, Total: &total, Limit: limit, Offset: offset})
+}
+
+// contactBefore reports whether the contact named an with JID aj sorts
+// before the one named bn with JID bj. Unnamed contacts go last; the JID
+// breaks ties so pages are stable.
+func contactBefore(an, aj, bn, bj string) bool {
+	if (an == "") != (bn == "") {
+		return an != ""
+	}
+	if an, bn := strings.ToLower(an), strings.ToLower(bn); an != bn {
+		return an < bn
+	}
+	return aj < bj
+}
+
+// writeContacts answers with a page of contacts: a bare array, or the
+// envelope including the total when asked for.
+func writeContacts(w http.ResponseWriter, r *http.Request, env envelope) {
+	if wantsEnvelope(r) {
+		writeEnvelope(w, r, env)
+		return
+	}
+	writeJSON(w, http.StatusOK, env.Items)
+}
+
+// match returns the fields of c that contain q, which is lowercase. A q
+// that looks like a phone number is compared by its digits alone, so
+// "+31 6 1234" finds +31612345678.
+func (c *contact) match(q string) []string {
+	var matched []string
+	for _, f := range []struct{ name, value string }{
+		{"push_name", c.PushName},
+		{"full_name", c.FullName},
+		{"business_name", c.BusinessName},
+	} {
+		if strings.Contains(strings.ToLower(f.value), q) {
+			matched = append(matched, f.name)
+		}
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, q)
+	if strings.Trim(q, "0123456789+-(). ") != "" {
+		digits = ""
+	}
+	if c.Phone != "" && (strings.Contains(c.Phone, q) || digits != "" && strings.Contains(c.Phone, digits)) {
+		matched = append(matched, "phone")
+	}
+	return matched
+}
+
+// contactPhone returns the phone number of jid in international format: its
+// user part for phone number JIDs, or the mapped number for LIDs WhatsApp has
+// told us about. It is "" when the number is unknown.
+func contactPhone(ctx context.Context, wc *whatsmeow.Client, jid types.JID) string {
+	switch jid.Server {
+	case types.DefaultUserServer:
+		return "+" + jid.User
+	case types.HiddenUserServer:
+		if pn, err := wc.Store.LIDs.GetPNForLID(ctx, jid); err == nil && !pn.IsEmpty() {
+			return "+" + pn.User
+		}
+	}
+	return ""
+}
+
+// handleSyncContacts resyncs the contact list from WhatsApp and waits for it
+// to complete, so clients can offer an explicit refresh.
+func (s *Server) handleSyncContacts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), contactSyncTimeout)
+	defer cancel()
+
+	n, err := s.Client.SyncContacts(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "contact sync did not complete in time")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "synced", "contacts": n})
+}
+
+func (s *Server) handleGetContactAvatar(w http.ResponseWriter, r *http.Request) {
+	s.writeAvatar(w, r, chi.URLParam(r, "jid"))
+}
+
+// writeAvatar streams the profile picture of jid, the full-size one or, with
+// ?preview=true, the thumbnail. It answers 404 when there is no picture and
+// 403 when privacy settings hide it from the linked account.
+func (s *Server) writeAvatar(w http.ResponseWriter, r *http.Request, jid string) {
+	var preview bool
+	if v := r.URL.Query().Get("preview"); v != "" {
+		var err error
+		if preview, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "preview must be true or false")
+			return
+		}
+	}
+
+	path, err := s.Client.Avatar(r.Context(), jid, preview)
+	switch {
+	case errors.Is(err, bridge.ErrNoAvatar):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, bridge.ErrAvatarHidden):
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, bridge.ErrInvalidJID):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, bridge.ErrNotConnected):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to open profile picture")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to stat profile picture")
+		return
+	}
+
+	// The file is named after the picture ID, which changes with the
+	// picture, so it makes a strong validator. Its name has no extension:
+	// ServeContent sniffs the Content-Type from the data.
+	w.Header().Set("ETag", `"`+filepath.Base(path)+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), f)
 }
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAvatarErrors(t *testing.T) {
+	h := NewRouter(newTestServer(t))
+
+	for _, c := range []struct {
+		path string
+		want int
+	}{
+		{"/contacts/123:abc@s.whatsapp.net/avatar", http.StatusBadRequest},
+		{"/contacts/+31612345678/avatar?preview=maybe", http.StatusBadRequest},
+		{"/contacts/+31612345678/avatar", http.StatusServiceUnavailable},
+		{"/groups/120363000000000000@g.us/avatar", http.StatusServiceUnavailable},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if rec.Code != c.want {
+			t.Errorf("GET %s: got %d, want %d: %s", c.path, rec.Code, c.want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"embed"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// swaggerUI holds the Swagger UI release /docs is rendered with. It is
+// served from the binary rather than a CDN, so the page cannot load code
+// the bridge was not built with; see swaggerui/README.md.
+//
+//go:embed swaggerui/swagger-ui-bundle.js swaggerui/swagger-ui.css
+var swaggerUI embed.FS
+
+// swaggerUIAssets maps the files under /docs to their content types.
+var swaggerUIAssets = map[string]string{
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+	"swagger-ui.css":       "text/css; charset=utf-8",
+}
+
+// handleDocs serves Swagger UI for /openapi.json, when APIDocs is set.
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	if !s.APIDocs {
+		writeError(w, http.StatusNotFound, "API documentation is disabled (set api_docs: true)")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(docsPageHTML))
+}
+
+// handleDocsAsset serves the Swagger UI script and stylesheet /docs loads.
+func (s *Server) handleDocsAsset(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "file")
+	contentType, ok := swaggerUIAssets[name]
+	if !s.APIDocs || !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	data, err := swaggerUI.ReadFile("swaggerui/" + name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+const docsPageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>OpenClaw WhatsApp — API</title>
+<link rel="stylesheet" href="/docs/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="/docs/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({ url: '/openapi.json', dom_id: '#swagger-ui' });
+</script>
+</body>
+</html>`
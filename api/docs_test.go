@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDocsServesBundledSwaggerUI(t *testing.T) {
+	s := newTestServer(t)
+	s.APIDocs = true
+	h := NewRouter(s)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	page := get("/docs")
+	if page.Code != http.StatusOK {
+		t.Fatalf("/docs: status %d", page.Code)
+	}
+	if strings.Contains(page.Body.String(), "://") {
+		t.Errorf("/docs loads something from another host:\n%s", page.Body)
+	}
+	for file, contentType := range swaggerUIAssets {
+		if !strings.Contains(page.Body.String(), `"/docs/`+file+`"`) {
+			t.Errorf("/docs does not load %s", file)
+		}
+		rec := get("/docs/" + file)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != contentType || rec.Body.Len() == 0 {
+			t.Errorf("/docs/%s: status %d, type %q, %d bytes", file, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Len())
+		}
+	}
+	if rec := get("/docs/README.md"); rec.Code != http.StatusNotFound {
+		t.Errorf("/docs/README.md: status %d, want 404", rec.Code)
+	}
+
+	s.APIDocs = false
+	for _, path := range []string{"/docs", "/docs/swagger-ui.css"} {
+		if rec := get(path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s with api_docs off: status %d, want 404", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// exportContentTypes maps export formats to their response Content-Type.
+var exportContentTypes = map[string]string{
+	store.ExportJSONL: "application/x-ndjson",
+	store.ExportCSV:   "text/csv; charset=utf-8",
+	store.ExportTXT:   "text/plain; charset=utf-8",
+}
+
+func (s *Server) handleExportChat(w http.ResponseWriter, r *http.Request) {
+	jid := chi.URLParam(r, "jid")
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = store.ExportTXT
+	case "json":
+		format = store.ExportJSONL
+	}
+	if !store.ValidExportFormat(format) {
+		writeError(w, http.StatusBadRequest, "format must be one of jsonl, csv, txt")
+		return
+	}
+	withMedia, _ := strconv.ParseBool(r.URL.Query().Get("media"))
+
+	name := "chat-" + exportFileStem(jid)
+	if withMedia {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+	} else {
+		w.Header().Set("Content-Type", exportContentTypes[format])
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	}
+
+	// A large export outlives the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// The body is streamed, so errors after the first write can only be
+	// logged; the client sees a truncated download.
+	var err error
+	if withMedia {
+		err = s.Store.ExportChatZip(jid, format, w)
+	} else {
+		err = s.Store.ExportChat(jid, format, w)
+	}
+	if err != nil {
+		s.Log.Error("chat export failed", "error", err, "chat", jid)
+	}
+}
+
+// exportFileStem turns a JID into a safe file name component.
+func exportFileStem(jid string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, jid)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+func TestExportOutlivesWriteTimeout(t *testing.T) {
+	s := newTestServer(t)
+	const chat = "1@s.whatsapp.net"
+	const n = 4000
+	msgs := make([]*store.Message, n)
+	for i := range msgs {
+		msgs[i] = &store.Message{ID: fmt.Sprintf("M%d", i), ChatJID: chat, SenderJID: chat,
+			MsgType: "text", Content: strings.Repeat("x", 2000), Timestamp: int64(i + 1)}
+	}
+	if _, err := s.Store.SaveMessages(msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(NewRouter(s))
+	srv.Config.WriteTimeout = 200 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/chats/" + chat + "/export?format=jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// A slow client: the export is far from written when the timeout passes.
+	if _, err := io.ReadFull(resp.Body, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * srv.Config.WriteTimeout)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("export cut off after %d bytes: %v", len(body)+1, err)
+	}
+	if lines := strings.Count(string(body), "\n"); lines != n {
+		t.Errorf("got %d messages, want %d", lines, n)
+	}
+}
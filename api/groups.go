@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/bridge"
+	"github.com/openclaw/whatsapp/store"
+)
+
+type createGroupRequest struct {
+	Name         string   `json:"name"`
+	Participants []string `json:"participants"`
+	Description  string   `json:"description,omitempty"`
+	Message      string   `json:"message,omitempty"` // sent into the group once created
+}
+
+type createGroupResponse struct {
+	*bridge.CreatedGroup
+	MessageIDs []string `json:"message_ids,omitempty"`
+
+	// Warnings report follow-up steps that failed after the group was
+	// created; the group exists regardless.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// handleCreateGroup creates a group, then optionally sets its description
+// and sends a first message into it. With ?dry_run=true all three steps are
+// only logged.
+func (s *Server) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := sendContext(w, r)
+	if !ok {
+		return
+	}
+	var req createGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" || len(req.Participants) == 0 {
+		writeError(w, http.StatusBadRequest, "name and participants are required")
+		return
+	}
+
+	created, err := s.Client.CreateGroup(ctx, req.Name, req.Participants, s.Store)
+	if errors.Is(err, bridge.ErrInvalidParticipant) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	resp := createGroupResponse{CreatedGroup: created}
+	if req.Description != "" {
+		if err := s.Client.SetGroupDescription(ctx, created.JID, req.Description); err != nil {
+			resp.Warnings = append(resp.Warnings, err.Error())
+		}
+	}
+	if req.Message != "" {
+		sent, err := s.Client.Send(ctx, created.JID, bridge.Content{Text: req.Message}, bridge.SendOptions{})
+		for _, m := range sent {
+			s.recordSent(m, "text", m.Content, "")
+			resp.MessageIDs = append(resp.MessageIDs, m.ID)
+		}
+		if err != nil {
+			s.recordFailed(created.JID, "text", req.Message, err)
+			resp.Warnings = append(resp.Warnings, err.Error())
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type updateParticipantsRequest struct {
+	Action       string   `json:"action"` // add, remove, promote or demote
+	Participants []string `json:"participants"`
+}
+
+// handleUpdateGroupParticipants adds, removes, promotes or demotes group
+// members, answering with the outcome for each participant.
+func (s *Server) handleUpdateGroupParticipants(w http.ResponseWriter, r *http.Request) {
+	var req updateParticipantsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return
+	}
+	if req.Action == "" || len(req.Participants) == 0 {
+		writeError(w, http.StatusBadRequest, "action and participants are required")
+		return
+	}
+
+	results, err := s.Client.UpdateGroupParticipants(r.Context(), chi.URLParam(r, "jid"), req.Action, req.Participants, s.Store)
+	switch {
+	case errors.Is(err, bridge.ErrInvalidAction), errors.Is(err, bridge.ErrInvalidParticipant):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, bridge.ErrNotGroupMember):
+		writeError(w, http.StatusNotFound, "the linked account is not a member of this group")
+		return
+	case errors.Is(err, bridge.ErrNotGroupAdmin):
+		writeError(w, http.StatusForbidden, "the linked account must be a group admin to "+req.Action+" participants")
+		return
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"action": req.Action, "participants": results})
+}
+
+// handleUpdateGroup changes any of a group's name, description, announce
+// and locked settings and answers with the group as it is afterwards.
+func (s *Server) handleUpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var settings bridge.GroupSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return
+	}
+	if settings.Name == nil && settings.Description == nil && settings.Announce == nil && settings.Locked == nil {
+		writeError(w, http.StatusBadRequest, "name, description, announce or locked is required")
+		return
+	}
+	if settings.Name != nil && strings.TrimSpace(*settings.Name) == "" {
+		writeError(w, http.StatusBadRequest, "name must not be empty")
+		return
+	}
+
+	group, err := s.Client.UpdateGroupSettings(r.Context(), chi.URLParam(r, "jid"), settings)
+	if err != nil {
+		writeGroupChangeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, group)
+}
+
+// handleSetGroupPhoto sets a group's photo from the "photo" field of a
+// multipart form. Any JPEG, PNG or GIF is cropped and scaled to fit.
+func (s *Server) handleSetGroupPhoto(w http.ResponseWriter, r *http.Request) {
+	// 10 MB max
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		writeBodyError(w, err, "failed to parse multipart form: "+err.Error())
+		return
+	}
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "photo is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to read photo")
+		return
+	}
+
+	group, err := s.Client.SetGroupPhoto(r.Context(), chi.URLParam(r, "jid"), data)
+	if err != nil {
+		writeGroupChangeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, group)
+}
+
+// handleGetGroupAvatar streams a group's photo; see writeAvatar.
+func (s *Server) handleGetGroupAvatar(w http.ResponseWriter, r *http.Request) {
+	jid := chi.URLParam(r, "jid")
+	if !strings.HasSuffix(jid, "@g.us") {
+		writeError(w, http.StatusBadRequest, "jid must be a group JID (…@g.us)")
+		return
+	}
+	s.writeAvatar(w, r, jid)
+}
+
+// writeGroupChangeError answers a failed group change: 400 for bad input,
+// 413 for an oversized photo, 403 when the linked account is not an admin, 404 when it is not in the
+// group, and 502 for anything else WhatsApp reports.
+func writeGroupChangeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bridge.ErrInvalidPhoto):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, bridge.ErrImageTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, bridge.ErrNotGroupAdmin):
+		writeError(w, http.StatusForbidden, "the linked account must be a group admin to change this: "+err.Error())
+	case errors.Is(err, bridge.ErrNotGroupMember):
+		writeError(w, http.StatusNotFound, "the linked account is not a member of this group")
+	default:
+		writeError(w, http.StatusBadGateway, err.Error())
+	}
+}
+
+// handleGetGroupParticipants lists a group's members from the local table.
+// ?refresh=true re-fetches the membership from WhatsApp first, and
+// ?include_removed=true also lists former members.
+func (s *Server) handleGetGroupParticipants(w http.ResponseWriter, r *http.Request) {
+	jid := chi.URLParam(r, "jid")
+	q := r.URL.Query()
+
+	var refresh, includeRemoved bool
+	var err error
+	if v := q.Get("refresh"); v != "" {
+		if refresh, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "refresh must be true or false")
+			return
+		}
+	}
+	if v := q.Get("include_removed"); v != "" {
+		if includeRemoved, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "include_removed must be true or false")
+			return
+		}
+	}
+
+	if refresh {
+		if err := s.Client.RefreshGroupParticipants(r.Context(), jid, s.Store); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	participants, err := s.Store.GetGroupParticipants(jid, includeRemoved)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if participants == nil {
+		participants = []store.Participant{}
+	}
+
+	writeJSON(w, http.StatusOK, participants)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateGroupDryRun(t *testing.T) {
+	s := newTestServer(t)
+	h := NewRouter(s)
+	body := `{"name": "Project X", "participants": ["31612345678@s.whatsapp.net"], "description": "Kick-off", "message": "Welcome"}`
+
+	// Without a connection only a dry run can create a group.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/groups", strings.NewReader(body)))
+	if rec.Code == http.StatusOK {
+		t.Fatalf("create while disconnected succeeded: %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/groups?dry_run=true", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry-run create: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		JID          string   `json:"jid"`
+		Participants []string `json:"participants"`
+		DryRun       bool     `json:"dry_run"`
+		MessageIDs   []string `json:"message_ids"`
+		Warnings     []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.DryRun || !strings.HasSuffix(resp.JID, "@g.us") || len(resp.Participants) != 1 {
+		t.Fatalf("dry-run create answered %s", rec.Body)
+	}
+	if len(resp.Warnings) != 0 || len(resp.MessageIDs) != 1 || !strings.HasPrefix(resp.MessageIDs[0], "DRYRUN-") {
+		t.Fatalf("dry-run follow-ups: %s", rec.Body)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+// handleRequestHistory asks WhatsApp for messages older than the oldest one
+// stored for a chat. The history arrives asynchronously and is stored when it
+// lands, so the request is only acknowledged here.
+func (s *Server) handleRequestHistory(w http.ResponseWriter, r *http.Request) {
+	jid := chi.URLParam(r, "jid")
+	count := queryInt(r, "count", bridge.DefaultHistoryCount)
+	if count < 1 || count > bridge.MaxHistoryCount {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", bridge.MaxHistoryCount))
+		return
+	}
+
+	err := s.Client.RequestHistory(r.Context(), jid, s.Store, count)
+	if errors.Is(err, bridge.ErrNoHistoryAnchor) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":   "requested",
+		"chat_jid": jid,
+		"count":    count,
+	})
+}
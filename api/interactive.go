@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+func (s *Server) handleSendButtons(w http.ResponseWriter, r *http.Request) {
+	if !s.Interactive {
+		writeError(w, http.StatusForbidden, "interactive messages are disabled (set interactive_messages: true)")
+		return
+	}
+
+	ctx, ok := sendContext(w, r)
+	if !ok {
+		return
+	}
+
+	req, ok := decodeSend(w, r)
+	if !ok {
+		return
+	}
+	if req.Text == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	if err := bridge.ValidateButtons(req.Buttons); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.deliver(ctx, w, req, bridge.Content{Text: req.Text, Buttons: req.Buttons}, "buttons")
+}
+
+func (s *Server) handleSendList(w http.ResponseWriter, r *http.Request) {
+	if !s.Interactive {
+		writeError(w, http.StatusForbidden, "interactive messages are disabled (set interactive_messages: true)")
+		return
+	}
+
+	ctx, ok := sendContext(w, r)
+	if !ok {
+		return
+	}
+
+	req, ok := decodeSend(w, r)
+	if !ok {
+		return
+	}
+	if req.Text == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	if err := bridge.ValidateList(req.ButtonText, req.Sections); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	list := &bridge.List{ButtonText: req.ButtonText, Sections: req.Sections}
+	s.deliver(ctx, w, req, bridge.Content{Text: req.Text, List: list}, "list")
+}
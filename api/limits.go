@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// BodyLimits cap the size of request bodies. A request over its limit gets
+// 413. Zero leaves a limit off.
+type BodyLimits struct {
+	// Body caps every request body except multipart uploads.
+	Body int64
+
+	// Upload caps multipart/form-data bodies, such as /send/file.
+	Upload int64
+}
+
+// maxFormValue caps each non-file field of a streamed multipart form.
+const maxFormValue = 64 << 10
+
+// sniffLen is how much of an upload is kept for content type detection.
+const sniffLen = 512
+
+// bodyLimitMiddleware limits request bodies to the upload limit for
+// multipart forms and the body limit for everything else.
+func bodyLimitMiddleware(limits BodyLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := limits.Body
+			if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+				limit = limits.Upload
+			}
+			if limit > 0 && r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeBodyError reports a failure to read the request body: 413 if the
+// body was over its limit, otherwise 400 with message.
+func writeBodyError(w http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+		return
+	}
+	writeError(w, http.StatusBadRequest, message)
+}
+
+// uploadForm is a multipart form whose file was streamed to a temporary
+// file instead of being held in memory. Close removes the file.
+type uploadForm struct {
+	values   url.Values
+	file     *os.File // nil if the form had no file field
+	filename string
+	size     int64
+	head     []byte // the first bytes of the file, for content sniffing
+}
+
+// readUpload streams the multipart form of r, spooling the part named
+// field to a temporary file. The other fields may come before or after it.
+func readUpload(r *http.Request, field string) (*uploadForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &uploadForm{values: url.Values{}}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			form.Close()
+			return nil, err
+		}
+
+		name := part.FormName()
+		if name == field && form.file == nil {
+			form.filename = part.FileName()
+			err = form.spool(part)
+		} else {
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, maxFormValue+1))
+			if err == nil && len(value) > maxFormValue {
+				err = fmt.Errorf("field %q is larger than %d bytes", name, maxFormValue)
+			}
+			form.values.Add(name, string(value))
+		}
+		part.Close()
+		if err != nil {
+			form.Close()
+			return nil, err
+		}
+	}
+}
+
+// spool copies the file in p to a temporary file.
+func (f *uploadForm) spool(p io.Reader) error {
+	tmp, err := os.CreateTemp("", "openclaw-upload-*")
+	if err != nil {
+		return err
+	}
+	f.file = tmp
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(p, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	f.head = head[:n]
+	if _, err := tmp.Write(f.head); err != nil {
+		return err
+	}
+	rest, err := io.Copy(tmp, p)
+	if err != nil {
+		return err
+	}
+	f.size = int64(n) + rest
+	_, err = tmp.Seek(0, io.SeekStart)
+	return err
+}
+
+// Value returns the first value of the named field.
+func (f *uploadForm) Value(name string) string {
+	return f.values.Get(name)
+}
+
+// Close removes the spooled file, if any.
+func (f *uploadForm) Close() {
+	if f.file != nil {
+		f.file.Close()
+		os.Remove(f.file.Name())
+	}
+}
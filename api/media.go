@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+func (s *Server) handleDownloadMedia(w http.ResponseWriter, r *http.Request) {
+	msg, ok := s.lookupMessage(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	if !msg.HasMediaKeys() {
+		writeError(w, http.StatusUnprocessableEntity, "message has no downloadable media")
+		return
+	}
+
+	if err := s.fetchMedia(r.Context(), msg); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// handleGetMedia streams a message's media file. When the file is not on disk
+// yet (lazy download mode, or an earlier download failed) it is fetched from
+// WhatsApp using the stored keys and cached for subsequent requests. Range
+// and conditional requests are supported, so audio and video can be
+// scrubbed. With signed media URLs enabled, a valid ?token= is required.
+func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if s.MediaSigner != nil {
+		if err := s.MediaSigner.Verify(id, r.URL.Query().Get("token")); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	msg, ok := s.lookupMessage(w, id)
+	if !ok {
+		return
+	}
+
+	if !mediaOnDisk(msg.MediaPath) {
+		if !msg.HasMediaKeys() {
+			writeError(w, http.StatusNotFound, "message has no media")
+			return
+		}
+		if err := s.fetchMedia(r.Context(), msg); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	if !insideDir(s.Client.MediaDir(), msg.MediaPath) {
+		writeError(w, http.StatusForbidden, "media path is outside the media directory")
+		return
+	}
+
+	f, err := os.Open(msg.MediaPath)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to open media file")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to stat media file")
+		return
+	}
+
+	if msg.MediaMimetype != "" {
+		w.Header().Set("Content-Type", msg.MediaMimetype)
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	http.ServeContent(w, r, filepath.Base(msg.MediaPath), info.ModTime(), f)
+}
+
+// lookupMessage loads a message by ID, writing a 404 or 500 response and
+// returning false if it cannot be loaded.
+func (s *Server) lookupMessage(w http.ResponseWriter, id string) (*store.Message, bool) {
+	msg, err := s.Store.GetMessageByID(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if msg == nil {
+		writeError(w, http.StatusNotFound, "message not found")
+		return nil, false
+	}
+	return msg, true
+}
+
+// fetchMedia downloads msg's media from WhatsApp and records the resulting
+// path in the store and on msg.
+func (s *Server) fetchMedia(ctx context.Context, msg *store.Message) error {
+	path, err := s.Client.DownloadStoredMedia(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.UpdateMediaPath(msg.ID, path); err != nil {
+		return err
+	}
+	msg.MediaPath = path
+	return nil
+}
+
+// insideDir reports whether path, once symlinks are resolved, lies within
+// dir. Media paths come from the store, so this keeps a tampered or
+// migrated row from serving arbitrary files.
+func insideDir(dir, path string) bool {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// mediaOnDisk reports whether path names an existing regular file.
+func mediaOnDisk(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
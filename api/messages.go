@@ -1,55 +1,112 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/openclaw/whatsapp/bridge"
 	"github.com/openclaw/whatsapp/store"
 )
 
-type sendTextRequest struct {
-	To      string `json:"to"`
-	Message string `json:"message"`
+// handleSendText sends a text message. It also serves /reply and
+// /agent/reply, which differ only in authentication.
+func (s *Server) handleSendText(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := sendContext(w, r)
+	if !ok {
+		return
+	}
+
+	req, ok := decodeSend(w, r)
+	if !ok {
+		return
+	}
+	if req.Message == "" {
+		writeError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+
+	if req.SimulateTyping {
+		s.deliverTyped(ctx, w, req, bridge.Content{Text: req.Message})
+		return
+	}
+	s.deliver(ctx, w, req, bridge.Content{Text: req.Message}, "text")
 }
 
-func (s *Server) handleSendText(w http.ResponseWriter, r *http.Request) {
-	var req sendTextRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
+func (s *Server) handleSendFile(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := sendContext(w, r)
+	if !ok {
 		return
 	}
-	if req.To == "" || req.Message == "" {
-		writeError(w, http.StatusBadRequest, "to and message are required")
+
+	// The file is streamed to disk so that large uploads do not have to
+	// fit in memory.
+	form, err := readUpload(r, "file")
+	if err != nil {
+		writeBodyError(w, err, "failed to parse multipart form: "+err.Error())
 		return
 	}
+	defer form.Close()
 
-	if err := s.Client.SendText(r.Context(), req.To, req.Message); err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+	req := sendRequest{
+		To:             form.Value("to"),
+		GroupName:      form.Value("group_name"),
+		QuoteMessageID: form.Value("quote_message_id"),
+	}
+	if req.To == "" && req.GroupName == "" {
+		writeError(w, http.StatusBadRequest, "to or group_name is required")
+		return
+	}
+	if form.file == nil {
+		writeError(w, http.StatusBadRequest, "file is required")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+	mimetype := http.DetectContentType(form.head)
+	if bridge.IsOpusOgg(form.head) {
+		// Sniffed as application/ogg; send it as the voice note it is.
+		mimetype = bridge.OpusVoiceMimetype
+	}
+	content := bridge.Content{
+		Text: form.Value("caption"),
+		File: &bridge.File{Reader: form.file, Size: form.size, Mimetype: mimetype, Filename: form.filename},
+	}
+	s.deliver(ctx, w, req, content, fileMsgType(mimetype))
 }
 
-func (s *Server) handleSendFile(w http.ResponseWriter, r *http.Request) {
-	// 50 MB max
-	if err := r.ParseMultipartForm(50 << 20); err != nil {
-		writeError(w, http.StatusBadRequest, "failed to parse multipart form: "+err.Error())
+// handleSendSticker sends the image in the "file" field of a multipart form
+// as a sticker, converting PNG and JPEG images to WebP first.
+func (s *Server) handleSendSticker(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := sendContext(w, r)
+	if !ok {
 		return
 	}
 
-	to := r.FormValue("to")
-	caption := r.FormValue("caption")
-	if to == "" {
-		writeError(w, http.StatusBadRequest, "to is required")
+	r.Body = http.MaxBytesReader(w, r.Body, bridge.MaxStickerInput+1<<20)
+	if err := r.ParseMultipartForm(bridge.MaxStickerInput); err != nil {
+		writeBodyError(w, err, "failed to parse multipart form: "+err.Error())
 		return
 	}
 
-	file, header, err := r.FormFile("file")
+	req := sendRequest{
+		To:             r.FormValue("to"),
+		GroupName:      r.FormValue("group_name"),
+		QuoteMessageID: r.FormValue("quote_message_id"),
+	}
+	if req.To == "" && req.GroupName == "" {
+		writeError(w, http.StatusBadRequest, "to or group_name is required")
+		return
+	}
+
+	file, _, err := r.FormFile("file")
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "file is required")
 		return
@@ -61,50 +118,312 @@ func (s *Server) handleSendFile(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to read file")
 		return
 	}
+	sticker, err := bridge.ConvertSticker(data)
+	if errors.Is(err, bridge.ErrStickerTooLarge) || errors.Is(err, bridge.ErrImageTooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.deliver(ctx, w, req, bridge.Content{Sticker: sticker}, "sticker")
+}
+
+func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
+	chatJID := r.URL.Query().Get("chat")
+	if chatJID == "" && r.URL.Query().Get("status") == "" {
+		writeError(w, http.StatusBadRequest, "chat or status query parameter is required")
+		return
+	}
+
+	s.writeChatMessages(w, r, chatJID)
+}
+
+func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	msg, ok := s.lookupMessage(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	if msg.IsGroup && msg.IsFromMe {
+		receipts, err := s.Store.GetReceipts(msg.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		msg.Receipts = receipts
+	}
+
+	if msg.EditCount > 0 {
+		edits, err := s.Store.GetEdits(msg.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		msg.Edits = edits
+	}
+
+	if err := s.Store.LoadQuoted(msg); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	mimetype := http.DetectContentType(data)
-	filename := header.Filename
+	msgs := []store.Message{*msg}
+	if err := s.Store.LoadReactions(msgs); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(msgs[0].Reactions) > 0 {
+		reactors, err := s.Store.GetReactionsForMessage(msg.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		msgs[0].Reactors = reactors
+	}
+
+	writeJSON(w, http.StatusOK, msgs[0])
+}
+
+func (s *Server) handleStarMessage(w http.ResponseWriter, r *http.Request) {
+	s.setStarred(w, chi.URLParam(r, "id"), true)
+}
+
+func (s *Server) handleUnstarMessage(w http.ResponseWriter, r *http.Request) {
+	s.setStarred(w, chi.URLParam(r, "id"), false)
+}
 
-	if err := s.Client.SendFile(r.Context(), to, data, mimetype, filename, caption); err != nil {
+func (s *Server) setStarred(w http.ResponseWriter, id string, starred bool) {
+	found, err := s.Store.SetStarred(id, starred)
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if !found {
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "starred": starred})
 }
 
-func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
-	chatJID := r.URL.Query().Get("chat")
-	if chatJID == "" {
-		writeError(w, http.StatusBadRequest, "chat query parameter is required")
+// handleRevokeMessage deletes one of our own messages for everyone and marks
+// it revoked in the store. A dry run only logs the revoke and leaves the
+// stored message alone.
+func (s *Server) handleRevokeMessage(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := sendContext(w, r)
+	if !ok {
+		return
+	}
+	msg, ok := s.lookupMessage(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	if !msg.IsFromMe {
+		writeError(w, http.StatusForbidden, "only our own messages can be revoked")
+		return
+	}
+
+	sent, err := s.Client.RevokeMessage(ctx, msg.ChatJID, msg.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if sent.DryRun {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": msg.ID, "revoked": false, "status": "dry_run"})
+		return
+	}
+	if _, err := s.Store.RevokeMessage(msg.ID, s.BlankRevoked); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": msg.ID, "revoked": true})
+}
+
+// handleGetMessagesByTime lists the messages of all chats in a time range as
+// {"items": [...], "next_cursor": "..."}. Items are written as they are read
+// from the store, so a failure part-way leaves the response truncated.
+func (s *Server) handleGetMessagesByTime(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tr := store.TimeRange{MsgType: q.Get("type")}
+
+	var err error
+	if tr.After, err = queryTime(r, "after"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if tr.Before, err = queryTime(r, "before"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if tr.After == 0 && tr.Before == 0 {
+		writeError(w, http.StatusBadRequest, "after or before is required")
+		return
+	}
+	if v := q.Get("is_group"); v != "" {
+		isGroup, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "is_group must be true or false")
+			return
+		}
+		tr.IsGroup = &isGroup
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		tr.Ascending = true
+	default:
+		writeError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	cursor := q.Get("cursor")
+	if cursor != "" {
+		if _, _, err := store.DecodeCursor(cursor); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	limit := min(queryInt(r, "limit", 100), store.MaxRangeLimit)
+
+	// The response starts with the first item, so that a store error before
+	// it can still be reported properly.
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `{"items":[`)
+		started = true
+	}
+	next, err := s.Store.GetMessagesByTime(tr, cursor, limit, func(m *store.Message) error {
+		item, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if started {
+			io.WriteString(w, ",")
+		} else {
+			start()
+		}
+		_, err = w.Write(item)
+		return err
+	})
+	if err != nil {
+		if !started {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Log.Error("message range response aborted", "error", err)
 		return
 	}
 
+	if !started {
+		start()
+	}
+	io.WriteString(w, "]")
+	if next != "" {
+		io.WriteString(w, `,"next_cursor":"`+next+`"`)
+	}
+	io.WriteString(w, "}\n")
+}
+
+func (s *Server) handleGetStarredMessages(w http.ResponseWriter, r *http.Request) {
 	limit := queryInt(r, "limit", 50)
 	offset := queryInt(r, "offset", 0)
 
-	msgs, err := s.Store.GetMessages(chatJID, limit, offset)
+	// Like a search cursor, a starred cursor carries the position of the
+	// next page.
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		keys, err := decodeKeyCursor(c, "starred", 1)
+		if err == nil {
+			offset, err = strconv.Atoi(keys[0])
+		}
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, store.ErrInvalidCursor.Error())
+			return
+		}
+	}
+
+	msgs, err := s.Store.GetStarredMessages(limit+1, offset)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	var next string
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+		next = encodeKeyCursor("starred", strconv.Itoa(offset+limit))
+	}
 	if msgs == nil {
 		msgs = []store.Message{}
 	}
 
+	if wantsEnvelope(r) {
+		writeEnvelope(w, r, envelope{Items: msgs, NextCursor: next, Limit: limit, Offset: offset})
+		return
+	}
 	writeJSON(w, http.StatusOK, msgs)
 }
 
 func (s *Server) handleSearchMessages(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query().Get("q")
-	if q == "" {
-		writeError(w, http.StatusBadRequest, "q query parameter is required")
+	q := r.URL.Query()
+	params := store.SearchParams{
+		Query:     q.Get("q"),
+		ChatJID:   q.Get("chat"),
+		SenderJID: q.Get("sender"),
+		MsgType:   q.Get("type"),
+		Limit:     queryInt(r, "limit", 20),
+		Offset:    queryInt(r, "offset", 0),
+	}
+
+	// Relevance ranks are no stable sort key, so a search cursor carries the
+	// position of the next page.
+	if c := q.Get("cursor"); c != "" {
+		keys, err := decodeKeyCursor(c, "search", 1)
+		if err == nil {
+			params.Offset, err = strconv.Atoi(keys[0])
+		}
+		if err != nil || params.Offset < 0 {
+			writeError(w, http.StatusBadRequest, store.ErrInvalidCursor.Error())
+			return
+		}
+	}
+
+	var err error
+	if params.After, err = queryTime(r, "after"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if params.Before, err = queryTime(r, "before"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := q.Get("is_group"); v != "" {
+		isGroup, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "is_group must be true or false")
+			return
+		}
+		params.IsGroup = &isGroup
+	}
 
-	limit := queryInt(r, "limit", 20)
+	if v := q.Get("include_revoked"); v != "" {
+		if params.IncludeRevoked, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "include_revoked must be true or false")
+			return
+		}
+	}
+
+	unfiltered := store.SearchParams{Limit: params.Limit, Offset: params.Offset, IncludeRevoked: params.IncludeRevoked}
+	if params == unfiltered {
+		writeError(w, http.StatusBadRequest, "q or at least one filter (chat, sender, type, after, before, is_group) is required")
+		return
+	}
 
-	msgs, err := s.Store.SearchMessages(q, limit)
+	msgs, total, err := s.Store.SearchMessages(params)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -113,6 +432,16 @@ func (s *Server) handleSearchMessages(w http.ResponseWriter, r *http.Request) {
 		msgs = []store.Message{}
 	}
 
+	var next string
+	if end := params.Offset + len(msgs); end < total {
+		next = encodeKeyCursor("search", strconv.Itoa(end))
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if wantsEnvelope(r) {
+		writeEnvelope(w, r, envelope{Items: msgs, NextCursor: next, Total: &total, Limit: params.Limit, Offset: params.Offset})
+		return
+	}
 	writeJSON(w, http.StatusOK, msgs)
 }
 
@@ -123,44 +452,241 @@ func (s *Server) handleGetChatMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := queryInt(r, "limit", 50)
-	offset := queryInt(r, "offset", 0)
+	s.writeChatMessages(w, r, jid)
+}
+
+// writeChatMessages writes one page of a chat's messages, or with an empty
+// chatJID of every chat: in the envelope when asked for, with the total for
+// ?count=true, and otherwise as a bare array with the next cursor in the
+// X-Next-Cursor header.
+func (s *Server) writeChatMessages(w http.ResponseWriter, r *http.Request, chatJID string) {
+	page := store.Page{
+		Limit:  queryInt(r, "limit", 50),
+		Offset: queryInt(r, "offset", 0),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	if v := r.URL.Query().Get("before_ts"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ts <= 0 {
+			writeError(w, http.StatusBadRequest, "before_ts must be a positive unix timestamp")
+			return
+		}
+		page.BeforeTS = ts
+	}
+	page.BeforeID = r.URL.Query().Get("before_id")
+	if page.BeforeID != "" && page.BeforeTS == 0 {
+		writeError(w, http.StatusBadRequest, "before_id needs before_ts")
+		return
+	}
+	if page.Cursor != "" && page.BeforeTS != 0 {
+		writeError(w, http.StatusBadRequest, "cursor and before_ts cannot be combined")
+		return
+	}
 
-	msgs, err := s.Store.GetMessages(jid, limit, offset)
+	filter := store.MessageFilter{
+		MsgType: r.URL.Query().Get("type"),
+		Status:  r.URL.Query().Get("status"),
+	}
+	switch filter.Status {
+	case "", store.StatusSent, store.StatusDelivered, store.StatusRead, store.StatusFailed:
+	default:
+		writeError(w, http.StatusBadRequest, "status must be one of sent, delivered, read, failed")
+		return
+	}
+	var err error
+	if filter.MinSize, err = querySize(r, "min_size"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.MaxSize, err = querySize(r, "max_size"); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	msgs, next, err := s.Store.GetMessages(chatJID, filter, page)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if err := s.Store.LoadReactions(msgs); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	if msgs == nil {
 		msgs = []store.Message{}
 	}
 
+	if wantsEnvelope(r) {
+		var total *int
+		if wantsCount(r) {
+			n, err := s.Store.CountMessages(chatJID, filter)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			total = &n
+		}
+		writeEnvelope(w, r, envelope{Items: msgs, NextCursor: next, Total: total, Limit: page.Limit, Offset: page.Offset})
+		return
+	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
 	writeJSON(w, http.StatusOK, msgs)
 }
 
-type replyRequest struct {
-	To             string `json:"to"`
-	Message        string `json:"message"`
-	QuoteMessageID string `json:"quote_message_id,omitempty"`
+// writeSentText records the messages of a text send and reports them. Long
+// texts go out as several messages: "id" is the first, "ids" lists all. Parts
+// sent before a failure are recorded even though the request fails, and the
+// rest of the text is recorded as one failed message.
+func (s *Server) writeSentText(w http.ResponseWriter, to, text string, sent []*bridge.SentMessage, err error) {
+	ids := s.recordSentText(to, text, sent, err)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := sendResult(sent[0])
+	resp["ids"] = ids
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) handleReply(w http.ResponseWriter, r *http.Request) {
-	var req replyRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
-		return
+// recordSentText records the parts of text that were sent and, after an
+// error, the rest as failed. It returns the IDs of the sent parts.
+func (s *Server) recordSentText(to, text string, sent []*bridge.SentMessage, err error) []string {
+	return s.Client.RecordSentText(s.Store, to, text, sent, err)
+}
+
+// recordSent persists a message we sent so that it appears in chat history
+// and can accumulate delivery receipts.
+func (s *Server) recordSent(sent *bridge.SentMessage, msgType, content, mediaPath string) {
+	s.Client.RecordSent(s.Store, sent, msgType, content, mediaPath)
+}
+
+// sendContext returns the context to send under: a dry run when the request
+// has ?dry_run=true. A malformed value is answered with 400 and ok false.
+func sendContext(w http.ResponseWriter, r *http.Request) (ctx context.Context, ok bool) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return r.Context(), true
 	}
-	if req.To == "" || req.Message == "" {
-		writeError(w, http.StatusBadRequest, "to and message are required")
-		return
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "dry_run must be true or false")
+		return nil, false
+	}
+	if dryRun {
+		return bridge.WithDryRun(r.Context()), true
+	}
+	return r.Context(), true
+}
+
+// recipient returns the JID a send goes to: to when given, otherwise the JID
+// of the joined group called groupName. It answers the request and returns
+// false when both are given or the name does not resolve to one group.
+func (s *Server) recipient(ctx context.Context, w http.ResponseWriter, to, groupName string) (string, bool) {
+	if groupName == "" {
+		return to, true
+	}
+	if to != "" {
+		writeError(w, http.StatusBadRequest, "give either to or group_name, not both")
+		return "", false
 	}
 
-	if err := s.Client.SendText(r.Context(), req.To, req.Message); err != nil {
+	jid, err := s.Client.ResolveGroupName(ctx, groupName)
+	var ambiguous *bridge.AmbiguousGroupError
+	switch {
+	case errors.Is(err, bridge.ErrGroupNotFound):
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no joined group is named %q", groupName))
+		return "", false
+	case errors.As(err, &ambiguous):
+		writeError(w, http.StatusConflict, err.Error())
+		return "", false
+	case err != nil:
 		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+		return "", false
 	}
+	return jid, true
+}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+// sendResult is the response to a send: the status, the message ID and the
+// timestamp WhatsApp's server acknowledged it with, in unix seconds like the
+// timestamps of stored messages and receipts. Channel messages also get the
+// ID the server assigned them.
+func sendResult(sent *bridge.SentMessage) map[string]interface{} {
+	resp := map[string]interface{}{
+		"status":    sendStatus(sent),
+		"id":        sent.ID,
+		"timestamp": sent.Timestamp.Unix(),
+	}
+	if sent.ServerID != 0 {
+		resp["server_id"] = sent.ServerID
+	}
+	return resp
+}
+
+// sendStatus is the status reported for a message handed to the bridge.
+func sendStatus(sent *bridge.SentMessage) string {
+	if sent.DryRun {
+		return "dry_run"
+	}
+	return "sent"
+}
+
+// recordFailed persists a message that could not be sent, with status failed
+// and the send error, so that it can be found with ?status=failed and sent
+// again. Nothing is recorded for an invalid recipient.
+func (s *Server) recordFailed(to, msgType, content string, sendErr error) {
+	s.Client.RecordFailed(s.Store, to, msgType, content, sendErr)
+}
+
+// fileMsgType maps a MIME type to the msg_type SendFile sends it as.
+func fileMsgType(mimetype string) string {
+	switch {
+	case strings.HasPrefix(mimetype, "image/"):
+		return "image"
+	case strings.HasPrefix(mimetype, "video/"):
+		return "video"
+	case strings.HasPrefix(mimetype, "audio/"):
+		return "audio"
+	default:
+		return "document"
+	}
+}
+
+// queryTime parses a timestamp query parameter given either as unix seconds
+// or as RFC 3339. It returns 0 when the parameter is absent.
+func queryTime(r *http.Request, key string) (int64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a unix timestamp or RFC 3339 time", key)
+	}
+	return t.Unix(), nil
+}
+
+// querySize parses a non-negative byte count query parameter, returning 0
+// when it is absent.
+func querySize(r *http.Request, key string) (int64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number of bytes", key)
+	}
+	return n, nil
 }
 
 func queryInt(r *http.Request, key string, defaultVal int) int {
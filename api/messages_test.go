@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+func TestRevokeMessageDryRun(t *testing.T) {
+	s := newTestServer(t)
+	h := NewRouter(s)
+	const chat = "1@s.whatsapp.net"
+	if err := s.Store.SaveMessage(&store.Message{ID: "M1", ChatJID: chat, SenderJID: "2@s.whatsapp.net", IsFromMe: true, MsgType: "text", Content: "oops", Timestamp: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a connection only a dry run can revoke.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/messages/M1/revoke", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("revoke while disconnected: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/messages/M1/revoke?dry_run=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry-run revoke: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Status  string `json:"status"`
+		Revoked bool   `json:"revoked"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "dry_run" || resp.Revoked {
+		t.Fatalf("dry-run revoke answered %s", rec.Body)
+	}
+
+	msg, err := s.Store.GetMessageByID("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Revoked || msg.Content != "oops" {
+		t.Fatalf("dry run changed the stored message: revoked %v, content %q", msg.Revoked, msg.Content)
+	}
+}
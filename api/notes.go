@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+type chatNoteRequest struct {
+	Note   string `json:"note"`
+	Author string `json:"author,omitempty"`
+}
+
+// decodeNote reads a note request body, answering 400 and returning false
+// when it is malformed or the note is blank.
+func decodeNote(w http.ResponseWriter, r *http.Request) (chatNoteRequest, bool) {
+	var req chatNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return req, false
+	}
+	if strings.TrimSpace(req.Note) == "" {
+		writeError(w, http.StatusBadRequest, "note is required")
+		return req, false
+	}
+	return req, true
+}
+
+// noteID parses the {id} URL parameter, answering 400 and returning false
+// when it is not a number.
+func noteID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "note id must be a number")
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) handleGetChatNotes(w http.ResponseWriter, r *http.Request) {
+	notes, err := s.Store.GetChatNotes(chi.URLParam(r, "jid"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if notes == nil {
+		notes = []store.Note{}
+	}
+	writeJSON(w, http.StatusOK, notes)
+}
+
+func (s *Server) handleAddChatNote(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeNote(w, r)
+	if !ok {
+		return
+	}
+
+	note, err := s.Store.AddChatNote(chi.URLParam(r, "jid"), req.Note, req.Author, time.Now().Unix())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, note)
+}
+
+func (s *Server) handleUpdateChatNote(w http.ResponseWriter, r *http.Request) {
+	id, ok := noteID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeNote(w, r)
+	if !ok {
+		return
+	}
+
+	note, err := s.Store.UpdateChatNote(chi.URLParam(r, "jid"), id, req.Note, time.Now().Unix())
+	if errors.Is(err, store.ErrNoteNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, note)
+}
+
+func (s *Server) handleDeleteChatNote(w http.ResponseWriter, r *http.Request) {
+	id, ok := noteID(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.Store.DeleteChatNote(chi.URLParam(r, "jid"), id)
+	if errors.Is(err, store.ErrNoteNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "deleted": true})
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// openAPIDoc is the hand-written OpenAPI 3 description of the API. Document
+// new routes there; routes missing from it are still listed, as stubs.
+//
+//go:embed openapi.json
+var openAPIDoc []byte
+
+// openAPISpec returns the OpenAPI document for the routes of r, with the
+// version filled in. It is checked against the router so that what is served
+// never drifts from what is routed: documented operations the router lacks
+// are dropped, and routes the document lacks are added as stubs. Either kind
+// of mismatch is logged, for whoever changed the routes to fix.
+func openAPISpec(r chi.Routes, version string, log *slog.Logger) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openAPIDoc, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi.json: %w", err)
+	}
+	if version != "" {
+		doc["info"].(map[string]interface{})["version"] = version
+	}
+	paths := doc["paths"].(map[string]interface{})
+
+	routed := make(map[string]bool)
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		method = strings.ToLower(method)
+		routed[method+" "+route] = true
+
+		item, _ := paths[route].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[route] = item
+		}
+		if _, ok := item[method]; !ok {
+			log.Warn("route missing from openapi.json", "method", strings.ToUpper(method), "path", route)
+			item[method] = map[string]interface{}{
+				"summary":   "Undocumented",
+				"responses": map[string]interface{}{"default": map[string]interface{}{"description": "See the README"}},
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk routes: %w", err)
+	}
+
+	var stale []string
+	for route, v := range paths {
+		item := v.(map[string]interface{})
+		for method := range item {
+			if !routed[method+" "+route] {
+				stale = append(stale, strings.ToUpper(method)+" "+route)
+				delete(item, method)
+			}
+		}
+		if len(item) == 0 {
+			delete(paths, route)
+		}
+	}
+	sort.Strings(stale)
+	for _, op := range stale {
+		log.Warn("openapi.json documents a route that does not exist", "operation", op)
+	}
+
+	return json.Marshal(doc)
+}
+
+// handleOpenAPI serves the OpenAPI document *spec, which NewRouter builds
+// once all routes are registered.
+func handleOpenAPI(spec *[]byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if *spec == nil {
+			writeError(w, http.StatusInternalServerError, "API description unavailable")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(*spec)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestOpenAPICoversRoutes checks openapi.json against the router, both
+// ways: every route is documented and every documented operation routed.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPIDoc, &doc); err != nil {
+		t.Fatal(err)
+	}
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	routed := make(map[string]bool)
+	err := chi.Walk(NewRouter(newTestServer(t)).(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var undocumented, unrouted []string
+	for op := range routed {
+		if !documented[op] {
+			undocumented = append(undocumented, op)
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			unrouted = append(unrouted, op)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(unrouted)
+	for _, op := range undocumented {
+		t.Errorf("route missing from openapi.json: %s", op)
+	}
+	for _, op := range unrouted {
+		t.Errorf("openapi.json documents a route that does not exist: %s", op)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// envelopeMediaType, accepted in the Accept header, selects the envelope
+// like ?envelope=true.
+const envelopeMediaType = "application/vnd.openclaw.v2+json"
+
+// envelope is the list response shape shared by every list endpoint. A
+// client pages through any listing by passing next_cursor back as ?cursor=
+// until has_more is false. Total counts every matching item, where the
+// endpoint knows it or the request asked for it with ?count=true.
+//
+// The envelope is a superset of the shapes that ?paginated=true and
+// ?count=true returned before it: limit and offset describe the page, and
+// data repeats items for ?paginated=true clients.
+type envelope struct {
+	Items      interface{} `json:"items"`
+	Data       interface{} `json:"data,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	HasMore    bool        `json:"has_more"`
+	Total      *int        `json:"total,omitempty"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+}
+
+// wantsEnvelope reports whether the request asked for the envelope: with
+// ?envelope=true or the envelopeMediaType Accept header, or with one of the
+// older ways, ?paginated=true, ?count=true or a cursor parameter (empty for
+// the first page). Other requests get a bare array.
+func wantsEnvelope(r *http.Request) bool {
+	q := r.URL.Query()
+	for _, name := range []string{"envelope", "paginated", "count"} {
+		if v, _ := strconv.ParseBool(q.Get(name)); v {
+			return true
+		}
+	}
+	if q.Has("cursor") {
+		return true
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if mt, _, err := mime.ParseMediaType(part); err == nil && mt == envelopeMediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wantsCount reports whether the request asked for the total with
+// ?count=true, for listings where counting costs a query of its own.
+func wantsCount(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("count"))
+	return v
+}
+
+// writeEnvelope answers with env; its NextCursor is the cursor of the
+// following page, empty on the last one, and its Total is nil when unknown.
+func writeEnvelope(w http.ResponseWriter, r *http.Request, env envelope) {
+	env.HasMore = env.NextCursor != ""
+	if v, _ := strconv.ParseBool(r.URL.Query().Get("paginated")); v {
+		env.Data = env.Items
+	}
+	writeJSON(w, http.StatusOK, env)
+}
+
+// encodeKeyCursor builds an opaque cursor from the sort keys of the last
+// item of a page, for listings ordered outside the store's cursor support.
+// The first key names the listing, so that a cursor is not taken for
+// another listing's.
+func encodeKeyCursor(keys ...string) string {
+	data, _ := json.Marshal(keys)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeKeyCursor recovers the sort keys following the listing name from a
+// cursor built by encodeKeyCursor, checking that there are n of them.
+func decodeKeyCursor(cursor, listing string, n int) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, store.ErrInvalidCursor
+	}
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil || len(keys) != n+1 || keys[0] != listing {
+		return nil, store.ErrInvalidCursor
+	}
+	return keys[1:], nil
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+func TestWantsEnvelope(t *testing.T) {
+	for _, c := range []struct {
+		query, accept string
+		want          bool
+	}{
+		{"", "", false},
+		{"limit=10&offset=20", "", false},
+		{"envelope=true", "", true},
+		{"paginated=true", "", true},
+		{"count=1", "", true},
+		{"cursor=", "", true},
+		{"envelope=false", "application/json", false},
+		{"", "application/json, " + envelopeMediaType + "; q=0.9", true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/messages?"+c.query, nil)
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+		if got := wantsEnvelope(r); got != c.want {
+			t.Errorf("wantsEnvelope(%q, Accept %q) = %v, want %v", c.query, c.accept, got, c.want)
+		}
+	}
+}
+
+func TestChatMessagesEnvelope(t *testing.T) {
+	s := newTestServer(t)
+	h := NewRouter(s)
+	const chat = "1@s.whatsapp.net"
+	for i := 0; i < 5; i++ {
+		msg := &store.Message{ID: fmt.Sprintf("M%d", i), ChatJID: chat, SenderJID: chat, MsgType: "text", Content: "hi", Timestamp: int64(100 + i)}
+		if err := s.Store.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(query string) envelope {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chats/"+chat+"/messages?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET ?%s: status %d: %s", query, rec.Code, rec.Body)
+		}
+		var env envelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+			t.Fatalf("GET ?%s: %v: %s", query, err, rec.Body)
+		}
+		return env
+	}
+
+	first := get("limit=3&count=true")
+	if items := first.Items.([]interface{}); len(items) != 3 || !first.HasMore || first.NextCursor == "" {
+		t.Fatalf("first page: %d items, has_more %v, next %q", len(items), first.HasMore, first.NextCursor)
+	}
+	if first.Total == nil || *first.Total != 5 {
+		t.Fatalf("total = %v, want 5", first.Total)
+	}
+
+	last := get("limit=3&cursor=" + url.QueryEscape(first.NextCursor))
+	if items := last.Items.([]interface{}); len(items) != 2 || last.HasMore || last.NextCursor != "" {
+		t.Fatalf("last page: %d items, has_more %v, next %q", len(items), last.HasMore, last.NextCursor)
+	}
+	if last.Total != nil {
+		t.Errorf("total = %d without ?count=true", *last.Total)
+	}
+}
+
+func TestEnvelopeKeepsOlderShapes(t *testing.T) {
+	s := newTestServer(t)
+	h := NewRouter(s)
+	const chat = "1@s.whatsapp.net"
+	for i := 0; i < 5; i++ {
+		msg := &store.Message{ID: fmt.Sprintf("M%d", i), ChatJID: chat, SenderJID: chat, MsgType: "text", Content: "hi", Timestamp: int64(100 + i)}
+		if err := s.Store.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		path string
+		keys []string
+	}{
+		// ?paginated=true answered {"data", limit, offset, has_more}.
+		{"/messages/starred?paginated=true&limit=2&offset=1", []string{"data", "limit", "offset", "has_more"}},
+		{"/chats/" + chat + "/messages?paginated=true&limit=2&offset=1", []string{"data", "limit", "offset", "has_more"}},
+		// ?count=true answered {"items", total, limit, offset}.
+		{"/chats/" + chat + "/messages?count=true&limit=2&offset=1", []string{"items", "total", "limit", "offset"}},
+		{"/messages/search?chat=" + chat + "&count=true&limit=2&offset=1", []string{"items", "total", "limit", "offset"}},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v: %s", c.path, err, rec.Body)
+		}
+		for _, k := range c.keys {
+			if _, ok := body[k]; !ok {
+				t.Errorf("GET %s: no %q in %s", c.path, k, rec.Body)
+			}
+		}
+		if string(body["limit"]) != "2" || string(body["offset"]) != "1" {
+			t.Errorf("GET %s: limit %s, offset %s, want 2 and 1", c.path, body["limit"], body["offset"])
+		}
+	}
+}
+
+func TestSearchTotal(t *testing.T) {
+	s := newTestServer(t)
+	h := NewRouter(s)
+	const chat = "1@s.whatsapp.net"
+	for i := 0; i < 3; i++ {
+		msg := &store.Message{ID: fmt.Sprintf("M%d", i), ChatJID: chat, SenderJID: chat, MsgType: "text", Content: "hi", Timestamp: int64(100 + i)}
+		if err := s.Store.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/messages/search?chat="+chat+"&limit=2", nil))
+	var msgs []store.Message
+	if err := json.Unmarshal(rec.Body.Bytes(), &msgs); err != nil || len(msgs) != 2 {
+		t.Fatalf("default: %d messages, %v: %s", len(msgs), err, rec.Body)
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "3" {
+		t.Errorf("X-Total-Count = %q, want 3", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/messages/search?chat="+chat+"&limit=2&envelope=true", nil))
+	var env envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	if env.Total == nil || *env.Total != 3 || !env.HasMore {
+		t.Fatalf("total = %v, has_more %v, want 3 and true", env.Total, env.HasMore)
+	}
+}
+
+func TestChatMessagesBeforeParams(t *testing.T) {
+	h := NewRouter(newTestServer(t))
+	for _, c := range []struct {
+		query string
+		want  int
+	}{
+		{"before_ts=100", http.StatusOK},
+		{"before_ts=100&before_id=M1", http.StatusOK},
+		{"before_ts=soon", http.StatusBadRequest},
+		{"before_id=M1", http.StatusBadRequest},
+		{"before_ts=100&cursor=" + store.EncodeCursor(100, "M1"), http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chats/1@s.whatsapp.net/messages?"+c.query, nil))
+		if rec.Code != c.want {
+			t.Errorf("?%s: got %d, want %d: %s", c.query, rec.Code, c.want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+// probeTimeout bounds the database ping of /healthz.
+const probeTimeout = 2 * time.Second
+
+type probeResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleHealthz is the liveness probe: the process serves requests and the
+// message database answers. It does not depend on WhatsApp, so a lost
+// session never gets the process restarted.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	if err := s.Store.Ping(ctx); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, probeResponse{Status: "unhealthy", Reason: "database: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, probeResponse{Status: "ok"})
+}
+
+// handleReadyz is the readiness probe: 200 only while a paired session is
+// connected to WhatsApp. Otherwise it answers 503 with the reason — "pairing"
+// while unpaired or showing a QR code, "logged_out" or "stream_replaced" when
+// WhatsApp ended the session, "manually_disconnected" after POST
+// /admin/disconnect, "disconnected" while reconnecting — so that
+// traffic is drained from an instance that cannot send.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.Client.GetStatus() == bridge.StatusConnected {
+		writeJSON(w, http.StatusOK, probeResponse{Status: "ready"})
+		return
+	}
+
+	reason := "disconnected"
+	switch drop := s.Client.DropReason(); {
+	case s.Client.ManuallyDisconnected():
+		reason = string(bridge.StatusManuallyDisconnected)
+	case s.Client.GetLatestQR() != "":
+		reason = "pairing"
+	case drop != "":
+		reason = drop
+	case !s.Client.HasSession():
+		reason = "pairing"
+	}
+	writeJSON(w, http.StatusServiceUnavailable, probeResponse{Status: "not_ready", Reason: reason})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbes(t *testing.T) {
+	s := newTestServer(t)
+	h := NewRouter(s)
+	get := func(path string) (int, probeResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body probeResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v: %s", path, err, rec.Body)
+		}
+		return rec.Code, body
+	}
+
+	if code, body := get("/healthz"); code != http.StatusOK || body.Status != "ok" {
+		t.Errorf("/healthz = %d %+v, want 200 ok", code, body)
+	}
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || body.Reason != "pairing" {
+		t.Errorf("/readyz unpaired = %d %+v, want 503 pairing", code, body)
+	}
+
+	s.Client.DisconnectManually()
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || body.Reason != "manually_disconnected" {
+		t.Errorf("/readyz after disconnect = %d %+v, want 503 manually_disconnected", code, body)
+	}
+	// Liveness does not depend on WhatsApp.
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz after disconnect = %d, want 200", code)
+	}
+
+	s.Store.Close()
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || body.Status != "unhealthy" {
+		t.Errorf("/healthz with the database closed = %d %+v, want 503 unhealthy", code, body)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+// handleGetProfile returns the linked account's push name, about text and
+// JID.
+func (s *Server) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := s.Client.GetProfile(r.Context())
+	if errors.Is(err, bridge.ErrNotConnected) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// handleUpdateProfile changes the linked account's push name and about
+// text and answers with the profile as it is afterwards. When the about
+// text fails after the name was changed, the error body also carries the
+// applied fields and the profile, so the caller knows what stuck.
+func (s *Server) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var update bridge.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return
+	}
+	if update.Name == nil && update.About == nil {
+		writeError(w, http.StatusBadRequest, "name or about is required")
+		return
+	}
+
+	profile, err := s.Client.UpdateProfile(r.Context(), update)
+	if err == nil {
+		writeJSON(w, http.StatusOK, profile)
+		return
+	}
+	status, msg := profileErrorStatus(err)
+	var partial *bridge.PartialProfileError
+	if !errors.As(err, &partial) {
+		writeError(w, status, msg)
+		return
+	}
+	body := map[string]interface{}{"error": msg, "applied": partial.Applied, "profile": partial.Profile}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		body["request_id"] = id
+	}
+	writeJSON(w, status, body)
+}
+
+// profileErrorStatus maps an UpdateProfile error to a status and message.
+func profileErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, bridge.ErrNotConnected):
+		return http.StatusServiceUnavailable, err.Error()
+	case errors.Is(err, bridge.ErrInvalidProfile):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, bridge.ErrProfileRestricted):
+		return http.StatusForbidden, err.Error() + "; change it on the phone instead"
+	case errors.Is(err, bridge.ErrAppState):
+		return http.StatusConflict, err.Error() + appStateGuidance
+	default:
+		return http.StatusBadGateway, err.Error()
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+func TestProfileNotConnected(t *testing.T) {
+	h := NewRouter(newTestServer(t))
+
+	for _, c := range []struct {
+		method, body string
+		want         int
+	}{
+		{http.MethodGet, "", http.StatusServiceUnavailable},
+		{http.MethodPatch, `{"name": "Acme"}`, http.StatusServiceUnavailable},
+		{http.MethodPatch, `{"name": " "}`, http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(c.method, "/profile", strings.NewReader(c.body)))
+		if rec.Code != c.want {
+			t.Errorf("%s %s: got %d, want %d: %s", c.method, c.body, rec.Code, c.want, rec.Body)
+		}
+	}
+}
+
+func TestProfileErrorStatus(t *testing.T) {
+	partial := &bridge.PartialProfileError{
+		Applied: []string{"name"},
+		Err:     fmt.Errorf("set about: %w", bridge.ErrProfileRestricted),
+	}
+	if status, _ := profileErrorStatus(partial); status != http.StatusForbidden {
+		t.Errorf("partial restricted: got %d, want 403", status)
+	}
+	if status, _ := profileErrorStatus(fmt.Errorf("set name: %w: x", bridge.ErrAppState)); status != http.StatusConflict {
+		t.Errorf("app state: got %d, want 409", status)
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/base64"
 	"net/http"
+	"strings"
 
 	"github.com/openclaw/whatsapp/bridge"
 )
@@ -33,9 +34,13 @@ func (s *Server) handleQRData(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleQRPage(w http.ResponseWriter, r *http.Request) {
+	page := qrPageHTML
+	if s.APIDocs {
+		page = strings.Replace(page, "<!--docs-->", `<p class="docs"><a href="/docs">API documentation</a></p>`, 1)
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(qrPageHTML))
+	w.Write([]byte(page))
 }
 
 const qrPageHTML = `<!DOCTYPE html>
@@ -88,6 +93,8 @@ const qrPageHTML = `<!DOCTYPE html>
   }
   .waiting { color: #888; font-size: 13px; }
   #phone { color: #4ade80; font-size: 14px; margin-top: 4px; }
+  .docs { margin-top: 24px; font-size: 13px; }
+  .docs a { color: #888; }
 </style>
 </head>
 <body>
@@ -99,6 +106,7 @@ const qrPageHTML = `<!DOCTYPE html>
   </div>
   <div id="status"></div>
   <div id="phone"></div>
+  <!--docs-->
 </div>
 <script>
 (function() {
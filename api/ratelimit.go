@@ -0,0 +1,260 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxRateLimitClients bounds the number of client IPs a limiter tracks.
+// Clients whose bucket has refilled are forgotten first, since they are
+// indistinguishable from new ones; past that, arbitrary clients are.
+const maxRateLimitClients = 10000
+
+// RateLimit is a token bucket: PerMinute requests a minute on average, in
+// bursts of up to Burst. A zero PerMinute disables the limit.
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// RateLimits configure per-IP rate limits of the API.
+type RateLimits struct {
+	// Send limits the send endpoints: /send/*, /reply and /agent/reply.
+	Send RateLimit
+
+	// Read limits all other GET requests.
+	Read RateLimit
+
+	// ExemptLocalhost exempts requests from loopback addresses.
+	ExemptLocalhost bool
+
+	// TrustedProxies are the proxies whose X-Real-IP and X-Forwarded-For
+	// headers name the client. Requests from anywhere else are keyed by
+	// their own address, whatever headers they carry.
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxies parses a list of proxy addresses or CIDR ranges.
+func ParseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// rateLimiter keeps a token bucket per client IP.
+type rateLimiter struct {
+	limit RateLimit
+	rate  float64 // tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	limited atomic.Int64
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for l, or nil if l is disabled. A burst
+// of 0 defaults to a minute's worth of requests.
+func newRateLimiter(l RateLimit) *rateLimiter {
+	if l.PerMinute <= 0 {
+		return nil
+	}
+	if l.Burst <= 0 {
+		l.Burst = l.PerMinute
+	}
+	return &rateLimiter{
+		limit:   l,
+		rate:    float64(l.PerMinute) / 60,
+		burst:   float64(l.Burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of ip. If there is none it returns
+// false and how long until there is.
+func (l *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitClients {
+			l.evict(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		l.limited.Add(1)
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// evict makes room for a new client: it drops the buckets that have
+// refilled, or failing that a tenth of all. Called with mu held.
+func (l *rateLimiter) evict(now time.Time) {
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+	n := len(l.buckets) - maxRateLimitClients*9/10
+	for ip := range l.buckets {
+		if n <= 0 {
+			break
+		}
+		delete(l.buckets, ip)
+		n--
+	}
+}
+
+// rateLimitStats describes a limiter in GET /stats.
+type rateLimitStats struct {
+	PerMinute int   `json:"per_minute"`
+	Burst     int   `json:"burst"`
+	Clients   int   `json:"clients"` // client IPs currently tracked
+	Limited   int64 `json:"limited"` // requests rejected since startup
+}
+
+func (l *rateLimiter) stats() *rateLimitStats {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	clients := len(l.buckets)
+	l.mu.Unlock()
+	return &rateLimitStats{
+		PerMinute: l.limit.PerMinute,
+		Burst:     l.limit.Burst,
+		Clients:   clients,
+		Limited:   l.limited.Load(),
+	}
+}
+
+// rateLimitMiddleware applies the send limiter to the send endpoints and
+// the read limiter to other GET requests except the probes, keyed by the
+// client IP. A rejected request gets 429 with Retry-After.
+func rateLimitMiddleware(send, read *rateLimiter, limits RateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := read
+			if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+				l = nil
+			} else if isSendPath(r.URL.Path) {
+				l = send
+			} else if r.Method != http.MethodGet {
+				l = nil
+			}
+			if l == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := clientIP(r, limits.TrustedProxies)
+			if limits.ExemptLocalhost && isLoopback(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if ok, wait := l.allow(ip, time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isSendPath reports whether path is one of the endpoints sending messages.
+func isSendPath(path string) bool {
+	return strings.HasPrefix(path, "/send/") || path == "/reply" || path == "/agent/reply"
+}
+
+// clientIP returns the address r came from. Only when that is one of the
+// trusted proxies does it take the client from X-Real-IP, or else from the
+// last address in X-Forwarded-For that is not a trusted proxy itself.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := remoteIP(r)
+	if !inNets(ip, trusted) {
+		return ip
+	}
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !inNets(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// remoteIP returns the host part of r.RemoteAddr.
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func inNets(ip string, nets []*net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopback(ip string) bool {
+	addr := net.ParseIP(ip)
+	return addr != nil && addr.IsLoopback()
+}
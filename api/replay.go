@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/bridge"
+	"github.com/openclaw/whatsapp/store"
+)
+
+// replayFailure is a message POST /admin/webhook/replay could not deliver.
+type replayFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// handleReplayMessageWebhook sends the webhook of a stored message again,
+// for consumers that lost it. Deduplication is bypassed; the filters still
+// apply.
+func (s *Server) handleReplayMessageWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.Webhook.Configured() {
+		writeError(w, http.StatusConflict, bridge.ErrNoWebhook.Error())
+		return
+	}
+	msg, ok := s.lookupMessage(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	if !bridge.Replayable(msg) {
+		writeError(w, http.StatusUnprocessableEntity, "only incoming messages are sent to the webhook")
+		return
+	}
+
+	payload, err := bridge.ReplayPayload(msg, s.Store, s.MediaSigner)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.Webhook.Replay(payload); err != nil {
+		switch {
+		case errors.Is(err, bridge.ErrWebhookFiltered):
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, bridge.ErrCircuitOpen):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		default:
+			writeError(w, http.StatusBadGateway, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "replayed", "id": msg.ID})
+}
+
+// handleReplayWebhooks replays the webhooks of the incoming messages
+// between from and to (inclusive), oldest first, optionally of one chat.
+// At most limit messages are read per request; next_cursor continues with
+// the following ones. Delivery stops early while the circuit breaker is
+// open; next_cursor then resumes with the first message not sent.
+func (s *Server) handleReplayWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !s.Webhook.Configured() {
+		writeError(w, http.StatusConflict, bridge.ErrNoWebhook.Error())
+		return
+	}
+
+	tr := store.TimeRange{ChatJID: r.URL.Query().Get("chat"), Ascending: true}
+	from, err := queryTime(r, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if from == 0 {
+		writeError(w, http.StatusBadRequest, "from is required")
+		return
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if to == 0 {
+		to = time.Now().Unix()
+	}
+	if to < from {
+		writeError(w, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+	tr.After, tr.Before = from-1, to+1
+
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" {
+		if _, _, err := store.DecodeCursor(cursor); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Collect the page first so that no read is held open while the
+	// webhook endpoint is waited for.
+	var msgs []store.Message
+	next, err := s.Store.GetMessagesByTime(tr, cursor, queryInt(r, "limit", 100), func(m *store.Message) error {
+		msgs = append(msgs, *m)
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	replayed, skipped := 0, 0
+	failed := []replayFailure{}
+	for i := range msgs {
+		msg := &msgs[i]
+		if !bridge.Replayable(msg) {
+			skipped++
+			continue
+		}
+		payload, err := bridge.ReplayPayload(msg, s.Store, s.MediaSigner)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		err = s.Webhook.Replay(payload)
+		switch {
+		case err == nil:
+			replayed++
+		case errors.Is(err, bridge.ErrWebhookFiltered):
+			skipped++
+		case errors.Is(err, bridge.ErrCircuitOpen):
+			if i == 0 {
+				writeError(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"error": err.Error(), "replayed": replayed, "skipped": skipped, "failed": failed,
+				"next_cursor": store.EncodeCursor(msgs[i-1].Timestamp, msgs[i-1].ID),
+			})
+			return
+		default:
+			failed = append(failed, replayFailure{ID: msg.ID, Error: err.Error()})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"replayed": replayed, "skipped": skipped, "failed": failed, "next_cursor": next,
+	})
+}
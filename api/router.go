@@ -1,9 +1,13 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -14,24 +18,91 @@ import (
 
 // Server holds the dependencies for all HTTP handlers.
 type Server struct {
-	Client   *bridge.Client
-	Store    *store.MessageStore
-	Log      *slog.Logger
-	Version  string
+	Client  *bridge.Client
+	Store   *store.MessageStore
+	Webhook *bridge.WebhookSender
+	Log     *slog.Logger
+	Version string
+	DataDir string
+
+	// MediaGCMinAge is the default safety age for POST /admin/media/gc.
+	MediaGCMinAge time.Duration
+
+	// BlankRevoked clears the stored content of messages revoked through
+	// the API.
+	BlankRevoked bool
+
+	// Typing times the typing indicator of sends with simulate_typing.
+	Typing bridge.TypingOptions
+
+	// Interactive enables POST /send/buttons and /send/list. WhatsApp's
+	// support for interactive messages is inconsistent, so it is off by
+	// default.
+	Interactive bool
+
+	// APIDocs enables GET /docs, Swagger UI for /openapi.json, and links
+	// it from the QR page.
+	APIDocs bool
+
+	// AgentReplyToken, if set, is the bearer token POST /agent/reply
+	// requires.
+	AgentReplyToken string
+
+	// AdminToken, if set, is the bearer token the /admin endpoints
+	// require. Without it they only answer requests from loopback
+	// addresses.
+	AdminToken string
+
+	// Shutdown, if set, starts a graceful shutdown of the bridge, as
+	// SIGTERM does. It must not wait for the shutdown to finish.
+	Shutdown func()
+
+	// MediaSigner, if set, makes GET /media/{id} require a signed token.
+	MediaSigner *bridge.MediaSigner
+
+	// CORS controls which browser origins may call the API.
+	CORS CORSOptions
+
+	// RateLimits limits how often each client IP may call the API.
+	RateLimits RateLimits
+
+	// BodyLimits cap the size of request bodies.
+	BodyLimits BodyLimits
+
+	// Compress compresses JSON, export and HTML responses for clients that
+	// accept gzip or deflate.
+	Compress bool
+
+	sendLimiter *rateLimiter
+	readLimiter *rateLimiter
 }
 
 // NewRouter returns a fully configured chi router with all API routes.
 func NewRouter(s *Server) http.Handler {
 	r := chi.NewRouter()
 
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.RealIP)
-	r.Use(corsMiddleware)
+	r.Use(middleware.RequestID)
 	r.Use(requestLogger(s.Log))
+	r.Use(middleware.Recoverer)
+	r.Use(corsMiddleware(s.CORS))
+	s.sendLimiter = newRateLimiter(s.RateLimits.Send)
+	s.readLimiter = newRateLimiter(s.RateLimits.Read)
+	r.Use(rateLimitMiddleware(s.sendLimiter, s.readLimiter, s.RateLimits))
+	r.Use(bodyLimitMiddleware(s.BodyLimits))
+	if s.Compress {
+		r.Use(compressMiddleware())
+	}
+
+	// Probes
+	r.Get("/healthz", s.handleHealthz)
+	r.Get("/readyz", s.handleReadyz)
 
 	// Status & auth
 	r.Get("/status", s.handleStatus)
+	r.Get("/status/detail", s.handleStatusDetail)
 	r.Post("/logout", s.handleLogout)
+	r.Get("/stats", s.handleStats)
+	r.Get("/events", s.handleEvents)
 
 	// QR web UI
 	r.Get("/qr", s.handleQRPage)
@@ -40,14 +111,78 @@ func NewRouter(s *Server) http.Handler {
 	// Messaging
 	r.Post("/send/text", s.handleSendText)
 	r.Post("/send/file", s.handleSendFile)
-	r.Post("/reply", s.handleReply)
+	r.Post("/send/sticker", s.handleSendSticker)
+	r.Post("/send/buttons", s.handleSendButtons)
+	r.Post("/send/list", s.handleSendList)
+	r.Post("/reply", s.handleSendText)
+	r.With(s.agentAuth).Post("/agent/reply", s.handleSendText)
 	r.Get("/messages", s.handleGetMessages)
 	r.Get("/messages/search", s.handleSearchMessages)
+	r.Get("/messages/starred", s.handleGetStarredMessages)
+	r.Get("/messages/range", s.handleGetMessagesByTime)
+	r.Get("/messages/{id}", s.handleGetMessage)
+	r.Post("/messages/{id}/star", s.handleStarMessage)
+	r.Post("/messages/{id}/unstar", s.handleUnstarMessage)
+	r.Post("/messages/{id}/revoke", s.handleRevokeMessage)
+	r.Post("/messages/{id}/download", s.handleDownloadMedia)
+	r.Get("/media/{id}", s.handleGetMedia)
 
 	// Contacts & chats
 	r.Get("/chats", s.handleGetChats)
+	r.Patch("/chats/{jid}", s.handleUpdateChat)
 	r.Get("/chats/{jid}/messages", s.handleGetChatMessages)
+	r.Get("/chats/{jid}/export", s.handleExportChat)
+	r.Get("/chats/{jid}/stats", s.handleGetChatStats)
+	r.Post("/chats/{jid}/history", s.handleRequestHistory)
+	r.Put("/chats/{jid}/labels", s.handleSetChatLabels)
+	r.Post("/chats/{jid}/archive", s.handleArchiveChat)
+	r.Post("/chats/{jid}/unarchive", s.handleUnarchiveChat)
+	r.Post("/chats/{jid}/mute", s.handleMuteChat)
+	r.Post("/chats/{jid}/unmute", s.handleUnmuteChat)
+	r.Get("/chats/{jid}/notes", s.handleGetChatNotes)
+	r.Post("/chats/{jid}/notes", s.handleAddChatNote)
+	r.Put("/chats/{jid}/notes/{id}", s.handleUpdateChatNote)
+	r.Delete("/chats/{jid}/notes/{id}", s.handleDeleteChatNote)
 	r.Get("/contacts", s.handleGetContacts)
+	r.Post("/contacts/sync", s.handleSyncContacts)
+	r.Get("/contacts/{jid}/avatar", s.handleGetContactAvatar)
+
+	// Own profile
+	r.Get("/profile", s.handleGetProfile)
+	r.Patch("/profile", s.handleUpdateProfile)
+
+	// Groups
+	r.Post("/groups", s.handleCreateGroup)
+	r.Patch("/groups/{jid}", s.handleUpdateGroup)
+	r.Put("/groups/{jid}/photo", s.handleSetGroupPhoto)
+	r.Get("/groups/{jid}/avatar", s.handleGetGroupAvatar)
+	r.Get("/groups/{jid}/participants", s.handleGetGroupParticipants)
+	r.Post("/groups/{jid}/participants", s.handleUpdateGroupParticipants)
+
+	// Admin
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(s.adminAuth)
+		r.Post("/connect", s.handleConnect)
+		r.Post("/disconnect", s.handleDisconnect)
+		r.Post("/reconnect", s.handleReconnect)
+		r.Post("/shutdown", s.handleShutdown)
+		r.Post("/media/gc", s.handleMediaGC)
+		r.Post("/db/maintenance", s.handleDBMaintenance)
+		r.Post("/backup", s.handleBackup)
+		r.Get("/backups", s.handleListBackups)
+		r.Post("/messages/{id}/replay-webhook", s.handleReplayMessageWebhook)
+		r.Post("/webhook/replay", s.handleReplayWebhooks)
+	})
+
+	// API description, checked against the routes above
+	var spec []byte
+	r.Get("/openapi.json", handleOpenAPI(&spec))
+	r.Get("/docs", s.handleDocs)
+	r.Get("/docs/{file}", s.handleDocsAsset)
+	spec, err := openAPISpec(r, s.Version, s.Log)
+	if err != nil {
+		s.Log.Error("failed to build API description", "error", err)
+	}
 
 	return r
 }
@@ -60,31 +195,163 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// writeError writes a JSON error. It carries the request ID, so that users
+// can find the request in the logs.
 func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+	body := map[string]string{"error": message}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		body["request_id"] = id
+	}
+	writeJSON(w, status, body)
 }
 
 // --- middleware --------------------------------------------------------------
 
-func corsMiddleware(next http.Handler) http.Handler {
+// CORSOptions control the CORS headers of API responses. The zero value
+// allows any origin, without credentials.
+type CORSOptions struct {
+	// Origins lists the origins allowed to call the API; empty or "*"
+	// allows any. Only listed origins are echoed back, so that credentials
+	// can be allowed.
+	Origins []string
+
+	// AllowCredentials lets the listed origins send cookies and
+	// Authorization headers. It has no effect while any origin is allowed.
+	AllowCredentials bool
+
+	// Headers are the request headers browsers may send; empty allows
+	// Content-Type and Authorization.
+	Headers []string
+
+	// MaxAge is how long browsers may cache a preflight result; 0 leaves it
+	// to them.
+	MaxAge time.Duration
+}
+
+// corsMiddleware adds the CORS headers opts call for and answers preflight
+// requests. A preflight from an origin that is not allowed gets 403; other
+// requests from it are served without CORS headers, which browsers block.
+func corsMiddleware(opts CORSOptions) func(http.Handler) http.Handler {
+	anyOrigin := len(opts.Origins) == 0
+	allowed := make(map[string]bool, len(opts.Origins))
+	for _, o := range opts.Origins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+	}
+	headers := "Content-Type, Authorization"
+	if len(opts.Headers) > 0 {
+		headers = strings.Join(opts.Headers, ", ")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			ok := anyOrigin
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Add("Vary", "Origin")
+				if ok = origin != "" && allowed[strings.ToLower(origin)]; ok {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					if opts.AllowCredentials {
+						w.Header().Set("Access-Control-Allow-Credentials", "true")
+					}
+				}
+			}
+
+			if r.Method == "OPTIONS" {
+				if !ok && origin != "" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				if opts.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// agentAuth rejects requests without the agent reply token, when one is
+// configured.
+func (s *Server) agentAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if s.AgentReplyToken != "" && !hasBearer(r, s.AgentReplyToken) {
+			writeError(w, http.StatusUnauthorized, "invalid or missing agent token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+// adminAuth rejects requests without the admin token. When none is
+// configured it only lets through requests made from this host, judged by
+// the peer address, never by forwarded headers.
+func (s *Server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.AdminToken == "" {
+			if !isLoopback(remoteIP(r)) {
+				writeError(w, http.StatusForbidden, "admin endpoints are only served to localhost unless admin_token is set")
+				return
+			}
+		} else if !hasBearer(r, s.AdminToken) {
+			writeError(w, http.StatusUnauthorized, "invalid or missing admin token")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// hasBearer reports whether r carries token as its bearer token.
+func hasBearer(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// requestIDHeader carries the request ID in responses. middleware.RequestID
+// takes the ID from the same request header when a client or proxy sets it.
+const requestIDHeader = "X-Request-ID"
+
+// requestLogger logs each request once it has been served, with its status,
+// response size and duration: at info if the status is not 2xx, otherwise
+// at debug. It also returns the request ID in the X-Request-ID header.
 func requestLogger(log *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Debug("http request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
-			next.ServeHTTP(w, r)
+			id := middleware.GetReqID(r.Context())
+			if id != "" {
+				w.Header().Set(requestIDHeader, id)
+			}
+
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				level := slog.LevelDebug
+				if status < 200 || status > 299 {
+					level = slog.LevelInfo
+				}
+				log.Log(r.Context(), level, "http request",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"status", status,
+					"bytes", ww.BytesWritten(),
+					"duration_ms", time.Since(start).Milliseconds(),
+					"remote", r.RemoteAddr,
+					"request_id", id,
+				)
+			}()
+			next.ServeHTTP(ww, r)
 		})
 	}
 }
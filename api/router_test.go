@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	listed := CORSOptions{
+		Origins:          []string{"https://app.example.com/"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	tests := []struct {
+		name   string
+		opts   CORSOptions
+		method string
+		origin string
+
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantMethods     bool
+		wantMaxAge      string
+		wantNext        bool
+	}{
+		{
+			name: "any origin, simple request", method: http.MethodGet, origin: "https://other.example",
+			wantStatus: http.StatusOK, wantOrigin: "*", wantNext: true,
+		},
+		{
+			name: "any origin, preflight", method: http.MethodOptions, origin: "https://other.example",
+			wantStatus: http.StatusOK, wantOrigin: "*", wantMethods: true,
+		},
+		{
+			name: "credentials ignored for any origin", opts: CORSOptions{AllowCredentials: true},
+			method: http.MethodGet, origin: "https://other.example",
+			wantStatus: http.StatusOK, wantOrigin: "*", wantNext: true,
+		},
+		{
+			name: "allowed origin, simple request", opts: listed, method: http.MethodGet, origin: "https://App.example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://App.example.com", wantCredentials: "true", wantNext: true,
+		},
+		{
+			name: "allowed origin, preflight", opts: listed, method: http.MethodOptions, origin: "https://app.example.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://app.example.com", wantCredentials: "true",
+			wantMethods: true, wantMaxAge: "600",
+		},
+		{
+			name: "disallowed origin, simple request", opts: listed, method: http.MethodGet, origin: "https://evil.example",
+			wantStatus: http.StatusOK, wantNext: true,
+		},
+		{
+			name: "disallowed origin, preflight", opts: listed, method: http.MethodOptions, origin: "https://evil.example",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "no origin", opts: listed, method: http.MethodGet,
+			wantStatus: http.StatusOK, wantNext: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := corsMiddleware(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			req := httptest.NewRequest(tt.method, "/messages", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("handler called: %v, want %v", called, tt.wantNext)
+			}
+			hdr := rec.Header()
+			if got := hdr.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Allow-Origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := hdr.Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Allow-Credentials %q, want %q", got, tt.wantCredentials)
+			}
+			if got := hdr.Get("Access-Control-Allow-Methods") != ""; got != tt.wantMethods {
+				t.Errorf("Allow-Methods set: %v, want %v", got, tt.wantMethods)
+			}
+			if got := hdr.Get("Access-Control-Max-Age"); got != tt.wantMaxAge {
+				t.Errorf("Max-Age %q, want %q", got, tt.wantMaxAge)
+			}
+			if len(tt.opts.Origins) > 0 && hdr.Get("Vary") != "Origin" {
+				t.Errorf("Vary %q, want Origin", hdr.Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestAgentTokenGuardsAgentReplyOnly(t *testing.T) {
+	s := newTestServer(t)
+	s.AgentReplyToken = "secret"
+	h := NewRouter(s)
+	for _, c := range []struct {
+		path, auth string
+		want       bool // whether the request gets past the token check
+	}{
+		{"/agent/reply", "", false},
+		{"/agent/reply", "Bearer wrong", false},
+		{"/agent/reply", "Bearer secret", true},
+		{"/send/text", "", true},
+		{"/reply", "", true},
+	} {
+		req := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(`{}`))
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Code != http.StatusUnauthorized; got != c.want {
+			t.Errorf("POST %s with %q: status %d", c.path, c.auth, rec.Code)
+		}
+	}
+}
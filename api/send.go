@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+// sendRequest is the body shared by the send endpoints. Each endpoint reads
+// the content fields of its kind of message; the recipient and the options
+// apply to all of them.
+type sendRequest struct {
+	To        string `json:"to"`
+	GroupName string `json:"group_name,omitempty"`
+
+	// Content: text messages use Message, buttons and lists use Text.
+	Message    string               `json:"message,omitempty"`
+	Text       string               `json:"text,omitempty"`
+	Buttons    []bridge.Button      `json:"buttons,omitempty"`
+	ButtonText string               `json:"button_text,omitempty"`
+	Sections   []bridge.ListSection `json:"sections,omitempty"`
+
+	// Options.
+	QuoteMessageID string `json:"quote_message_id,omitempty"`
+	SimulateTyping bool   `json:"simulate_typing,omitempty"`
+}
+
+// decodeSend reads a JSON send request, answering 400 and returning false
+// when it is malformed or names no recipient.
+func decodeSend(w http.ResponseWriter, r *http.Request) (sendRequest, bool) {
+	var req sendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, err, "invalid request body")
+		return req, false
+	}
+	if req.To == "" && req.GroupName == "" {
+		writeError(w, http.StatusBadRequest, "to or group_name is required")
+		return req, false
+	}
+	return req, true
+}
+
+// sendOptions maps the options of req, answering 404 and returning false
+// when the message to quote is not stored.
+func (s *Server) sendOptions(w http.ResponseWriter, req sendRequest) (bridge.SendOptions, bool) {
+	var opts bridge.SendOptions
+	if req.QuoteMessageID != "" {
+		quoted, err := s.Store.GetMessageByID(req.QuoteMessageID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return opts, false
+		}
+		if quoted == nil {
+			writeError(w, http.StatusNotFound, "quoted message not found")
+			return opts, false
+		}
+		opts.Quote = &bridge.Quote{ID: quoted.ID, SenderJID: quoted.SenderJID, Content: quoted.Content}
+	}
+	return opts, true
+}
+
+// deliver sends content to the recipient of req with its options, records
+// what was sent as msgType and answers the request.
+func (s *Server) deliver(ctx context.Context, w http.ResponseWriter, req sendRequest, content bridge.Content, msgType string) {
+	to, ok := s.recipient(ctx, w, req.To, req.GroupName)
+	if !ok {
+		return
+	}
+	opts, ok := s.sendOptions(w, req)
+	if !ok {
+		return
+	}
+
+	sent, err := s.Client.Send(ctx, to, content, opts)
+	if msgType == "text" {
+		s.writeSentText(w, to, content.Text, sent, err)
+		return
+	}
+	if err != nil {
+		s.recordFailed(to, msgType, content.Text, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.recordSent(sent[0], msgType, content.Text, "")
+
+	writeJSON(w, http.StatusOK, sendResult(sent[0]))
+}
+
+// deliverTyped queues text content to be sent after the typing indicator
+// has shown for a while, and answers 202 with the ID the message will have.
+// The outcome is recorded as deliver records it, once the send is done. It
+// answers 503 while bridge.MaxTypedSends messages are already waiting.
+func (s *Server) deliverTyped(ctx context.Context, w http.ResponseWriter, req sendRequest, content bridge.Content) {
+	to, ok := s.recipient(ctx, w, req.To, req.GroupName)
+	if !ok {
+		return
+	}
+	opts, ok := s.sendOptions(w, req)
+	if !ok {
+		return
+	}
+
+	id, err := s.Client.SendTyped(ctx, to, content, opts, s.Typing, func(sent []*bridge.SentMessage, err error) {
+		s.recordSentText(to, content.Text, sent, err)
+		if err != nil {
+			s.Log.Warn("typed send failed", "error", err, "to", to)
+		}
+	})
+	if errors.Is(err, bridge.ErrTooManyTypedSends) || errors.Is(err, bridge.ErrShuttingDown) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":    "queued",
+		"id":        id,
+		"typing_ms": s.Typing.Duration(content.Text).Milliseconds(),
+	})
+}
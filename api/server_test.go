@@ -0,0 +1,32 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/openclaw/whatsapp/bridge"
+	"github.com/openclaw/whatsapp/store"
+)
+
+// newTestServer returns a Server backed by a client that was never paired
+// and an empty message store, both in a temporary directory.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	client, err := bridge.NewClient(dir, bridge.SessionKeys{}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	st, err := store.NewMessageStore(filepath.Join(dir, "messages.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	return &Server{Client: client, Store: st, Log: log, DataDir: dir}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// mediaWalkLimit bounds the number of files inspected when sizing the media
+// directory, so /stats stays fast on very large installs.
+const mediaWalkLimit = 100000
+
+// statsResponse is the body of GET /stats.
+type statsResponse struct {
+	*store.Stats
+	Media      mediaUsage     `json:"media"`
+	RateLimits rateLimitUsage `json:"rate_limits"`
+}
+
+// rateLimitUsage describes the API rate limits; a disabled limit is null.
+type rateLimitUsage struct {
+	Send            *rateLimitStats `json:"send"`
+	Read            *rateLimitStats `json:"read"`
+	ExemptLocalhost bool            `json:"exempt_localhost"`
+}
+
+// mediaUsage describes the media directory. Truncated is set when the walk
+// stopped at mediaWalkLimit, in which case the figures are lower bounds.
+type mediaUsage struct {
+	Files     int64 `json:"files"`
+	Bytes     int64 `json:"bytes"`
+	Truncated bool  `json:"truncated,omitempty"`
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	st, err := s.Store.Stats(queryInt(r, "top", 10))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statsResponse{
+		Stats: st,
+		Media: dirUsage(s.Client.MediaDir(), mediaWalkLimit),
+		RateLimits: rateLimitUsage{
+			Send:            s.sendLimiter.stats(),
+			Read:            s.readLimiter.stats(),
+			ExemptLocalhost: s.RateLimits.ExemptLocalhost,
+		},
+	})
+}
+
+func (s *Server) handleGetChatStats(w http.ResponseWriter, r *http.Request) {
+	st, err := s.Store.GetChatStats(chi.URLParam(r, "jid"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if st == nil {
+		writeError(w, http.StatusNotFound, "chat not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, st)
+}
+
+var errWalkLimit = errors.New("walk limit reached")
+
+// dirUsage counts the regular files under dir and their total size, visiting
+// at most limit files.
+func dirUsage(dir string, limit int64) mediaUsage {
+	var u mediaUsage
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if u.Files >= limit {
+			return errWalkLimit
+		}
+		if info, err := d.Info(); err == nil {
+			u.Files++
+			u.Bytes += info.Size()
+		}
+		return nil
+	})
+	u.Truncated = errors.Is(err, errWalkLimit)
+	return u
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+func TestChatStatsEndpoint(t *testing.T) {
+	s := newTestServer(t)
+	h := NewRouter(s)
+	if err := s.Store.SaveMessage(&store.Message{ID: "M1", ChatJID: "1@s.whatsapp.net", SenderJID: "1@s.whatsapp.net", MsgType: "text", Timestamp: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{
+		"/chats/1@s.whatsapp.net/stats": http.StatusOK,
+		"/chats/2@s.whatsapp.net/stats": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s: status %d, want %d: %s", path, rec.Code, want, rec.Body)
+		}
+	}
+}
+
+func TestDirUsage(t *testing.T) {
+	dir := t.TempDir()
+	for i, size := range []int{10, 20, 30} {
+		name := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(name, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if u := dirUsage(dir, 10); u != (mediaUsage{Files: 3, Bytes: 60}) {
+		t.Errorf("dirUsage = %+v, want 3 files, 60 bytes", u)
+	}
+	if u := dirUsage(dir, 2); u.Files != 2 || !u.Truncated {
+		t.Errorf("dirUsage with limit 2 = %+v, want 2 files, truncated", u)
+	}
+	if u := dirUsage(filepath.Join(dir, "missing"), 10); u != (mediaUsage{}) {
+		t.Errorf("dirUsage of a missing dir = %+v, want zero", u)
+	}
+}
@@ -1,28 +1,60 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"time"
+
+	"github.com/openclaw/whatsapp/bridge"
 )
 
 type statusResponse struct {
-	Status  string `json:"status"`
-	Phone   string `json:"phone,omitempty"`
-	Uptime  string `json:"uptime"`
-	Version string `json:"version"`
+	Status      string `json:"status"`
+	Phone       string `json:"phone,omitempty"`
+	Uptime      string `json:"uptime"`
+	Version     string `json:"version"`
+	LastEventAt int64  `json:"last_event_at,omitempty"` // unix seconds; omitted until an event arrives
+	LastSendAt  int64  `json:"last_send_at,omitempty"`  // unix seconds; omitted until a message is sent
+}
+
+type statusDetailResponse struct {
+	statusResponse
+	Webhook webhookStatus `json:"webhook"`
+}
+
+type webhookStatus struct {
+	Configured bool                 `json:"configured"`
+	Circuit    *bridge.CircuitState `json:"circuit,omitempty"`
 }
 
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	status := string(s.Client.GetStatus())
-	phone := s.Client.GetJID()
-	uptime := time.Since(s.Client.GetStartTime()).Truncate(time.Second).String()
-
-	writeJSON(w, http.StatusOK, statusResponse{
-		Status:  status,
-		Phone:   phone,
-		Uptime:  uptime,
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// handleStatusDetail extends /status with the state of outgoing delivery.
+func (s *Server) handleStatusDetail(w http.ResponseWriter, r *http.Request) {
+	resp := statusDetailResponse{statusResponse: s.status()}
+	if s.Webhook != nil && s.Webhook.Configured() {
+		circuit := s.Webhook.Circuit()
+		resp.Webhook = webhookStatus{Configured: true, Circuit: &circuit}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) status() statusResponse {
+	resp := statusResponse{
+		Status:  string(s.Client.GetStatus()),
+		Phone:   s.Client.GetJID(),
+		Uptime:  time.Since(s.Client.GetStartTime()).Truncate(time.Second).String(),
 		Version: s.Version,
-	})
+	}
+	if t := s.Client.LastEventAt(); !t.IsZero() {
+		resp.LastEventAt = t.Unix()
+	}
+	if t := s.Client.LastSendAt(); !t.IsZero() {
+		resp.LastSendAt = t.Unix()
+	}
+	return resp
 }
 
 func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
@@ -32,3 +64,29 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "logged_out"})
 }
+
+// handleConnect connects to WhatsApp, after a manual disconnect or while
+// the reconnect loop is waiting. A device without a session starts pairing
+// and reports "connecting" until the QR code is scanned.
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	s.Client.ResumeConnecting()
+	// Not the request context: pairing outlives the request.
+	if err := s.Client.Connect(context.Background()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": string(s.Client.GetStatus())})
+}
+
+// handleDisconnect closes the WhatsApp connection and keeps it closed until
+// POST /admin/connect; the API keeps serving stored data meanwhile.
+func (s *Server) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	s.Client.DisconnectManually()
+	writeJSON(w, http.StatusOK, map[string]string{"status": string(s.Client.GetStatus())})
+}
+
+// handleReconnect drops the WhatsApp connection and opens a new one.
+func (s *Server) handleReconnect(w http.ResponseWriter, r *http.Request) {
+	s.Client.Disconnect()
+	s.handleConnect(w, r)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openclaw/whatsapp/bridge"
+)
+
+// sseHeartbeat is how often an idle event stream gets a comment line, so
+// that proxies do not time the connection out.
+const sseHeartbeat = 15 * time.Second
+
+// sseDrainTimeout bounds how long a stream may take, once the bridge shuts
+// down, to pass on the events it still holds, so that a slow client cannot
+// hold up the shutdown.
+const sseDrainTimeout = 2 * time.Second
+
+// handleEvents streams bridge events as Server-Sent Events. A client that
+// reconnects with Last-Event-ID (or ?last_event_id=) first receives the
+// buffered events it missed; if some are no longer buffered, a "gap" event
+// tells it to catch up through the REST API. ?types= limits the stream to a
+// comma-separated list of event types. When the bridge shuts down, the
+// stream ends with a "shutdown" event after the events still pending.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var after uint64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "Last-Event-ID must be an event ID")
+			return
+		}
+	}
+	var types map[string]bool
+	if v := r.URL.Query().Get("types"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	missed, complete, events, cancel := s.Client.Events().Subscribe(after)
+	defer cancel()
+
+	// The stream outlives the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(ev bridge.Event) bool {
+		if types != nil && !types[ev.Type] {
+			return true
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			s.Log.Error("failed to encode event", "error", err, "type", ev.Type)
+			return true
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+		return err == nil
+	}
+
+	if !complete {
+		fmt.Fprintf(w, "event: gap\ndata: {\"last_event_id\":%d}\n\n", after)
+	}
+	for _, ev := range missed {
+		if !send(ev) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	closing := s.Client.Events().Closed()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closing:
+			// Deliver what is still buffered, within the drain timeout.
+			closing = nil
+			http.NewResponseController(w).SetWriteDeadline(time.Now().Add(sseDrainTimeout))
+			continue
+		case ev, ok := <-events:
+			if !ok {
+				select {
+				case <-s.Client.Events().Closed():
+					fmt.Fprint(w, "event: shutdown\ndata: {}\n\n")
+					flusher.Flush()
+				default:
+					// Fell behind; the client reconnects with Last-Event-ID.
+				}
+				return
+			}
+			if !send(ev) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
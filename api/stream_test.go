@@ -0,0 +1,57 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStreamEndsWithShutdown(t *testing.T) {
+	s := newTestServer(t)
+	srv := httptest.NewServer(NewRouter(s))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+
+	// The handler has subscribed by the time the headers arrive.
+	s.Client.Events().Publish("test", map[string]string{"n": "1"})
+	s.Client.Events().Close()
+
+	type result struct {
+		events []string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var events []string
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if name, ok := strings.CutPrefix(sc.Text(), "event: "); ok {
+				events = append(events, name)
+			}
+		}
+		done <- result{events, sc.Err()}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if want := []string{"test", "shutdown"}; strings.Join(res.events, ",") != strings.Join(want, ",") {
+			t.Fatalf("events %q, want %q", res.events, want)
+		}
+	case <-time.After(sseDrainTimeout + time.Second):
+		t.Fatal("stream did not end after the event bus closed")
+	}
+}
@@ -0,0 +1,44 @@
+package bridge
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// activity records when the client last heard from WhatsApp and last sent
+// a message, in unix nanoseconds (0 = never). It is updated on every event,
+// so it uses atomics rather than the client's mutex.
+type activity struct {
+	lastEvent atomic.Int64
+	lastSend  atomic.Int64
+}
+
+// touchEvent is a whatsmeow event handler recording that an event arrived.
+func (a *activity) touchEvent(interface{}) {
+	a.lastEvent.Store(time.Now().UnixNano())
+}
+
+// touchSend records that a message was accepted by WhatsApp.
+func (a *activity) touchSend() {
+	a.lastSend.Store(time.Now().UnixNano())
+}
+
+// LastEventAt returns when the last event was received from WhatsApp, or
+// the zero time if none has been since startup. Connection state changes
+// and receipts count, so on a quiet account it still moves now and then.
+func (c *Client) LastEventAt() time.Time {
+	return unixNanoTime(c.activity.lastEvent.Load())
+}
+
+// LastSendAt returns when a message was last sent successfully, or the zero
+// time if none has been since startup. Dry runs do not count.
+func (c *Client) LastSendAt() time.Time {
+	return unixNanoTime(c.activity.lastSend.Load())
+}
+
+func unixNanoTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -3,74 +3,174 @@ package bridge
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"mime"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"go.mau.fi/whatsmeow/types"
+
+	"github.com/openclaw/whatsapp/store"
 )
 
+// AgentOptions configures an AgentTrigger.
+type AgentOptions struct {
+	Enabled        bool
+	Mode           string // "command" or "http"
+	Command        string
+	HTTPURL        string
+	ReplyEndpoint  string
+	SystemPrompt   string
+	IgnoreFromMe   bool
+	DMOnly         bool
+	Allowlist      []string
+	Blocklist      []string
+	Labels         []string      // if set, only chats with one of these labels
+	IgnoreLabels   []string      // chats with any of these labels are skipped
+	IgnoreMuted    bool          // muted chats are skipped
+	CommandTimeout time.Duration // bounds command execution
+	HTTPTimeout    time.Duration // bounds HTTP calls
+
+	// CommandShell is the interpreter Command is run with, followed by the
+	// flags that make it take a command string; nil selects sh -c.
+	// CommandArgs, if set, replaces Command with an argument vector run
+	// without a shell, each element expanded from the template verbatim.
+	CommandShell []string
+	CommandArgs  []string
+
+	// StaticCommand runs Command or CommandArgs as written, without
+	// substituting placeholders; the command reads the message from the
+	// OC_WA_* environment variables instead, which are always set.
+	StaticCommand bool
+
+	// ReplyWithOutput sends the standard output of a successful command back
+	// to the chat as the agent's reply, split like any long text. Empty
+	// output sends nothing. ErrorReply, if set, is sent instead when the
+	// command fails or times out.
+	ReplyWithOutput bool
+	ErrorReply      string
+
+	// MediaInlineMaxBytes is the largest media file sent base64-encoded as
+	// media_data in HTTP mode. Zero disables inlining.
+	MediaInlineMaxBytes int64
+
+	// TypingRefresh is how often the typing indicator is re-sent while the
+	// agent runs; WhatsApp drops it after about ten seconds. Zero sends it
+	// once.
+	TypingRefresh time.Duration
+
+	// HTTPHeaders are added to every HTTP mode request. Their values are
+	// never logged.
+	HTTPHeaders map[string]string
+
+	// Store, if set, receives the agent_status of each message the agent
+	// considers, and the replies sent with ReplyWithOutput or ErrorReply.
+	Store *store.MessageStore
+
+	// ReadReceipts, if set, marks each message the agent handled without
+	// error as read (read_receipts: on_agent_reply).
+	ReadReceipts *ReadReceipts
+}
+
 // AgentTrigger handles waking an OpenClaw agent when a message arrives.
 type AgentTrigger struct {
-	enabled       bool
-	mode          string // "command" or "http"
-	command       string
-	httpURL       string
-	replyEndpoint string
-	systemPrompt  string
-	ignoreFromMe  bool
-	dmOnly        bool
-	allowlist     map[string]bool
-	blocklist     map[string]bool
-	timeout       time.Duration
-	client        *http.Client
-	log           *slog.Logger
+	enabled        bool
+	mode           string // "command" or "http"
+	command        string
+	commandShell   []string
+	commandArgs    []string
+	staticCommand  bool
+	replyOutput    bool
+	errorReply     string
+	httpURL        string
+	replyEndpoint  string
+	systemPrompt   string
+	ignoreFromMe   bool
+	dmOnly         bool
+	allowlist      map[string]bool
+	blocklist      map[string]bool
+	labels         []string
+	ignoreLabels   []string
+	ignoreMuted    bool
+	cmdTimeout     time.Duration
+	httpTimeout    time.Duration
+	inlineMediaMax int64
+	httpHeaders    map[string]string
+	typingRefresh  time.Duration
+	store          *store.MessageStore
+	readReceipts   *ReadReceipts
+	client         *http.Client
+	log            *slog.Logger
 }
 
 // AgentPayload is the JSON body sent to the agent in HTTP mode.
 type AgentPayload struct {
-	From          string `json:"from"`
-	Name          string `json:"name,omitempty"`
-	Message       string `json:"message"`
-	ChatJID       string `json:"chat_jid"`
-	Type          string `json:"type"`
-	IsGroup       bool   `json:"is_group"`
-	GroupName     string `json:"group_name,omitempty"`
-	MessageID     string `json:"message_id"`
-	Timestamp     int64  `json:"timestamp"`
-	ReplyEndpoint string `json:"reply_endpoint,omitempty"`
-	SystemPrompt  string `json:"system_prompt,omitempty"`
+	From          string   `json:"from"`
+	Name          string   `json:"name,omitempty"`
+	Message       string   `json:"message"`
+	ChatJID       string   `json:"chat_jid"`
+	Type          string   `json:"type"`
+	IsGroup       bool     `json:"is_group"`
+	GroupName     string   `json:"group_name,omitempty"`
+	MessageID     string   `json:"message_id"`
+	SelectedID    string   `json:"selected_id,omitempty"` // button or list row chosen in a reply
+	Labels        []string `json:"labels,omitempty"`      // local labels of the chat
+	Timestamp     int64    `json:"timestamp"`
+	MediaPath     string   `json:"media_path,omitempty"`
+	MediaMimetype string   `json:"media_mimetype,omitempty"`
+	MediaData     string   `json:"media_data,omitempty"` // base64, only under the inline size cap
+	ReplyEndpoint string   `json:"reply_endpoint,omitempty"`
+	SystemPrompt  string   `json:"system_prompt,omitempty"`
+	OperatorNotes []string `json:"operator_notes,omitempty"` // notes left on the chat, oldest first
 }
 
-// NewAgentTrigger creates a new AgentTrigger. If enabled is false, Trigger is a
-// no-op.
-func NewAgentTrigger(enabled bool, mode, command, httpURL, replyEndpoint, systemPrompt string, ignoreFromMe, dmOnly bool, allowlist, blocklist []string, timeout time.Duration, log *slog.Logger) *AgentTrigger {
+// NewAgentTrigger creates a new AgentTrigger. If opts.Enabled is false,
+// Trigger is a no-op.
+func NewAgentTrigger(opts AgentOptions, log *slog.Logger) *AgentTrigger {
 	al := make(map[string]bool)
-	for _, v := range allowlist {
+	for _, v := range opts.Allowlist {
 		al[normalizeNumber(v)] = true
 	}
 	bl := make(map[string]bool)
-	for _, v := range blocklist {
+	for _, v := range opts.Blocklist {
 		bl[normalizeNumber(v)] = true
 	}
 	return &AgentTrigger{
-		enabled:       enabled,
-		mode:          mode,
-		command:       command,
-		httpURL:       httpURL,
-		replyEndpoint: replyEndpoint,
-		systemPrompt:  systemPrompt,
-		ignoreFromMe:  ignoreFromMe,
-		dmOnly:        dmOnly,
-		allowlist:     al,
-		blocklist:     bl,
-		timeout:       timeout,
-		client:        &http.Client{Timeout: timeout},
-		log:           log,
+		enabled:        opts.Enabled,
+		mode:           opts.Mode,
+		command:        opts.Command,
+		commandShell:   opts.CommandShell,
+		commandArgs:    opts.CommandArgs,
+		staticCommand:  opts.StaticCommand,
+		replyOutput:    opts.ReplyWithOutput,
+		errorReply:     opts.ErrorReply,
+		httpURL:        opts.HTTPURL,
+		replyEndpoint:  opts.ReplyEndpoint,
+		systemPrompt:   opts.SystemPrompt,
+		ignoreFromMe:   opts.IgnoreFromMe,
+		dmOnly:         opts.DMOnly,
+		allowlist:      al,
+		blocklist:      bl,
+		labels:         opts.Labels,
+		ignoreLabels:   opts.IgnoreLabels,
+		ignoreMuted:    opts.IgnoreMuted,
+		cmdTimeout:     opts.CommandTimeout,
+		httpTimeout:    opts.HTTPTimeout,
+		inlineMediaMax: opts.MediaInlineMaxBytes,
+		httpHeaders:    opts.HTTPHeaders,
+		typingRefresh:  opts.TypingRefresh,
+		store:          opts.Store,
+		readReceipts:   opts.ReadReceipts,
+		client:         &http.Client{Timeout: opts.HTTPTimeout},
+		log:            log,
 	}
 }
 
@@ -86,75 +186,290 @@ func (a *AgentTrigger) SystemPrompt() string {
 	return a.systemPrompt
 }
 
+// Agent skip reasons recorded as the agent_detail of skipped messages.
+const (
+	skipNewsletter   = "newsletter"
+	skipDMOnly       = "dm_only"
+	skipBlocklist    = "blocklist"
+	skipNotAllowlist = "not_allowlisted"
+	skipLabel        = "label"
+	skipNotLabelled  = "not_labelled"
+	skipMuted        = "muted"
+)
+
 // Trigger fires the agent for an incoming message. It sends a typing indicator,
-// then runs the configured command or HTTP call asynchronously.
+// then runs the configured command or HTTP call asynchronously. The outcome is
+// recorded as the message's agent_status.
 func (a *AgentTrigger) Trigger(client *Client, payload *WebhookPayload) {
-	if !a.enabled {
+	if !a.accept(payload) {
 		return
 	}
 
-	// Apply filters.
+	// Run async — don't block the event loop.
+	go a.run(client, payload)
+}
+
+// TriggerWait is like Trigger but returns only once the agent has finished.
+// It is used by ordered delivery, which already runs off the event loop.
+func (a *AgentTrigger) TriggerWait(client *Client, payload *WebhookPayload) {
+	if !a.accept(payload) {
+		return
+	}
+	a.run(client, payload)
+}
+
+// accept applies the agent filters to payload, recording skipped messages,
+// and reports whether the agent should run.
+func (a *AgentTrigger) accept(payload *WebhookPayload) bool {
+	if !a.enabled {
+		return false
+	}
+
+	// Channels cannot be replied to, so their posts never reach the agent.
+	if payload.ChatType == "newsletter" {
+		a.setStatus(payload.MessageID, store.AgentSkipped, skipNewsletter)
+		return false
+	}
 	if a.dmOnly && payload.ChatType == "group" {
 		a.log.Debug("agent skipping group message (dm_only)", "message_id", payload.MessageID)
-		return
+		a.setStatus(payload.MessageID, store.AgentSkipped, skipDMOnly)
+		return false
 	}
 
 	sender := normalizeNumber(payload.From)
 	if len(a.blocklist) > 0 && a.blocklist[sender] {
 		a.log.Debug("agent skipping blocklisted sender", "from", payload.From, "message_id", payload.MessageID)
-		return
+		a.setStatus(payload.MessageID, store.AgentSkipped, skipBlocklist)
+		return false
 	}
 	if len(a.allowlist) > 0 && !a.allowlist[sender] {
 		a.log.Debug("agent skipping non-allowlisted sender", "from", payload.From, "message_id", payload.MessageID)
-		return
+		a.setStatus(payload.MessageID, store.AgentSkipped, skipNotAllowlist)
+		return false
+	}
+	if hasAnyLabel(payload.Labels, a.ignoreLabels) {
+		a.log.Debug("agent skipping chat with ignored label", "chat", payload.From, "message_id", payload.MessageID)
+		a.setStatus(payload.MessageID, store.AgentSkipped, skipLabel)
+		return false
+	}
+	if len(a.labels) > 0 && !hasAnyLabel(payload.Labels, a.labels) {
+		a.log.Debug("agent skipping unlabelled chat", "chat", payload.From, "message_id", payload.MessageID)
+		a.setStatus(payload.MessageID, store.AgentSkipped, skipNotLabelled)
+		return false
+	}
+	if a.ignoreMuted && payload.Muted {
+		a.log.Debug("agent skipping muted chat", "chat", payload.From, "message_id", payload.MessageID)
+		a.setStatus(payload.MessageID, store.AgentSkipped, skipMuted)
+		return false
 	}
 
-	// Send typing indicator.
-	a.sendTyping(client, payload.From)
+	a.setStatus(payload.MessageID, store.AgentTriggered, "")
+	return true
+}
 
-	// Run async — don't block the event loop.
-	go func() {
-		defer a.clearTyping(client, payload.From)
-
-		switch a.mode {
-		case "http":
-			a.triggerHTTP(payload)
-		default:
-			a.triggerCommand(payload)
+// run invokes the agent while showing a typing indicator and records the
+// outcome.
+func (a *AgentTrigger) run(client *Client, payload *WebhookPayload) {
+	if jid, err := types.ParseJID(payload.From); err == nil {
+		defer client.keepTyping(context.Background(), jid, a.typingRefresh)()
+	} else {
+		a.log.Debug("agent typing: could not parse JID", "jid", payload.From, "error", err)
+	}
+
+	var err error
+	switch a.mode {
+	case "http":
+		err = a.triggerHTTP(payload)
+	default:
+		var output string
+		output, err = a.triggerCommand(payload)
+		switch {
+		case err != nil && a.errorReply != "":
+			if rerr := a.reply(client, payload, a.errorReply); rerr != nil {
+				a.log.Error("failed to send agent error reply", "error", rerr, "message_id", payload.MessageID)
+			}
+		case err == nil && a.replyOutput:
+			if err = a.reply(client, payload, strings.TrimSpace(output)); err != nil {
+				a.log.Error("failed to send agent reply", "error", err, "message_id", payload.MessageID)
+			}
 		}
-	}()
+	}
+	if err != nil {
+		a.setStatus(payload.MessageID, store.AgentFailed, err.Error())
+		return
+	}
+	a.setStatus(payload.MessageID, store.AgentSucceeded, "")
+	a.readReceipts.Mark(payload.From, payload.senderJID, payload.MessageID)
 }
 
-// triggerCommand executes a shell command with template variables substituted.
-func (a *AgentTrigger) triggerCommand(payload *WebhookPayload) {
-	if a.command == "" {
-		a.log.Warn("agent command mode enabled but no command configured")
+// setStatus records the agent outcome for a message, if a store is configured.
+func (a *AgentTrigger) setStatus(msgID, status, detail string) {
+	if a.store == nil {
 		return
 	}
+	if err := a.store.SetAgentStatus(msgID, status, detail); err != nil {
+		a.log.Error("failed to record agent status", "error", err, "message_id", msgID)
+	}
+}
+
+// operatorNotes returns the text of the notes operators left on the chat of
+// payload, if a store is configured. A failed lookup only loses the notes.
+func (a *AgentTrigger) operatorNotes(payload *WebhookPayload) []string {
+	if a.store == nil {
+		return nil
+	}
+	notes, err := a.store.GetChatNotes(payload.From)
+	if err != nil {
+		a.log.Error("failed to load operator notes", "error", err, "message_id", payload.MessageID)
+		return nil
+	}
+	texts := make([]string, 0, len(notes))
+	for _, n := range notes {
+		texts = append(texts, n.Note)
+	}
+	return texts
+}
 
-	cmd := a.expandTemplate(a.command, payload)
+// defaultCommandShell runs the agent command when no shell is configured.
+var defaultCommandShell = []string{"sh", "-c"}
 
-	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
-	defer cancel()
+// posixShells are the interpreters whose single quotes shellEscape is
+// written for: nothing inside them is special, not even a backslash.
+var posixShells = map[string]bool{
+	"sh": true, "ash": true, "dash": true, "bash": true, "ksh": true, "mksh": true, "zsh": true,
+}
+
+// templatePlaceholders are the placeholders expandTemplate substitutes.
+var templatePlaceholders = []string{
+	"{from}", "{name}", "{message}", "{chat_jid}", "{type}", "{is_group}", "{group_name}",
+	"{message_id}", "{selected_id}", "{labels}", "{media_path}", "{system_prompt}",
+}
+
+// CheckCommandShell returns an error if the agent command string has
+// placeholders to substitute but shell is not a POSIX shell. The values are
+// escaped for POSIX single quotes, which other shells, such as fish or
+// PowerShell, parse differently, so a sender could inject commands. Static
+// commands, and commands without placeholders, may use any interpreter. A
+// nil shell selects defaultCommandShell.
+func CheckCommandShell(shell []string, command string, static bool) error {
+	if len(shell) == 0 || static {
+		return nil
+	}
+	templated := false
+	for _, p := range templatePlaceholders {
+		if strings.Contains(command, p) {
+			templated = true
+			break
+		}
+	}
+	if templated && !posixShells[filepath.Base(shell[0])] {
+		return fmt.Errorf("command_shell %q is not a POSIX shell, so placeholders in command cannot be quoted safely; use sh, bash or similar, or command_args or static_command instead", shell[0])
+	}
+	return nil
+}
+
+// maxCommandOutput is how much of each of the agent command's standard
+// output and standard error is kept; the rest is discarded as it arrives.
+const maxCommandOutput = 64 << 10
+
+// cappedBuffer keeps only the first max bytes written to it. Writes never
+// fail, so the command is not killed by a broken pipe. The buffer is not
+// embedded: its ReadFrom would let io.Copy bypass the cap.
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	keep := min(len(p), max(b.max-b.buf.Len(), 0))
+	b.buf.Write(p[:keep])
+	b.dropped += len(p) - keep
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string { return b.buf.String() }
+
+// triggerCommand runs the agent command with template variables
+// substituted, unless it is static: the command string through the
+// configured shell, or the argument vector directly. The message is also
+// passed in the environment. It returns what the command wrote to standard
+// output, up to maxCommandOutput.
+func (a *AgentTrigger) triggerCommand(payload *WebhookPayload) (string, error) {
+	if a.command == "" && len(a.commandArgs) == 0 {
+		a.log.Warn("agent command mode enabled but no command configured")
+		return "", errors.New("no command configured")
+	}
+	expand := func(tmpl string, escape func(string) string) string {
+		if a.staticCommand {
+			return tmpl
+		}
+		return a.expandTemplate(tmpl, payload, escape)
+	}
 
-	a.log.Info("agent triggering command", "command", cmd, "message_id", payload.MessageID)
+	ctx, cancel := context.WithTimeout(context.Background(), a.cmdTimeout)
+	defer cancel()
 
-	proc := exec.CommandContext(ctx, "sh", "-c", cmd)
-	proc.Env = append(os.Environ(), "OC_WA_SYSTEM_PROMPT="+a.systemPrompt)
-	output, err := proc.CombinedOutput()
+	var proc *exec.Cmd
+	if len(a.commandArgs) > 0 {
+		argv := make([]string, len(a.commandArgs))
+		for i, arg := range a.commandArgs {
+			argv[i] = expand(arg, nil)
+		}
+		a.log.Info("agent triggering command", "argv", argv, "message_id", payload.MessageID)
+		proc = exec.CommandContext(ctx, argv[0], argv[1:]...)
+	} else {
+		cmd := expand(a.command, shellEscape)
+		shell := a.commandShell
+		if len(shell) == 0 {
+			shell = defaultCommandShell
+		}
+		a.log.Info("agent triggering command", "shell", strings.Join(shell, " "), "command", cmd, "message_id", payload.MessageID)
+		proc = exec.CommandContext(ctx, shell[0], append(shell[1:len(shell):len(shell)], cmd)...)
+	}
+	proc.Env = append(os.Environ(), a.commandEnv(payload)...)
+	stdout := &cappedBuffer{max: maxCommandOutput}
+	stderr := &cappedBuffer{max: maxCommandOutput}
+	proc.Stdout = stdout
+	proc.Stderr = stderr
+	err := proc.Run()
+	if stdout.dropped > 0 || stderr.dropped > 0 {
+		a.log.Warn("agent command output truncated", "limit", maxCommandOutput, "stdout_dropped", stdout.dropped, "stderr_dropped", stderr.dropped, "message_id", payload.MessageID)
+	}
 	if err != nil {
-		a.log.Error("agent command failed", "error", err, "output", string(output), "message_id", payload.MessageID)
-		return
+		a.log.Error("agent command failed", "error", err, "output", stdout.String(), "stderr", stderr.String(), "message_id", payload.MessageID)
+		return "", fmt.Errorf("command failed: %w", err)
 	}
 
-	a.log.Info("agent command completed", "output", string(output), "message_id", payload.MessageID)
+	a.log.Info("agent command completed", "output", stdout.String(), "stderr", stderr.String(), "message_id", payload.MessageID)
+	return stdout.String(), nil
+}
+
+// reply sends text to the chat of payload on the agent's behalf and records
+// it, if a store is configured, like a text sent through the API: the parts
+// that went out, and after an error the rest as a failed message. Empty
+// text is not sent.
+func (a *AgentTrigger) reply(client *Client, payload *WebhookPayload, text string) error {
+	if text == "" {
+		a.log.Debug("agent reply empty, not sent", "message_id", payload.MessageID)
+		return nil
+	}
+	sent, err := client.Send(context.Background(), payload.From, Content{Text: text}, SendOptions{})
+	if a.store != nil {
+		client.RecordSentText(a.store, payload.From, text, sent, err)
+	}
+	if err != nil {
+		return fmt.Errorf("send reply: %w", err)
+	}
+	a.log.Info("agent reply sent", "parts", len(sent), "message_id", payload.MessageID)
+	return nil
 }
 
 // triggerHTTP POSTs message details to the configured HTTP endpoint.
-func (a *AgentTrigger) triggerHTTP(payload *WebhookPayload) {
+func (a *AgentTrigger) triggerHTTP(payload *WebhookPayload) error {
 	if a.httpURL == "" {
 		a.log.Warn("agent http mode enabled but no http_url configured")
-		return
+		return errors.New("no http_url configured")
 	}
 
 	agentPayload := &AgentPayload{
@@ -166,107 +481,154 @@ func (a *AgentTrigger) triggerHTTP(payload *WebhookPayload) {
 		IsGroup:       payload.ChatType == "group",
 		GroupName:     payload.GroupName,
 		MessageID:     payload.MessageID,
+		SelectedID:    payload.SelectedID,
+		Labels:        payload.Labels,
 		Timestamp:     payload.Timestamp,
 		ReplyEndpoint: a.replyEndpoint,
 		SystemPrompt:  a.systemPrompt,
+		OperatorNotes: a.operatorNotes(payload),
+	}
+	if path := agentMediaPath(payload); path != "" {
+		agentPayload.MediaPath = path
+		agentPayload.MediaMimetype = mime.TypeByExtension(filepath.Ext(path))
+		agentPayload.MediaData = a.inlineMedia(path, payload.MessageID)
 	}
 
 	body, err := json.Marshal(agentPayload)
 	if err != nil {
 		a.log.Error("agent marshal payload failed", "error", err, "message_id", payload.MessageID)
-		return
+		return fmt.Errorf("marshal payload: %w", err)
 	}
 
-	a.log.Info("agent triggering http", "url", a.httpURL, "message_id", payload.MessageID)
+	a.log.Info("agent triggering http", "url", a.httpURL, "headers", redactHeaders(a.httpHeaders), "message_id", payload.MessageID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), a.httpTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.httpURL, bytes.NewReader(body))
 	if err != nil {
 		a.log.Error("agent http request creation failed", "error", err, "message_id", payload.MessageID)
-		return
+		return fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	for k, v := range a.httpHeaders {
+		req.Header.Set(k, v)
+	}
 
 	resp, err := a.client.Do(req)
 	if err != nil {
 		a.log.Error("agent http delivery failed", "error", err, "message_id", payload.MessageID)
-		return
+		return fmt.Errorf("http delivery failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		a.log.Info("agent http delivered", "status", resp.StatusCode, "message_id", payload.MessageID)
-	} else {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		a.log.Warn("agent http non-2xx response", "status", resp.StatusCode, "message_id", payload.MessageID)
+		return fmt.Errorf("http status %d", resp.StatusCode)
 	}
+
+	a.log.Info("agent http delivered", "status", resp.StatusCode, "message_id", payload.MessageID)
+	return nil
 }
 
-// expandTemplate replaces {var} placeholders in the command template.
-// Values are shell-escaped to prevent injection.
-func (a *AgentTrigger) expandTemplate(tmpl string, p *WebhookPayload) string {
-	isGroup := "false"
-	if p.ChatType == "group" {
-		isGroup = "true"
+// redactHeaders returns the header names with their values masked, for
+// logging.
+func redactHeaders(h map[string]string) map[string]string {
+	if len(h) == 0 {
+		return nil
 	}
-
-	replacements := map[string]string{
-		"{from}":          shellEscape(p.From),
-		"{name}":          shellEscape(p.Name),
-		"{message}":       shellEscape(p.Message),
-		"{chat_jid}":      shellEscape(p.From),
-		"{type}":          shellEscape(p.Type),
-		"{is_group}":      isGroup,
-		"{group_name}":    shellEscape(p.GroupName),
-		"{message_id}":    shellEscape(p.MessageID),
-		"{system_prompt}": shellEscape(a.systemPrompt),
+	out := make(map[string]string, len(h))
+	for k := range h {
+		out[k] = "[REDACTED]"
 	}
+	return out
+}
 
-	result := tmpl
-	for k, v := range replacements {
-		result = strings.ReplaceAll(result, k, v)
+// expandTemplate replaces {var} placeholders in a command template, in a
+// single pass so that values containing placeholders are left alone. Values
+// go through escape, if given: shellEscape for the shell form, where they
+// sit inside single quotes.
+func (a *AgentTrigger) expandTemplate(tmpl string, p *WebhookPayload, escape func(string) string) string {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+	isGroup := "false"
+	if p.ChatType == "group" {
+		isGroup = "true"
 	}
-	return result
-}
 
-// shellEscape escapes a string for safe use in a shell command by replacing
-// single quotes with the standard escape sequence.
-func shellEscape(s string) string {
-	return strings.ReplaceAll(s, "'", "'\"'\"'")
+	r := strings.NewReplacer(
+		"{from}", escape(p.From),
+		"{name}", escape(p.Name),
+		"{message}", escape(p.Message),
+		"{chat_jid}", escape(p.From),
+		"{type}", escape(p.Type),
+		"{is_group}", isGroup,
+		"{group_name}", escape(p.GroupName),
+		"{message_id}", escape(p.MessageID),
+		"{selected_id}", escape(p.SelectedID),
+		"{labels}", escape(strings.Join(p.Labels, ",")),
+		"{media_path}", escape(agentMediaPath(p)),
+		"{system_prompt}", escape(a.systemPrompt),
+	)
+	return r.Replace(tmpl)
 }
 
-// sendTyping sends a composing (typing) indicator to the given chat.
-func (a *AgentTrigger) sendTyping(client *Client, chatJID string) {
-	wc := client.GetClient()
-	if wc == nil {
-		return
+// commandEnv returns the environment variables describing the message
+// that the agent command receives, in addition to the bridge's own.
+func (a *AgentTrigger) commandEnv(p *WebhookPayload) []string {
+	isGroup := "false"
+	if p.ChatType == "group" {
+		isGroup = "true"
 	}
-
-	jid, err := types.ParseJID(chatJID)
-	if err != nil {
-		a.log.Debug("agent typing: could not parse JID", "jid", chatJID, "error", err)
-		return
+	return []string{
+		"OC_WA_FROM=" + p.From,
+		"OC_WA_NAME=" + p.Name,
+		"OC_WA_MESSAGE=" + p.Message,
+		"OC_WA_CHAT_JID=" + p.From,
+		"OC_WA_TYPE=" + p.Type,
+		"OC_WA_IS_GROUP=" + isGroup,
+		"OC_WA_GROUP_NAME=" + p.GroupName,
+		"OC_WA_MESSAGE_ID=" + p.MessageID,
+		"OC_WA_SELECTED_ID=" + p.SelectedID,
+		"OC_WA_LABELS=" + strings.Join(p.Labels, ","),
+		"OC_WA_MEDIA_PATH=" + agentMediaPath(p),
+		"OC_WA_SYSTEM_PROMPT=" + a.systemPrompt,
+		"OC_WA_OPERATOR_NOTES=" + strings.Join(a.operatorNotes(p), "\n"),
 	}
+}
 
-	if err := wc.SendChatPresence(context.Background(), jid, "composing", ""); err != nil {
-		a.log.Debug("agent typing indicator failed", "error", err, "chat", chatJID)
+// agentMediaPath returns the downloaded media file of a message when it is of
+// a kind the agent can inspect (image, video, or document).
+func agentMediaPath(p *WebhookPayload) string {
+	switch p.Type {
+	case "image", "video", "document":
+		return p.MediaURL
+	default:
+		return ""
 	}
 }
 
-// clearTyping sends a paused indicator to clear the typing state.
-func (a *AgentTrigger) clearTyping(client *Client, chatJID string) {
-	wc := client.GetClient()
-	if wc == nil {
-		return
+// inlineMedia returns the base64-encoded contents of the media file at path
+// if inlining is enabled and the file is within the size cap.
+func (a *AgentTrigger) inlineMedia(path, msgID string) string {
+	if a.inlineMediaMax <= 0 {
+		return ""
 	}
-
-	jid, err := types.ParseJID(chatJID)
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > a.inlineMediaMax {
+		return ""
+	}
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return
+		a.log.Warn("agent could not read media for inlining", "error", err, "message_id", msgID)
+		return ""
 	}
+	return base64.StdEncoding.EncodeToString(data)
+}
 
-	if err := wc.SendChatPresence(context.Background(), jid, "paused", ""); err != nil {
-		a.log.Debug("agent clear typing failed", "error", err, "chat", chatJID)
-	}
+// shellEscape escapes a string for safe use in a shell command by replacing
+// single quotes with the standard escape sequence.
+func shellEscape(s string) string {
+	return strings.ReplaceAll(s, "'", "'\"'\"'")
 }
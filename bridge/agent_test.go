@@ -0,0 +1,69 @@
+package bridge
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerCommandCapsOutput(t *testing.T) {
+	a := NewAgentTrigger(AgentOptions{
+		Enabled:        true,
+		Command:        "head -c 200000 /dev/zero | tr '\\0' x; echo done >&2",
+		StaticCommand:  true,
+		CommandTimeout: 10 * time.Second,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	out, err := a.triggerCommand(&WebhookPayload{MessageID: "M1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != maxCommandOutput || strings.Trim(out, "x") != "" {
+		t.Fatalf("got %d bytes of output, want %d", len(out), maxCommandOutput)
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 5}
+	for _, p := range []string{"abc", "defg", "h"} {
+		if n, err := b.Write([]byte(p)); n != len(p) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", p, n, err)
+		}
+	}
+	if b.String() != "abcde" || b.dropped != 3 {
+		t.Fatalf("got %q with %d dropped, want \"abcde\" with 3", b.String(), b.dropped)
+	}
+}
+
+func TestCheckCommandShell(t *testing.T) {
+	for _, c := range []struct {
+		shell   string
+		command string
+		static  bool
+		ok      bool
+	}{
+		{"", "notify '{message}'", false, true},
+		{"bash -c", "notify '{message}'", false, true},
+		{"/busybox/sh -c", "notify '{message}'", false, true},
+		{"fish -c", "notify '{message}'", false, false},
+		{"pwsh -Command", "notify '{name}'", false, false},
+		{"fish -c", "notify \"$OC_WA_MESSAGE\"", false, true},
+		{"fish -c", "notify '{message}'", true, true},
+	} {
+		err := CheckCommandShell(strings.Fields(c.shell), c.command, c.static)
+		if (err == nil) != c.ok {
+			t.Errorf("CheckCommandShell(%q, %q, %v) = %v", c.shell, c.command, c.static, err)
+		}
+	}
+}
+
+func TestTemplatePlaceholdersAreExpanded(t *testing.T) {
+	a := NewAgentTrigger(AgentOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, p := range templatePlaceholders {
+		if got := a.expandTemplate(p, &WebhookPayload{}, nil); got == p {
+			t.Errorf("%s is not expanded", p)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// maxAvatarSize bounds the profile picture download.
+const maxAvatarSize = 10 << 20
+
+// avatarRecheckInterval is how long a cached picture is served without
+// asking WhatsApp whether it changed. A picture change notification drops
+// it from the cache sooner.
+const avatarRecheckInterval = time.Hour
+
+// Errors returned by Avatar when there is no picture to return. Avatar
+// also returns ErrNotConnected when the picture must be checked with
+// WhatsApp while disconnected.
+var (
+	ErrNoAvatar     = errors.New("no profile picture is set")
+	ErrAvatarHidden = errors.New("the profile picture is hidden by privacy settings")
+	ErrInvalidJID   = errors.New("invalid JID")
+)
+
+var avatarHTTP = &http.Client{Timeout: 30 * time.Second}
+
+// AvatarDir returns the directory where downloaded profile pictures are
+// cached. It is kept apart from the media directory, which holds only
+// message media and is garbage-collected as such.
+func (c *Client) AvatarDir() string {
+	return filepath.Join(c.dataDir, "avatars")
+}
+
+// Avatar returns the path of the profile picture of the user or group jid,
+// downloading it unless the current picture is already cached. Files are
+// named after the picture ID, so a changed picture is fetched again and
+// the one it replaces is removed. A picture checked within
+// avatarRecheckInterval is returned without asking WhatsApp, even while
+// disconnected. With preview set the low-resolution thumbnail is returned
+// instead.
+func (c *Client) Avatar(ctx context.Context, jid string, preview bool) (string, error) {
+	target, err := c.recipientJID(jid)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidJID, err)
+	}
+	target = target.ToNonAD()
+
+	variant := "image"
+	if preview {
+		variant = "preview"
+	}
+	prefix := filepath.Join(c.AvatarDir(), target.String()+"_"+variant+"_")
+	cached := cachedAvatars(prefix)
+
+	var existingID string
+	if len(cached) == 1 {
+		if info, err := os.Stat(cached[0]); err == nil && time.Since(info.ModTime()) < avatarRecheckInterval {
+			return cached[0], nil
+		}
+		existingID = strings.TrimPrefix(cached[0], prefix)
+	}
+
+	if c.client == nil || !c.client.IsConnected() {
+		return "", ErrNotConnected
+	}
+	info, err := c.client.GetProfilePictureInfo(ctx, target, &whatsmeow.GetProfilePictureParams{
+		Preview:    preview,
+		ExistingID: existingID,
+	})
+	switch {
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet):
+		removeFiles(cached)
+		return "", ErrNoAvatar
+	case errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		return "", ErrAvatarHidden
+	case err != nil:
+		return "", fmt.Errorf("get profile picture info: %w", err)
+	case info == nil:
+		// Unchanged since it was cached.
+		touchFile(cached[0])
+		return cached[0], nil
+	}
+	if info.ID == "" || strings.ContainsAny(info.ID, `/\.`) {
+		return "", fmt.Errorf("unexpected profile picture ID %q", info.ID)
+	}
+
+	path := prefix + info.ID
+	if _, err := os.Stat(path); err != nil {
+		if err := c.downloadAvatar(ctx, info.URL, path); err != nil {
+			return "", err
+		}
+	} else {
+		touchFile(path)
+	}
+	for _, old := range cached {
+		if old != path {
+			os.Remove(old)
+		}
+	}
+	return path, nil
+}
+
+// downloadAvatar fetches url into path, writing a temporary file first so
+// that a failed download never leaves a truncated picture in the cache.
+func (c *Client) downloadAvatar(ctx context.Context, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("download profile picture: %w", err)
+	}
+	resp, err := avatarHTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("download profile picture: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download profile picture: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarSize+1))
+	if err != nil {
+		return fmt.Errorf("download profile picture: %w", err)
+	}
+	if len(data) > maxAvatarSize {
+		return fmt.Errorf("download profile picture: larger than %d bytes", maxAvatarSize)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), c.dirMode); err != nil {
+		return fmt.Errorf("create avatar directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, c.fileMode); err != nil {
+		return fmt.Errorf("write profile picture: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write profile picture: %w", err)
+	}
+	return nil
+}
+
+// forgetAvatars drops the cached pictures of jid, so that the next request
+// fetches the current one.
+func (c *Client) forgetAvatars(jid types.JID) {
+	removeFiles(cachedAvatars(filepath.Join(c.AvatarDir(), jid.ToNonAD().String()+"_")))
+}
+
+// cachedAvatars lists the cached pictures whose paths start with prefix,
+// leaving out unfinished downloads.
+func cachedAvatars(prefix string) []string {
+	var cached []string
+	matches, _ := filepath.Glob(prefix + "*")
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".tmp") {
+			cached = append(cached, m)
+		}
+	}
+	return cached
+}
+
+// touchFile marks the cached picture at path as checked just now.
+func touchFile(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// removeFiles removes the cached pictures at paths, ignoring failures.
+func removeFiles(paths []string) {
+	for _, p := range paths {
+		os.Remove(p)
+	}
+}
@@ -0,0 +1,76 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c, err := NewClient(t.TempDir(), SessionKeys{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestAvatarServesFreshCache(t *testing.T) {
+	c := newTestClient(t)
+	const jid = "31612345678@s.whatsapp.net"
+	path := filepath.Join(c.AvatarDir(), jid+"_image_123")
+	if err := os.MkdirAll(c.AvatarDir(), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checked recently: served without asking WhatsApp, so no connection
+	// is needed.
+	got, err := c.Avatar(context.Background(), jid, false)
+	if err != nil || got != path {
+		t.Fatalf("Avatar = %q, %v; want the cached %q", got, err, path)
+	}
+
+	// Stale: WhatsApp must be asked again.
+	old := time.Now().Add(-2 * avatarRecheckInterval)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Avatar(context.Background(), jid, false); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("stale cache: got %v, want a connection error", err)
+	}
+
+	c.forgetAvatars(types.NewJID("31612345678", types.DefaultUserServer))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("picture still cached after forgetAvatars: %v", err)
+	}
+}
+
+func TestDownloadAvatarRejectsOversize(t *testing.T) {
+	c := newTestClient(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte{1}, maxAvatarSize+1))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(c.AvatarDir(), "x_image_1")
+	if err := c.downloadAvatar(context.Background(), srv.URL, path); err == nil {
+		t.Fatal("oversized picture accepted")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("oversized picture cached: %v", err)
+	}
+}
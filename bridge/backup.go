@@ -0,0 +1,511 @@
+package bridge
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// BackupFormat is the version of the backup archive layout written by
+// WriteBackupArchive. Archives with a newer format are refused on restore.
+const BackupFormat = 1
+
+// Names of the entries in a backup archive. The manifest always comes first;
+// media files follow the databases under media/.
+const (
+	backupManifestName   = "manifest.json"
+	backupMessagesName   = "messages.db"
+	backupSessionName    = "sessions/whatsapp.db"
+	backupSessionEncName = "sessions/whatsapp.db.enc"
+	backupMediaPrefix    = "media/"
+)
+
+// BackupManifest describes the contents of a backup archive.
+type BackupManifest struct {
+	Format           int          `json:"format"`
+	Version          string       `json:"version"`    // bridge version that wrote the archive
+	CreatedAt        int64        `json:"created_at"` // unix seconds
+	SchemaVersion    int          `json:"schema_version"`
+	SessionEncrypted bool         `json:"session_encrypted"`
+	Files            []BackupFile `json:"files"`
+	MediaFiles       int          `json:"media_files"`
+	MediaBytes       int64        `json:"media_bytes"`
+
+	// MediaDir is the media directory of the bridge that wrote the
+	// archive, as its stored media paths name it.
+	MediaDir string `json:"media_dir,omitempty"`
+}
+
+// BackupFile is a database in a backup archive with its checksum.
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// WriteBackupArchive writes the message database, the session store and,
+// with withMedia, the media files under dataDir into a gzip-compressed tar
+// at out, which must not exist. The databases are snapshotted with VACUUM
+// INTO, which reads committed changes still in their WAL, so the bridge may
+// keep running. An encrypted session store is copied as is and needs the
+// same session_key after restoring.
+func WriteBackupArchive(dataDir, out, version string, withMedia bool) (*BackupManifest, error) {
+	if _, err := os.Stat(out); err == nil {
+		return nil, fmt.Errorf("backup: %s already exists", out)
+	}
+
+	staging, err := os.MkdirTemp(dataDir, ".backup-")
+	if err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	m := &BackupManifest{
+		Format:    BackupFormat,
+		Version:   version,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	// staged maps archive names to the files holding their contents.
+	staged := map[string]string{}
+
+	mediaDir := filepath.Join(dataDir, "media")
+	m.MediaDir = mediaDir
+
+	msgSnap := filepath.Join(staging, "messages.db")
+	if err := store.BackupDatabase(filepath.Join(dataDir, "messages.db"), msgSnap); err != nil {
+		return nil, err
+	}
+	if m.SchemaVersion, err = store.VerifyBackup(msgSnap); err != nil {
+		return nil, err
+	}
+	staged[backupMessagesName] = msgSnap
+
+	sessionPath := filepath.Join(dataDir, "sessions", "whatsapp.db")
+	switch {
+	case fileExists(sessionPath + ".enc"):
+		// The vault replaces the file atomically, so a plain copy is
+		// always a complete snapshot.
+		staged[backupSessionEncName] = sessionPath + ".enc"
+		m.SessionEncrypted = true
+	case fileExists(sessionPath):
+		sessionSnap := filepath.Join(staging, "whatsapp.db")
+		if err := snapshotSessionDB(sessionPath, sessionSnap); err != nil {
+			return nil, err
+		}
+		staged[backupSessionName] = sessionSnap
+	}
+
+	names := []string{backupMessagesName, backupSessionName, backupSessionEncName}
+	for _, name := range names {
+		src, ok := staged[name]
+		if !ok {
+			continue
+		}
+		f, err := checksumFile(name, src)
+		if err != nil {
+			return nil, fmt.Errorf("backup: %w", err)
+		}
+		m.Files = append(m.Files, f)
+	}
+
+	var media []string
+	if withMedia {
+		err := filepath.WalkDir(mediaDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			media = append(media, p)
+			m.MediaFiles++
+			m.MediaBytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backup: scan media: %w", err)
+		}
+	}
+
+	err = writeArchive(out, func(tw *tar.Writer) error {
+		manifest, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:    backupManifestName,
+			Mode:    0o600,
+			Size:    int64(len(manifest)),
+			ModTime: time.Unix(m.CreatedAt, 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(manifest); err != nil {
+			return err
+		}
+
+		for _, f := range m.Files {
+			if err := addArchiveFile(tw, f.Name, staged[f.Name]); err != nil {
+				return err
+			}
+		}
+		for _, p := range media {
+			rel, err := filepath.Rel(mediaDir, p)
+			if err != nil {
+				return err
+			}
+			if err := addArchiveFile(tw, backupMediaPrefix+filepath.ToSlash(rel), p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	return m, nil
+}
+
+// snapshotSessionDB copies the plaintext session database at src to dst
+// with VACUUM INTO.
+func snapshotSessionDB(src, dst string) error {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", src))
+	if err != nil {
+		return fmt.Errorf("backup: open session store: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`VACUUM INTO ?`, dst); err != nil {
+		return fmt.Errorf("backup: session store: %w", err)
+	}
+	return nil
+}
+
+// writeArchive creates a gzip-compressed tar at dst and fills it with fill,
+// removing the file again if anything fails.
+func writeArchive(dst string, fill func(tw *tar.Writer) error) (err error) {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, sessionFileMode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := fill(tw); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addArchiveFile(tw *tar.Writer, name, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, in)
+	return err
+}
+
+func checksumFile(name, src string) (BackupFile, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	defer in.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, in)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	return BackupFile{Name: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// IsBackupArchive reports whether the file at path is a gzip-compressed
+// archive rather than a bare message database snapshot.
+func IsBackupArchive(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	var magic [2]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return false, nil
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// RestoreBackupArchive restores an archive written by WriteBackupArchive
+// into dataDir. The bridge must not be running. Everything is extracted to
+// a staging directory and checked against the manifest before anything in
+// dataDir is touched; the media paths stored in the message database are
+// rewritten to point into dataDir/media. The restored files are then
+// renamed into place, and if that fails partway the earlier steps are
+// undone. The message database is replaced as by store.RestoreDatabase,
+// and the session store files and media directory being replaced are kept
+// with a ".pre-restore" suffix. An archive without media leaves the media
+// directory as it is. Restored media get dirMode and fileMode.
+func RestoreBackupArchive(in, dataDir string, dirMode, fileMode os.FileMode) (*BackupManifest, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("restore: read archive: %w", err)
+	}
+	if hdr.Name != backupManifestName {
+		return nil, errors.New("restore: not a bridge backup archive (no manifest)")
+	}
+	var m BackupManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("restore: read manifest: %w", err)
+	}
+	if m.Format > BackupFormat {
+		return nil, fmt.Errorf("restore: archive format %d is newer than this build supports (%d)", m.Format, BackupFormat)
+	}
+	want := map[string]BackupFile{}
+	for _, bf := range m.Files {
+		want[bf.Name] = bf
+	}
+	if _, ok := want[backupMessagesName]; !ok {
+		return nil, errors.New("restore: archive has no message database")
+	}
+
+	staging, err := os.MkdirTemp(dataDir, ".restore-")
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	extracted := map[string]string{}
+	var media []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("restore: read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		var rel string
+		if strings.HasPrefix(hdr.Name, backupMediaPrefix) {
+			rel = strings.TrimPrefix(hdr.Name, backupMediaPrefix)
+			if !filepath.IsLocal(filepath.FromSlash(rel)) || path.Clean(rel) != rel {
+				return nil, fmt.Errorf("restore: unsafe media path %q", hdr.Name)
+			}
+			media = append(media, rel)
+			rel = filepath.Join("media", filepath.FromSlash(rel))
+		} else if _, ok := want[hdr.Name]; ok {
+			rel = filepath.Base(hdr.Name)
+		} else {
+			return nil, fmt.Errorf("restore: unexpected archive entry %q", hdr.Name)
+		}
+
+		dst := filepath.Join(staging, rel)
+		sum, err := extractFile(tr, dst)
+		if err != nil {
+			return nil, fmt.Errorf("restore: extract %s: %w", hdr.Name, err)
+		}
+		if bf, ok := want[hdr.Name]; ok {
+			if sum != bf.SHA256 {
+				return nil, fmt.Errorf("restore: %s does not match its checksum", hdr.Name)
+			}
+			extracted[hdr.Name] = dst
+		}
+	}
+	for name := range want {
+		if _, ok := extracted[name]; !ok {
+			return nil, fmt.Errorf("restore: archive is missing %s", name)
+		}
+	}
+
+	// Point the media paths where Client.MediaDir puts media.
+	mediaDir := filepath.Join(dataDir, "media")
+	if _, err := store.RebaseMediaPaths(extracted[backupMessagesName], m.MediaDir, mediaDir); err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	stagedMedia := filepath.Join(staging, "media")
+	if len(media) > 0 {
+		if err := chmodTree(stagedMedia, dirMode, fileMode); err != nil {
+			return nil, fmt.Errorf("restore: %w", err)
+		}
+	}
+
+	// Move everything into place, remembering how to undo each step.
+	var undo []func()
+	fail := func(err error) (*BackupManifest, error) {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return nil, err
+	}
+
+	if len(media) > 0 {
+		aside := mediaDir + ".pre-restore"
+		if fileExists(mediaDir) {
+			if err := os.RemoveAll(aside); err != nil {
+				return fail(fmt.Errorf("restore: %w", err))
+			}
+			if err := os.Rename(mediaDir, aside); err != nil {
+				return fail(fmt.Errorf("restore: %w", err))
+			}
+			undo = append(undo, func() { os.Rename(aside, mediaDir) })
+		}
+		if err := os.Rename(stagedMedia, mediaDir); err != nil {
+			return fail(fmt.Errorf("restore: %w", err))
+		}
+		undo = append(undo, func() { os.Rename(mediaDir, stagedMedia) })
+	}
+
+	sessionName := backupSessionName
+	if m.SessionEncrypted {
+		sessionName = backupSessionEncName
+	}
+	if src, ok := extracted[sessionName]; ok {
+		undoSession, err := restoreSession(src, filepath.Join(dataDir, filepath.FromSlash(sessionName)))
+		if err != nil {
+			return fail(err)
+		}
+		undo = append(undo, undoSession)
+	}
+
+	if _, err := store.RestoreDatabase(extracted[backupMessagesName], filepath.Join(dataDir, "messages.db")); err != nil {
+		return fail(err)
+	}
+	return &m, nil
+}
+
+// restoreSession moves the session store at src to dst, setting aside the
+// store files currently in dst's directory, plaintext or encrypted. It
+// returns a function that puts them back.
+func restoreSession(src, dst string) (func(), error) {
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, sessionDirMode); err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	var aside []string
+	undo := func() {
+		os.Remove(dst)
+		for _, p := range aside {
+			os.Rename(p+".pre-restore", p)
+		}
+	}
+	current, _ := filepath.Glob(filepath.Join(dir, "whatsapp.db*"))
+	for _, p := range current {
+		if strings.HasSuffix(p, ".pre-restore") {
+			continue
+		}
+		if err := os.Rename(p, p+".pre-restore"); err != nil {
+			undo()
+			return nil, fmt.Errorf("restore: %w", err)
+		}
+		aside = append(aside, p)
+	}
+	if err := os.Chmod(src, sessionFileMode); err != nil {
+		undo()
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		undo()
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	return undo, nil
+}
+
+// chmodTree gives the directories under root dirMode and the files in them
+// fileMode.
+func chmodTree(root string, dirMode, fileMode os.FileMode) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.Chmod(p, dirMode)
+		}
+		return os.Chmod(p, fileMode)
+	})
+}
+
+// extractFile writes the contents of r to dst and returns their SHA-256.
+func extractFile(r io.Reader, dst string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), sessionDirMode); err != nil {
+		return "", err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, sessionFileMode)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(out, io.TeeReader(r, h)); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,157 @@
+package bridge
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by WebhookSender.Send while its circuit breaker
+// is open: the endpoint failed repeatedly and is not being tried.
+var ErrCircuitOpen = errors.New("webhook circuit open")
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"    // deliveries go through
+	CircuitOpen     = "open"      // deliveries fail fast until the cooldown ends
+	CircuitHalfOpen = "half_open" // one probe delivery is in flight
+)
+
+// BreakerOptions configures a circuit breaker. Zero values select the
+// defaults.
+type BreakerOptions struct {
+	Threshold int           // consecutive failures that open the circuit
+	Cooldown  time.Duration // how long the circuit stays open before a probe
+}
+
+// Circuit breaker defaults.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// CircuitState is a snapshot of a circuit breaker.
+type CircuitState struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            int64  `json:"opened_at,omitempty"` // unix seconds, while not closed
+	RetryAt             int64  `json:"retry_at,omitempty"`  // unix seconds, while open
+	Rejected            int64  `json:"rejected"`            // deliveries failed fast since startup
+}
+
+// breaker stops calls to an endpoint after it fails threshold times in a
+// row. Once cooldown has passed a single probe call is let through: if it
+// succeeds the circuit closes, otherwise it stays open for another cooldown.
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	log       *slog.Logger
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	rejected int64
+	events   *EventBus // receives state changes, if set
+}
+
+func newBreaker(name string, opts BreakerOptions, log *slog.Logger) *breaker {
+	if opts.Threshold <= 0 {
+		opts.Threshold = defaultBreakerThreshold
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = defaultBreakerCooldown
+	}
+	return &breaker{
+		name:      name,
+		threshold: opts.Threshold,
+		cooldown:  opts.Cooldown,
+		log:       log,
+		state:     CircuitClosed,
+	}
+}
+
+// allow reports whether a call may go ahead. A call that is allowed must be
+// followed by done.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		if time.Since(b.openedAt) >= b.cooldown {
+			b.state = CircuitHalfOpen
+			b.log.Info("circuit half-open, probing", "event", "circuit_half_open", "circuit", b.name)
+			b.publishLocked()
+			return true
+		}
+	}
+	b.rejected++
+	return false
+}
+
+// done records the outcome of an allowed call.
+func (b *breaker) done(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		wasClosed := b.state == CircuitClosed
+		b.state = CircuitClosed
+		b.failures = 0
+		if !wasClosed {
+			b.log.Info("circuit closed", "event", "circuit_closed", "circuit", b.name)
+			b.publishLocked()
+		}
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == CircuitHalfOpen:
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+		b.log.Warn("circuit probe failed, staying open", "event", "circuit_opened", "circuit", b.name,
+			"failures", b.failures, "cooldown", b.cooldown.String())
+		b.publishLocked()
+	case b.state == CircuitClosed && b.failures >= b.threshold:
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+		b.log.Warn("circuit opened", "event", "circuit_opened", "circuit", b.name,
+			"failures", b.failures, "cooldown", b.cooldown.String())
+		b.publishLocked()
+	}
+}
+
+// publishLocked publishes the breaker's state as an EventCircuit event.
+// Publishing never blocks, so it is done with b.mu held to keep the events
+// in the order of the transitions.
+func (b *breaker) publishLocked() {
+	b.events.Publish(EventCircuit, &CircuitEvent{Circuit: b.name, CircuitState: b.snapshotLocked()})
+}
+
+// snapshot returns the breaker's current state.
+func (b *breaker) snapshot() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshotLocked()
+}
+
+func (b *breaker) snapshotLocked() CircuitState {
+	st := CircuitState{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Rejected:            b.rejected,
+	}
+	if b.state != CircuitClosed {
+		st.OpenedAt = b.openedAt.Unix()
+	}
+	if b.state == CircuitOpen {
+		st.RetryAt = b.openedAt.Add(b.cooldown).Unix()
+	}
+	return st
+}
@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookBreakerPublishesAndForgetsRejected(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	w, err := NewWebhookSender(srv.URL, true, RequestOptions{}, WebhookFilters{}, DedupOptions{}, BreakerOptions{Threshold: 2, Cooldown: 50 * time.Millisecond}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewEventBus(0)
+	w.SetEventBus(bus)
+	_, _, events, unsubscribe := bus.Subscribe(0)
+	defer unsubscribe()
+
+	w.Send(&WebhookPayload{MessageID: "A"})
+	w.Send(&WebhookPayload{MessageID: "B"})
+	if err := w.Send(&WebhookPayload{MessageID: "C"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Fatalf("endpoint called %d times, want 2", n)
+	}
+
+	// C was never delivered, so sending it again is not a duplicate.
+	fail.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if err := w.Send(&WebhookPayload{MessageID: "C"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Fatalf("endpoint called %d times, want 3", n)
+	}
+
+	var states []string
+	for len(states) < 3 {
+		select {
+		case ev := <-events:
+			if ev.Type != EventCircuit {
+				t.Fatalf("got a %s event", ev.Type)
+			}
+			states = append(states, ev.Data.(*CircuitEvent).State)
+		case <-time.After(time.Second):
+			t.Fatalf("got events %v, want open, half_open and closed", states)
+		}
+	}
+	if states[0] != CircuitOpen || states[1] != CircuitHalfOpen || states[2] != CircuitClosed {
+		t.Fatalf("got %v", states)
+	}
+}
@@ -0,0 +1,146 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// ErrAppState is returned when WhatsApp's app state, which holds chat list
+// settings such as archived, pinned and muted chats as well as the push
+// name, could not be patched. Right after linking this usually means the
+// device has not received the app state keys from the phone yet.
+var ErrAppState = errors.New("WhatsApp app state could not be changed")
+
+// ArchiveChat archives or unarchives chatJID for all devices of the
+// account and records the change in msgStore. Archiving also unpins the
+// chat. The patch names the last stored message of the chat, so that the
+// phone knows which messages the archive covers.
+func (c *Client) ArchiveChat(ctx context.Context, chatJID string, archive bool, msgStore *store.MessageStore) error {
+	jid, err := c.appStateTarget(chatJID)
+	if err != nil {
+		return err
+	}
+
+	last, err := msgStore.GetLatestMessage(jid.String())
+	if err != nil {
+		return err
+	}
+	var lastTime time.Time
+	var lastKey *waCommon.MessageKey
+	if last != nil {
+		lastTime = time.Unix(last.Timestamp, 0)
+		lastKey = messageKey(jid, last)
+	}
+
+	if err := c.client.SendAppState(ctx, appstate.BuildArchive(jid, archive, lastTime, lastKey)); err != nil {
+		return fmt.Errorf("%w: %v", ErrAppState, err)
+	}
+	return msgStore.SetChatArchived(jid.String(), archive)
+}
+
+// PinChat pins chatJID to the top of the chat list, or unpins it, for all
+// devices of the account and records the change in msgStore. WhatsApp
+// allows three pinned chats.
+func (c *Client) PinChat(ctx context.Context, chatJID string, pin bool, msgStore *store.MessageStore) error {
+	jid, err := c.appStateTarget(chatJID)
+	if err != nil {
+		return err
+	}
+	if err := c.client.SendAppState(ctx, appstate.BuildPin(jid, pin)); err != nil {
+		return fmt.Errorf("%w: %v", ErrAppState, err)
+	}
+	return msgStore.SetChatPinned(jid.String(), pin)
+}
+
+// MuteForever is the MuteChat until value that mutes a chat indefinitely.
+const MuteForever = -1
+
+// MuteChat mutes chatJID until the unix time until (in seconds), or
+// indefinitely with MuteForever, for all devices of the account, and
+// records the change in msgStore. An until of 0 unmutes the chat.
+func (c *Client) MuteChat(ctx context.Context, chatJID string, until int64, msgStore *store.MessageStore) error {
+	jid, err := c.appStateTarget(chatJID)
+	if err != nil {
+		return err
+	}
+	var patch appstate.PatchInfo
+	switch {
+	case until == 0:
+		patch = appstate.BuildMuteAbs(jid, false, nil)
+	case until == MuteForever:
+		patch = appstate.BuildMuteAbs(jid, true, nil)
+	default:
+		patch = appstate.BuildMuteAbs(jid, true, proto.Int64(until*1000))
+	}
+	if err := c.client.SendAppState(ctx, patch); err != nil {
+		return fmt.Errorf("%w: %v", ErrAppState, err)
+	}
+	return msgStore.SetChatMutedUntil(jid.String(), until)
+}
+
+// appStateTarget parses the chat an app state patch is for, failing if
+// the client is not connected.
+func (c *Client) appStateTarget(chatJID string) (types.JID, error) {
+	if c.client == nil || !c.client.IsConnected() {
+		return types.EmptyJID, fmt.Errorf("client is not connected")
+	}
+	jid, err := c.recipientJID(chatJID)
+	if err != nil {
+		return types.EmptyJID, fmt.Errorf("parse chat JID: %w", err)
+	}
+	return jid, nil
+}
+
+// handleArchive records a chat being archived or unarchived, on the phone
+// or another device, or as part of the app state sync after linking.
+func handleArchive(evt *events.Archive, msgStore *store.MessageStore, log *slog.Logger) {
+	if err := msgStore.SetChatArchived(evt.JID.String(), evt.Action.GetArchived()); err != nil {
+		log.Error("failed to record archived chat", "error", err, "chat", evt.JID)
+	}
+}
+
+// handlePin records a chat being pinned or unpinned elsewhere.
+func handlePin(evt *events.Pin, msgStore *store.MessageStore, log *slog.Logger) {
+	if err := msgStore.SetChatPinned(evt.JID.String(), evt.Action.GetPinned()); err != nil {
+		log.Error("failed to record pinned chat", "error", err, "chat", evt.JID)
+	}
+}
+
+// handleMute records a chat being muted or unmuted elsewhere. WhatsApp
+// gives the end of a mute in milliseconds, and -1 for an indefinite one.
+func handleMute(evt *events.Mute, msgStore *store.MessageStore, log *slog.Logger) {
+	var until int64
+	if evt.Action.GetMuted() {
+		until = MuteForever
+		if end := evt.Action.GetMuteEndTimestamp(); end > 0 {
+			until = end / 1000
+		}
+	}
+	if err := msgStore.SetChatMutedUntil(evt.JID.String(), until); err != nil {
+		log.Error("failed to record muted chat", "error", err, "chat", evt.JID)
+	}
+}
+
+// messageKey returns the key identifying the stored message m of chat.
+func messageKey(chat types.JID, m *store.Message) *waCommon.MessageKey {
+	key := &waCommon.MessageKey{
+		RemoteJID: proto.String(chat.String()),
+		FromMe:    proto.Bool(m.IsFromMe),
+		ID:        proto.String(m.ID),
+	}
+	if chat.Server == types.GroupServer && !m.IsFromMe {
+		key.Participant = proto.String(m.SenderJID)
+	}
+	return key
+}
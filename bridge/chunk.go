@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxTextLength is the default number of characters Send puts in one
+// text message. WhatsApp rejects or truncates much longer text messages.
+const DefaultMaxTextLength = 4096
+
+// splitText breaks text into chunks of at most max characters, preferring to
+// split between paragraphs, then lines, then words. Whitespace at chunk
+// boundaries is dropped. A max of 0 or less returns text unsplit.
+func splitText(text string, max int) []string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return []string{text}
+	}
+
+	var chunks []string
+	for utf8.RuneCountInString(text) > max {
+		// Byte offset just past the first max characters.
+		limit := 0
+		for i := 0; i < max; i++ {
+			_, size := utf8.DecodeRuneInString(text[limit:])
+			limit += size
+		}
+
+		cut := -1
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(text[:limit], sep); i > 0 {
+				cut = i
+				break
+			}
+		}
+		if cut <= 0 {
+			cut = limit // no boundary: split mid-word
+		}
+
+		if chunk := strings.TrimRightFunc(text[:cut], unicode.IsSpace); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = strings.TrimLeftFunc(text[cut:], unicode.IsSpace)
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	if len(chunks) == 0 {
+		return []string{""} // whitespace only
+	}
+	return chunks
+}
@@ -2,6 +2,8 @@ package bridge
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -27,6 +29,10 @@ const (
 	StatusDisconnected Status = "disconnected"
 	StatusConnecting   Status = "connecting"
 	StatusConnected    Status = "connected"
+
+	// StatusManuallyDisconnected is a connection closed through
+	// DisconnectManually, which stays closed until Connect is called.
+	StatusManuallyDisconnected Status = "manually_disconnected"
 )
 
 // Client wraps a single-device whatsmeow client, managing session storage,
@@ -34,6 +40,7 @@ const (
 type Client struct {
 	client    *whatsmeow.Client
 	container *sqlstore.Container
+	vault     *sessionVault // persists an encrypted session store, if any
 	status    Status
 	latestQR  string
 	qrChan    <-chan whatsmeow.QRChannelItem
@@ -42,36 +49,112 @@ type Client struct {
 	startTime time.Time
 	dataDir   string
 
+	// dirMode and fileMode are the permissions of the media and avatar
+	// directories and files.
+	dirMode  os.FileMode
+	fileMode os.FileMode
+
+	// maxTextLength splits longer texts given to Send (0 = never).
+	maxTextLength int
+
+	// dryRun logs sends instead of delivering them.
+	dryRun bool
+
+	// countryCode completes national phone numbers of recipients ("" =
+	// leave them as they are).
+	countryCode string
+
+	// dropReason says why WhatsApp ended the session (DropLoggedOut or
+	// DropStreamReplaced); cleared once connected again.
+	dropReason string
+
+	// manual is set by DisconnectManually and cleared by ResumeConnecting;
+	// while it is set Connect refuses, so the reconnect loop leaves the
+	// connection closed.
+	manual bool
+
+	// groupNames caches joined group names for ResolveGroupName.
+	groupNames groupNameCache
+
+	// groupInfos caches the group info of incoming group messages.
+	groupInfos groupInfoCache
+
+	// newsletterNames caches the names of channels posts arrive from.
+	newsletterNames newsletterNameCache
+
+	// events streams what happens to API subscribers.
+	events *EventBus
+
+	// activity tracks the last received event and successful send.
+	activity activity
+
+	// typed tracks the messages SendTyped has yet to send.
+	typed typedSends
+
 	// Set externally before Connect.
 	eventHandler func(evt interface{})
 }
 
 // NewClient creates a new bridge Client backed by an SQLite session store
-// in dataDir/sessions. The store is opened immediately so that session
-// presence can be checked before connecting.
-func NewClient(dataDir string, log *slog.Logger) (*Client, error) {
+// in dataDir/sessions, encrypted with keys if they are set. The store is
+// opened immediately so that session presence can be checked before
+// connecting. Close releases it.
+func NewClient(dataDir string, keys SessionKeys, log *slog.Logger) (*Client, error) {
 	storeDir := filepath.Join(dataDir, "sessions")
-	if err := os.MkdirAll(storeDir, 0o755); err != nil {
+	if err := os.MkdirAll(storeDir, sessionDirMode); err != nil {
 		return nil, fmt.Errorf("create sessions dir: %w", err)
 	}
+	if err := restrictSessions(storeDir); err != nil {
+		return nil, err
+	}
 
-	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)",
-		filepath.Join(storeDir, "whatsapp.db"))
-
-	container, err := sqlstore.New(context.Background(), "sqlite", dsn, waLog.Noop)
+	dbPath := filepath.Join(storeDir, "whatsapp.db")
+	db, vault, err := openSessionDB(dbPath, keys, log)
 	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)", dbPath)
+		if db, err = sql.Open("sqlite", dsn); err != nil {
+			return nil, fmt.Errorf("open sqlstore: %w", err)
+		}
+	}
+	container := sqlstore.NewWithDB(db, "sqlite", waLog.Noop)
+	if err := container.Upgrade(context.Background()); err != nil {
+		if vault != nil {
+			vault.close()
+		}
+		db.Close()
 		return nil, fmt.Errorf("open sqlstore: %w", err)
 	}
 
 	return &Client{
-		container: container,
-		status:    StatusDisconnected,
-		log:       log,
-		startTime: time.Now(),
-		dataDir:   dataDir,
+		container:     container,
+		vault:         vault,
+		status:        StatusDisconnected,
+		log:           log,
+		startTime:     time.Now(),
+		dataDir:       dataDir,
+		dirMode:       sessionDirMode,
+		fileMode:      sessionFileMode,
+		maxTextLength: DefaultMaxTextLength,
+		groupInfos:    groupInfoCache{ttl: DefaultGroupInfoTTL},
+		events:        NewEventBus(DefaultEventBuffer),
 	}, nil
 }
 
+// Events returns the bus on which the client publishes incoming messages,
+// receipts and connection changes.
+func (c *Client) Events() *EventBus {
+	return c.events
+}
+
+// SetMaxTextLength sets the number of characters above which Send splits a
+// text into several messages (0 disables splitting).
+func (c *Client) SetMaxTextLength(n int) {
+	c.maxTextLength = n
+}
+
 // SetEventHandler sets the handler function that will receive all whatsmeow
 // events. Must be called before Connect.
 func (c *Client) SetEventHandler(handler func(evt interface{})) {
@@ -80,6 +163,14 @@ func (c *Client) SetEventHandler(handler func(evt interface{})) {
 	c.eventHandler = handler
 }
 
+// ErrManuallyDisconnected is returned by Connect after DisconnectManually,
+// until ResumeConnecting is called.
+var ErrManuallyDisconnected = errors.New("disconnected on request")
+
+// ErrNotConnected is returned by calls that need a live connection to
+// WhatsApp while there is none.
+var ErrNotConnected = errors.New("client is not connected")
+
 // Connect establishes the WhatsApp connection. If the device has no stored
 // session, it initiates QR code pairing; otherwise it reconnects using the
 // existing session. Connect is safe to call multiple times.
@@ -89,6 +180,10 @@ func (c *Client) Connect(ctx context.Context) error {
 		c.mu.Unlock()
 		return nil
 	}
+	if c.manual {
+		c.mu.Unlock()
+		return ErrManuallyDisconnected
+	}
 	c.status = StatusConnecting
 	c.mu.Unlock()
 
@@ -102,6 +197,7 @@ func (c *Client) Connect(ctx context.Context) error {
 	cli := whatsmeow.NewClient(deviceStore, waLog.Noop)
 
 	c.mu.Lock()
+	cli.AddEventHandler(c.activity.touchEvent)
 	if c.eventHandler != nil {
 		cli.AddEventHandler(c.eventHandler)
 	}
@@ -197,6 +293,49 @@ func (c *Client) Disconnect() {
 	c.latestQR = ""
 }
 
+// Close closes the session store, writing it out first if it is encrypted.
+// The client must be disconnected.
+func (c *Client) Close() error {
+	var err error
+	if c.vault != nil {
+		err = c.vault.close()
+	}
+	if cerr := c.container.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// DisconnectManually disconnects and keeps the client disconnected: the
+// reconnect loop leaves it alone until ResumeConnecting is called. It is meant
+// for maintenance, such as letting another instance use the session for a
+// while.
+func (c *Client) DisconnectManually() {
+	c.mu.Lock()
+	c.manual = true
+	c.mu.Unlock()
+	c.Disconnect()
+	c.events.Publish(EventConnection, &ConnectionEvent{Status: string(StatusManuallyDisconnected)})
+	c.log.Info("disconnected from WhatsApp on request")
+}
+
+// ResumeConnecting ends a manual disconnect, so that Connect and the
+// reconnect loop connect again.
+func (c *Client) ResumeConnecting() {
+	c.mu.Lock()
+	c.manual = false
+	c.mu.Unlock()
+}
+
+// ManuallyDisconnected reports whether the client was disconnected with
+// DisconnectManually and not resumed since. Thread-safe. Implements the
+// Reconnectable interface.
+func (c *Client) ManuallyDisconnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.manual
+}
+
 // Logout logs out the current session and disconnects. The stored session
 // is removed so the next Connect will require a fresh QR scan.
 func (c *Client) Logout() error {
@@ -259,9 +398,26 @@ func (c *Client) GetStatus() Status {
 	if c.status == StatusConnecting {
 		return StatusConnecting
 	}
+	if c.manual {
+		return StatusManuallyDisconnected
+	}
 	return StatusDisconnected
 }
 
+// Reasons WhatsApp ended a session, reported by DropReason.
+const (
+	DropLoggedOut      = "logged_out"      // the device was unlinked
+	DropStreamReplaced = "stream_replaced" // another client took over the session
+)
+
+// DropReason returns why WhatsApp last ended the session, or "" if it has
+// not since the last successful connection. Thread-safe.
+func (c *Client) DropReason() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dropReason
+}
+
 // GetLatestQR returns the most recent QR code string for pairing, or an
 // empty string if no QR is currently available. Thread-safe.
 func (c *Client) GetLatestQR() string {
@@ -294,56 +450,56 @@ func (c *Client) GetStartTime() time.Time {
 	return c.startTime
 }
 
-// SendText sends a plain text message to the specified JID or phone number.
-func (c *Client) SendText(ctx context.Context, to string, message string) error {
-	if c.client == nil || !c.client.IsConnected() {
-		return fmt.Errorf("client is not connected")
-	}
-
-	jid, err := parseJID(to)
-	if err != nil {
-		return fmt.Errorf("parse recipient JID: %w", err)
-	}
-
-	msg := &waProto.Message{
-		Conversation: proto.String(message),
-	}
-
-	_, err = c.client.SendMessage(ctx, jid, msg)
-	if err != nil {
-		return fmt.Errorf("send text message: %w", err)
-	}
+// SentMessage describes a message accepted by WhatsApp's servers.
+type SentMessage struct {
+	ID        string
+	ChatJID   string
+	SenderJID string
+	Timestamp time.Time // server timestamp from the acknowledgement
+	ServerID  int       // server-assigned ID, for channel messages only
+	Content   string    // text of this message, for texts; one part of a split text
+	DryRun    bool      // logged but not sent; ID is made up
+	QuotedID  string    // message the sent message quotes, if any
+}
 
-	return nil
+// Quote identifies a message a reply quotes.
+type Quote struct {
+	ID        string
+	SenderJID string // author of the quoted message
+	Content   string // text shown in the quote bubble
 }
 
-// SendFile uploads and sends a media file (image, video, audio, or document)
-// to the specified JID or phone number. The media type is inferred from the
-// provided MIME type.
-func (c *Client) SendFile(ctx context.Context, to string, data []byte, mimetype, filename, caption string) error {
-	if c.client == nil || !c.client.IsConnected() {
-		return fmt.Errorf("client is not connected")
+// contextInfo returns the message context that makes a message quote q.
+func (q *Quote) contextInfo() *waProto.ContextInfo {
+	info := &waProto.ContextInfo{
+		StanzaID:      proto.String(q.ID),
+		QuotedMessage: &waProto.Message{Conversation: proto.String(q.Content)},
 	}
-
-	jid, err := parseJID(to)
-	if err != nil {
-		return fmt.Errorf("parse recipient JID: %w", err)
+	if sender, err := types.ParseJID(q.SenderJID); err == nil {
+		info.Participant = proto.String(sender.ToNonAD().String())
 	}
+	return info
+}
 
+// fileMessage uploads f and builds its message: an image, video, audio or
+// document message depending on its MIME type. Ogg/Opus audio becomes a
+// voice note.
+func (c *Client) fileMessage(ctx context.Context, f *File, caption string) (*waProto.Message, error) {
+	mimetype, filename, size := f.Mimetype, f.Filename, uint64(f.size())
 	var msg *waProto.Message
 
 	switch {
 	case isImage(mimetype):
-		resp, err := c.client.Upload(ctx, data, whatsmeow.MediaImage)
+		resp, err := c.uploadFile(ctx, f, whatsmeow.MediaImage)
 		if err != nil {
-			return fmt.Errorf("upload image: %w", err)
+			return nil, fmt.Errorf("upload image: %w", err)
 		}
 		msg = &waProto.Message{
 			ImageMessage: &waProto.ImageMessage{
 				URL:           proto.String(resp.URL),
 				Mimetype:      proto.String(mimetype),
 				Caption:       proto.String(caption),
-				FileLength:    proto.Uint64(uint64(len(data))),
+				FileLength:    proto.Uint64(size),
 				FileSHA256:    resp.FileSHA256,
 				FileEncSHA256: resp.FileEncSHA256,
 				MediaKey:      resp.MediaKey,
@@ -352,16 +508,16 @@ func (c *Client) SendFile(ctx context.Context, to string, data []byte, mimetype,
 		}
 
 	case isVideo(mimetype):
-		resp, err := c.client.Upload(ctx, data, whatsmeow.MediaVideo)
+		resp, err := c.uploadFile(ctx, f, whatsmeow.MediaVideo)
 		if err != nil {
-			return fmt.Errorf("upload video: %w", err)
+			return nil, fmt.Errorf("upload video: %w", err)
 		}
 		msg = &waProto.Message{
 			VideoMessage: &waProto.VideoMessage{
 				URL:           proto.String(resp.URL),
 				Mimetype:      proto.String(mimetype),
 				Caption:       proto.String(caption),
-				FileLength:    proto.Uint64(uint64(len(data))),
+				FileLength:    proto.Uint64(size),
 				FileSHA256:    resp.FileSHA256,
 				FileEncSHA256: resp.FileEncSHA256,
 				MediaKey:      resp.MediaKey,
@@ -370,27 +526,52 @@ func (c *Client) SendFile(ctx context.Context, to string, data []byte, mimetype,
 		}
 
 	case isAudio(mimetype):
-		resp, err := c.client.Upload(ctx, data, whatsmeow.MediaAudio)
+		// A voice note's duration and waveform are read from its contents.
+		// Voice notes are small, so a streamed one is read into memory.
+		var voice []byte
+		if f.Reader == nil || mimetype == OpusVoiceMimetype {
+			var err error
+			if voice, err = f.contents(); err != nil {
+				return nil, fmt.Errorf("read audio: %w", err)
+			}
+		}
+		resp, err := c.uploadFile(ctx, f, whatsmeow.MediaAudio)
 		if err != nil {
-			return fmt.Errorf("upload audio: %w", err)
+			return nil, fmt.Errorf("upload audio: %w", err)
 		}
 		msg = &waProto.Message{
 			AudioMessage: &waProto.AudioMessage{
 				URL:           proto.String(resp.URL),
 				Mimetype:      proto.String(mimetype),
-				FileLength:    proto.Uint64(uint64(len(data))),
+				FileLength:    proto.Uint64(size),
 				FileSHA256:    resp.FileSHA256,
 				FileEncSHA256: resp.FileEncSHA256,
 				MediaKey:      resp.MediaKey,
 				DirectPath:    proto.String(resp.DirectPath),
 			},
 		}
+		// Ogg/Opus audio goes out as a voice note with its duration and
+		// waveform. If the duration cannot be read it is sent as plain
+		// audio; if only the audio cannot be decoded, without waveform.
+		if IsOpusOgg(voice) {
+			if seconds, err := voiceNoteDuration(voice); err == nil {
+				msg.AudioMessage.PTT = proto.Bool(true)
+				msg.AudioMessage.Seconds = proto.Uint32(seconds)
+				if waveform, err := voiceNoteWaveform(voice); err == nil {
+					msg.AudioMessage.Waveform = waveform
+				} else {
+					c.log.Warn("could not decode voice note, sending without waveform", "error", err)
+				}
+			} else {
+				c.log.Warn("could not read voice note, sending as plain audio", "error", err)
+			}
+		}
 
 	default:
 		// Treat everything else as a document.
-		resp, err := c.client.Upload(ctx, data, whatsmeow.MediaDocument)
+		resp, err := c.uploadFile(ctx, f, whatsmeow.MediaDocument)
 		if err != nil {
-			return fmt.Errorf("upload document: %w", err)
+			return nil, fmt.Errorf("upload document: %w", err)
 		}
 		msg = &waProto.Message{
 			DocumentMessage: &waProto.DocumentMessage{
@@ -398,7 +579,7 @@ func (c *Client) SendFile(ctx context.Context, to string, data []byte, mimetype,
 				Mimetype:      proto.String(mimetype),
 				Title:         proto.String(caption),
 				FileName:      proto.String(filename),
-				FileLength:    proto.Uint64(uint64(len(data))),
+				FileLength:    proto.Uint64(size),
 				FileSHA256:    resp.FileSHA256,
 				FileEncSHA256: resp.FileEncSHA256,
 				MediaKey:      resp.MediaKey,
@@ -407,20 +588,76 @@ func (c *Client) SendFile(ctx context.Context, to string, data []byte, mimetype,
 		}
 	}
 
-	_, err = c.client.SendMessage(ctx, jid, msg)
+	return msg, nil
+}
+
+// RevokeMessage deletes one of our own messages for everyone in the chat and
+// returns the revoke as sent. In a dry run the revoke is only logged.
+func (c *Client) RevokeMessage(ctx context.Context, chatJID, msgID string) (*SentMessage, error) {
+	if err := c.canSend(ctx); err != nil {
+		return nil, err
+	}
+
+	jid, err := c.recipientJID(chatJID)
 	if err != nil {
-		return fmt.Errorf("send file message: %w", err)
+		return nil, fmt.Errorf("parse chat JID: %w", err)
 	}
 
-	return nil
+	// BuildRevoke works on a nil client when no sender is given.
+	resp, err := c.send(ctx, jid, c.client.BuildRevoke(jid, types.EmptyJID, msgID), "")
+	if err != nil {
+		return nil, fmt.Errorf("revoke message: %w", err)
+	}
+	return c.sentMessage(jid, resp), nil
+}
+
+// sentMessage converts a whatsmeow send response into a SentMessage.
+func (c *Client) sentMessage(to types.JID, resp whatsmeow.SendResponse) *SentMessage {
+	sender := resp.Sender
+	if sender.IsEmpty() && c.client != nil && c.client.Store.ID != nil {
+		sender = *c.client.Store.ID
+	}
+	return &SentMessage{
+		ID:        resp.ID,
+		ChatJID:   to.String(),
+		SenderJID: sender.ToNonAD().String(),
+		Timestamp: resp.Timestamp,
+		ServerID:  int(resp.ServerID),
+		DryRun:    isDryRunID(resp.ID),
+	}
+}
+
+// FailedMessage describes a message to the specified JID or phone number that
+// could not be sent, under a new message ID, so that the attempt can be
+// recorded and retried. It fails only if to is not a valid recipient.
+func (c *Client) FailedMessage(to string) (*SentMessage, error) {
+	jid, err := c.recipientJID(to)
+	if err != nil {
+		return nil, fmt.Errorf("parse recipient JID: %w", err)
+	}
+
+	// GenerateMessageID works on a nil or disconnected client.
+	var sender string
+	if c.client != nil && c.client.Store.ID != nil {
+		sender = c.client.Store.ID.ToNonAD().String()
+	}
+	return &SentMessage{
+		ID:        c.client.GenerateMessageID(),
+		ChatJID:   jid.String(),
+		SenderJID: sender,
+		Timestamp: time.Now(),
+	}, nil
 }
 
 // --- helpers ----------------------------------------------------------------
 
-// parseJID converts a string to a types.JID. If the string contains "@" it is
-// parsed as a full JID; otherwise it is treated as a phone number (leading "+"
-// or "00" stripped, non-digit characters removed) on the default user server.
-func parseJID(s string) (types.JID, error) {
+// parseJIDIn converts a string to a types.JID. If the string contains "@" it
+// is parsed as a full JID; otherwise it is treated as a phone number (leading
+// "+" or "00" stripped, non-digit characters removed) on the default user
+// server. countryCode, the calling code of the user's country, is prepended
+// to numbers that look national (see withCountryCode); "" leaves numbers as
+// they are.
+func parseJIDIn(s, countryCode string) (types.JID, error) {
 	if s == "" {
 		return types.JID{}, fmt.Errorf("empty JID")
 	}
@@ -434,9 +671,10 @@ func parseJID(s string) (types.JID, error) {
 	}
 
 	// Treat as phone number.
-	cleaned := s
-	cleaned = strings.TrimPrefix(cleaned, "+")
+	trimmed := strings.TrimSpace(s)
+	cleaned := strings.TrimPrefix(trimmed, "+")
 	cleaned = strings.TrimPrefix(cleaned, "00")
+	international := cleaned != trimmed
 
 	// Strip any remaining non-digit characters.
 	var digits strings.Builder
@@ -450,6 +688,9 @@ func parseJID(s string) (types.JID, error) {
 	if num == "" {
 		return types.JID{}, fmt.Errorf("no digits in JID %q", s)
 	}
+	if !international {
+		num = withCountryCode(num, countryCode)
+	}
 
 	return types.NewJID(num, types.DefaultUserServer), nil
 }
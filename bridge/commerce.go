@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"fmt"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// Product describes a catalog item shared in a product message. Prices are
+// in the currency's major unit (WhatsApp transmits thousandths).
+type Product struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	Price       float64 `json:"price,omitempty"`
+	SalePrice   float64 `json:"sale_price,omitempty"`
+	Currency    string  `json:"currency,omitempty"`
+	RetailerID  string  `json:"retailer_id,omitempty"`
+	URL         string  `json:"url,omitempty"`
+	BusinessJID string  `json:"business_jid,omitempty"`
+}
+
+// Order describes a cart sent to a business as an order message.
+type Order struct {
+	ID        string  `json:"id"`
+	Title     string  `json:"title,omitempty"`
+	ItemCount int     `json:"item_count"`
+	Status    string  `json:"status,omitempty"` // inquiry, accepted or declined
+	Total     float64 `json:"total,omitempty"`
+	Currency  string  `json:"currency,omitempty"`
+	Message   string  `json:"message,omitempty"`
+	SellerJID string  `json:"seller_jid,omitempty"`
+}
+
+// productFromProto extracts the product shared in pm.
+func productFromProto(pm *waProto.ProductMessage) *Product {
+	snap := pm.GetProduct()
+	return &Product{
+		ID:          snap.GetProductID(),
+		Title:       snap.GetTitle(),
+		Description: snap.GetDescription(),
+		Price:       fromThousandths(snap.GetPriceAmount1000()),
+		SalePrice:   fromThousandths(snap.GetSalePriceAmount1000()),
+		Currency:    snap.GetCurrencyCode(),
+		RetailerID:  snap.GetRetailerID(),
+		URL:         snap.GetURL(),
+		BusinessJID: pm.GetBusinessOwnerJID(),
+	}
+}
+
+// orderFromProto extracts the order in om.
+func orderFromProto(om *waProto.OrderMessage) *Order {
+	return &Order{
+		ID:        om.GetOrderID(),
+		Title:     om.GetOrderTitle(),
+		ItemCount: int(om.GetItemCount()),
+		Status:    strings.ToLower(om.GetStatus().String()),
+		Total:     fromThousandths(om.GetTotalAmount1000()),
+		Currency:  om.GetTotalCurrencyCode(),
+		Message:   om.GetMessage(),
+		SellerJID: om.GetSellerJID(),
+	}
+}
+
+// Summary is the product's stored message content, e.g. "Blue mug (12.50 EUR)".
+func (p *Product) Summary() string {
+	if p.Price == 0 {
+		return p.Title
+	}
+	return fmt.Sprintf("%s (%.2f %s)", p.Title, p.Price, p.Currency)
+}
+
+// Summary is the order's stored message content, e.g.
+// "Order: 3 items, 40.00 EUR".
+func (o *Order) Summary() string {
+	title := o.Title
+	if title == "" {
+		title = "Order"
+	}
+	items := "items"
+	if o.ItemCount == 1 {
+		items = "item"
+	}
+	s := fmt.Sprintf("%s: %d %s", title, o.ItemCount, items)
+	if o.Total != 0 {
+		s += fmt.Sprintf(", %.2f %s", o.Total, o.Currency)
+	}
+	if o.Message != "" {
+		s += "\n" + o.Message
+	}
+	return s
+}
+
+func fromThousandths(v int64) float64 {
+	return float64(v) / 1000
+}
@@ -0,0 +1,59 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// SyncContacts re-fetches the contact list from WhatsApp's app state and
+// returns the number of contacts known afterwards. It performs a full resync
+// of the patch collection holding contacts and returns once whatsmeow has
+// applied it and emitted its sync complete event, or when ctx expires.
+func (c *Client) SyncContacts(ctx context.Context) (int, error) {
+	if c.client == nil || !c.client.IsConnected() {
+		return 0, fmt.Errorf("client is not connected")
+	}
+
+	if err := c.client.FetchAppState(ctx, appstate.WAPatchCriticalUnblockLow, true, false); err != nil {
+		return 0, fmt.Errorf("sync contacts: %w", err)
+	}
+
+	contacts, err := c.client.Store.Contacts.GetAllContacts(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("sync contacts: %w", err)
+	}
+	return len(contacts), nil
+}
+
+// verifiedNameBatch is the number of users looked up per user info query.
+const verifiedNameBatch = 100
+
+// VerifiedNames looks up the verified business names of jids on WhatsApp's
+// servers. Users without one, which includes every non-business account,
+// are left out of the result.
+func (c *Client) VerifiedNames(ctx context.Context, jids []types.JID) (map[types.JID]string, error) {
+	if c.client == nil || !c.client.IsConnected() {
+		return nil, fmt.Errorf("client is not connected")
+	}
+
+	names := make(map[types.JID]string)
+	for start := 0; start < len(jids); start += verifiedNameBatch {
+		end := min(start+verifiedNameBatch, len(jids))
+		infos, err := c.client.GetUserInfo(ctx, jids[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("get user info: %w", err)
+		}
+		for jid, info := range infos {
+			if info.VerifiedName == nil {
+				continue
+			}
+			if name := info.VerifiedName.Details.GetVerifiedName(); name != "" {
+				names[jid] = name
+			}
+		}
+	}
+	return names, nil
+}
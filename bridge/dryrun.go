@@ -0,0 +1,110 @@
+package bridge
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// DryRunIDPrefix starts the made-up IDs of messages sent in a dry run.
+const DryRunIDPrefix = "DRYRUN-"
+
+// dryRunKey marks a context whose sends are dry runs.
+type dryRunKey struct{}
+
+// WithDryRun returns a context under which sends are validated and logged
+// but never reach WhatsApp.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// SetDryRun makes every send a dry run, whatever its context.
+func (c *Client) SetDryRun(on bool) {
+	c.dryRun = on
+}
+
+// isDryRun reports whether sends under ctx are dry runs.
+func (c *Client) isDryRun(ctx context.Context) bool {
+	on, _ := ctx.Value(dryRunKey{}).(bool)
+	return c.dryRun || on
+}
+
+// canSend returns an error unless messages can be sent under ctx. Dry runs
+// do not need a connection.
+func (c *Client) canSend(ctx context.Context) error {
+	if c.isDryRun(ctx) {
+		return nil
+	}
+	if c.client == nil || !c.client.IsConnected() {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// send delivers msg to jid, as the message with the given ID if it is set.
+// In a dry run it logs the message instead and returns a response with a
+// made-up ID.
+func (c *Client) send(ctx context.Context, jid types.JID, msg *waProto.Message, id string) (whatsmeow.SendResponse, error) {
+	if !c.isDryRun(ctx) {
+		resp, err := c.client.SendMessage(ctx, jid, msg, whatsmeow.SendRequestExtra{ID: types.MessageID(id)})
+		if err == nil {
+			c.activity.touchSend()
+		}
+		return resp, err
+	}
+
+	if id == "" {
+		id = c.newMessageID(ctx)
+	}
+	resp := whatsmeow.SendResponse{
+		ID:        id,
+		Timestamp: time.Now(),
+	}
+	c.log.Info("dry run: message not sent", "to", jid.String(), "message_id", resp.ID, "message", msg.String())
+	return resp, nil
+}
+
+// newMessageID returns an ID for a message about to be sent, marked as
+// made up in a dry run.
+func (c *Client) newMessageID(ctx context.Context) string {
+	// GenerateMessageID works on a nil client.
+	id := c.client.GenerateMessageID()
+	if c.isDryRun(ctx) {
+		return DryRunIDPrefix + id
+	}
+	return id
+}
+
+// upload uploads media for sending. In a dry run nothing is uploaded and the
+// response is empty.
+func (c *Client) upload(ctx context.Context, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	if c.isDryRun(ctx) {
+		return whatsmeow.UploadResponse{}, nil
+	}
+	return c.client.Upload(ctx, data, mediaType)
+}
+
+// uploadFile uploads f for sending, streaming it from its Reader if it has
+// one. In a dry run nothing is uploaded and the response is empty.
+func (c *Client) uploadFile(ctx context.Context, f *File, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	if f.Reader == nil {
+		return c.upload(ctx, f.Data, mediaType)
+	}
+	if c.isDryRun(ctx) {
+		return whatsmeow.UploadResponse{}, nil
+	}
+	if _, err := f.Reader.Seek(0, io.SeekStart); err != nil {
+		return whatsmeow.UploadResponse{}, err
+	}
+	return c.client.UploadReader(ctx, f.Reader, nil, mediaType)
+}
+
+// isDryRunID reports whether id was made up by a dry run.
+func isDryRunID(id string) bool {
+	return strings.HasPrefix(id, DryRunIDPrefix)
+}
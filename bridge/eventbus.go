@@ -0,0 +1,198 @@
+package bridge
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published on the event bus.
+const (
+	EventMessage    = "message"    // an incoming message; Data is its WebhookPayload
+	EventReceipt    = "receipt"    // our messages were delivered or read; Data is a ReceiptEvent
+	EventConnection = "connection" // the connection status changed; Data is a ConnectionEvent
+	EventCircuit    = "circuit"    // a circuit breaker opened, half-opened or closed; Data is a CircuitEvent
+	EventIdentity   = "identity"   // a contact's security code changed; Data is an IdentityEvent
+)
+
+// DefaultEventBuffer is how many recent events an EventBus keeps for
+// subscribers resuming after a disconnect.
+const DefaultEventBuffer = 1000
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 64
+
+// Event is the envelope of everything streamed to event subscribers.
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time int64       `json:"time"` // unix milliseconds
+	Data interface{} `json:"data"`
+}
+
+// ReceiptEvent reports that a contact received or read our messages.
+type ReceiptEvent struct {
+	ChatJID     string   `json:"chat_jid"`
+	Participant string   `json:"participant"`
+	MessageIDs  []string `json:"message_ids"`
+	Kind        string   `json:"kind"` // delivered or read
+	Timestamp   int64    `json:"timestamp"`
+}
+
+// ConnectionEvent reports a change of the connection status, with the
+// reason WhatsApp ended the session, if it did.
+type ConnectionEvent struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// IdentityEvent reports that a contact's security code changed, because
+// they switched phones or reinstalled WhatsApp. Implicit is set when the
+// change was only noticed through a message that failed to decrypt.
+type IdentityEvent struct {
+	JID       string `json:"jid"`
+	Timestamp int64  `json:"timestamp"`
+	Implicit  bool   `json:"implicit,omitempty"`
+}
+
+// CircuitEvent reports a state change of the circuit breaker named
+// Circuit, such as the webhook's.
+type CircuitEvent struct {
+	Circuit string `json:"circuit"`
+	CircuitState
+}
+
+// EventBus fans events out to any number of subscribers and keeps the most
+// recent ones so that a subscriber can resume where it left off. Event IDs
+// start at the bus's creation time in milliseconds, so IDs from an earlier
+// run of the bridge are older than any of the current run.
+type EventBus struct {
+	mu     sync.Mutex
+	nextID uint64
+	recent []Event // ring buffer, oldest at head once full
+	head   int
+	subs   map[chan Event]struct{}
+	closed chan struct{} // closed by Close
+}
+
+// NewEventBus returns a bus keeping the last size events; 0 selects
+// DefaultEventBuffer.
+func NewEventBus(size int) *EventBus {
+	if size <= 0 {
+		size = DefaultEventBuffer
+	}
+	return &EventBus{
+		nextID: uint64(time.Now().UnixMilli()),
+		recent: make([]Event, 0, size),
+		subs:   make(map[chan Event]struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber. A subscriber too far behind
+// to take it is dropped, its channel closed, rather than holding up the
+// others; it can resubscribe from the last event it saw.
+func (b *EventBus) Publish(typ string, data interface{}) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.isClosed() {
+		return
+	}
+
+	ev := Event{ID: b.nextID, Type: typ, Time: time.Now().UnixMilli(), Data: data}
+	b.nextID++
+	if len(b.recent) < cap(b.recent) {
+		b.recent = append(b.recent, ev)
+	} else {
+		b.recent[b.head] = ev
+		b.head = (b.head + 1) % len(b.recent)
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a subscriber. With a non-zero after it also returns
+// the buffered events following the event with that ID, and complete is
+// false when some of those are no longer buffered. Events arrive on the
+// channel until cancel is called or the subscriber falls behind, when it is
+// closed. On a closed bus the channel is closed from the start.
+func (b *EventBus) Subscribe(after uint64) (missed []Event, complete bool, events <-chan Event, cancel func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	complete = true
+	if after > 0 {
+		n := len(b.recent)
+		for i := 0; i < n; i++ {
+			ev := b.recent[(b.head+i)%n]
+			if ev.ID > after {
+				missed = append(missed, ev)
+			}
+		}
+		// The event after the one seen must still be buffered, or be
+		// the next one to come.
+		if after+1 < b.nextID && (len(missed) == 0 || missed[0].ID != after+1) {
+			complete = false
+		}
+	}
+	if b.isClosed() {
+		close(ch)
+	} else {
+		b.subs[ch] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return missed, complete, ch, cancel
+}
+
+// Close shuts the bus down at the end of the run: later events are
+// dropped, later subscribers get a closed channel, and the channels of the
+// current subscribers are closed. Events already on those channels can
+// still be received before they report closed, so subscribers get to pass
+// them on. Close may be called more than once.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.isClosed() {
+		return
+	}
+	close(b.closed)
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Closed returns a channel that is closed once Close is called, so a
+// subscriber can tell a shutdown from being dropped for falling behind.
+func (b *EventBus) Closed() <-chan struct{} {
+	return b.closed
+}
+
+// isClosed reports whether Close was called. b.mu must be held.
+func (b *EventBus) isClosed() bool {
+	select {
+	case <-b.closed:
+		return true
+	default:
+		return false
+	}
+}
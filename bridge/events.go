@@ -4,28 +4,116 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 
 	"github.com/openclaw/whatsapp/store"
 )
 
+// Media download modes.
+const (
+	MediaDownloadEager = "eager" // download media as soon as the message arrives
+	MediaDownloadLazy  = "lazy"  // store keys only; download on first request
+)
+
+// HandlerOptions tunes how MakeEventHandler processes incoming messages.
+type HandlerOptions struct {
+	// MediaDownloadMode is MediaDownloadEager (default) or MediaDownloadLazy.
+	MediaDownloadMode string
+
+	// BlankRevoked clears the stored content of messages deleted for
+	// everyone, rather than only flagging them as revoked.
+	BlankRevoked bool
+
+	// OrderedDelivery delivers webhooks and runs the agent one message at a
+	// time per chat, in receipt order. Different chats still proceed in
+	// parallel.
+	OrderedDelivery bool
+
+	// SkipSystemMessages drops chat notifications, such as disappearing
+	// message setting changes, instead of storing them as system messages.
+	SkipSystemMessages bool
+
+	// MediaSigner, if set, adds signed media URLs to webhook payloads.
+	MediaSigner *MediaSigner
+
+	// Workers processes messages and receipts off whatsmeow's event
+	// goroutine, in order per chat. Nil processes them synchronously.
+	Workers *EventWorkers
+
+	// MessageLogLevel is the level of the "message processed" log written
+	// for every incoming message; the zero value is info. Busy bridges
+	// demote it to debug without losing connection and agent logs.
+	MessageLogLevel slog.Level
+
+	// ReadReceipts, if set, marks every stored incoming message as read
+	// (read_receipts: on_receive).
+	ReadReceipts *ReadReceipts
+}
+
 // MakeEventHandler returns an event handler function suitable for use with
 // whatsmeow's AddEventHandler. It processes incoming WhatsApp events, persists
 // messages to msgStore, forwards them to the webhook, and triggers the agent.
-func MakeEventHandler(client *Client, msgStore *store.MessageStore, webhook *WebhookSender, agent *AgentTrigger, log *slog.Logger) func(evt interface{}) {
+func MakeEventHandler(client *Client, msgStore *store.MessageStore, webhook *WebhookSender, agent *AgentTrigger, opts HandlerOptions, log *slog.Logger) func(evt interface{}) {
+	var queue *chatQueue
+	if opts.OrderedDelivery {
+		queue = newChatQueue()
+	}
+
 	return func(evt interface{}) {
 		switch v := evt.(type) {
 		case *events.Message:
-			handleMessage(client, v, msgStore, webhook, agent, log)
+			opts.Workers.Dispatch(v.Info.Chat.String(), func() {
+				handleMessage(client, v, msgStore, webhook, agent, opts, queue, log)
+			})
+
+		case *events.Receipt:
+			opts.Workers.Dispatch(v.Chat.String(), func() {
+				handleReceipt(client, v, msgStore, log)
+			})
+
+		case *events.HistorySync:
+			handleHistorySync(client, v, msgStore, log)
+
+		case *events.GroupInfo:
+			client.groupInfos.forget(v.JID)
+			if v.Name != nil {
+				client.forgetGroupNames()
+			}
+			opts.Workers.Dispatch(v.JID.String(), func() {
+				handleGroupInfo(client, v, msgStore, log)
+			})
+
+		case *events.Archive:
+			handleArchive(v, msgStore, log)
+
+		case *events.Pin:
+			handlePin(v, msgStore, log)
+
+		case *events.Mute:
+			handleMute(v, msgStore, log)
+
+		case *events.IdentityChange:
+			opts.Workers.Dispatch(v.JID.ToNonAD().String(), func() {
+				handleIdentityChange(client, v, msgStore, opts, log)
+			})
+
+		case *events.Picture:
+			client.forgetAvatars(v.JID)
+
+		case *events.JoinedGroup:
+			client.groupInfos.forget(v.JID)
+			client.forgetGroupNames()
 
 		case *events.Connected:
 			client.mu.Lock()
 			client.status = StatusConnected
+			client.dropReason = ""
 			if client.client != nil {
 				jid := client.client.Store.ID
 				if jid != nil {
@@ -33,24 +121,30 @@ func MakeEventHandler(client *Client, msgStore *store.MessageStore, webhook *Web
 				}
 			}
 			client.mu.Unlock()
+			client.events.Publish(EventConnection, &ConnectionEvent{Status: string(StatusConnected)})
 
 		case *events.Disconnected:
 			client.mu.Lock()
 			client.status = StatusDisconnected
 			client.mu.Unlock()
+			client.events.Publish(EventConnection, &ConnectionEvent{Status: string(StatusDisconnected)})
 			log.Info("disconnected from WhatsApp")
 
 		case *events.LoggedOut:
 			client.mu.Lock()
 			client.status = StatusDisconnected
+			client.dropReason = DropLoggedOut
 			client.latestQR = ""
 			client.mu.Unlock()
+			client.events.Publish(EventConnection, &ConnectionEvent{Status: string(StatusDisconnected), Reason: DropLoggedOut})
 			log.Warn("logged out from WhatsApp")
 
 		case *events.StreamReplaced:
 			client.mu.Lock()
 			client.status = StatusDisconnected
+			client.dropReason = DropStreamReplaced
 			client.mu.Unlock()
+			client.events.Publish(EventConnection, &ConnectionEvent{Status: string(StatusDisconnected), Reason: DropStreamReplaced})
 			log.Warn("stream replaced — another device connected with this session")
 		}
 	}
@@ -59,7 +153,31 @@ func MakeEventHandler(client *Client, msgStore *store.MessageStore, webhook *Web
 // handleMessage processes a single incoming WhatsApp message event. It skips
 // messages sent by the current user and status broadcasts, extracts content
 // based on message type, persists to the message store, and sends a webhook.
-func handleMessage(client *Client, msg *events.Message, msgStore *store.MessageStore, webhook *WebhookSender, agent *AgentTrigger, log *slog.Logger) {
+func handleMessage(client *Client, msg *events.Message, msgStore *store.MessageStore, webhook *WebhookSender, agent *AgentTrigger, opts HandlerOptions, queue *chatQueue, log *slog.Logger) {
+	// Reactions update the reacted-to message rather than creating a new one.
+	// Our own reactions are recorded too so the API can report them.
+	if reaction := msg.Message.GetReactionMessage(); reaction != nil {
+		handleReaction(msg, reaction, msgStore, log)
+		return
+	}
+	if msg.Message.GetEncReactionMessage() != nil {
+		handleEncReaction(client, msg, msgStore, log)
+		return
+	}
+
+	// Edits replace the content of the original message. Edits made from
+	// our other devices are recorded as well.
+	if pm := msg.Message.GetProtocolMessage(); pm.GetType() == waProto.ProtocolMessage_MESSAGE_EDIT {
+		handleEdit(msg, pm, msgStore, log)
+		return
+	}
+
+	// Deletions for everyone flag the original message.
+	if pm := msg.Message.GetProtocolMessage(); pm.GetType() == waProto.ProtocolMessage_REVOKE {
+		handleRevoke(client, msg, pm, msgStore, opts.BlankRevoked, log)
+		return
+	}
+
 	// Skip messages from ourselves.
 	if msg.Info.IsFromMe {
 		return
@@ -70,83 +188,49 @@ func handleMessage(client *Client, msg *events.Message, msgStore *store.MessageS
 		return
 	}
 
-	// Determine message type and extract content / media path.
-	var (
-		msgType   string
-		content   string
-		mediaPath string
-	)
-
-	m := msg.Message
-	switch {
-	case m.GetConversation() != "":
-		msgType = "text"
-		content = m.GetConversation()
-
-	case m.GetExtendedTextMessage() != nil:
-		msgType = "text"
-		content = m.GetExtendedTextMessage().GetText()
-
-	case m.GetImageMessage() != nil:
-		msgType = "image"
-		img := m.GetImageMessage()
-		content = img.GetCaption()
-		ext := getExtension(img.GetMimetype())
-		mediaPath = downloadMedia(client, img, msg.Info.ID, ext, log)
-
-	case m.GetVideoMessage() != nil:
-		msgType = "video"
-		vid := m.GetVideoMessage()
-		content = vid.GetCaption()
-		ext := getExtension(vid.GetMimetype())
-		mediaPath = downloadMedia(client, vid, msg.Info.ID, ext, log)
-
-	case m.GetAudioMessage() != nil:
-		msgType = "audio"
-		aud := m.GetAudioMessage()
-		ext := getExtension(aud.GetMimetype())
-		mediaPath = downloadMedia(client, aud, msg.Info.ID, ext, log)
-
-	case m.GetDocumentMessage() != nil:
-		msgType = "document"
-		doc := m.GetDocumentMessage()
-		content = doc.GetTitle()
-		ext := getExtension(doc.GetMimetype())
-		mediaPath = downloadMedia(client, doc, msg.Info.ID, ext, log)
-
-	case m.GetStickerMessage() != nil:
-		msgType = "sticker"
-		stk := m.GetStickerMessage()
-		ext := getExtension(stk.GetMimetype())
-		mediaPath = downloadMedia(client, stk, msg.Info.ID, ext, log)
-
-	case m.GetContactMessage() != nil:
-		msgType = "contact"
-		content = m.GetContactMessage().GetDisplayName()
+	// Determine message type and extract content / downloadable media.
+	mc := extractContent(msg.Message)
+	if mc.msgType == "unknown" {
+		log.Debug("received unhandled message type", "message_id", msg.Info.ID)
+	}
+	if mc.msgType == MsgTypeSystem && (mc.content == "" || opts.SkipSystemMessages) {
+		log.Debug("skipping system message", "message_id", msg.Info.ID, "description", mc.content)
+		return
+	}
+	msgType, content, media, mimetype, selected := mc.msgType, mc.content, mc.media, mc.mimetype, mc.selected
 
-	case m.GetLocationMessage() != nil:
-		msgType = "location"
-		loc := m.GetLocationMessage()
-		content = fmt.Sprintf("%.6f,%.6f", loc.GetDegreesLatitude(), loc.GetDegreesLongitude())
+	content = store.SanitizeText(content)
 
-	default:
-		msgType = "unknown"
-		log.Debug("received unhandled message type", "message_id", msg.Info.ID)
+	var mediaPath string
+	if media != nil && opts.MediaDownloadMode != MediaDownloadLazy {
+		mediaPath = downloadMedia(client, media, msg.Info.ID, getExtension(mimetype), log)
 	}
 
 	// Determine chat context.
 	isGroup := msg.Info.Chat.Server == "g.us"
+	isNewsletter := msg.Info.Chat.Server == types.NewsletterServer
 	senderJID := msg.Info.Sender.String()
 	chatJID := msg.Info.Chat.String()
-	senderName := msg.Info.PushName
+	senderName := store.SanitizeText(msg.Info.PushName)
+
+	// Channel posts have no push name; they are attributed to the channel.
+	// Text posts are stored as "newsletter" so they stand apart from chat
+	// messages, while media posts keep their media type for downloads.
+	if isNewsletter {
+		senderName = newsletterName(client, msg.Info.Chat)
+		if msgType == "text" {
+			msgType = "newsletter"
+		}
+	}
 
 	var groupName string
 	if isGroup {
 		// Try to get group info for the name.
-		if client.GetClient() != nil {
-			gi, err := client.GetClient().GetGroupInfo(context.Background(), msg.Info.Chat)
-			if err == nil && gi != nil {
-				groupName = gi.Name
+		gi, fetched, err := client.groupInfo(context.Background(), msg.Info.Chat)
+		if err == nil {
+			groupName = store.SanitizeText(gi.Name)
+			if fetched {
+				recordGroupOnFirstSight(msgStore, gi, log)
 			}
 		}
 	}
@@ -164,6 +248,13 @@ func handleMessage(client *Client, msg *events.Message, msgStore *store.MessageS
 		IsFromMe:   false,
 		IsGroup:    isGroup,
 		GroupName:  groupName,
+		SelectedID: selected,
+		QuotedID:   quotedID(msg.Message),
+
+		SenderPlatform: senderPlatform(&msg.Info),
+	}
+	if media != nil {
+		setMediaKeys(storeMsg, media, mimetype)
 	}
 
 	// Persist the message.
@@ -171,34 +262,54 @@ func handleMessage(client *Client, msg *events.Message, msgStore *store.MessageS
 		log.Error("failed to save message", "error", err, "message_id", msg.Info.ID)
 	}
 
-	// Build and send webhook payload.
-	chatType := "dm"
-	if isGroup {
-		chatType = "group"
+	// System notifications are kept for the chat history only; nobody
+	// wrote them, so they reach neither the webhook nor the agent.
+	if msgType == MsgTypeSystem {
+		log.Debug("system message stored", "message_id", msg.Info.ID, "chat", chatJID, "description", content)
+		return
 	}
 
-	payload := &WebhookPayload{
-		From:      chatJID,
-		Name:      senderName,
-		Message:   content,
-		Timestamp: msg.Info.Timestamp.Unix(),
-		Type:      msgType,
-		MediaURL:  mediaPath,
-		ChatType:  chatType,
-		GroupName: groupName,
-		MessageID: msg.Info.ID,
-	}
+	opts.ReadReceipts.Mark(chatJID, senderJID, msg.Info.ID)
 
-	if err := webhook.Send(payload); err != nil {
-		log.Error("failed to send webhook", "error", err, "message_id", msg.Info.ID)
+	// Build and send webhook payload.
+	payload := webhookPayload(storeMsg, opts.MediaSigner)
+	payload.Product = mc.product
+	payload.Order = mc.order
+	if labels, err := msgStore.GetChatLabels(chatJID); err != nil {
+		log.Error("failed to load chat labels", "error", err, "chat", chatJID)
+	} else {
+		payload.Labels = labels
 	}
+	if muted, err := msgStore.IsChatMuted(chatJID, time.Now()); err != nil {
+		log.Error("failed to load chat mute state", "error", err, "chat", chatJID)
+	} else {
+		payload.Muted = muted
+	}
+	client.events.Publish(EventMessage, payload)
+
+	if queue != nil {
+		// Ordered delivery: the webhook and the agent run on the chat's
+		// queue, and the next message of the chat waits for both.
+		queue.Enqueue(chatJID, func() {
+			if err := webhook.Send(payload); err != nil {
+				log.Error("failed to send webhook", "error", err, "message_id", payload.MessageID)
+			}
+			if agent != nil {
+				agent.TriggerWait(client, payload)
+			}
+		})
+	} else {
+		if err := webhook.Send(payload); err != nil {
+			log.Error("failed to send webhook", "error", err, "message_id", msg.Info.ID)
+		}
 
-	// Trigger agent (async — does not block).
-	if agent != nil {
-		agent.Trigger(client, payload)
+		// Trigger agent (async — does not block).
+		if agent != nil {
+			agent.Trigger(client, payload)
+		}
 	}
 
-	log.Info("message processed",
+	log.Log(context.Background(), opts.MessageLogLevel, "message processed",
 		"message_id", msg.Info.ID,
 		"type", msgType,
 		"from", senderJID,
@@ -207,6 +318,393 @@ func handleMessage(client *Client, msg *events.Message, msgStore *store.MessageS
 	)
 }
 
+// quotedID returns the ID of the message m replies to, or "".
+func quotedID(m *waProto.Message) string {
+	for _, part := range []interface{ GetContextInfo() *waProto.ContextInfo }{
+		m.GetExtendedTextMessage(),
+		m.GetImageMessage(),
+		m.GetVideoMessage(),
+		m.GetAudioMessage(),
+		m.GetDocumentMessage(),
+		m.GetStickerMessage(),
+		m.GetContactMessage(),
+		m.GetLocationMessage(),
+	} {
+		if id := part.GetContextInfo().GetStanzaID(); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// messageContent is what a message carries, independent of who sent it.
+type messageContent struct {
+	msgType  string
+	content  string
+	media    whatsmeow.DownloadableMessage
+	mimetype string
+	selected string // button or row ID chosen in a button_reply or list_reply
+	product  *Product
+	order    *Order
+}
+
+// extractContent determines the type, text and downloadable media of m.
+// Unsupported kinds of message have type "unknown".
+func extractContent(m *waProto.Message) messageContent {
+	var mc messageContent
+	switch {
+	case m.GetConversation() != "":
+		mc.msgType = "text"
+		mc.content = m.GetConversation()
+
+	case m.GetExtendedTextMessage() != nil:
+		mc.msgType = "text"
+		mc.content = m.GetExtendedTextMessage().GetText()
+
+	case m.GetImageMessage() != nil:
+		mc.msgType = "image"
+		img := m.GetImageMessage()
+		mc.content = img.GetCaption()
+		mc.media, mc.mimetype = img, img.GetMimetype()
+
+	case m.GetVideoMessage() != nil:
+		mc.msgType = "video"
+		vid := m.GetVideoMessage()
+		mc.content = vid.GetCaption()
+		mc.media, mc.mimetype = vid, vid.GetMimetype()
+
+	case m.GetAudioMessage() != nil:
+		mc.msgType = "audio"
+		aud := m.GetAudioMessage()
+		mc.media, mc.mimetype = aud, aud.GetMimetype()
+
+	case m.GetDocumentMessage() != nil:
+		mc.msgType = "document"
+		doc := m.GetDocumentMessage()
+		mc.content = doc.GetTitle()
+		mc.media, mc.mimetype = doc, doc.GetMimetype()
+
+	case m.GetStickerMessage() != nil:
+		mc.msgType = "sticker"
+		stk := m.GetStickerMessage()
+		mc.media, mc.mimetype = stk, stk.GetMimetype()
+
+	case m.GetContactMessage() != nil:
+		mc.msgType = "contact"
+		mc.content = m.GetContactMessage().GetDisplayName()
+
+	case m.GetLocationMessage() != nil:
+		mc.msgType = "location"
+		loc := m.GetLocationMessage()
+		mc.content = fmt.Sprintf("%.6f,%.6f", loc.GetDegreesLatitude(), loc.GetDegreesLongitude())
+
+	case m.GetButtonsResponseMessage() != nil:
+		mc.msgType = "button_reply"
+		br := m.GetButtonsResponseMessage()
+		mc.content, mc.selected = br.GetSelectedDisplayText(), br.GetSelectedButtonID()
+
+	case m.GetTemplateButtonReplyMessage() != nil:
+		mc.msgType = "button_reply"
+		tr := m.GetTemplateButtonReplyMessage()
+		mc.content, mc.selected = tr.GetSelectedDisplayText(), tr.GetSelectedID()
+
+	case m.GetListResponseMessage() != nil:
+		mc.msgType = "list_reply"
+		lr := m.GetListResponseMessage()
+		mc.content, mc.selected = lr.GetTitle(), lr.GetSingleSelectReply().GetSelectedRowID()
+
+	case m.GetProductMessage() != nil:
+		mc.msgType = "product"
+		mc.product = productFromProto(m.GetProductMessage())
+		mc.content = mc.product.Summary()
+
+	case m.GetOrderMessage() != nil:
+		mc.msgType = "order"
+		mc.order = orderFromProto(m.GetOrderMessage())
+		mc.content = mc.order.Summary()
+
+	default:
+		mc.msgType = "unknown"
+		if desc, ok := systemContent(m); ok {
+			mc.msgType, mc.content = MsgTypeSystem, desc
+		}
+	}
+	return mc
+}
+
+// senderPlatform tells the kind of device a message was sent from by the
+// shape of its ID, which each WhatsApp client generates in its own way:
+// "3A" and 20 characters on iOS, "3EB0"-style 22 characters on the web
+// client, 21 or 32 characters on Android, and "3F" or 18 characters on the
+// desktop apps. Web and desktop clients are always linked devices, so a
+// matching ID from a primary device is left unknown, as is any other shape.
+func senderPlatform(info *types.MessageInfo) string {
+	id := string(info.ID)
+	switch {
+	case len(id) == 20 && strings.HasPrefix(id, "3A"):
+		return "ios"
+	case len(id) == 22 && strings.HasPrefix(id, "3E"):
+		if info.Sender.Device == 0 {
+			return ""
+		}
+		return "web"
+	case len(id) == 21 || len(id) == 32:
+		return "android"
+	case strings.HasPrefix(id, "3F") || len(id) == 18:
+		if info.Sender.Device == 0 {
+			return ""
+		}
+		return "desktop"
+	default:
+		return ""
+	}
+}
+
+// handleReaction records or removes a reaction on a stored message. An empty
+// reaction text means the reactor withdrew their reaction.
+func handleReaction(msg *events.Message, reaction *waProto.ReactionMessage, msgStore *store.MessageStore, log *slog.Logger) {
+	targetID := reaction.GetKey().GetID()
+	if targetID == "" {
+		return
+	}
+	reactor := msg.Info.Sender.ToNonAD().String()
+
+	tsMS := msg.Info.Timestamp.UnixMilli()
+	if ms := reaction.GetSenderTimestampMS(); ms > 0 {
+		tsMS = ms
+	}
+
+	if reaction.GetText() == "" {
+		if err := msgStore.RemoveReaction(targetID, reactor, tsMS, msg.Info.IsFromMe); err != nil {
+			log.Error("failed to remove reaction", "error", err, "message_id", targetID)
+			return
+		}
+		log.Debug("reaction removed", "message_id", targetID, "reactor", reactor)
+		return
+	}
+
+	if err := msgStore.SaveReaction(&store.Reaction{
+		MessageID:   targetID,
+		ReactorJID:  reactor,
+		Emoji:       reaction.GetText(),
+		TimestampMS: tsMS,
+		IsFromMe:    msg.Info.IsFromMe,
+	}); err != nil {
+		log.Error("failed to save reaction", "error", err, "message_id", targetID)
+		return
+	}
+	log.Debug("reaction saved", "message_id", targetID, "reactor", reactor, "emoji", reaction.GetText())
+}
+
+// handleEncReaction decrypts a reaction sent encrypted, as reactions in
+// community announcement groups are, and records it like any other.
+func handleEncReaction(client *Client, msg *events.Message, msgStore *store.MessageStore, log *slog.Logger) {
+	if client.client == nil {
+		return
+	}
+	reaction, err := client.client.DecryptReaction(context.Background(), msg)
+	if err != nil {
+		log.Warn("failed to decrypt reaction", "error", err, "id", msg.Info.ID)
+		return
+	}
+	handleReaction(msg, reaction, msgStore, log)
+}
+
+// handleEdit applies an edit to the stored original message, keeping the
+// previous content in its edit history. Message IDs are not secret, so an
+// edit is only applied if it comes from the original's chat and sender.
+func handleEdit(msg *events.Message, pm *waProto.ProtocolMessage, msgStore *store.MessageStore, log *slog.Logger) {
+	targetID := pm.GetKey().GetID()
+	if targetID == "" {
+		return
+	}
+
+	target, err := msgStore.GetMessageByID(targetID)
+	if err != nil {
+		log.Error("failed to load edited message", "error", err, "message_id", targetID)
+		return
+	}
+	if target == nil {
+		log.Debug("edit for unknown message", "message_id", targetID)
+		return
+	}
+	if !inSameChat(msg, target) || !fromSameSender(msg, target) {
+		log.Debug("ignoring edit from another chat or sender", "message_id", targetID,
+			"chat", msg.Info.Chat.String(), "sender", msg.Info.Sender.ToNonAD().String())
+		return
+	}
+
+	ts := msg.Info.Timestamp.Unix()
+	if ms := pm.GetTimestampMS(); ms > 0 {
+		ts = ms / 1000
+	}
+
+	found, err := msgStore.EditMessage(targetID, editedText(pm.GetEditedMessage()), ts)
+	if err != nil {
+		log.Error("failed to apply edit", "error", err, "message_id", targetID)
+		return
+	}
+	if !found {
+		log.Debug("edit for unknown message", "message_id", targetID)
+		return
+	}
+	log.Debug("message edited", "message_id", targetID)
+}
+
+// handleRevoke marks the target of a delete-for-everyone as revoked. Like
+// an edit, a revoke must come from the original's chat and sender, except
+// that group admins may revoke other members' messages.
+func handleRevoke(client *Client, msg *events.Message, pm *waProto.ProtocolMessage, msgStore *store.MessageStore, blank bool, log *slog.Logger) {
+	targetID := pm.GetKey().GetID()
+	if targetID == "" {
+		return
+	}
+
+	target, err := msgStore.GetMessageByID(targetID)
+	if err != nil {
+		log.Error("failed to load revoked message", "error", err, "message_id", targetID)
+		return
+	}
+	if target == nil {
+		log.Debug("revoke for unknown message", "message_id", targetID)
+		return
+	}
+	if !inSameChat(msg, target) || !(fromSameSender(msg, target) || adminRevoke(client, msg, pm, target)) {
+		log.Debug("ignoring revoke from another chat or sender", "message_id", targetID,
+			"chat", msg.Info.Chat.String(), "sender", msg.Info.Sender.ToNonAD().String())
+		return
+	}
+
+	found, err := msgStore.RevokeMessage(targetID, blank)
+	if err != nil {
+		log.Error("failed to revoke message", "error", err, "message_id", targetID)
+		return
+	}
+	if !found {
+		log.Debug("revoke for unknown message", "message_id", targetID)
+		return
+	}
+	log.Debug("message revoked", "message_id", targetID)
+}
+
+// inSameChat reports whether msg was sent in the chat of the stored target.
+// Direct chats may be addressed by phone number or by LID, so the other
+// address of the contact counts too.
+func inSameChat(msg *events.Message, target *store.Message) bool {
+	chats := []types.JID{msg.Info.Chat}
+	if !msg.Info.IsGroup {
+		if msg.Info.IsFromMe {
+			chats = append(chats, msg.Info.RecipientAlt)
+		} else {
+			chats = append(chats, msg.Info.SenderAlt)
+		}
+	}
+	return sameUser(target.ChatJID, chats...)
+}
+
+// fromSameSender reports whether msg was sent by the author of the stored
+// target: by us for our own messages, or by the same contact otherwise.
+func fromSameSender(msg *events.Message, target *store.Message) bool {
+	if msg.Info.IsFromMe || target.IsFromMe {
+		return msg.Info.IsFromMe && target.IsFromMe
+	}
+	return sameUser(target.SenderJID, msg.Info.Sender, msg.Info.SenderAlt)
+}
+
+// adminRevoke reports whether msg is a group admin revoking another
+// member's message: it names the target's sender as the key's participant,
+// and its own sender is an admin of the group.
+func adminRevoke(client *Client, msg *events.Message, pm *waProto.ProtocolMessage, target *store.Message) bool {
+	if !msg.Info.IsGroup || target.IsFromMe {
+		return false
+	}
+	participant, err := types.ParseJID(pm.GetKey().GetParticipant())
+	if err != nil || !sameUser(target.SenderJID, participant) {
+		return false
+	}
+	gi, _, err := client.groupInfo(context.Background(), msg.Info.Chat)
+	if err != nil {
+		return false
+	}
+	for _, p := range gi.Participants {
+		if (p.IsAdmin || p.IsSuperAdmin) && (sameUser(p.JID.String(), msg.Info.Sender, msg.Info.SenderAlt) ||
+			sameUser(p.LID.String(), msg.Info.Sender, msg.Info.SenderAlt) ||
+			sameUser(p.PhoneNumber.String(), msg.Info.Sender, msg.Info.SenderAlt)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameUser reports whether the stored JID names the same user as any of
+// jids, whatever their device.
+func sameUser(stored string, jids ...types.JID) bool {
+	want, err := types.ParseJID(stored)
+	if err != nil {
+		return false
+	}
+	want = want.ToNonAD()
+	for _, jid := range jids {
+		if !jid.IsEmpty() && jid.ToNonAD() == want {
+			return true
+		}
+	}
+	return false
+}
+
+// editedText extracts the new text or caption from an edited message.
+func editedText(m *waProto.Message) string {
+	switch {
+	case m.GetConversation() != "":
+		return m.GetConversation()
+	case m.GetExtendedTextMessage() != nil:
+		return m.GetExtendedTextMessage().GetText()
+	case m.GetImageMessage() != nil:
+		return m.GetImageMessage().GetCaption()
+	case m.GetVideoMessage() != nil:
+		return m.GetVideoMessage().GetCaption()
+	case m.GetDocumentMessage() != nil:
+		return m.GetDocumentMessage().GetCaption()
+	default:
+		return ""
+	}
+}
+
+// handleReceipt records delivery and read receipts for our own messages.
+// Receipts generated by our other devices (read-self, played-self) concern
+// messages we received and are ignored.
+func handleReceipt(client *Client, receipt *events.Receipt, msgStore *store.MessageStore, log *slog.Logger) {
+	if receipt.IsFromMe {
+		return
+	}
+
+	var kind string
+	switch receipt.Type {
+	case types.ReceiptTypeDelivered:
+		kind = store.ReceiptDelivered
+	case types.ReceiptTypeRead, types.ReceiptTypePlayed:
+		kind = store.ReceiptRead
+	default:
+		return
+	}
+
+	participant := receipt.Sender.ToNonAD().String()
+	ts := receipt.Timestamp.Unix()
+	for _, id := range receipt.MessageIDs {
+		if err := msgStore.UpdateReceipt(id, participant, kind, ts, receipt.IsGroup); err != nil {
+			log.Error("failed to update receipt", "error", err, "message_id", id)
+		}
+	}
+	client.events.Publish(EventReceipt, &ReceiptEvent{
+		ChatJID:     receipt.Chat.String(),
+		Participant: participant,
+		MessageIDs:  receipt.MessageIDs,
+		Kind:        kind,
+		Timestamp:   ts,
+	})
+	log.Debug("receipt processed", "kind", kind, "from", participant, "count", len(receipt.MessageIDs))
+}
+
 // downloadMedia downloads media from a WhatsApp message and saves it to disk.
 // It returns the file path on success, or an empty string on error.
 func downloadMedia(client *Client, downloadable whatsmeow.DownloadableMessage, msgID, ext string, log *slog.Logger) string {
@@ -222,16 +720,9 @@ func downloadMedia(client *Client, downloadable whatsmeow.DownloadableMessage, m
 		return ""
 	}
 
-	// Ensure the media directory exists.
-	mediaDir := filepath.Join(client.dataDir, "media")
-	if err := os.MkdirAll(mediaDir, 0o755); err != nil {
-		log.Error("failed to create media directory", "error", err, "message_id", msgID)
-		return ""
-	}
-
-	filePath := filepath.Join(mediaDir, msgID+ext)
-	if err := os.WriteFile(filePath, data, 0o644); err != nil {
-		log.Error("failed to write media file", "error", err, "path", filePath, "message_id", msgID)
+	filePath, err := client.saveMedia(msgID, ext, data)
+	if err != nil {
+		log.Error("failed to save media", "error", err, "message_id", msgID)
 		return ""
 	}
 
@@ -239,6 +730,33 @@ func downloadMedia(client *Client, downloadable whatsmeow.DownloadableMessage, m
 	return filePath
 }
 
+// setMediaKeys copies the download metadata of a media message into msg so
+// the media can be re-downloaded later, along with the file's type, size,
+// hash and, for images and videos, dimensions and, for audio and videos,
+// duration.
+func setMediaKeys(msg *store.Message, media whatsmeow.DownloadableMessage, mimetype string) {
+	msg.MediaKey = media.GetMediaKey()
+	msg.MediaDirectPath = media.GetDirectPath()
+	msg.MediaEncSHA256 = media.GetFileEncSHA256()
+	msg.MediaSHA256 = media.GetFileSHA256()
+	msg.MediaMimetype = mimetype
+	if sized, ok := media.(interface{ GetFileLength() uint64 }); ok && sized.GetFileLength() > 0 {
+		n := int64(sized.GetFileLength())
+		msg.MediaLength = &n
+	}
+	if dims, ok := media.(interface {
+		GetWidth() uint32
+		GetHeight() uint32
+	}); ok && dims.GetWidth() > 0 && dims.GetHeight() > 0 {
+		w, h := int(dims.GetWidth()), int(dims.GetHeight())
+		msg.MediaWidth, msg.MediaHeight = &w, &h
+	}
+	if timed, ok := media.(interface{ GetSeconds() uint32 }); ok && timed.GetSeconds() > 0 {
+		d := int(timed.GetSeconds())
+		msg.MediaDuration = &d
+	}
+}
+
 // getExtension maps a MIME type to a file extension (with leading dot).
 func getExtension(mimeType string) string {
 	// Normalise: strip any parameters (e.g. "audio/ogg; codecs=opus").
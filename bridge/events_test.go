@@ -0,0 +1,144 @@
+package bridge
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// newEventTestStore returns a message store holding one message, M1, sent
+// by alice in a group.
+func newEventTestStore(t *testing.T) *store.MessageStore {
+	t.Helper()
+	st, err := store.NewMessageStore(filepath.Join(t.TempDir(), "messages.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if err := st.SaveMessage(&store.Message{
+		ID: "M1", ChatJID: testGroup.String(), SenderJID: testAlice.String(), MsgType: "text",
+		Content: "original", Timestamp: 1, IsGroup: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+var (
+	testGroup = types.NewJID("120363000000000001", types.GroupServer)
+	testAlice = types.NewJID("31611111111", types.DefaultUserServer)
+	testBob   = types.NewJID("31622222222", types.DefaultUserServer)
+)
+
+// protocolEvent builds an incoming protocol message from sender in chat.
+func protocolEvent(chat, sender types.JID, pm *waProto.ProtocolMessage) *events.Message {
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsGroup: chat.Server == types.GroupServer},
+			ID:            "P1",
+			Timestamp:     time.Unix(2, 0),
+		},
+		Message: &waProto.Message{ProtocolMessage: pm},
+	}
+}
+
+func TestHandleEditChecksSender(t *testing.T) {
+	st := newEventTestStore(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	edit := func(text string) *waProto.ProtocolMessage {
+		return &waProto.ProtocolMessage{
+			Type:          waProto.ProtocolMessage_MESSAGE_EDIT.Enum(),
+			Key:           &waCommon.MessageKey{ID: proto.String("M1")},
+			EditedMessage: &waProto.Message{Conversation: proto.String(text)},
+		}
+	}
+
+	// Another member, and alice from another chat, may not edit it.
+	handleEdit(protocolEvent(testGroup, testBob, edit("forged")), edit("forged"), st, log)
+	handleEdit(protocolEvent(testAlice, testAlice, edit("forged")), edit("forged"), st, log)
+	msg, err := st.GetMessageByID("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "original" || msg.EditCount != 0 {
+		t.Fatalf("foreign edit applied: content %q, %d edits", msg.Content, msg.EditCount)
+	}
+
+	// Alice may, from any of her devices.
+	device := testAlice
+	device.Device = 3
+	handleEdit(protocolEvent(testGroup, device, edit("fixed")), edit("fixed"), st, log)
+	if msg, err = st.GetMessageByID("M1"); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "fixed" || msg.EditCount != 1 {
+		t.Fatalf("author's edit: content %q, %d edits", msg.Content, msg.EditCount)
+	}
+}
+
+func TestHandleRevokeChecksSender(t *testing.T) {
+	st := newEventTestStore(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := newTestClient(t)
+	revoke := func(participant types.JID) *waProto.ProtocolMessage {
+		return &waProto.ProtocolMessage{
+			Type: waProto.ProtocolMessage_REVOKE.Enum(),
+			Key:  &waCommon.MessageKey{ID: proto.String("M1"), Participant: proto.String(participant.String())},
+		}
+	}
+	revoked := func() bool {
+		t.Helper()
+		msg, err := st.GetMessageByID("M1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg.Revoked
+	}
+
+	// Bob is a member, not an admin, so he cannot revoke alice's message;
+	// nor can alice from another chat.
+	c.groupInfos.put(&types.GroupInfo{JID: testGroup, Participants: []types.GroupParticipant{
+		{JID: testAlice}, {JID: testBob},
+	}})
+	handleRevoke(c, protocolEvent(testGroup, testBob, revoke(testAlice)), revoke(testAlice), st, true, log)
+	handleRevoke(c, protocolEvent(testAlice, testAlice, revoke(testAlice)), revoke(testAlice), st, true, log)
+	if revoked() {
+		t.Fatal("revoke by a member or from another chat applied")
+	}
+
+	// As an admin he can.
+	c.groupInfos.put(&types.GroupInfo{JID: testGroup, Participants: []types.GroupParticipant{
+		{JID: testAlice}, {JID: testBob, IsAdmin: true},
+	}})
+	handleRevoke(c, protocolEvent(testGroup, testBob, revoke(testAlice)), revoke(testAlice), st, true, log)
+	if !revoked() {
+		t.Fatal("admin revoke not applied")
+	}
+}
+
+func TestHandleRevokeByAuthor(t *testing.T) {
+	st := newEventTestStore(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pm := &waProto.ProtocolMessage{
+		Type: waProto.ProtocolMessage_REVOKE.Enum(),
+		Key:  &waCommon.MessageKey{ID: proto.String("M1")},
+	}
+	handleRevoke(newTestClient(t), protocolEvent(testGroup, testAlice, pm), pm, st, false, log)
+	msg, err := st.GetMessageByID("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Revoked {
+		t.Fatal("author's revoke not applied")
+	}
+}
@@ -0,0 +1,121 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// groupNameTTL is how long the joined groups list is reused to resolve group
+// names before it is fetched again.
+const groupNameTTL = 10 * time.Minute
+
+// groupNameMissRefresh is how old the joined groups list must be before a
+// name that is not in it fetches it again. Joins and renames clear the cache
+// as they are reported, so this is only a fallback, and unknown names must
+// not cost a request to WhatsApp each.
+const groupNameMissRefresh = time.Minute
+
+// ErrGroupNotFound is returned by ResolveGroupName when no joined group has
+// the name.
+var ErrGroupNotFound = errors.New("no joined group has that name")
+
+// AmbiguousGroupError is returned by ResolveGroupName when several joined
+// groups share the name.
+type AmbiguousGroupError struct {
+	Name string
+	JIDs []string
+}
+
+func (e *AmbiguousGroupError) Error() string {
+	return fmt.Sprintf("group name %q matches %d groups (%s); send by JID instead",
+		e.Name, len(e.JIDs), strings.Join(e.JIDs, ", "))
+}
+
+// groupNameCache maps folded group names to the JIDs of the joined groups
+// with that name.
+type groupNameCache struct {
+	mu      sync.Mutex
+	byName  map[string][]string
+	fetched time.Time
+}
+
+// groupNameKey folds a group name for matching: case and surrounding space
+// are ignored.
+func groupNameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// ResolveGroupName returns the JID of the joined group called name, compared
+// case-insensitively. The joined groups are fetched from WhatsApp and cached;
+// a name that is not found refreshes the cache once, in case the group was
+// joined or renamed since, unless it was fetched within
+// groupNameMissRefresh.
+func (c *Client) ResolveGroupName(ctx context.Context, name string) (string, error) {
+	key := groupNameKey(name)
+	if key == "" {
+		return "", ErrGroupNotFound
+	}
+
+	gc := &c.groupNames
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	fresh := false
+	if gc.byName == nil || time.Since(gc.fetched) > groupNameTTL {
+		if err := c.fetchGroupNames(ctx); err != nil {
+			return "", err
+		}
+		fresh = true
+	}
+	jids := gc.byName[key]
+	if len(jids) == 0 && !fresh && time.Since(gc.fetched) > groupNameMissRefresh {
+		if err := c.fetchGroupNames(ctx); err != nil {
+			return "", err
+		}
+		jids = gc.byName[key]
+	}
+
+	switch len(jids) {
+	case 0:
+		return "", ErrGroupNotFound
+	case 1:
+		return jids[0], nil
+	default:
+		return "", &AmbiguousGroupError{Name: name, JIDs: jids}
+	}
+}
+
+// fetchGroupNames refills the group name cache. The caller holds its lock.
+func (c *Client) fetchGroupNames(ctx context.Context) error {
+	if c.client == nil || !c.client.IsConnected() {
+		return fmt.Errorf("client is not connected")
+	}
+	groups, err := c.client.GetJoinedGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("get joined groups: %w", err)
+	}
+
+	byName := make(map[string][]string, len(groups))
+	for _, g := range groups {
+		key := groupNameKey(g.Name)
+		if key == "" {
+			continue
+		}
+		byName[key] = append(byName[key], g.JID.String())
+	}
+	c.groupNames.byName = byName
+	c.groupNames.fetched = time.Now()
+	return nil
+}
+
+// forgetGroupNames drops the group name cache, so that the next lookup sees
+// joins and renames.
+func (c *Client) forgetGroupNames() {
+	c.groupNames.mu.Lock()
+	c.groupNames.byName = nil
+	c.groupNames.mu.Unlock()
+}
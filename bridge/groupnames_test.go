@@ -0,0 +1,28 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResolveGroupNameMissUsesRecentList(t *testing.T) {
+	c := newTestClient(t)
+	c.groupNames.byName = map[string][]string{"family": {"120363012345678901@g.us"}}
+	c.groupNames.fetched = time.Now()
+
+	if jid, err := c.ResolveGroupName(context.Background(), " Family "); err != nil || jid != "120363012345678901@g.us" {
+		t.Fatalf("known name: %q, %v", jid, err)
+	}
+	// The list was just fetched, so an unknown name is answered from it
+	// rather than by asking WhatsApp, which would fail while disconnected.
+	if _, err := c.ResolveGroupName(context.Background(), "Work"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("unknown name: got %v, want ErrGroupNotFound", err)
+	}
+
+	c.groupNames.fetched = time.Now().Add(-2 * groupNameMissRefresh)
+	if _, err := c.ResolveGroupName(context.Background(), "Work"); err == nil || errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("unknown name with an older list: got %v, want a refresh attempt", err)
+	}
+}
@@ -0,0 +1,443 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// RefreshGroupParticipants fetches a group's current membership from
+// WhatsApp and records it.
+func (c *Client) RefreshGroupParticipants(ctx context.Context, groupJID string, msgStore *store.MessageStore) error {
+	if c.client == nil || !c.client.IsConnected() {
+		return fmt.Errorf("client is not connected")
+	}
+
+	jid, err := c.recipientJID(groupJID)
+	if err != nil {
+		return fmt.Errorf("parse group JID: %w", err)
+	}
+
+	gi, err := c.client.GetGroupInfo(ctx, jid)
+	if err != nil {
+		return fmt.Errorf("get group info: %w", err)
+	}
+	c.groupInfos.put(gi)
+	return saveGroupParticipants(msgStore, gi)
+}
+
+// DefaultGroupInfoTTL is how long group info fetched for incoming messages
+// is reused before it is fetched again.
+const DefaultGroupInfoTTL = time.Hour
+
+// groupInfoCache keeps the group info fetched for incoming messages, so that
+// a busy group is not looked up on WhatsApp's servers for every message.
+// Entries are dropped when a group info event reports a change.
+type groupInfoCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration // 0 disables the cache
+	entries map[types.JID]groupInfoEntry
+}
+
+type groupInfoEntry struct {
+	info    *types.GroupInfo
+	fetched time.Time
+}
+
+func (gc *groupInfoCache) get(jid types.JID) *types.GroupInfo {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	e, ok := gc.entries[jid]
+	if !ok || time.Since(e.fetched) > gc.ttl {
+		return nil
+	}
+	return e.info
+}
+
+func (gc *groupInfoCache) put(gi *types.GroupInfo) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if gc.ttl <= 0 {
+		return
+	}
+	if gc.entries == nil {
+		gc.entries = make(map[types.JID]groupInfoEntry)
+	}
+	gc.entries[gi.JID] = groupInfoEntry{info: gi, fetched: time.Now()}
+}
+
+func (gc *groupInfoCache) forget(jid types.JID) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	delete(gc.entries, jid)
+}
+
+// SetGroupInfoTTL sets how long group info is cached for incoming messages
+// (0 fetches it for every message).
+func (c *Client) SetGroupInfoTTL(ttl time.Duration) {
+	c.groupInfos.mu.Lock()
+	defer c.groupInfos.mu.Unlock()
+	c.groupInfos.ttl = ttl
+}
+
+// groupInfo returns the info of group jid, from the cache when it is fresh.
+// fetched reports whether it came from WhatsApp.
+func (c *Client) groupInfo(ctx context.Context, jid types.JID) (gi *types.GroupInfo, fetched bool, err error) {
+	if gi := c.groupInfos.get(jid); gi != nil {
+		return gi, false, nil
+	}
+	cli := c.GetClient()
+	if cli == nil {
+		return nil, false, fmt.Errorf("client is not connected")
+	}
+	gi, err = cli.GetGroupInfo(ctx, jid)
+	if err != nil {
+		return nil, false, err
+	}
+	c.groupInfos.put(gi)
+	return gi, true, nil
+}
+
+// saveGroupParticipants records the membership snapshot in gi.
+func saveGroupParticipants(msgStore *store.MessageStore, gi *types.GroupInfo) error {
+	participants := make([]store.Participant, len(gi.Participants))
+	for i, p := range gi.Participants {
+		participants[i] = store.Participant{
+			ParticipantJID: p.JID.ToNonAD().String(),
+			IsAdmin:        p.IsAdmin || p.IsSuperAdmin,
+		}
+	}
+	return msgStore.ReplaceGroupParticipants(gi.JID.String(), participants, time.Now().Unix())
+}
+
+// recordGroupOnFirstSight stores a group's membership the first time one of
+// its messages is seen, or the first time after only changes to it were
+// recorded. Later changes arrive as group info events.
+func recordGroupOnFirstSight(msgStore *store.MessageStore, gi *types.GroupInfo, log *slog.Logger) {
+	known, err := msgStore.HasGroupSnapshot(gi.JID.String())
+	if err != nil || known {
+		return
+	}
+	if err := saveGroupParticipants(msgStore, gi); err != nil {
+		log.Error("failed to save group participants", "error", err, "group", gi.JID.String())
+		return
+	}
+	log.Debug("group participants recorded", "group", gi.JID.String(), "participants", len(gi.Participants))
+}
+
+// handleGroupInfo applies membership changes from a group info event. For a
+// group without a recorded snapshot the changes alone would pass for the
+// whole membership, so the full group info is fetched instead, once; if
+// that fails, the changes are recorded and their rows marked partial.
+func handleGroupInfo(client *Client, evt *events.GroupInfo, msgStore *store.MessageStore, log *slog.Logger) {
+	group := evt.JID.String()
+	ts := evt.Timestamp.Unix()
+
+	if known, err := msgStore.HasGroupSnapshot(group); err == nil && !known {
+		gi, _, err := client.groupInfo(context.Background(), evt.JID)
+		if err == nil {
+			recordGroupOnFirstSight(msgStore, gi, log)
+			return
+		}
+		log.Warn("failed to fetch group info, recording partial membership", "error", err, "group", group)
+	}
+
+	apply := func(what string, err error) {
+		if err != nil {
+			log.Error("failed to update group participants", "error", err, "group", group, "change", what)
+		}
+	}
+	apply("join", msgStore.AddGroupParticipants(group, jidStrings(evt.Join), ts))
+	apply("leave", msgStore.RemoveGroupParticipants(group, jidStrings(evt.Leave), ts))
+	apply("promote", msgStore.SetGroupAdmins(group, jidStrings(evt.Promote), true))
+	apply("demote", msgStore.SetGroupAdmins(group, jidStrings(evt.Demote), false))
+}
+
+// jidStrings converts JIDs to their device-less string form.
+func jidStrings(jids []types.JID) []string {
+	out := make([]string, len(jids))
+	for i, j := range jids {
+		out[i] = j.ToNonAD().String()
+	}
+	return out
+}
+
+// ErrInvalidParticipant is returned by CreateGroup when a participant is
+// neither a JID nor a phone number.
+var ErrInvalidParticipant = errors.New("invalid participant")
+
+// CreatedGroup is the outcome of CreateGroup.
+type CreatedGroup struct {
+	JID          string              `json:"jid"`
+	Name         string              `json:"name"`
+	Participants []string            `json:"participants"` // members, including us
+	Failed       []FailedParticipant `json:"failed"`       // participants WhatsApp did not add
+	DryRun       bool                `json:"dry_run,omitempty"`
+}
+
+// FailedParticipant is a participant that could not be added to a group.
+type FailedParticipant struct {
+	JID    string `json:"jid"`
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// addFailureReasons explains the error codes WhatsApp gives for participants
+// it did not add.
+var addFailureReasons = map[int]string{
+	401: "blocked",
+	403: "privacy settings do not allow being added",
+	404: "not on WhatsApp",
+	408: "recently left the group",
+	409: "already a member",
+}
+
+// CreateGroup creates a group called name with the given participants (JIDs
+// or phone numbers) and records its membership. Participants WhatsApp
+// refuses to add, for example because of their privacy settings, are listed
+// in Failed rather than failing the call. A dry run only logs the group and
+// returns it under a made-up JID, with every participant added.
+func (c *Client) CreateGroup(ctx context.Context, name string, participants []string, msgStore *store.MessageStore) (*CreatedGroup, error) {
+	if err := c.canSend(ctx); err != nil {
+		return nil, err
+	}
+
+	jids := make([]types.JID, len(participants))
+	for i, p := range participants {
+		jid, err := c.recipientJID(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidParticipant, p, err)
+		}
+		jids[i] = jid
+	}
+
+	if c.isDryRun(ctx) {
+		jid := types.NewJID(c.newMessageID(ctx), types.GroupServer)
+		c.log.Info("dry run: group not created", "jid", jid.String(), "name", name, "participants", jidStrings(jids))
+		return &CreatedGroup{
+			JID:          jid.String(),
+			Name:         name,
+			Participants: jidStrings(jids),
+			Failed:       []FailedParticipant{},
+			DryRun:       true,
+		}, nil
+	}
+
+	gi, err := c.client.CreateGroup(ctx, whatsmeow.ReqCreateGroup{Name: name, Participants: jids})
+	if err != nil {
+		return nil, fmt.Errorf("create group: %w", err)
+	}
+
+	created := &CreatedGroup{
+		JID:          gi.JID.String(),
+		Name:         gi.Name,
+		Participants: []string{},
+		Failed:       []FailedParticipant{},
+	}
+	joined := *gi
+	joined.Participants = nil
+	for _, p := range gi.Participants {
+		if p.Error != 0 {
+			reason := addFailureReasons[p.Error]
+			if reason == "" {
+				reason = fmt.Sprintf("error %d", p.Error)
+			}
+			created.Failed = append(created.Failed, FailedParticipant{
+				JID:    p.JID.ToNonAD().String(),
+				Code:   p.Error,
+				Reason: reason,
+			})
+			continue
+		}
+		created.Participants = append(created.Participants, p.JID.ToNonAD().String())
+		joined.Participants = append(joined.Participants, p)
+	}
+
+	c.groupInfos.put(&joined)
+	c.forgetGroupNames()
+	if err := saveGroupParticipants(msgStore, &joined); err != nil {
+		c.log.Error("failed to save group participants", "error", err, "group", created.JID)
+	}
+	return created, nil
+}
+
+// SetGroupDescription replaces the description of group groupJID. A dry run
+// only logs it.
+func (c *Client) SetGroupDescription(ctx context.Context, groupJID, description string) error {
+	if err := c.canSend(ctx); err != nil {
+		return err
+	}
+
+	jid, err := c.recipientJID(groupJID)
+	if err != nil {
+		return fmt.Errorf("parse group JID: %w", err)
+	}
+	if c.isDryRun(ctx) {
+		c.log.Info("dry run: group description not set", "jid", jid.String(), "description", description)
+		return nil
+	}
+	if err := c.client.SetGroupDescription(ctx, jid, description); err != nil {
+		return fmt.Errorf("set group description: %w", err)
+	}
+	return nil
+}
+
+// Errors returned by UpdateGroupParticipants when the linked account may not
+// change the group's membership.
+var (
+	ErrNotGroupMember = errors.New("not a member of the group")
+	ErrNotGroupAdmin  = errors.New("not an admin of the group")
+)
+
+// ErrInvalidAction is returned by UpdateGroupParticipants for an action other
+// than add, remove, promote or demote.
+var ErrInvalidAction = errors.New("invalid action")
+
+// participantActions maps the actions of UpdateGroupParticipants to
+// whatsmeow's.
+var participantActions = map[string]whatsmeow.ParticipantChange{
+	"add":     whatsmeow.ParticipantChangeAdd,
+	"remove":  whatsmeow.ParticipantChangeRemove,
+	"promote": whatsmeow.ParticipantChangePromote,
+	"demote":  whatsmeow.ParticipantChangeDemote,
+}
+
+// ParticipantResult is the outcome of a membership change for one
+// participant.
+type ParticipantResult struct {
+	JID    string `json:"jid"`
+	OK     bool   `json:"ok"`
+	Code   int    `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// InviteCode is set when WhatsApp refused to add someone but allows
+	// sending them a group invite instead, valid until InviteExpiration.
+	InviteCode       string `json:"invite_code,omitempty"`
+	InviteExpiration int64  `json:"invite_expiration,omitempty"`
+}
+
+// participantFailureReason explains the error code WhatsApp gives for a
+// participant it did not change.
+func participantFailureReason(action string, code int) string {
+	if action == "add" {
+		if reason := addFailureReasons[code]; reason != "" {
+			return reason
+		}
+	} else if code == 404 {
+		return "not a member of the group"
+	}
+	return fmt.Sprintf("error %d", code)
+}
+
+// UpdateGroupParticipants adds, removes, promotes or demotes participants
+// (JIDs or phone numbers) of group groupJID and records the changes that
+// succeeded. The linked account must be an admin, except for adding members
+// to groups that let every member add. Participants WhatsApp refuses are
+// reported in their result rather than failing the call.
+func (c *Client) UpdateGroupParticipants(ctx context.Context, groupJID, action string, participants []string, msgStore *store.MessageStore) ([]ParticipantResult, error) {
+	change, ok := participantActions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w %q: must be add, remove, promote or demote", ErrInvalidAction, action)
+	}
+	if c.client == nil || !c.client.IsConnected() {
+		return nil, fmt.Errorf("client is not connected")
+	}
+
+	group, err := c.recipientJID(groupJID)
+	if err != nil {
+		return nil, fmt.Errorf("parse group JID: %w", err)
+	}
+	jids := make([]types.JID, len(participants))
+	for i, p := range participants {
+		jid, err := c.recipientJID(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidParticipant, p, err)
+		}
+		jids[i] = jid
+	}
+
+	// Check our own rights on fresh info first: WhatsApp's answer to a
+	// change we may not make is a bare "forbidden".
+	gi, err := c.client.GetGroupInfo(ctx, group)
+	if errors.Is(err, whatsmeow.ErrNotInGroup) || errors.Is(err, whatsmeow.ErrGroupNotFound) {
+		return nil, ErrNotGroupMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get group info: %w", err)
+	}
+	c.groupInfos.put(gi)
+	self, found := c.ownParticipant(gi)
+	if !found {
+		return nil, ErrNotGroupMember
+	}
+	if !self.IsAdmin && !(action == "add" && gi.MemberAddMode == types.GroupMemberAddModeAllMember) {
+		return nil, ErrNotGroupAdmin
+	}
+
+	changed, err := c.client.UpdateGroupParticipants(ctx, group, jids, change)
+	if errors.Is(err, whatsmeow.ErrIQForbidden) {
+		return nil, ErrNotGroupAdmin
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update group participants: %w", err)
+	}
+	c.groupInfos.forget(group)
+
+	results := make([]ParticipantResult, 0, len(changed))
+	var done []string
+	for _, p := range changed {
+		r := ParticipantResult{JID: p.JID.ToNonAD().String(), OK: p.Error == 0}
+		if r.OK {
+			done = append(done, r.JID)
+		} else {
+			r.Code = p.Error
+			r.Reason = participantFailureReason(action, p.Error)
+			if p.AddRequest != nil {
+				r.InviteCode = p.AddRequest.Code
+				r.InviteExpiration = p.AddRequest.Expiration.Unix()
+			}
+		}
+		results = append(results, r)
+	}
+
+	if len(done) > 0 {
+		group := group.String()
+		now := time.Now().Unix()
+		switch action {
+		case "add":
+			err = msgStore.AddGroupParticipants(group, done, now)
+		case "remove":
+			err = msgStore.RemoveGroupParticipants(group, done, now)
+		case "promote":
+			err = msgStore.SetGroupAdmins(group, done, true)
+		case "demote":
+			err = msgStore.SetGroupAdmins(group, done, false)
+		}
+		if err != nil {
+			c.log.Error("failed to update group participants", "error", err, "group", group, "change", action)
+		}
+	}
+	return results, nil
+}
+
+// ownParticipant finds the linked account among the participants of gi,
+// which name it by phone number or LID depending on the group.
+func (c *Client) ownParticipant(gi *types.GroupInfo) (types.GroupParticipant, bool) {
+	pn, lid := c.client.Store.GetJID().ToNonAD(), c.client.Store.GetLID().ToNonAD()
+	for _, p := range gi.Participants {
+		jid := p.JID.ToNonAD()
+		if jid == pn || (!lid.IsEmpty() && jid == lid) {
+			return p, true
+		}
+	}
+	return types.GroupParticipant{}, false
+}
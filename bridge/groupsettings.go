@@ -0,0 +1,196 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for group photos
+	"image/jpeg"
+	_ "image/png"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/image/draw"
+)
+
+// GroupPhotoSize is the edge length, in pixels, of the square JPEG WhatsApp
+// expects as a group photo.
+const GroupPhotoSize = 640
+
+// MaxImagePixels is the largest image, in pixels, decoded for a group photo
+// or sticker. A small file can declare huge dimensions, so the limit is
+// checked against the header before any pixels are allocated.
+const MaxImagePixels = 40_000_000
+
+// ErrInvalidPhoto is returned by SetGroupPhoto for data that is not a JPEG,
+// PNG or GIF image.
+var ErrInvalidPhoto = errors.New("photo must be a JPEG, PNG or GIF image")
+
+// ErrImageTooLarge is returned for images with more than MaxImagePixels.
+var ErrImageTooLarge = fmt.Errorf("image exceeds %d megapixels", MaxImagePixels/1_000_000)
+
+// Group describes a group's settings as WhatsApp reports them.
+type Group struct {
+	JID          string `json:"jid"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Announce     bool   `json:"announce"` // only admins may send messages
+	Locked       bool   `json:"locked"`   // only admins may edit the group info
+	Participants int    `json:"participants"`
+	PhotoID      string `json:"photo_id,omitempty"` // set after a photo change
+}
+
+func groupFromInfo(gi *types.GroupInfo) *Group {
+	return &Group{
+		JID:          gi.JID.String(),
+		Name:         gi.Name,
+		Description:  gi.Topic,
+		Announce:     gi.IsAnnounce,
+		Locked:       gi.IsLocked,
+		Participants: len(gi.Participants),
+	}
+}
+
+// GroupSettings are the changes UpdateGroupSettings applies; nil fields are
+// left as they are.
+type GroupSettings struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Announce    *bool   `json:"announce"`
+	Locked      *bool   `json:"locked"`
+}
+
+// UpdateGroupSettings applies settings to group groupJID and returns the
+// group as WhatsApp reports it afterwards. Changes are made one at a time;
+// if one fails, the earlier ones stay applied.
+func (c *Client) UpdateGroupSettings(ctx context.Context, groupJID string, settings GroupSettings) (*Group, error) {
+	if c.client == nil || !c.client.IsConnected() {
+		return nil, fmt.Errorf("client is not connected")
+	}
+	jid, err := c.recipientJID(groupJID)
+	if err != nil {
+		return nil, fmt.Errorf("parse group JID: %w", err)
+	}
+
+	steps := []struct {
+		what  string
+		set   bool
+		apply func() error
+	}{
+		{"name", settings.Name != nil, func() error { return c.client.SetGroupName(ctx, jid, *settings.Name) }},
+		{"description", settings.Description != nil, func() error { return c.client.SetGroupDescription(ctx, jid, *settings.Description) }},
+		{"announce", settings.Announce != nil, func() error { return c.client.SetGroupAnnounce(ctx, jid, *settings.Announce) }},
+		{"locked", settings.Locked != nil, func() error { return c.client.SetGroupLocked(ctx, jid, *settings.Locked) }},
+	}
+	for _, step := range steps {
+		if !step.set {
+			continue
+		}
+		if err := step.apply(); err != nil {
+			c.groupInfos.forget(jid)
+			return nil, groupChangeError("set group "+step.what, err)
+		}
+	}
+	if settings.Name != nil {
+		c.forgetGroupNames()
+	}
+
+	return c.refreshGroup(ctx, jid)
+}
+
+// SetGroupPhoto crops the image in data to a square, scales it to
+// GroupPhotoSize and makes it the photo of group groupJID.
+func (c *Client) SetGroupPhoto(ctx context.Context, groupJID string, data []byte) (*Group, error) {
+	if c.client == nil || !c.client.IsConnected() {
+		return nil, fmt.Errorf("client is not connected")
+	}
+	jid, err := c.recipientJID(groupJID)
+	if err != nil {
+		return nil, fmt.Errorf("parse group JID: %w", err)
+	}
+	photo, err := squareJPEG(data, GroupPhotoSize)
+	if err != nil {
+		return nil, err
+	}
+
+	photoID, err := c.client.SetGroupPhoto(ctx, jid, photo)
+	if err != nil {
+		return nil, groupChangeError("set group photo", err)
+	}
+	g, err := c.refreshGroup(ctx, jid)
+	if err != nil {
+		return nil, err
+	}
+	g.PhotoID = photoID
+	return g, nil
+}
+
+// refreshGroup fetches the info of group jid after a change, replacing the
+// cached copy.
+func (c *Client) refreshGroup(ctx context.Context, jid types.JID) (*Group, error) {
+	gi, err := c.client.GetGroupInfo(ctx, jid)
+	if err != nil {
+		c.groupInfos.forget(jid)
+		return nil, fmt.Errorf("get group info: %w", err)
+	}
+	c.groupInfos.put(gi)
+	return groupFromInfo(gi), nil
+}
+
+// groupChangeError maps WhatsApp's refusals of a group change to
+// ErrNotGroupAdmin and ErrNotGroupMember.
+func groupChangeError(what string, err error) error {
+	switch {
+	case errors.Is(err, whatsmeow.ErrIQForbidden), errors.Is(err, whatsmeow.ErrIQNotAuthorized):
+		return fmt.Errorf("%s: %w", what, ErrNotGroupAdmin)
+	case errors.Is(err, whatsmeow.ErrIQNotFound):
+		return fmt.Errorf("%s: %w", what, ErrNotGroupMember)
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
+// decodeImage decodes the image in data after checking its dimensions
+// against MaxImagePixels. Data that cannot be decoded yields invalid.
+func decodeImage(data []byte, invalid error) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", invalid
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, "", invalid
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return nil, "", ErrImageTooLarge
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", invalid
+	}
+	return img, format, nil
+}
+
+// squareJPEG crops the image in data to its central square and scales it to
+// size×size. Transparent areas become white, as JPEG has no alpha channel.
+func squareJPEG(data []byte, size int) ([]byte, error) {
+	src, _, err := decodeImage(data, ErrInvalidPhoto)
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, image.Rect(x0, y0, x0+side, y0+side), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("encode group photo: %w", err)
+	}
+	return buf.Bytes(), nil
+}
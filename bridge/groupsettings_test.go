@@ -0,0 +1,74 @@
+package bridge
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestSquareJPEG(t *testing.T) {
+	// A 300×100 image, red with a transparent band in the middle third.
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			if x < 100 || x >= 200 {
+				src.Set(x, y, color.NRGBA{R: 255, A: 255})
+			}
+		}
+	}
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := squareJPEG(in.Bytes(), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 64 {
+		t.Fatalf("got %v, want 64×64", b)
+	}
+	// The central square is the transparent band, which becomes white.
+	if r, g, b, _ := img.At(32, 32).RGBA(); r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+		t.Errorf("centre is %d,%d,%d, want white", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestSquareJPEGRejects(t *testing.T) {
+	huge := hugeGIF(t)
+	for _, c := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not an image", []byte("hello"), ErrInvalidPhoto},
+		{"too many pixels", huge, ErrImageTooLarge},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := squareJPEG(c.data, GroupPhotoSize); !errors.Is(err, c.want) {
+				t.Fatalf("got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+// hugeGIF returns a tiny GIF whose header declares a 65535×65535 image.
+func hugeGIF(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	copy(data[6:10], []byte{0xff, 0xff, 0xff, 0xff}) // logical screen width and height
+	return data
+}
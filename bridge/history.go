@@ -0,0 +1,177 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// History request limits. WhatsApp recommends asking for 50 messages at a
+// time.
+const (
+	DefaultHistoryCount = 50
+	MaxHistoryCount     = 500
+)
+
+// ErrNoHistoryAnchor is returned by RequestHistory when the chat has no
+// stored message to fetch older history before.
+var ErrNoHistoryAnchor = errors.New("no stored messages in this chat to request older history before")
+
+// RequestHistory asks the primary device for up to count messages older than
+// the oldest message stored for chatJID. The request is asynchronous: the
+// messages arrive later as a history sync event and are stored by the event
+// handler.
+func (c *Client) RequestHistory(ctx context.Context, chatJID string, msgStore *store.MessageStore, count int) error {
+	if c.client == nil || !c.client.IsConnected() {
+		return fmt.Errorf("client is not connected")
+	}
+
+	jid, err := c.recipientJID(chatJID)
+	if err != nil {
+		return fmt.Errorf("parse chat JID: %w", err)
+	}
+
+	oldest, err := msgStore.GetOldestMessage(jid.String())
+	if err != nil {
+		return err
+	}
+	if oldest == nil {
+		return ErrNoHistoryAnchor
+	}
+
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     jid,
+			IsFromMe: oldest.IsFromMe,
+		},
+		ID:        oldest.ID,
+		Timestamp: time.Unix(oldest.Timestamp, 0),
+	}
+	if _, err := c.client.SendPeerMessage(ctx, c.client.BuildHistorySyncRequest(info, count)); err != nil {
+		return fmt.Errorf("request history: %w", err)
+	}
+	return nil
+}
+
+// handleHistorySync stores the messages of a history sync, whether it was
+// pushed by WhatsApp after linking (so a new device starts with its recent
+// conversations) or requested with RequestHistory. Historical messages are
+// not forwarded to the webhook or the agent, and their media is not
+// downloaded; the stored keys allow fetching it on demand.
+func handleHistorySync(client *Client, evt *events.HistorySync, msgStore *store.MessageStore, log *slog.Logger) {
+	wc := client.GetClient()
+	if wc == nil {
+		return
+	}
+
+	// Most historical messages carry no push name. whatsmeow keeps the names
+	// from the push name sync in its contact store; look each sender up once.
+	names := make(map[types.JID]string)
+	senderName := func(jid types.JID) string {
+		if name, ok := names[jid]; ok {
+			return name
+		}
+		var name string
+		if c, err := wc.Store.Contacts.GetContact(context.Background(), jid); err == nil {
+			name = c.PushName
+			if name == "" {
+				name = c.FullName
+			}
+		}
+		names[jid] = name
+		return name
+	}
+
+	var msgs []*store.Message
+	for _, conv := range evt.Data.GetConversations() {
+		chat, err := types.ParseJID(conv.GetID())
+		if err != nil || chat.String() == "status@broadcast" {
+			continue
+		}
+		for _, hm := range conv.GetMessages() {
+			parsed, err := wc.ParseWebMessage(chat, hm.GetMessage())
+			if err != nil {
+				log.Debug("skipping history message", "error", err, "chat", chat.String())
+				continue
+			}
+			m := historyMessage(parsed, conv)
+			if m == nil {
+				continue
+			}
+			if m.SenderName == "" && !m.IsFromMe {
+				m.SenderName = senderName(parsed.Info.Sender.ToNonAD())
+			}
+			msgs = append(msgs, m)
+		}
+	}
+
+	inserted, err := msgStore.SaveMessages(msgs)
+	if err != nil {
+		log.Error("failed to store history sync", "error", err, "type", evt.Data.GetSyncType().String())
+		return
+	}
+	log.Info("history sync stored",
+		"type", evt.Data.GetSyncType().String(),
+		"conversations", len(evt.Data.GetConversations()),
+		"messages", len(msgs),
+		"new", inserted,
+	)
+}
+
+// historyMessage converts a message from a history sync into a store
+// message. Reactions, edits, revokes and other protocol messages return nil:
+// they modify other messages rather than standing on their own. So do system
+// notifications, which are only recorded as they happen.
+func historyMessage(msg *events.Message, conv *waHistorySync.Conversation) *store.Message {
+	if msg.Message == nil || msg.Message.GetReactionMessage() != nil || msg.Message.GetProtocolMessage() != nil {
+		return nil
+	}
+
+	mc := extractContent(msg.Message)
+	if mc.msgType == "unknown" || mc.msgType == MsgTypeSystem {
+		return nil
+	}
+
+	isGroup := msg.Info.Chat.Server == types.GroupServer
+	senderName := msg.Info.PushName
+	var groupName string
+	switch {
+	case isGroup:
+		groupName = conv.GetName()
+	case msg.Info.Chat.Server == types.NewsletterServer:
+		senderName = conv.GetName()
+		if mc.msgType == "text" {
+			mc.msgType = "newsletter"
+		}
+	}
+
+	m := &store.Message{
+		ID:         msg.Info.ID,
+		ChatJID:    msg.Info.Chat.String(),
+		SenderJID:  msg.Info.Sender.String(),
+		SenderName: senderName,
+		Content:    mc.content,
+		MsgType:    mc.msgType,
+		Timestamp:  msg.Info.Timestamp.Unix(),
+		IsFromMe:   msg.Info.IsFromMe,
+		IsGroup:    isGroup,
+		GroupName:  groupName,
+		SelectedID: mc.selected,
+		QuotedID:   quotedID(msg.Message),
+	}
+	if !m.IsFromMe {
+		m.SenderPlatform = senderPlatform(&msg.Info)
+	}
+	if mc.media != nil {
+		setMediaKeys(m, mc.media, mc.mimetype)
+	}
+	return m
+}
@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// Interactive messages are only partially supported by WhatsApp: delivery
+// and rendering of button and list messages sent from non-business accounts
+// change between client releases, and some clients show nothing at all.
+// Callers should treat them as best effort and provide a text fallback.
+
+// WhatsApp limits for reply buttons.
+const (
+	MaxButtons          = 3
+	MaxButtonTextLength = 20
+	MaxButtonIDLength   = 256
+)
+
+// WhatsApp limits for list messages. The row limit applies to all sections
+// together.
+const (
+	MaxListSections          = 10
+	MaxListRows              = 10
+	MaxListTitleLength       = 24 // section and row titles
+	MaxListDescriptionLength = 72
+	MaxListRowIDLength       = 200
+)
+
+// Button is a quick-reply button. ID is returned in the button_reply message
+// when the recipient taps it; Text is the label shown.
+type Button struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// ValidateButtons checks buttons against WhatsApp's limits.
+func ValidateButtons(buttons []Button) error {
+	if len(buttons) == 0 {
+		return errors.New("at least one button is required")
+	}
+	if len(buttons) > MaxButtons {
+		return fmt.Errorf("at most %d buttons are allowed", MaxButtons)
+	}
+	seen := make(map[string]bool, len(buttons))
+	for i, b := range buttons {
+		switch {
+		case b.ID == "" || b.Text == "":
+			return fmt.Errorf("button %d: id and text are required", i+1)
+		case len(b.ID) > MaxButtonIDLength:
+			return fmt.Errorf("button %d: id is longer than %d bytes", i+1, MaxButtonIDLength)
+		case utf8.RuneCountInString(b.Text) > MaxButtonTextLength:
+			return fmt.Errorf("button %d: text is longer than %d characters", i+1, MaxButtonTextLength)
+		case seen[b.ID]:
+			return fmt.Errorf("button %d: duplicate id %q", i+1, b.ID)
+		}
+		seen[b.ID] = true
+	}
+	return nil
+}
+
+// buttonsMessage builds a message of text with quick-reply buttons.
+func buttonsMessage(text string, buttons []Button) *waProto.Message {
+	protoButtons := make([]*waProto.ButtonsMessage_Button, len(buttons))
+	for i, b := range buttons {
+		protoButtons[i] = &waProto.ButtonsMessage_Button{
+			ButtonID:   proto.String(b.ID),
+			ButtonText: &waProto.ButtonsMessage_Button_ButtonText{DisplayText: proto.String(b.Text)},
+			Type:       waProto.ButtonsMessage_Button_RESPONSE.Enum(),
+		}
+	}
+
+	return &waProto.Message{
+		ButtonsMessage: &waProto.ButtonsMessage{
+			ContentText: proto.String(text),
+			HeaderType:  waProto.ButtonsMessage_EMPTY.Enum(),
+			Buttons:     protoButtons,
+		},
+	}
+}
+
+// ListRow is a selectable entry of a list message. ID is returned in the
+// list_reply message when the recipient picks it.
+type ListRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// ListSection groups rows under an optional heading. A heading is required
+// when the list has more than one section.
+type ListSection struct {
+	Title string    `json:"title,omitempty"`
+	Rows  []ListRow `json:"rows"`
+}
+
+// List is a menu of selectable rows, opened by a button labelled
+// ButtonText.
+type List struct {
+	ButtonText string
+	Sections   []ListSection
+}
+
+// ValidateList checks the menu button label and sections against WhatsApp's
+// limits.
+func ValidateList(buttonText string, sections []ListSection) error {
+	if buttonText == "" {
+		return errors.New("button_text is required")
+	}
+	if utf8.RuneCountInString(buttonText) > MaxButtonTextLength {
+		return fmt.Errorf("button_text is longer than %d characters", MaxButtonTextLength)
+	}
+	if len(sections) == 0 {
+		return errors.New("at least one section is required")
+	}
+	if len(sections) > MaxListSections {
+		return fmt.Errorf("at most %d sections are allowed", MaxListSections)
+	}
+
+	rows := 0
+	seen := make(map[string]bool)
+	for i, sec := range sections {
+		switch {
+		case sec.Title == "" && len(sections) > 1:
+			return fmt.Errorf("section %d: title is required when there are several sections", i+1)
+		case utf8.RuneCountInString(sec.Title) > MaxListTitleLength:
+			return fmt.Errorf("section %d: title is longer than %d characters", i+1, MaxListTitleLength)
+		case len(sec.Rows) == 0:
+			return fmt.Errorf("section %d: at least one row is required", i+1)
+		}
+		for j, row := range sec.Rows {
+			switch {
+			case row.ID == "" || row.Title == "":
+				return fmt.Errorf("section %d row %d: id and title are required", i+1, j+1)
+			case len(row.ID) > MaxListRowIDLength:
+				return fmt.Errorf("section %d row %d: id is longer than %d bytes", i+1, j+1, MaxListRowIDLength)
+			case utf8.RuneCountInString(row.Title) > MaxListTitleLength:
+				return fmt.Errorf("section %d row %d: title is longer than %d characters", i+1, j+1, MaxListTitleLength)
+			case utf8.RuneCountInString(row.Description) > MaxListDescriptionLength:
+				return fmt.Errorf("section %d row %d: description is longer than %d characters", i+1, j+1, MaxListDescriptionLength)
+			case seen[row.ID]:
+				return fmt.Errorf("section %d row %d: duplicate id %q", i+1, j+1, row.ID)
+			}
+			seen[row.ID] = true
+		}
+		rows += len(sec.Rows)
+	}
+	if rows > MaxListRows {
+		return fmt.Errorf("at most %d rows are allowed across all sections", MaxListRows)
+	}
+	return nil
+}
+
+// listMessage builds a message of text with a menu of selectable rows.
+func listMessage(text string, l *List) *waProto.Message {
+	protoSections := make([]*waProto.ListMessage_Section, len(l.Sections))
+	for i, sec := range l.Sections {
+		rows := make([]*waProto.ListMessage_Row, len(sec.Rows))
+		for j, row := range sec.Rows {
+			rows[j] = &waProto.ListMessage_Row{
+				RowID: proto.String(row.ID),
+				Title: proto.String(row.Title),
+			}
+			if row.Description != "" {
+				rows[j].Description = proto.String(row.Description)
+			}
+		}
+		protoSections[i] = &waProto.ListMessage_Section{
+			Title: proto.String(sec.Title),
+			Rows:  rows,
+		}
+	}
+
+	return &waProto.Message{
+		ListMessage: &waProto.ListMessage{
+			Description: proto.String(text),
+			ButtonText:  proto.String(l.ButtonText),
+			ListType:    waProto.ListMessage_SINGLE_SELECT.Enum(),
+			Sections:    protoSections,
+		},
+	}
+}
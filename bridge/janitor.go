@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// MediaGCResult reports what a media garbage collection pass did.
+type MediaGCResult struct {
+	Scanned        int   `json:"scanned"`
+	Removed        int   `json:"removed"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+// ErrMediaDirMismatch is returned by CollectMediaGarbage when messages
+// reference media but none of it lies in the media directory, as after a
+// data directory was moved without rebasing the stored paths. Collecting
+// then would delete every file the messages actually point to.
+var ErrMediaDirMismatch = errors.New("no stored media path is under the media directory; refusing to delete files")
+
+// CollectMediaGarbage deletes files in the media directory that no stored
+// message references. Files modified within minAge are kept so that a
+// download whose message has not been saved yet is not removed under it.
+func (c *Client) CollectMediaGarbage(msgStore *store.MessageStore, minAge time.Duration) (*MediaGCResult, error) {
+	return CollectMediaGarbage(c.MediaDir(), msgStore, minAge, c.log)
+}
+
+// CollectMediaGarbage is Client.CollectMediaGarbage for a media directory
+// given directly, for use without a WhatsApp client.
+func CollectMediaGarbage(mediaDir string, msgStore *store.MessageStore, minAge time.Duration, log *slog.Logger) (*MediaGCResult, error) {
+	stored, err := msgStore.ListReferencedMedia()
+	if err != nil {
+		return nil, err
+	}
+	mediaDir, err = filepath.Abs(mediaDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve media directory: %w", err)
+	}
+	// Compare paths relative to the media directory, so that "./data/media/x"
+	// and "/srv/bridge/data/media/x" name the same file.
+	referenced := make(map[string]bool, len(stored))
+	for p := range stored {
+		if rel, ok := mediaRel(mediaDir, p); ok {
+			referenced[rel] = true
+		}
+	}
+	if len(stored) > 0 && len(referenced) == 0 {
+		return nil, fmt.Errorf("%w (%s)", ErrMediaDirMismatch, mediaDir)
+	}
+
+	res := &MediaGCResult{}
+	cutoff := time.Now().Add(-minAge)
+	err = filepath.WalkDir(mediaDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		res.Scanned++
+
+		if rel, ok := mediaRel(mediaDir, path); !ok || referenced[rel] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Warn("media gc: failed to remove file", "path", path, "error", err)
+			return nil
+		}
+		res.Removed++
+		res.ReclaimedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("walk media directory: %w", err)
+	}
+	return res, nil
+}
+
+// mediaRel returns path relative to the absolute directory mediaDir, and
+// false when path does not lie inside it.
+func mediaRel(mediaDir, path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(mediaDir, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// JanitorOptions configures the background janitor.
+type JanitorOptions struct {
+	Interval      time.Duration // zero disables the janitor
+	MediaGCMinAge time.Duration
+}
+
+// StartJanitor launches a background goroutine that periodically removes
+// orphaned media files. It stops when ctx is cancelled.
+func StartJanitor(ctx context.Context, client *Client, msgStore *store.MessageStore, opts JanitorOptions, log *slog.Logger) {
+	if opts.Interval <= 0 {
+		return
+	}
+	go janitorLoop(ctx, client, msgStore, opts, log)
+}
+
+func janitorLoop(ctx context.Context, client *Client, msgStore *store.MessageStore, opts JanitorOptions, log *slog.Logger) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("janitor stopped")
+			return
+		case <-ticker.C:
+			res, err := client.CollectMediaGarbage(msgStore, opts.MediaGCMinAge)
+			if err != nil {
+				log.Error("media gc failed", "error", err)
+				continue
+			}
+			log.Info("media gc completed", "scanned", res.Scanned, "removed", res.Removed, "reclaimed_bytes", res.ReclaimedBytes)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package bridge
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+func TestCollectMediaGarbage(t *testing.T) {
+	dir := t.TempDir()
+	mediaDir := filepath.Join(dir, "media")
+	if err := os.MkdirAll(mediaDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := store.NewMessageStore(filepath.Join(dir, "messages.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"kept.jpg", "orphan.jpg"} {
+		p := filepath.Join(mediaDir, name)
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, old, old)
+	}
+	// Reference kept.jpg through a relative path with a redundant element.
+	wd, _ := os.Getwd()
+	rel, err := filepath.Rel(wd, filepath.Join(mediaDir, ".", "kept.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &store.Message{ID: "M1", ChatJID: "1@s.whatsapp.net", MsgType: "image", Timestamp: time.Now().Unix(), MediaPath: rel}
+	if err := s.SaveMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := CollectMediaGarbage(mediaDir, s, time.Minute, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Scanned != 2 || res.Removed != 1 {
+		t.Fatalf("got %+v, want 2 scanned and 1 removed", res)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "kept.jpg")); err != nil {
+		t.Errorf("referenced file removed: %v", err)
+	}
+
+	// Once the stored paths point elsewhere, nothing is deleted.
+	if err := s.UpdateMediaPath("M1", "/somewhere/else/media/kept.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CollectMediaGarbage(mediaDir, s, time.Minute, log); !errors.Is(err, ErrMediaDirMismatch) {
+		t.Fatalf("got %v, want ErrMediaDirMismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "kept.jpg")); err != nil {
+		t.Errorf("file removed despite the mismatch: %v", err)
+	}
+}
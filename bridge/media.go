@@ -0,0 +1,81 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.mau.fi/whatsmeow"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// MediaDir returns the directory where downloaded media files are stored.
+func (c *Client) MediaDir() string {
+	return filepath.Join(c.dataDir, "media")
+}
+
+// saveMedia writes media bytes for msgID to the media directory and returns
+// the resulting file path.
+func (c *Client) saveMedia(msgID, ext string, data []byte) (string, error) {
+	mediaDir := c.MediaDir()
+	if err := os.MkdirAll(mediaDir, c.dirMode); err != nil {
+		return "", fmt.Errorf("create media directory: %w", err)
+	}
+
+	filePath := filepath.Join(mediaDir, msgID+ext)
+	if err := os.WriteFile(filePath, data, c.fileMode); err != nil {
+		return "", fmt.Errorf("write media file %s: %w", filePath, err)
+	}
+	return filePath, nil
+}
+
+// DownloadStoredMedia re-downloads the media of a stored message using the
+// keys persisted alongside it, writes it to the media directory, and returns
+// the file path. It works across restarts as long as WhatsApp still serves
+// the media.
+func (c *Client) DownloadStoredMedia(ctx context.Context, msg *store.Message) (string, error) {
+	wc := c.GetClient()
+	if wc == nil || !wc.IsConnected() {
+		return "", fmt.Errorf("client is not connected")
+	}
+	if !msg.HasMediaKeys() {
+		return "", fmt.Errorf("message %s has no stored media keys", msg.ID)
+	}
+
+	mediaType := mediaTypeFor(msg.MsgType)
+	if mediaType == "" {
+		return "", fmt.Errorf("message type %q has no downloadable media", msg.MsgType)
+	}
+
+	length := -1
+	if msg.MediaLength != nil {
+		length = int(*msg.MediaLength)
+	}
+
+	data, err := wc.DownloadMediaWithPath(ctx, msg.MediaDirectPath, msg.MediaEncSHA256, msg.MediaSHA256,
+		msg.MediaKey, length, mediaType, "")
+	if err != nil {
+		return "", fmt.Errorf("download media: %w", err)
+	}
+
+	return c.saveMedia(msg.ID, getExtension(msg.MediaMimetype), data)
+}
+
+// mediaTypeFor maps a stored msg_type to the whatsmeow media type used to
+// derive its decryption keys.
+func mediaTypeFor(msgType string) whatsmeow.MediaType {
+	switch msgType {
+	case "image", "sticker":
+		return whatsmeow.MediaImage
+	case "video":
+		return whatsmeow.MediaVideo
+	case "audio":
+		return whatsmeow.MediaAudio
+	case "document":
+		return whatsmeow.MediaDocument
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,75 @@
+package bridge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMediaURLTTL is how long a signed media URL stays valid.
+const DefaultMediaURLTTL = 24 * time.Hour
+
+// ErrMediaToken is returned by MediaSigner.Verify for a missing, malformed,
+// forged or expired token.
+var ErrMediaToken = errors.New("invalid or expired media token")
+
+// MediaSigner issues and checks signed media URLs: GET /media/{id}?token=...
+// where the token carries its expiry and an HMAC of the message ID, so that
+// webhook consumers can fetch one message's media without other access to
+// the API. A nil *MediaSigner issues no URLs.
+type MediaSigner struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+// NewMediaSigner returns a signer keyed by secret. URLs are absolute under
+// baseURL (e.g. "http://bridge.internal:8555") or, if it is empty, paths
+// relative to the API root. A ttl of 0 selects DefaultMediaURLTTL.
+func NewMediaSigner(secret, baseURL string, ttl time.Duration) *MediaSigner {
+	if ttl <= 0 {
+		ttl = DefaultMediaURLTTL
+	}
+	return &MediaSigner{
+		secret:  []byte(secret),
+		baseURL: strings.TrimRight(baseURL, "/"),
+		ttl:     ttl,
+	}
+}
+
+// URL returns a signed URL for the media of message msgID.
+func (m *MediaSigner) URL(msgID string) string {
+	if m == nil {
+		return ""
+	}
+	expires := time.Now().Add(m.ttl).Unix()
+	token := strconv.FormatInt(expires, 10) + "." + m.sign(msgID, expires)
+	return m.baseURL + "/media/" + url.PathEscape(msgID) + "?token=" + url.QueryEscape(token)
+}
+
+// Verify checks that token was issued for msgID and has not expired.
+func (m *MediaSigner) Verify(msgID, token string) error {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrMediaToken
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrMediaToken
+	}
+	if !hmac.Equal([]byte(sig), []byte(m.sign(msgID, expires))) {
+		return ErrMediaToken
+	}
+	return nil
+}
+
+func (m *MediaSigner) sign(msgID string, expires int64) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(msgID + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
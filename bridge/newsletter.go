@@ -0,0 +1,58 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// newsletterNameTTL is how long a channel's name is reused before it is
+// looked up again; newsletterNameRetry is how long a failed lookup waits.
+const (
+	newsletterNameTTL   = time.Hour
+	newsletterNameRetry = 5 * time.Minute
+)
+
+// newsletterNameCache keeps the names of channels, so that a busy channel
+// is not looked up on WhatsApp's servers for every post.
+type newsletterNameCache struct {
+	mu      sync.Mutex
+	entries map[types.JID]newsletterNameEntry
+}
+
+type newsletterNameEntry struct {
+	name    string
+	expires time.Time
+}
+
+// newsletterName looks up a channel's display name, falling back to its JID.
+func newsletterName(client *Client, jid types.JID) string {
+	nc := &client.newsletterNames
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if e, ok := nc.entries[jid]; ok && time.Now().Before(e.expires) {
+		return e.name
+	}
+
+	wc := client.GetClient()
+	if wc == nil {
+		return jid.String()
+	}
+	e := newsletterNameEntry{name: jid.String(), expires: time.Now().Add(newsletterNameRetry)}
+	info, err := wc.GetNewsletterInfo(context.Background(), jid)
+	if err == nil && info != nil && info.ThreadMeta.Name.Text != "" {
+		e = newsletterNameEntry{
+			name:    store.SanitizeText(info.ThreadMeta.Name.Text),
+			expires: time.Now().Add(newsletterNameTTL),
+		}
+	}
+	if nc.entries == nil {
+		nc.entries = make(map[types.JID]newsletterNameEntry)
+	}
+	nc.entries[jid] = e
+	return e.name
+}
@@ -0,0 +1,25 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestNewsletterNameCached(t *testing.T) {
+	c := newTestClient(t)
+	jid := types.NewJID("120363000000000000", types.NewsletterServer)
+	c.newsletterNames.entries = map[types.JID]newsletterNameEntry{
+		jid: {name: "Daily News", expires: time.Now().Add(time.Minute)},
+	}
+	// Not connected, so the name can only come from the cache.
+	if got := newsletterName(c, jid); got != "Daily News" {
+		t.Fatalf("got %q, want the cached name", got)
+	}
+
+	c.newsletterNames.entries[jid] = newsletterNameEntry{name: "Daily News", expires: time.Now().Add(-time.Second)}
+	if got := newsletterName(c, jid); got != jid.String() {
+		t.Fatalf("got %q after expiry, want the JID", got)
+	}
+}
@@ -0,0 +1,38 @@
+package bridge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The session store holds the credentials of the linked account, so it is
+// private to the bridge's user whatever permissions the rest of the data
+// directory has.
+const (
+	sessionDirMode  os.FileMode = 0o700
+	sessionFileMode os.FileMode = 0o600
+)
+
+// SetFileModes sets the permissions of the media and avatar directories and
+// the files saved in them. They default to 0700 and 0600.
+func (c *Client) SetFileModes(dir, file os.FileMode) {
+	c.dirMode = dir
+	c.fileMode = file
+}
+
+// restrictSessions tightens the permissions of the session store directory
+// and its database files, which earlier versions created readable by other
+// local users.
+func restrictSessions(dir string) error {
+	if err := os.Chmod(dir, sessionDirMode); err != nil {
+		return fmt.Errorf("restrict sessions dir: %w", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "whatsapp.db*"))
+	for _, f := range files {
+		if err := os.Chmod(f, sessionFileMode); err != nil {
+			return fmt.Errorf("restrict session store: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// maxNationalLength is the longest number taken for a national one when a
+// default country code is set. National significant numbers rarely exceed
+// ten digits, while international ones are mostly longer.
+const maxNationalLength = 10
+
+// ValidateCountryCode checks a default country code: one to three digits,
+// optionally after a "+". It returns the code without the "+".
+func ValidateCountryCode(code string) (string, error) {
+	code = strings.TrimPrefix(strings.TrimSpace(code), "+")
+	if code == "" || len(code) > 3 || strings.Trim(code, "0123456789") != "" || code[0] == '0' {
+		return "", fmt.Errorf("country code must be 1 to 3 digits, like 31 or +1")
+	}
+	return code, nil
+}
+
+// SetDefaultCountryCode sets the calling code prepended to phone numbers
+// given without one; "" (the default) leaves numbers as they are. The code
+// must have passed ValidateCountryCode.
+func (c *Client) SetDefaultCountryCode(code string) {
+	c.countryCode = strings.TrimPrefix(code, "+")
+}
+
+// recipientJID parses a JID or phone number given by the user, such as a
+// recipient, chat or participant, with parseJIDIn, completing national phone
+// numbers with the default country code. Every user-supplied JID goes
+// through it, so that a number is understood the same way everywhere.
+func (c *Client) recipientJID(s string) (types.JID, error) {
+	return parseJIDIn(s, c.countryCode)
+}
+
+// ChatJID normalizes a chat JID or phone number given by the user the way
+// the chat endpoints understand it, for looking the chat up in the store.
+func (c *Client) ChatJID(s string) (string, error) {
+	jid, err := c.recipientJID(s)
+	if err != nil {
+		return "", err
+	}
+	return jid.String(), nil
+}
+
+// withCountryCode returns the digits of a phone number entered without "+"
+// or "00" in international form, assuming the country with calling code
+// cc. A leading 0 is a national trunk prefix, replaced by cc. Otherwise a
+// number of at most maxNationalLength digits is taken to be national and
+// gets cc prepended, and a longer one is taken to include its country code
+// already and is left alone. Short international numbers are ambiguous and
+// need the "+".
+func withCountryCode(num, cc string) string {
+	switch {
+	case cc == "":
+		return num
+	case strings.HasPrefix(num, "0"):
+		return cc + num[1:]
+	case len(num) <= maxNationalLength:
+		return cc + num
+	}
+	return num
+}
@@ -0,0 +1,75 @@
+package bridge
+
+import "testing"
+
+func TestValidateCountryCode(t *testing.T) {
+	for in, want := range map[string]string{"31": "31", "+1": "1", " 971 ": "971"} {
+		if got, err := ValidateCountryCode(in); err != nil || got != want {
+			t.Errorf("ValidateCountryCode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "+", "0", "031", "1234", "3a", "+-1", "++1"} {
+		if got, err := ValidateCountryCode(in); err == nil {
+			t.Errorf("ValidateCountryCode(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestRecipientJID(t *testing.T) {
+	tests := []struct {
+		name, cc, in, want string
+		wantErr            bool
+	}{
+		{name: "national number", cc: "31", in: "612345678", want: "31612345678@s.whatsapp.net"},
+		{name: "national with trunk prefix", cc: "31", in: "0612345678", want: "31612345678@s.whatsapp.net"},
+		{name: "national with punctuation", cc: "44", in: "07700 900-123", want: "447700900123@s.whatsapp.net"},
+		{name: "leading plus", cc: "31", in: "+15551234567", want: "15551234567@s.whatsapp.net"},
+		{name: "short international with plus", cc: "31", in: "+3531234567", want: "3531234567@s.whatsapp.net"},
+		{name: "leading 00", cc: "31", in: "0044 7700 900123", want: "447700900123@s.whatsapp.net"},
+		{name: "too long to be national", cc: "31", in: "447700900123", want: "447700900123@s.whatsapp.net"},
+		{name: "ten digits is still national", cc: "1", in: "5551234567", want: "15551234567@s.whatsapp.net"},
+		{name: "no country code set", cc: "", in: "0612345678", want: "0612345678@s.whatsapp.net"},
+		{name: "full JID left alone", cc: "31", in: "612345678@s.whatsapp.net", want: "612345678@s.whatsapp.net"},
+		{name: "group JID", cc: "31", in: "120363000000000000@g.us", want: "120363000000000000@g.us"},
+		{name: "empty", cc: "31", in: "", wantErr: true},
+		{name: "no digits", cc: "31", in: "+abc", wantErr: true},
+		{name: "malformed JID", cc: "31", in: "123:abc@s.whatsapp.net", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{}
+			c.SetDefaultCountryCode(tt.cc)
+			jid, err := c.recipientJID(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("recipientJID(%q) = %s, want an error", tt.in, jid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jid.String() != tt.want {
+				t.Errorf("recipientJID(%q) = %s, want %s", tt.in, jid, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatJID(t *testing.T) {
+	c := &Client{}
+	c.SetDefaultCountryCode("31")
+	for in, want := range map[string]string{
+		"0612345678":                 "31612345678@s.whatsapp.net",
+		"+31 6 12345678":             "31612345678@s.whatsapp.net",
+		"31612345678@s.whatsapp.net": "31612345678@s.whatsapp.net",
+		"120363000000000000@g.us":    "120363000000000000@g.us",
+	} {
+		if got, err := c.ChatJID(in); err != nil || got != want {
+			t.Errorf("ChatJID(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if got, err := c.ChatJID("123:abc@s.whatsapp.net"); err == nil {
+		t.Errorf("ChatJID of a malformed JID = %q, want an error", got)
+	}
+}
@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Length limits WhatsApp puts on the profile, in characters.
+const (
+	MaxProfileNameLength  = 25
+	MaxProfileAboutLength = 139
+)
+
+var (
+	// ErrInvalidProfile is returned by UpdateProfile for a name or about
+	// text WhatsApp would not accept.
+	ErrInvalidProfile = errors.New("invalid profile")
+
+	// ErrProfileRestricted is returned when WhatsApp refuses a profile
+	// change for this account, as it does for some business accounts,
+	// whose name must be changed in the WhatsApp Business app.
+	ErrProfileRestricted = errors.New("WhatsApp does not allow this account to change its profile")
+)
+
+// Profile is the linked account's own profile.
+type Profile struct {
+	JID   string `json:"jid"`
+	Name  string `json:"name"`  // the push name contacts see
+	About string `json:"about"` // the about text, "" if it could not be read
+}
+
+// PartialProfileError is returned by UpdateProfile when a change failed
+// after an earlier one was applied. Applied names the fields that were
+// changed, and Profile is the profile as it is afterwards.
+type PartialProfileError struct {
+	Applied []string
+	Profile *Profile
+	Err     error
+}
+
+func (e *PartialProfileError) Error() string { return e.Err.Error() }
+func (e *PartialProfileError) Unwrap() error { return e.Err }
+
+// ProfileUpdate holds the changes UpdateProfile applies; nil fields are
+// left as they are.
+type ProfileUpdate struct {
+	Name  *string `json:"name"`
+	About *string `json:"about"`
+}
+
+// GetProfile returns the linked account's push name, about text and JID.
+func (c *Client) GetProfile(ctx context.Context) (*Profile, error) {
+	if c.client == nil || !c.client.IsConnected() || c.client.Store.ID == nil {
+		return nil, ErrNotConnected
+	}
+	own := c.client.Store.ID.ToNonAD()
+	p := &Profile{JID: own.String(), Name: c.client.Store.PushName}
+
+	infos, err := c.client.GetUserInfo(ctx, []types.JID{own})
+	if err != nil {
+		return nil, fmt.Errorf("get own user info: %w", err)
+	}
+	p.About = infos[own].Status
+	return p, nil
+}
+
+// UpdateProfile applies update to the linked account's profile and returns
+// the profile afterwards. The name is set through the app state shared by
+// all devices of the account, so it fails with ErrAppState until the phone
+// has sent the app state keys. Changes are made one at a time; if the about
+// text fails after the name was set, the error is a *PartialProfileError.
+func (c *Client) UpdateProfile(ctx context.Context, update ProfileUpdate) (*Profile, error) {
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: name must not be empty", ErrInvalidProfile)
+		}
+		if utf8.RuneCountInString(name) > MaxProfileNameLength {
+			return nil, fmt.Errorf("%w: name must be at most %d characters", ErrInvalidProfile, MaxProfileNameLength)
+		}
+		update.Name = &name
+	}
+	if update.About != nil && utf8.RuneCountInString(*update.About) > MaxProfileAboutLength {
+		return nil, fmt.Errorf("%w: about must be at most %d characters", ErrInvalidProfile, MaxProfileAboutLength)
+	}
+	if c.client == nil || !c.client.IsConnected() || c.client.Store.ID == nil {
+		return nil, ErrNotConnected
+	}
+
+	if update.Name != nil {
+		if err := c.client.SendAppState(ctx, appstate.BuildSettingPushName(*update.Name)); err != nil {
+			if isProfileRestricted(err) {
+				return nil, fmt.Errorf("set name: %w", ErrProfileRestricted)
+			}
+			return nil, fmt.Errorf("set name: %w: %v", ErrAppState, err)
+		}
+		c.client.Store.PushName = *update.Name
+		if err := c.client.Store.Save(ctx); err != nil {
+			c.log.Error("failed to save push name", "error", err)
+		}
+	}
+	if update.About != nil {
+		if err := c.client.SetStatusMessage(ctx, *update.About); err != nil {
+			if isProfileRestricted(err) {
+				err = fmt.Errorf("set about: %w", ErrProfileRestricted)
+			} else {
+				err = fmt.Errorf("set about: %w", err)
+			}
+			if update.Name == nil {
+				return nil, err
+			}
+			return nil, c.partialProfile(ctx, []string{"name"}, err)
+		}
+	}
+
+	return c.GetProfile(ctx)
+}
+
+// partialProfile wraps err, which stopped UpdateProfile after the applied
+// fields were changed, with the profile as it is now. If the profile cannot
+// be read back, it is built from the local push name without the about text.
+func (c *Client) partialProfile(ctx context.Context, applied []string, err error) error {
+	p, gerr := c.GetProfile(ctx)
+	if gerr != nil {
+		p = &Profile{JID: c.client.Store.ID.ToNonAD().String(), Name: c.client.Store.PushName}
+	}
+	return &PartialProfileError{Applied: applied, Profile: p, Err: err}
+}
+
+// isProfileRestricted reports whether err is WhatsApp refusing a profile
+// change for the account.
+func isProfileRestricted(err error) bool {
+	return errors.Is(err, whatsmeow.ErrIQForbidden) || errors.Is(err, whatsmeow.ErrIQNotAuthorized) ||
+		errors.Is(err, whatsmeow.ErrIQNotAllowed)
+}
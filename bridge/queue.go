@@ -0,0 +1,44 @@
+package bridge
+
+import "sync"
+
+// chatQueue runs tasks one at a time per chat, in the order they were
+// enqueued, while tasks for different chats run concurrently. A chat's
+// worker goroutine exits as soon as its queue drains.
+type chatQueue struct {
+	mu    sync.Mutex
+	chats map[string][]func()
+}
+
+func newChatQueue() *chatQueue {
+	return &chatQueue{chats: make(map[string][]func())}
+}
+
+// Enqueue schedules task to run after all earlier tasks for chatJID.
+func (q *chatQueue) Enqueue(chatJID string, task func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, running := q.chats[chatJID]
+	q.chats[chatJID] = append(pending, task)
+	if !running {
+		go q.work(chatJID)
+	}
+}
+
+func (q *chatQueue) work(chatJID string) {
+	for {
+		q.mu.Lock()
+		pending := q.chats[chatJID]
+		if len(pending) == 0 {
+			delete(q.chats, chatJID)
+			q.mu.Unlock()
+			return
+		}
+		task := pending[0]
+		q.chats[chatJID] = pending[1:]
+		q.mu.Unlock()
+
+		task()
+	}
+}
@@ -0,0 +1,147 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Points at which incoming messages are marked as read.
+const (
+	ReadReceiptsNever        = "never"          // never send read receipts (default)
+	ReadReceiptsOnReceive    = "on_receive"     // once the message is stored
+	ReadReceiptsOnAgentReply = "on_agent_reply" // once the agent has handled the message
+)
+
+// readReceiptDelay is how long ReadReceipts collects the messages of a
+// sender before marking them read in one receipt.
+const readReceiptDelay = time.Second
+
+// MarkRead sends a read receipt for the messages ids of chatJID, which must
+// all come from senderJID. The sender is required in groups. If read
+// receipts are turned off in the account's privacy settings, WhatsApp only
+// marks the messages read on our own devices and the sender sees no blue
+// ticks. In dry-run mode nothing is sent.
+func (c *Client) MarkRead(ctx context.Context, chatJID, senderJID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	chat, err := c.recipientJID(chatJID)
+	if err != nil {
+		return fmt.Errorf("parse chat JID: %w", err)
+	}
+	var sender types.JID
+	if senderJID != "" {
+		if sender, err = c.recipientJID(senderJID); err != nil {
+			return fmt.Errorf("parse sender JID: %w", err)
+		}
+	}
+	if chat.Server == types.GroupServer && sender.IsEmpty() {
+		return fmt.Errorf("mark read: sender is required in groups")
+	}
+
+	if c.dryRun {
+		c.log.Info("dry run: read receipt not sent", "chat", chatJID, "sender", senderJID, "message_ids", ids)
+		return nil
+	}
+	if c.client == nil || !c.client.IsConnected() {
+		return fmt.Errorf("client is not connected")
+	}
+	if err := c.client.MarkRead(ctx, ids, time.Now(), chat, sender); err != nil {
+		return fmt.Errorf("mark read: %w", err)
+	}
+	return nil
+}
+
+// ReadReceipts marks incoming messages as read, batching the messages of
+// each sender in a chat that arrive within a second of each other into one
+// receipt. A nil *ReadReceipts marks nothing.
+type ReadReceipts struct {
+	client *Client
+	log    *slog.Logger
+
+	mu      sync.Mutex
+	pending map[readKey][]string
+	closed  bool
+}
+
+// readKey identifies the messages a single receipt can cover.
+type readKey struct {
+	chat, sender string
+}
+
+// NewReadReceipts returns a ReadReceipts sending receipts through client.
+func NewReadReceipts(client *Client, log *slog.Logger) *ReadReceipts {
+	return &ReadReceipts{
+		client:  client,
+		log:     log,
+		pending: make(map[readKey][]string),
+	}
+}
+
+// Mark queues msgID, sent by senderJID in chatJID, to be marked read. The
+// sender is only needed in groups.
+func (r *ReadReceipts) Mark(chatJID, senderJID, msgID string) {
+	if r == nil {
+		return
+	}
+	key := readKey{chat: chatJID}
+	if strings.HasSuffix(chatJID, "@g.us") {
+		key.sender = senderJID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	ids, waiting := r.pending[key]
+	r.pending[key] = append(ids, msgID)
+	if !waiting {
+		time.AfterFunc(readReceiptDelay, func() { r.flush(key) })
+	}
+}
+
+// flush sends the receipt for the messages queued under key.
+func (r *ReadReceipts) flush(key readKey) {
+	r.mu.Lock()
+	ids := r.pending[key]
+	delete(r.pending, key)
+	r.mu.Unlock()
+	r.send(key, ids)
+}
+
+func (r *ReadReceipts) send(key readKey, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.client.MarkRead(ctx, key.chat, key.sender, ids); err != nil {
+		r.log.Warn("failed to send read receipt", "error", err, "chat", key.chat, "messages", len(ids))
+		return
+	}
+	r.log.Debug("read receipt sent", "chat", key.chat, "messages", len(ids))
+}
+
+// Close sends the receipts still queued and stops queueing new ones. It
+// must be called before the client disconnects.
+func (r *ReadReceipts) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[readKey][]string)
+	r.closed = true
+	r.mu.Unlock()
+
+	for key, ids := range pending {
+		r.send(key, ids)
+	}
+}
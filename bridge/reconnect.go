@@ -2,6 +2,7 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"time"
 )
@@ -12,7 +13,8 @@ const maxBackoff = 5 * time.Minute
 // Reconnectable is implemented by the bridge client.
 type Reconnectable interface {
 	IsConnected() bool
-	HasSession() bool // true if there's a stored WhatsApp session (not fresh/logged-out)
+	HasSession() bool           // true if there's a stored WhatsApp session (not fresh/logged-out)
+	ManuallyDisconnected() bool // true while disconnected on request; no reconnect is attempted
 	Connect(ctx context.Context) error
 }
 
@@ -22,7 +24,8 @@ type Reconnectable interface {
 // The loop:
 //  1. Ticker fires every interval.
 //  2. If connected, reset backoff and continue.
-//  3. If no stored session (fresh device or logged out), skip.
+//  3. If disconnected on request, or there is no stored session (fresh
+//     device or logged out), skip.
 //  4. Attempt reconnect with a per-attempt timeout equal to the current backoff.
 //  5. On failure, double the backoff (capped at 5 minutes).
 //  6. On success, reset the backoff.
@@ -55,6 +58,11 @@ func reconnectLoop(ctx context.Context, client Reconnectable, interval time.Dura
 				continue
 			}
 
+			if client.ManuallyDisconnected() {
+				log.Debug("disconnected on request, skipping reconnect")
+				continue
+			}
+
 			if !client.HasSession() {
 				// No stored session — nothing to reconnect to.
 				log.Debug("no stored session, skipping reconnect")
@@ -67,6 +75,10 @@ func reconnectLoop(ctx context.Context, client Reconnectable, interval time.Dura
 			attemptCtx, cancel := context.WithTimeout(ctx, backoff)
 			err := client.Connect(attemptCtx)
 			cancel()
+			if errors.Is(err, ErrManuallyDisconnected) {
+				// Disconnected on request since the check above.
+				continue
+			}
 
 			if err != nil {
 				log.Warn("reconnect failed", "error", err, "next_backoff", backoff*2)
@@ -0,0 +1,75 @@
+package bridge
+
+import (
+	"strings"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// RecordSent persists a message we sent to st so that it appears in chat
+// history and can accumulate delivery receipts. Failures are logged, not
+// returned: the message has already gone out.
+func (c *Client) RecordSent(st *store.MessageStore, sent *SentMessage, msgType, content, mediaPath string) {
+	msg := &store.Message{
+		ID:        sent.ID,
+		ChatJID:   sent.ChatJID,
+		SenderJID: sent.SenderJID,
+		Content:   content,
+		MsgType:   msgType,
+		MediaPath: mediaPath,
+		Timestamp: sent.Timestamp.Unix(),
+		IsFromMe:  true,
+		IsGroup:   strings.HasSuffix(sent.ChatJID, "@g.us"),
+		Status:    store.StatusSent,
+		DryRun:    sent.DryRun,
+		QuotedID:  sent.QuotedID,
+	}
+	if err := st.SaveMessage(msg); err != nil {
+		c.log.Error("failed to save sent message", "error", err, "message_id", sent.ID)
+	}
+}
+
+// RecordFailed persists a message to to that could not be sent, with the
+// send error, under a new ID so that it can be retried.
+func (c *Client) RecordFailed(st *store.MessageStore, to, msgType, content string, sendErr error) {
+	failed, err := c.FailedMessage(to)
+	if err != nil {
+		return
+	}
+	msg := &store.Message{
+		ID:        failed.ID,
+		ChatJID:   failed.ChatJID,
+		SenderJID: failed.SenderJID,
+		Content:   content,
+		MsgType:   msgType,
+		Timestamp: failed.Timestamp.Unix(),
+		IsFromMe:  true,
+		IsGroup:   strings.HasSuffix(failed.ChatJID, "@g.us"),
+		Status:    store.StatusFailed,
+		Error:     sendErr.Error(),
+	}
+	if err := st.SaveMessage(msg); err != nil {
+		c.log.Error("failed to save failed message", "error", err, "message_id", failed.ID)
+	}
+}
+
+// RecordSentText records the parts of a text send that went out and, after
+// an error, the rest of text as one failed message. It returns the IDs of
+// the sent parts.
+func (c *Client) RecordSentText(st *store.MessageStore, to, text string, sent []*SentMessage, err error) []string {
+	ids := make([]string, len(sent))
+	rest := text
+	for i, m := range sent {
+		c.RecordSent(st, m, "text", m.Content, "")
+		ids[i] = m.ID
+		if j := strings.Index(rest, m.Content); j >= 0 {
+			rest = rest[j+len(m.Content):]
+		}
+	}
+	if err != nil {
+		if rest = strings.TrimSpace(rest); rest != "" {
+			c.RecordFailed(st, to, "text", rest, err)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,66 @@
+package bridge
+
+import (
+	"strings"
+	"time"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// webhookPayload builds the webhook payload of a stored incoming message.
+// Product and order details are not stored, so callers that have them fill
+// them in.
+func webhookPayload(msg *store.Message, signer *MediaSigner) *WebhookPayload {
+	chatType := "dm"
+	switch {
+	case msg.IsGroup:
+		chatType = "group"
+	case strings.HasSuffix(msg.ChatJID, "@newsletter"):
+		chatType = "newsletter"
+	}
+
+	payload := &WebhookPayload{
+		From:       msg.ChatJID,
+		Name:       msg.SenderName,
+		Message:    msg.Content,
+		Timestamp:  msg.Timestamp,
+		Type:       msg.MsgType,
+		MediaURL:   msg.MediaPath,
+		ChatType:   chatType,
+		GroupName:  msg.GroupName,
+		MessageID:  msg.ID,
+		SelectedID: msg.SelectedID,
+
+		SenderPlatform: msg.SenderPlatform,
+
+		senderJID: msg.SenderJID,
+	}
+	if msg.HasMediaKeys() {
+		payload.MediaDownloadURL = signer.URL(msg.ID)
+	}
+	return payload
+}
+
+// Replayable reports whether msg is one the webhook is sent for: an
+// incoming message other than a system notification.
+func Replayable(msg *store.Message) bool {
+	return !msg.IsFromMe && msg.MsgType != MsgTypeSystem && msg.ChatJID != "status@broadcast"
+}
+
+// ReplayPayload rebuilds the webhook payload of the stored message msg, for
+// WebhookSender.Replay, flagged as a replay. It carries the chat's current
+// labels and mute state, and lacks the product and order details of commerce messages,
+// which are not stored.
+func ReplayPayload(msg *store.Message, msgStore *store.MessageStore, signer *MediaSigner) (*WebhookPayload, error) {
+	payload := webhookPayload(msg, signer)
+	labels, err := msgStore.GetChatLabels(msg.ChatJID)
+	if err != nil {
+		return nil, err
+	}
+	payload.Labels = labels
+	if payload.Muted, err = msgStore.IsChatMuted(msg.ChatJID, time.Now()); err != nil {
+		return nil, err
+	}
+	payload.Replay = true
+	return payload, nil
+}
@@ -0,0 +1,207 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// chunkDelay separates the parts of a long text message so they arrive in
+// order.
+const chunkDelay = 500 * time.Millisecond
+
+// Content is what a message carries. Text alone is a text message; with
+// File it is the file's caption, and with Buttons or List the text shown
+// above them. Sticker is an image sent as a sticker, which has no text. At
+// most one of File, Sticker, Buttons and List is set.
+type Content struct {
+	Text    string
+	File    *File
+	Sticker []byte
+	Buttons []Button
+	List    *List
+}
+
+// File is a file to send. Its MIME type decides how it is sent: as an image,
+// video, audio (Ogg/Opus as a voice note) or document. The contents are
+// Data, or are read from Reader when it is set, so that large files need
+// not be held in memory; Size is then their length.
+type File struct {
+	Data     []byte
+	Reader   io.ReadSeeker
+	Size     int64
+	Mimetype string
+	Filename string
+}
+
+// size returns the length of the file's contents.
+func (f *File) size() int64 {
+	if f.Reader != nil {
+		return f.Size
+	}
+	return int64(len(f.Data))
+}
+
+// contents returns the file's contents, reading them from Reader if it is
+// set.
+func (f *File) contents() ([]byte, error) {
+	if f.Reader == nil {
+		return f.Data, nil
+	}
+	if _, err := f.Reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f.Reader)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Reader.Seek(0, io.SeekStart)
+	return data, err
+}
+
+// kind names the content for error messages.
+func (ct Content) kind() string {
+	switch {
+	case ct.File != nil:
+		return "file"
+	case ct.Sticker != nil:
+		return "sticker"
+	case len(ct.Buttons) > 0:
+		return "buttons"
+	case ct.List != nil:
+		return "list"
+	}
+	return "text"
+}
+
+// SendOptions change how a message is sent, whatever its content.
+type SendOptions struct {
+	// Quote makes the message a reply quoting another message.
+	Quote *Quote
+
+	// ID, if set, is used as the ID of the (first) message instead of a
+	// new one.
+	ID string
+}
+
+// contextInfo returns the message context the options call for, or nil.
+func (o SendOptions) contextInfo() *waProto.ContextInfo {
+	if o.Quote == nil {
+		return nil
+	}
+	return o.Quote.contextInfo()
+}
+
+// Send sends content to the specified JID or phone number. Text longer than
+// the configured maximum length is sent as several messages, in order and a
+// moment apart, split on paragraph or word boundaries where possible; the
+// options apply to the first. It returns every message sent; if a later part
+// fails, the parts already sent are returned along with the error.
+func (c *Client) Send(ctx context.Context, to string, content Content, opts SendOptions) ([]*SentMessage, error) {
+	if err := c.canSend(ctx); err != nil {
+		return nil, err
+	}
+
+	jid, err := c.recipientJID(to)
+	if err != nil {
+		return nil, fmt.Errorf("parse recipient JID: %w", err)
+	}
+
+	var msgs []*waProto.Message
+	var parts []string
+	switch content.kind() {
+	case "file":
+		msg, err := c.fileMessage(ctx, content.File, content.Text)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	case "sticker":
+		msg, err := c.stickerMessage(ctx, content.Sticker)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	case "buttons":
+		if err := ValidateButtons(content.Buttons); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, buttonsMessage(content.Text, content.Buttons))
+	case "list":
+		if err := ValidateList(content.List.ButtonText, content.List.Sections); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, listMessage(content.Text, content.List))
+	default:
+		parts = splitText(content.Text, c.maxTextLength)
+		for _, part := range parts {
+			msgs = append(msgs, &waProto.Message{Conversation: proto.String(part)})
+		}
+	}
+	if info := opts.contextInfo(); info != nil {
+		setContextInfo(msgs[0], info)
+	}
+
+	sent := make([]*SentMessage, 0, len(msgs))
+	for i, msg := range msgs {
+		if i > 0 {
+			select {
+			case <-time.After(chunkDelay):
+			case <-ctx.Done():
+				return sent, ctx.Err()
+			}
+		}
+
+		var id string
+		if i == 0 {
+			id = opts.ID
+		}
+		resp, err := c.send(ctx, jid, msg, id)
+		if err != nil {
+			if len(msgs) > 1 {
+				return sent, fmt.Errorf("send %s message part %d of %d: %w", content.kind(), i+1, len(msgs), err)
+			}
+			return nil, fmt.Errorf("send %s message: %w", content.kind(), err)
+		}
+		m := c.sentMessage(jid, resp)
+		if parts != nil {
+			m.Content = parts[i]
+		}
+		if i == 0 && opts.Quote != nil {
+			m.QuotedID = opts.Quote.ID
+		}
+		sent = append(sent, m)
+	}
+
+	return sent, nil
+}
+
+// setContextInfo attaches info to the content of msg. Plain text becomes
+// extended text, the kind of text message that carries a context.
+func setContextInfo(msg *waProto.Message, info *waProto.ContextInfo) {
+	switch {
+	case msg.Conversation != nil:
+		msg.ExtendedTextMessage = &waProto.ExtendedTextMessage{Text: msg.Conversation, ContextInfo: info}
+		msg.Conversation = nil
+	case msg.ExtendedTextMessage != nil:
+		msg.ExtendedTextMessage.ContextInfo = info
+	case msg.ImageMessage != nil:
+		msg.ImageMessage.ContextInfo = info
+	case msg.VideoMessage != nil:
+		msg.VideoMessage.ContextInfo = info
+	case msg.AudioMessage != nil:
+		msg.AudioMessage.ContextInfo = info
+	case msg.DocumentMessage != nil:
+		msg.DocumentMessage.ContextInfo = info
+	case msg.StickerMessage != nil:
+		msg.StickerMessage.ContextInfo = info
+	case msg.ButtonsMessage != nil:
+		msg.ButtonsMessage.ContextInfo = info
+	case msg.ListMessage != nil:
+		msg.ListMessage.ContextInfo = info
+	}
+}
@@ -0,0 +1,159 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"io/fs"
+	"time"
+)
+
+// vaultConnector opens the in-memory session database through connections
+// that write a snapshot to the vault after every committed change, so that
+// a crash cannot lose Signal session or pre-key updates.
+type vaultConnector struct {
+	drv driver.Driver
+	dsn string
+	v   *sessionVault
+}
+
+func (c *vaultConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultConn{sqliteConn: conn.(sqliteConn), v: c.v}, nil
+}
+
+func (c *vaultConnector) Driver() driver.Driver { return c.drv }
+
+// sqliteConn is the part of the SQLite driver's connection used by the
+// session store.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.SessionResetter
+	driver.Validator
+	sqliteSerializer
+	sqliteRestorer
+}
+
+// vaultConn is a session database connection that saves the vault once a
+// statement outside a transaction, or a transaction, has completed.
+type vaultConn struct {
+	sqliteConn
+	v    *sessionVault
+	inTx bool
+}
+
+// committed saves the vault unless a transaction is still open. The change
+// is already committed to the in-memory database, so a failed save is
+// logged rather than reported to the caller; the next one retries it.
+func (c *vaultConn) committed() {
+	if c.inTx {
+		return
+	}
+	if err := c.v.save(c.sqliteConn, false); err != nil {
+		c.v.log.Error("failed to save session store", "error", err)
+	}
+}
+
+func (c *vaultConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *vaultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.sqliteConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &vaultTx{Tx: tx, c: c}, nil
+}
+
+func (c *vaultConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *vaultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.sqliteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultStmt{Stmt: s, c: c}, nil
+}
+
+func (c *vaultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.sqliteConn.ExecContext(ctx, query, args)
+	if err == nil {
+		c.committed()
+	}
+	return r, err
+}
+
+type vaultTx struct {
+	driver.Tx
+	c *vaultConn
+}
+
+func (t *vaultTx) Commit() error {
+	err := t.Tx.Commit()
+	t.c.inTx = false
+	if err == nil {
+		t.c.committed()
+	}
+	return err
+}
+
+func (t *vaultTx) Rollback() error {
+	t.c.inTx = false
+	return t.Tx.Rollback()
+}
+
+type vaultStmt struct {
+	driver.Stmt
+	c *vaultConn
+}
+
+func (s *vaultStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	r, err := s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	if err == nil {
+		s.c.committed()
+	}
+	return r, err
+}
+
+func (s *vaultStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+}
+
+// imageFS is a read-only file system holding a single database image, so
+// that SQLite can read the image without it being written to disk.
+type imageFS struct {
+	name  string
+	image []byte
+}
+
+func (f imageFS) Open(name string) (fs.File, error) {
+	if name != f.name {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &imageFile{Reader: bytes.NewReader(f.image), name: name}, nil
+}
+
+// imageFile is an open imageFS file; it is its own fs.FileInfo.
+type imageFile struct {
+	*bytes.Reader
+	name string
+}
+
+func (f *imageFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *imageFile) Close() error               { return nil }
+func (f *imageFile) Name() string               { return f.name }
+func (f *imageFile) Mode() fs.FileMode          { return 0o400 }
+func (f *imageFile) ModTime() time.Time         { return time.Time{} }
+func (f *imageFile) IsDir() bool                { return false }
+func (f *imageFile) Sys() any                   { return nil }
@@ -0,0 +1,346 @@
+package bridge
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"modernc.org/sqlite"
+	"modernc.org/sqlite/vfs"
+)
+
+// sessionMagic starts an encrypted session store file, followed by the
+// nonce and the AES-GCM ciphertext of the SQLite database image.
+const sessionMagic = "OCWSESS1"
+
+var (
+	// ErrSessionKeyRequired is returned when the session store is encrypted
+	// but no key is configured.
+	ErrSessionKeyRequired = errors.New("session store is encrypted; session_key is required")
+
+	// ErrWrongSessionKey is returned when no configured key decrypts the
+	// session store.
+	ErrWrongSessionKey = errors.New("wrong session encryption key")
+)
+
+// SessionKeys encrypt the session store, which holds the credentials of the
+// linked account. With Key set the store is kept encrypted on disk and only
+// decrypted in memory; a plaintext store is encrypted on first use.
+// Previous is only used for reading, so that keys can be rotated: a store
+// it opens is rewritten with Key at once, or in plaintext if Key is nil.
+type SessionKeys struct {
+	Key      []byte
+	Previous []byte
+}
+
+// sessionVault keeps an in-memory session database and writes an
+// encrypted snapshot of it to path after every committed change.
+type sessionVault struct {
+	path string
+	aead cipher.AEAD
+	db   *sql.DB
+	log  *slog.Logger
+
+	mu      sync.Mutex
+	written int64 // total_changes() at the last snapshot
+}
+
+// sqliteSerializer and sqliteRestorer are implemented by the SQLite
+// driver's connections.
+type (
+	sqliteSerializer interface{ Serialize() ([]byte, error) }
+	sqliteRestorer   interface {
+		NewRestore(string) (*sqlite.Backup, error)
+	}
+)
+
+// openSessionDB opens the session database at path with keys. Without a
+// key it returns a nil vault and the caller opens path as usual, after a
+// store encrypted with the previous key has been decrypted back to it.
+// With a key it returns an in-memory database and the vault persisting it.
+func openSessionDB(path string, keys SessionKeys, log *slog.Logger) (*sql.DB, *sessionVault, error) {
+	encPath := path + ".enc"
+	enc, err := os.ReadFile(encPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		enc = nil
+	case err != nil:
+		return nil, nil, fmt.Errorf("read session store: %w", err)
+	}
+
+	var image []byte
+	rewrite := false
+	if enc != nil {
+		if keys.Key == nil && keys.Previous == nil {
+			return nil, nil, ErrSessionKeyRequired
+		}
+		image, rewrite, err = openSessionImage(enc, keys)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if keys.Key == nil {
+		if enc != nil {
+			// Decrypt back to a plaintext store.
+			if err := writeFileAtomic(path, image); err != nil {
+				return nil, nil, fmt.Errorf("write session store: %w", err)
+			}
+			os.Remove(encPath)
+			log.Warn("session store decrypted; it is now stored in plaintext")
+		}
+		return nil, nil, nil
+	}
+
+	if enc == nil {
+		if image, err = readPlainSessionDB(path); err != nil {
+			return nil, nil, err
+		}
+		rewrite = image != nil
+	}
+
+	aead, err := sessionAEAD(keys.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := &sessionVault{path: encPath, aead: aead, log: log}
+	db := sql.OpenDB(&vaultConnector{drv: &sqlite.Driver{}, dsn: "file::memory:?_pragma=foreign_keys(1)", v: v})
+	v.db = db
+	// Every connection to :memory: is a database of its own, so the pool
+	// must keep exactly one.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	if image != nil {
+		if err := v.load(image); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+	}
+	if rewrite {
+		if err := v.snapshot(true); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(path + suffix)
+		}
+		log.Info("session store encrypted", "path", encPath)
+	}
+	return db, v, nil
+}
+
+// openSessionImage decrypts an encrypted session store with Key, falling
+// back to Previous; rewrite reports whether the fallback was needed.
+func openSessionImage(enc []byte, keys SessionKeys) (image []byte, rewrite bool, err error) {
+	for i, key := range [][]byte{keys.Key, keys.Previous} {
+		if key == nil {
+			continue
+		}
+		aead, err := sessionAEAD(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if image, err := openSession(aead, enc); err == nil {
+			return image, i > 0, nil
+		}
+	}
+	return nil, false, ErrWrongSessionKey
+}
+
+// readPlainSessionDB returns the image of the plaintext session database at
+// path, including changes still in its WAL, or nil if there is none.
+func readPlainSessionDB(path string) ([]byte, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return nil, fmt.Errorf("read session store: %w", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read session store: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return nil, fmt.Errorf("read session store: %w", err)
+	}
+	image, err := serializeConn(conn)
+	if err != nil {
+		return nil, fmt.Errorf("read session store: %w", err)
+	}
+	return image, nil
+}
+
+func sessionAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("session encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSession encrypts a database image into the file format.
+func sealSession(aead cipher.AEAD, image []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("bridge: read random nonce: %v", err))
+	}
+	out := append([]byte(sessionMagic), nonce...)
+	return aead.Seal(out, nonce, image, []byte(sessionMagic))
+}
+
+// openSession decrypts a file written by sealSession.
+func openSession(aead cipher.AEAD, data []byte) ([]byte, error) {
+	n := len(sessionMagic) + aead.NonceSize()
+	if len(data) < n || string(data[:len(sessionMagic)]) != sessionMagic {
+		return nil, errors.New("not an encrypted session store")
+	}
+	return aead.Open(nil, data[len(sessionMagic):n], data[n:], []byte(sessionMagic))
+}
+
+// load replaces the in-memory database with image. The image is read
+// through a read-only in-memory file system and copied with SQLite's backup
+// API, so the plaintext never touches the disk. A database read that way
+// cannot be in WAL mode, so the image's header is switched to rollback
+// journal mode first.
+func (v *sessionVault) load(image []byte) error {
+	if len(image) >= 20 {
+		image[18], image[19] = 1, 1
+	}
+	name, fsys, err := vfs.New(imageFS{name: "session.db", image: image})
+	if err != nil {
+		return fmt.Errorf("load session store: %w", err)
+	}
+	defer fsys.Close()
+
+	conn, err := v.db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("load session store: %w", err)
+	}
+	defer conn.Close()
+	err = conn.Raw(func(dc interface{}) error {
+		r, ok := dc.(sqliteRestorer)
+		if !ok {
+			return errors.New("sqlite driver cannot restore")
+		}
+		b, err := r.NewRestore("file:session.db?vfs=" + name + "&mode=ro")
+		if err != nil {
+			return err
+		}
+		if _, err := b.Step(-1); err != nil {
+			b.Finish()
+			return err
+		}
+		return b.Finish()
+	})
+	if err != nil {
+		return fmt.Errorf("load session store: %w", err)
+	}
+	return nil
+}
+
+// snapshot encrypts the database to disk if it changed since the last
+// snapshot, or regardless with force.
+func (v *sessionVault) snapshot(force bool) error {
+	conn, err := v.db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(dc interface{}) error {
+		return v.save(dc.(*vaultConn).sqliteConn, force)
+	})
+}
+
+// save is snapshot on a driver connection to the database.
+func (v *sessionVault) save(conn sqliteConn, force bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	rows, err := conn.QueryContext(context.Background(), `SELECT total_changes()`, nil)
+	if err != nil {
+		return err
+	}
+	row := make([]driver.Value, 1)
+	err = rows.Next(row)
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	changes, _ := row[0].(int64)
+	if changes == v.written && !force {
+		return nil
+	}
+	image, err := conn.Serialize()
+	if err != nil {
+		return fmt.Errorf("serialize session store: %w", err)
+	}
+	if err := writeFileAtomic(v.path, sealSession(v.aead, image)); err != nil {
+		return fmt.Errorf("write session store: %w", err)
+	}
+	v.written = changes
+	return nil
+}
+
+// close writes a final snapshot, in case a change was not saved. The
+// database itself is closed by its owner afterwards.
+func (v *sessionVault) close() error {
+	return v.snapshot(false)
+}
+
+// serializeConn returns the image of the main database of conn.
+func serializeConn(conn *sql.Conn) ([]byte, error) {
+	var image []byte
+	err := conn.Raw(func(dc interface{}) error {
+		s, ok := dc.(sqliteSerializer)
+		if !ok {
+			return errors.New("sqlite driver cannot serialize")
+		}
+		var err error
+		image, err = s.Serialize()
+		return err
+	})
+	return image, err
+}
+
+// writeFileAtomic replaces path with data, readable by the owner only,
+// through a synced temporary file so that a crash leaves the old or the new
+// contents.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(sessionFileMode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
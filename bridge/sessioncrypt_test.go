@@ -0,0 +1,95 @@
+package bridge
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionVaultSavesEveryCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "whatsapp.db")
+	keys := SessionKeys{Key: bytes.Repeat([]byte{7}, 32)}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, v, err := openSessionDB(path, keys, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE kv (k TEXT PRIMARY KEY, v TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO kv VALUES ('a', '1')`); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO kv VALUES ('b', '2')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read the file as a crash would leave it: without closing the vault.
+	enc, err := os.ReadFile(path + ".enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enc, []byte("CREATE TABLE kv")) {
+		t.Fatal("session store written in plaintext")
+	}
+	crashed := filepath.Join(t.TempDir(), "whatsapp.db")
+	if err := os.WriteFile(crashed+".enc", enc, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db2, v2, err := openSessionDB(crashed, keys, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db2.QueryRow(`SELECT COUNT(*) FROM kv`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d rows after reopening, want 2", n)
+	}
+
+	for _, c := range []struct {
+		v  *sessionVault
+		db interface{ Close() error }
+	}{{v, db}, {v2, db2}} {
+		if err := c.v.close(); err != nil {
+			t.Fatal(err)
+		}
+		c.db.Close()
+	}
+}
+
+func TestSessionVaultWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "whatsapp.db")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, v, err := openSessionDB(path, SessionKeys{Key: bytes.Repeat([]byte{1}, 32)}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO t VALUES (1)`); err != nil {
+		t.Fatal(err)
+	}
+	v.close()
+	db.Close()
+
+	if _, _, err := openSessionDB(path, SessionKeys{Key: bytes.Repeat([]byte{2}, 32)}, log); err != ErrWrongSessionKey {
+		t.Fatalf("got %v, want ErrWrongSessionKey", err)
+	}
+	if _, _, err := openSessionDB(path, SessionKeys{}, log); err != ErrSessionKeyRequired {
+		t.Fatalf("got %v, want ErrSessionKeyRequired", err)
+	}
+}
@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for sticker sources
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"google.golang.org/protobuf/proto"
+)
+
+// StickerSize is the edge length, in pixels, of the square WebP images
+// WhatsApp shows as stickers.
+const StickerSize = 512
+
+// MaxStickerInput is the largest image accepted for conversion to a sticker.
+const MaxStickerInput = 5 << 20
+
+// Errors returned by Send for sticker content that cannot be converted.
+var (
+	ErrInvalidSticker  = errors.New("sticker must be a PNG, JPEG or static WebP image")
+	ErrStickerTooLarge = fmt.Errorf("sticker image exceeds %d MB", MaxStickerInput>>20)
+)
+
+// ConvertSticker converts an image to a sticker: a StickerSize square WebP
+// with the image scaled to fit and centered on a transparent background.
+// WebP input that is already the right size is used as is, so converting
+// twice is cheap.
+func ConvertSticker(data []byte) ([]byte, error) {
+	if len(data) > MaxStickerInput {
+		return nil, ErrStickerTooLarge
+	}
+	src, format, err := decodeImage(data, ErrInvalidSticker)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	if format == "webp" && b.Dx() == StickerSize && b.Dy() == StickerSize {
+		return data, nil
+	}
+
+	// Fit the longer side, keeping the aspect ratio.
+	w, h := StickerSize, StickerSize
+	if b.Dx() > b.Dy() {
+		h = max(1, b.Dy()*StickerSize/b.Dx())
+	} else {
+		w = max(1, b.Dx()*StickerSize/b.Dy())
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, StickerSize, StickerSize))
+	at := image.Rect((StickerSize-w)/2, (StickerSize-h)/2, (StickerSize+w)/2, (StickerSize+h)/2)
+	draw.CatmullRom.Scale(dst, at, src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, dst, nil); err != nil {
+		return nil, fmt.Errorf("encode sticker: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// stickerMessage converts data to a sticker and uploads it.
+func (c *Client) stickerMessage(ctx context.Context, data []byte) (*waProto.Message, error) {
+	webp, err := ConvertSticker(data)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.upload(ctx, webp, whatsmeow.MediaImage)
+	if err != nil {
+		return nil, fmt.Errorf("upload sticker: %w", err)
+	}
+	return &waProto.Message{
+		StickerMessage: &waProto.StickerMessage{
+			URL:           proto.String(resp.URL),
+			Mimetype:      proto.String("image/webp"),
+			FileLength:    proto.Uint64(uint64(len(webp))),
+			FileSHA256:    resp.FileSHA256,
+			FileEncSHA256: resp.FileEncSHA256,
+			MediaKey:      resp.MediaKey,
+			DirectPath:    proto.String(resp.DirectPath),
+			Width:         proto.Uint32(StickerSize),
+			Height:        proto.Uint32(StickerSize),
+		},
+	}, nil
+}
@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestConvertSticker(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			src.Set(x, y, color.NRGBA{B: 255, A: 255})
+		}
+	}
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ConvertSticker(in.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := webp.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != StickerSize || b.Dy() != StickerSize {
+		t.Fatalf("got %v, want %d×%[2]d", b, StickerSize)
+	}
+	// The 2:1 image fills the middle half; above it is transparent.
+	if _, _, _, a := img.At(StickerSize/2, 10).RGBA(); a != 0 {
+		t.Errorf("top margin alpha = %d, want 0", a)
+	}
+	if _, _, b, a := img.At(StickerSize/2, StickerSize/2).RGBA(); a>>8 != 255 || b>>8 < 250 {
+		t.Errorf("centre is not opaque blue")
+	}
+
+	again, err := ConvertSticker(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, out) {
+		t.Error("converting a sticker twice changed it")
+	}
+}
+
+func TestConvertStickerRejects(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not an image", []byte("hello"), ErrInvalidSticker},
+		{"file too large", make([]byte, MaxStickerInput+1), ErrStickerTooLarge},
+		{"too many pixels", hugeGIF(t), ErrImageTooLarge},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := ConvertSticker(c.data); !errors.Is(err, c.want) {
+				t.Fatalf("got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
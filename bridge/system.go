@@ -0,0 +1,99 @@
+package bridge
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+// MsgTypeSystem is the type of stored chat notifications, such as a change
+// of the disappearing messages setting, as opposed to messages someone wrote.
+const MsgTypeSystem = "system"
+
+// systemContent classifies messages that only carry protocol or encryption
+// details. It returns the description shown in the chat history, or "" for
+// messages with nothing to show, and false if m is not such a message.
+func systemContent(m *waProto.Message) (string, bool) {
+	switch {
+	case m.GetProtocolMessage() != nil:
+		return protocolDescription(m.GetProtocolMessage()), true
+
+	case m.GetPinInChatMessage() != nil:
+		if m.GetPinInChatMessage().GetType() == waProto.PinInChatMessage_UNPIN_FOR_ALL {
+			return "Message unpinned", true
+		}
+		return "Message pinned", true
+
+	case m.GetSenderKeyDistributionMessage() != nil, m.GetMessageContextInfo() != nil:
+		// A group encryption key handover or bare context: WhatsApp
+		// shows nothing for these.
+		return "", true
+	}
+	return "", false
+}
+
+// protocolDescription describes the protocol messages WhatsApp shows in a
+// chat. Edits and revokes are handled before classification; the rest, such
+// as key shares and sync notifications, are invisible and return "".
+func protocolDescription(pm *waProto.ProtocolMessage) string {
+	switch pm.GetType() {
+	case waProto.ProtocolMessage_EPHEMERAL_SETTING:
+		exp := time.Duration(pm.GetEphemeralExpiration()) * time.Second
+		if exp == 0 {
+			return "Disappearing messages turned off"
+		}
+		return "Disappearing messages set to " + humanDuration(exp)
+	case waProto.ProtocolMessage_SHARE_PHONE_NUMBER:
+		return "Phone number shared"
+	}
+	return ""
+}
+
+// humanDuration formats the disappearing message timers WhatsApp offers:
+// whole days, otherwise hours.
+func humanDuration(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d%day == 0 && d/day == 1:
+		return "24 hours"
+	case d%day == 0:
+		return fmt.Sprintf("%d days", d/day)
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+	return d.String()
+}
+
+// handleIdentityChange notes a contact's new security code in their chat, as
+// WhatsApp does, unless system messages are skipped, and publishes it on the
+// event bus. The notice's ID is derived from the contact and time, so a
+// change reported twice is stored once.
+func handleIdentityChange(client *Client, evt *events.IdentityChange, msgStore *store.MessageStore, opts HandlerOptions, log *slog.Logger) {
+	jid := evt.JID.ToNonAD().String()
+	log.Info("security code changed", "jid", jid, "implicit", evt.Implicit)
+	client.events.Publish(EventIdentity, &IdentityEvent{
+		JID:       jid,
+		Timestamp: evt.Timestamp.Unix(),
+		Implicit:  evt.Implicit,
+	})
+
+	if opts.SkipSystemMessages {
+		return
+	}
+	msg := &store.Message{
+		ID:        fmt.Sprintf("IDENTITY-%s-%d", evt.JID.User, evt.Timestamp.Unix()),
+		ChatJID:   jid,
+		SenderJID: jid,
+		Content:   "Security code changed",
+		MsgType:   MsgTypeSystem,
+		Timestamp: evt.Timestamp.Unix(),
+	}
+	if err := msgStore.SaveMessage(msg); err != nil {
+		log.Error("failed to save security code change", "error", err, "jid", jid)
+	}
+}
@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"github.com/openclaw/whatsapp/store"
+)
+
+func TestHandleIdentityChange(t *testing.T) {
+	dir := t.TempDir()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c, err := NewClient(dir, SessionKeys{}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	st, err := store.NewMessageStore(filepath.Join(dir, "messages.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	_, _, evs, unsubscribe := c.Events().Subscribe(0)
+	defer unsubscribe()
+
+	evt := &events.IdentityChange{
+		JID:       types.NewJID("31612345678", types.DefaultUserServer),
+		Timestamp: time.Unix(1760000000, 0),
+	}
+	// A change reported twice is stored once.
+	handleIdentityChange(c, evt, st, HandlerOptions{}, log)
+	handleIdentityChange(c, evt, st, HandlerOptions{}, log)
+
+	ev := <-evs
+	id, ok := ev.Data.(*IdentityEvent)
+	if ev.Type != EventIdentity || !ok || id.JID != "31612345678@s.whatsapp.net" || id.Timestamp != 1760000000 {
+		t.Fatalf("published %s %+v", ev.Type, ev.Data)
+	}
+
+	msgs, _, err := st.GetMessages("31612345678@s.whatsapp.net", store.MessageFilter{}, store.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].MsgType != MsgTypeSystem || msgs[0].Content != "Security code changed" {
+		t.Fatalf("stored %+v", msgs)
+	}
+}
@@ -0,0 +1,179 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// MaxTypedSends is how many SendTyped messages may be waiting to go out at
+// once; more are refused with ErrTooManyTypedSends.
+const MaxTypedSends = 100
+
+// Errors returned by SendTyped when it cannot take the message.
+var (
+	ErrTooManyTypedSends = errors.New("too many messages are waiting for their typing indicator")
+	ErrShuttingDown      = errors.New("the bridge is shutting down")
+)
+
+// TypingOptions set how long SendTyped shows the typing indicator: PerChar
+// for each character of the text, but at least Min and, if Max is set, at
+// most Max. The indicator is repeated every Refresh, as WhatsApp clients
+// drop it after a while; zero sends it once.
+type TypingOptions struct {
+	PerChar time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Refresh time.Duration
+}
+
+// Duration returns how long typing text takes.
+func (o TypingOptions) Duration(text string) time.Duration {
+	d := time.Duration(utf8.RuneCountInString(text)) * o.PerChar
+	if d < o.Min {
+		d = o.Min
+	}
+	if o.Max > 0 && d > o.Max {
+		d = o.Max
+	}
+	return d
+}
+
+// SendTyped sends content the way a person would: it shows the typing
+// indicator in the chat for typing.Duration of the text, sends, and clears
+// the indicator. Only the checks Send makes up front happen before it
+// returns, with the ID the first message will have; the rest runs in the
+// background, outliving ctx but keeping its dry-run setting, and ends by
+// calling done with what Send returned. FinishTypedSends waits for it.
+func (c *Client) SendTyped(ctx context.Context, to string, content Content, opts SendOptions, typing TypingOptions, done func([]*SentMessage, error)) (string, error) {
+	if err := c.canSend(ctx); err != nil {
+		return "", err
+	}
+	jid, err := c.recipientJID(to)
+	if err != nil {
+		return "", err
+	}
+	hurry, err := c.typed.start()
+	if err != nil {
+		return "", err
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	opts.ID = c.newMessageID(ctx)
+	go func() {
+		defer c.typed.done()
+		stop := c.keepTyping(ctx, jid, typing.Refresh)
+		wait := time.NewTimer(typing.Duration(content.Text))
+		select {
+		case <-wait.C:
+		case <-hurry:
+			wait.Stop()
+		}
+		sent, err := c.Send(ctx, to, content, opts)
+		stop()
+		done(sent, err)
+	}()
+	return opts.ID, nil
+}
+
+// FinishTypedSends sends the messages SendTyped is still showing the typing
+// indicator for without waiting further, and returns once they are sent.
+// SendTyped refuses new messages from then on. It is called on shutdown,
+// before disconnecting.
+func (c *Client) FinishTypedSends() {
+	c.typed.finish()
+}
+
+// typedSends tracks the background sends of SendTyped.
+type typedSends struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	active int
+	closed bool
+	hurry  chan struct{} // closed by finish
+}
+
+// start registers a send, returning the channel that is closed when it
+// should stop typing and send at once.
+func (t *typedSends) start() (<-chan struct{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrShuttingDown
+	}
+	if t.active >= MaxTypedSends {
+		return nil, ErrTooManyTypedSends
+	}
+	if t.hurry == nil {
+		t.hurry = make(chan struct{})
+	}
+	t.active++
+	t.wg.Add(1)
+	return t.hurry, nil
+}
+
+func (t *typedSends) done() {
+	t.mu.Lock()
+	t.active--
+	t.mu.Unlock()
+	t.wg.Done()
+}
+
+func (t *typedSends) finish() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		if t.hurry != nil {
+			close(t.hurry)
+		}
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+}
+
+// keepTyping shows the typing indicator in the chat with jid, repeating it
+// every refresh if that is set, until the returned function is called; that
+// clears the indicator.
+func (c *Client) keepTyping(ctx context.Context, jid types.JID, refresh time.Duration) (stop func()) {
+	c.chatPresence(ctx, jid, types.ChatPresenceComposing)
+	if refresh <= 0 {
+		return func() { c.chatPresence(ctx, jid, types.ChatPresencePaused) }
+	}
+
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				c.chatPresence(ctx, jid, types.ChatPresenceComposing)
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-finished
+		c.chatPresence(ctx, jid, types.ChatPresencePaused)
+	}
+}
+
+// chatPresence sends a chat presence to jid, except in a dry run. Failures
+// only cost the indicator, so they are logged at debug.
+func (c *Client) chatPresence(ctx context.Context, jid types.JID, state types.ChatPresence) {
+	wc := c.GetClient()
+	if wc == nil || c.isDryRun(ctx) {
+		return
+	}
+	if err := wc.SendChatPresence(ctx, jid, state, ""); err != nil {
+		c.log.Debug("chat presence failed", "error", err, "chat", jid.String(), "state", state)
+	}
+}
@@ -0,0 +1,83 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestTypingDuration(t *testing.T) {
+	o := TypingOptions{PerChar: 100 * time.Millisecond, Min: time.Second, Max: 3 * time.Second}
+	for _, c := range []struct {
+		text string
+		want time.Duration
+	}{
+		{"hi", time.Second},
+		{"twenty characters!!!", 2 * time.Second},
+		{"héllo wörld, this is long", 2500 * time.Millisecond}, // runes, not bytes
+		{string(make([]byte, 100)), 3 * time.Second},
+	} {
+		if got := o.Duration(c.text); got != c.want {
+			t.Errorf("Duration(%q) = %v, want %v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestFinishTypedSends(t *testing.T) {
+	c, err := NewClient(t.TempDir(), SessionKeys{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := WithDryRun(context.Background())
+
+	sent := make(chan error, 1)
+	id, err := c.SendTyped(ctx, "31612345678@s.whatsapp.net", Content{Text: "hello"}, SendOptions{}, TypingOptions{Min: time.Hour}, func(_ []*SentMessage, err error) {
+		sent <- err
+	})
+	if err != nil || id == "" {
+		t.Fatalf("SendTyped = %q, %v", id, err)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		c.FinishTypedSends()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FinishTypedSends did not cut the typing short")
+	}
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	default:
+		t.Fatal("FinishTypedSends returned before the message was sent")
+	}
+
+	if _, err := c.SendTyped(ctx, "31612345678@s.whatsapp.net", Content{Text: "late"}, SendOptions{}, TypingOptions{}, func([]*SentMessage, error) {}); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("got %v after finishing, want ErrShuttingDown", err)
+	}
+}
+
+func TestTypedSendsLimit(t *testing.T) {
+	var ts typedSends
+	for i := 0; i < MaxTypedSends; i++ {
+		if _, err := ts.start(); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+	}
+	if _, err := ts.start(); !errors.Is(err, ErrTooManyTypedSends) {
+		t.Fatalf("got %v, want ErrTooManyTypedSends", err)
+	}
+	ts.done()
+	if _, err := ts.start(); err != nil {
+		t.Fatalf("start after done: %v", err)
+	}
+}
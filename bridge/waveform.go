@@ -0,0 +1,178 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/pion/opus"
+)
+
+// OpusVoiceMimetype is the MIME type WhatsApp uses for voice notes.
+const OpusVoiceMimetype = "audio/ogg; codecs=opus"
+
+// waveformLength is the number of samples in a voice note waveform, each
+// 0-100.
+const waveformLength = 64
+
+// opusSampleRate is the rate Ogg granule positions of Opus streams count in,
+// whatever the input rate was.
+const opusSampleRate = 48000
+
+// waveformSampleRate is the rate voice notes are decoded at for their
+// waveform, and maxOpusPacketMS the longest audio an Opus packet holds.
+const (
+	waveformSampleRate = 16000
+	maxOpusPacketMS    = 120
+)
+
+// IsOpusOgg reports whether data is an Ogg file carrying an Opus stream, the
+// format of WhatsApp voice notes.
+func IsOpusOgg(data []byte) bool {
+	pkts, _, err := readOggPackets(data, 1)
+	return err == nil && len(pkts) == 1 && bytes.HasPrefix(pkts[0], []byte("OpusHead"))
+}
+
+// voiceNoteDuration returns the duration in seconds of an Ogg/Opus voice
+// note, from the granule position of its last page.
+func voiceNoteDuration(data []byte) (uint32, error) {
+	pkts, lastGranule, err := readOggPackets(data, -1)
+	if err != nil {
+		return 0, err
+	}
+	preSkip, err := opusPreSkip(pkts)
+	if err != nil {
+		return 0, err
+	}
+	samples := lastGranule - preSkip
+	if samples <= 0 {
+		return 0, errors.New("Ogg/Opus stream has no audio")
+	}
+	return uint32((samples + opusSampleRate - 1) / opusSampleRate), nil
+}
+
+// voiceNoteWaveform decodes an Ogg/Opus voice note and returns its
+// amplitude envelope: the RMS level of each of waveformLength equal slices
+// of the audio, scaled so that the loudest is 100.
+func voiceNoteWaveform(data []byte) ([]byte, error) {
+	pkts, lastGranule, err := readOggPackets(data, -1)
+	if err != nil {
+		return nil, err
+	}
+	preSkip, err := opusPreSkip(pkts)
+	if err != nil {
+		return nil, err
+	}
+	// Decoded at a low rate: the envelope needs no high frequencies.
+	skip := preSkip * waveformSampleRate / opusSampleRate
+	total := lastGranule*waveformSampleRate/opusSampleRate - skip
+	if total <= 0 {
+		return nil, errors.New("Ogg/Opus stream has no audio")
+	}
+	dec, err := opus.NewDecoderWithOutput(waveformSampleRate, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sums   [waveformLength]float64
+		counts [waveformLength]int64
+		pcm    = make([]float32, waveformSampleRate*maxOpusPacketMS/1000)
+		pos    = -skip
+	)
+	for _, p := range pkts[2:] { // pkts[1] is OpusTags
+		n, err := dec.DecodeToFloat32(p, pcm)
+		if err != nil {
+			return nil, fmt.Errorf("decode Opus packet: %w", err)
+		}
+		for _, v := range pcm[:n] {
+			if pos >= 0 && pos < total {
+				bucket := pos * waveformLength / total
+				sums[bucket] += float64(v) * float64(v)
+				counts[bucket]++
+			}
+			pos++
+		}
+	}
+
+	var levels [waveformLength]float64
+	peak := 0.0
+	for i := range levels {
+		if counts[i] > 0 {
+			levels[i] = math.Sqrt(sums[i] / float64(counts[i]))
+		}
+		peak = math.Max(peak, levels[i])
+	}
+	waveform := make([]byte, waveformLength)
+	if peak > 0 {
+		for i, v := range levels {
+			waveform[i] = byte(math.Round(v / peak * 100))
+		}
+	}
+	return waveform, nil
+}
+
+// opusPreSkip checks that pkts start with the Opus headers and returns the
+// number of samples at the start of the stream that are not audio.
+func opusPreSkip(pkts [][]byte) (int64, error) {
+	if len(pkts) < 3 || !bytes.HasPrefix(pkts[0], []byte("OpusHead")) || len(pkts[0]) < 19 {
+		return 0, errors.New("not an Ogg/Opus stream")
+	}
+	return int64(binary.LittleEndian.Uint16(pkts[0][10:12])), nil
+}
+
+// readOggPackets splits the logical stream of an Ogg file into packets,
+// stopping after max packets unless max is negative, and returns the
+// granule position of the last page read. Only the first stream of the file
+// is read; CRCs are not checked.
+func readOggPackets(data []byte, max int) (pkts [][]byte, granule int64, err error) {
+	const headerLen = 27
+
+	var serial uint32
+	var cur []byte
+	for first := true; len(data) > 0; first = false {
+		if len(data) < headerLen || !bytes.HasPrefix(data, []byte("OggS")) {
+			return nil, 0, errors.New("not an Ogg file")
+		}
+		nsegs := int(data[26])
+		if len(data) < headerLen+nsegs {
+			return nil, 0, errors.New("truncated Ogg page")
+		}
+		segs := data[headerLen : headerLen+nsegs]
+		body := data[headerLen+nsegs:]
+
+		pageSerial := binary.LittleEndian.Uint32(data[14:18])
+		if first {
+			serial = pageSerial
+		}
+		ours := pageSerial == serial
+		if ours {
+			if g := int64(binary.LittleEndian.Uint64(data[6:14])); g >= 0 {
+				granule = g
+			}
+		}
+
+		n := 0
+		for _, s := range segs {
+			if n+int(s) > len(body) {
+				return nil, 0, errors.New("truncated Ogg page")
+			}
+			if ours {
+				cur = append(cur, body[n:n+int(s)]...)
+				// A segment shorter than 255 bytes ends a packet.
+				if s < 255 {
+					pkts = append(pkts, cur)
+					cur = nil
+					if max >= 0 && len(pkts) >= max {
+						return pkts, granule, nil
+					}
+				}
+			}
+			n += int(s)
+		}
+		data = body[n:]
+	}
+	return pkts, granule, nil
+}
@@ -0,0 +1,92 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// oggPage builds an Ogg page holding one packet shorter than 255 bytes.
+func oggPage(granule int64, packet []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("OggS")
+	b.Write([]byte{0, 0})
+	binary.Write(&b, binary.LittleEndian, granule)
+	binary.Write(&b, binary.LittleEndian, uint32(1)) // serial
+	b.Write(make([]byte, 8))                         // sequence and CRC
+	b.Write([]byte{1, byte(len(packet))})
+	b.Write(packet)
+	return b.Bytes()
+}
+
+// testVoiceNote builds an Ogg/Opus stream of 20 ms CELT packets: silent
+// ones for the first half, and ones that decode to noise for the second.
+func testVoiceNote() []byte {
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, 0) // pre-skip
+	head = append(head, make([]byte, 7)...)
+	data := append(oggPage(0, head), oggPage(0, []byte("OpusTags"))...)
+
+	const toc = 0xf8 // CELT fullband, one 20 ms frame
+	loud := []byte{toc}
+	for i := 0; i < 60; i++ {
+		loud = append(loud, byte(i*37+11))
+	}
+	for i := int64(1); i <= 2*waveformLength; i++ {
+		pkt := []byte{toc} // a frame without data is silence
+		if i > waveformLength {
+			pkt = loud
+		}
+		data = append(data, oggPage(i*opusSampleRate/50, pkt)...)
+	}
+	return data
+}
+
+func TestVoiceNoteDuration(t *testing.T) {
+	data := testVoiceNote()
+	if !IsOpusOgg(data) {
+		t.Fatal("IsOpusOgg = false")
+	}
+	// 128 packets of 20 ms, rounded up.
+	if seconds, err := voiceNoteDuration(data); err != nil || seconds != 3 {
+		t.Fatalf("got %d seconds, %v, want 3", seconds, err)
+	}
+	if _, err := voiceNoteDuration([]byte("not ogg")); err == nil {
+		t.Error("no error for a file that is not Ogg")
+	}
+}
+
+func TestVoiceNoteWaveform(t *testing.T) {
+	waveform, err := voiceNoteWaveform(testVoiceNote())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waveform) != waveformLength {
+		t.Fatalf("got %d samples, want %d", len(waveform), waveformLength)
+	}
+	peak := byte(0)
+	for i, v := range waveform {
+		if i < waveformLength/2 && v != 0 {
+			t.Errorf("sample %d of the silent half is %d", i, v)
+		}
+		if i > waveformLength/2 && v == 0 {
+			t.Errorf("sample %d of the loud half is 0", i)
+		}
+		peak = max(peak, v)
+	}
+	if peak != 100 {
+		t.Errorf("loudest sample is %d, want 100", peak)
+	}
+}
+
+func TestVoiceNoteWaveformUndecodable(t *testing.T) {
+	data := testVoiceNote()
+	// A code 3 packet without its frame count byte cannot be decoded.
+	bad := append(data[:len(data):len(data)], oggPage(int64(2*waveformLength+1)*opusSampleRate/50, []byte{0xfb})...)
+	if _, err := voiceNoteWaveform(bad); err == nil {
+		t.Fatal("no error for an undecodable packet")
+	}
+	if _, err := voiceNoteDuration(bad); err != nil {
+		t.Fatalf("duration of a stream with an undecodable packet: %v", err)
+	}
+}
@@ -3,10 +3,16 @@ package bridge
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -19,49 +25,219 @@ type WebhookPayload struct {
 	Timestamp int64  `json:"timestamp"`
 	Type      string `json:"type"`
 	MediaURL  string `json:"media_url,omitempty"`
+
+	// MediaDownloadURL is a signed URL to fetch the media from the bridge,
+	// when signed media URLs are enabled.
+	MediaDownloadURL string `json:"media_download_url,omitempty"`
+
 	ChatType  string `json:"chat_type"`
 	GroupName string `json:"group_name,omitempty"`
 	MessageID string `json:"message_id"`
+
+	// SelectedID is the button or row ID chosen in a button_reply or
+	// list_reply message.
+	SelectedID string `json:"selected_id,omitempty"`
+
+	// Structured details of product and order messages.
+	Product *Product `json:"product,omitempty"`
+	Order   *Order   `json:"order,omitempty"`
+
+	// SenderPlatform is android, ios, web or desktop when the sender's
+	// device could be told from the message.
+	SenderPlatform string `json:"sender_platform,omitempty"`
+
+	// Labels are the local labels of the chat.
+	Labels []string `json:"labels,omitempty"`
+
+	// Muted is set when the chat is muted on WhatsApp.
+	Muted bool `json:"muted,omitempty"`
+
+	// Replay is set when the payload is sent again on request, rather
+	// than as the message arrives.
+	Replay bool `json:"replay,omitempty"`
+
+	// senderJID is who wrote the message; a read receipt for a group
+	// message must name them.
+	senderJID string
 }
 
 // WebhookFilters controls which messages are forwarded to the webhook endpoint.
 type WebhookFilters struct {
 	DMOnly       bool     // If true, only direct messages are forwarded (groups are dropped).
 	IgnoreGroups []string // Group JIDs to silently ignore.
+	Labels       []string // If set, only chats with one of these labels are forwarded.
+	IgnoreLabels []string // Chats with any of these labels are silently ignored.
+	IgnoreMuted  bool     // If true, muted chats are silently ignored.
+}
+
+// DedupOptions bounds the deduplication map. Zero values select the
+// defaults.
+type DedupOptions struct {
+	TTL        time.Duration // how long a message ID is remembered
+	MaxEntries int           // the oldest IDs are evicted beyond this many
 }
 
+// RequestOptions shape the HTTP request a webhook is delivered with. Zero
+// values select POST and application/json; the body is JSON either way.
+type RequestOptions struct {
+	Method      string // POST, PUT or PATCH
+	ContentType string // Content-Type header sent with the payload
+}
+
+// Request defaults.
+const (
+	defaultWebhookMethod      = http.MethodPost
+	defaultWebhookContentType = "application/json"
+)
+
+// webhookMethods are the methods a webhook may be sent with: those that
+// carry a request body.
+var webhookMethods = map[string]bool{
+	http.MethodPost:  true,
+	http.MethodPut:   true,
+	http.MethodPatch: true,
+}
+
+// Deduplication defaults.
+const (
+	defaultSeenTTL        = 5 * time.Minute
+	defaultSeenMaxEntries = 10000
+)
+
 // WebhookSender delivers webhook payloads to an external HTTP endpoint with
 // deduplication and filtering.
 type WebhookSender struct {
-	url     string
-	filters WebhookFilters
-	seen    map[string]time.Time // message ID -> first seen time (dedup)
-	mu      sync.Mutex
-	client  *http.Client
-	log     *slog.Logger
+	url         string
+	method      string
+	contentType string
+	filters     WebhookFilters
+	seen        map[string]time.Time // message ID -> first seen time (dedup)
+	order       []string             // seen IDs, oldest first
+	seenTTL     time.Duration
+	seenMax     int
+	mu          sync.Mutex
+	client      *http.Client
+	breaker     *breaker
+	log         *slog.Logger
 }
 
-// seenTTL is the time-to-live for entries in the deduplication map.
-const seenTTL = 5 * time.Minute
-
-// NewWebhookSender creates a WebhookSender ready to POST payloads to the given
-// url. If url is empty the sender is effectively a no-op (Send returns nil
-// immediately).
-func NewWebhookSender(url string, filters WebhookFilters, log *slog.Logger) *WebhookSender {
+// NewWebhookSender creates a WebhookSender ready to send payloads to the
+// given url. If url is empty the sender is effectively a no-op (Send returns
+// nil immediately). An invalid url is rejected, as is a loopback or
+// link-local one unless allowInternal is set; see ValidateWebhookURL. So are
+// a method other than POST, PUT or PATCH and a malformed content type.
+func NewWebhookSender(url string, allowInternal bool, req RequestOptions, filters WebhookFilters, dedup DedupOptions, circuit BreakerOptions, log *slog.Logger) (*WebhookSender, error) {
+	url = strings.TrimSpace(url)
+	if url != "" {
+		if err := ValidateWebhookURL(url, allowInternal); err != nil {
+			return nil, err
+		}
+	}
+	req.Method = strings.ToUpper(strings.TrimSpace(req.Method))
+	if req.Method == "" {
+		req.Method = defaultWebhookMethod
+	}
+	if !webhookMethods[req.Method] {
+		return nil, fmt.Errorf("invalid webhook method %q: must be POST, PUT or PATCH", req.Method)
+	}
+	req.ContentType = strings.TrimSpace(req.ContentType)
+	if req.ContentType == "" {
+		req.ContentType = defaultWebhookContentType
+	}
+	if _, _, err := mime.ParseMediaType(req.ContentType); err != nil {
+		return nil, fmt.Errorf("invalid webhook content type %q: %w", req.ContentType, err)
+	}
+	if dedup.TTL <= 0 {
+		dedup.TTL = defaultSeenTTL
+	}
+	if dedup.MaxEntries <= 0 {
+		dedup.MaxEntries = defaultSeenMaxEntries
+	}
 	return &WebhookSender{
-		url:     url,
-		filters: filters,
-		seen:    make(map[string]time.Time),
-		client: &http.Client{
-			Timeout: 10 * time.Second,
+		url:         url,
+		method:      req.Method,
+		contentType: req.ContentType,
+		filters:     filters,
+		seen:        make(map[string]time.Time),
+		seenTTL:     dedup.TTL,
+		seenMax:     dedup.MaxEntries,
+		client:      webhookClient(allowInternal),
+		breaker:     newBreaker("webhook", circuit, log),
+		log:         log,
+	}, nil
+}
+
+// ValidateWebhookURL checks that raw is an absolute http or https URL. Unless
+// allowInternal is set it also refuses loopback, link-local and unspecified
+// hosts, so that a webhook cannot be pointed at services on the bridge host
+// or at cloud metadata endpoints.
+func ValidateWebhookURL(raw string, allowInternal bool) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid webhook URL %q: scheme must be http or https", raw)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("invalid webhook URL %q: missing host", raw)
+	}
+	if allowInternal {
+		return nil
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("webhook URL %q points at the local host; set allow_internal_webhook to allow it", raw)
+	}
+	if ip := net.ParseIP(host); ip != nil && isInternalIP(ip) {
+		return fmt.Errorf("webhook URL %q points at an internal address; set allow_internal_webhook to allow it", raw)
+	}
+	return nil
+}
+
+// isInternalIP reports whether ip is loopback, link-local or unspecified.
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// webhookClient returns the HTTP client webhooks are posted with. Unless
+// allowInternal is set it refuses to connect to internal addresses, which
+// also covers host names resolving to them and redirects.
+func webhookClient(allowInternal bool) *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if allowInternal {
+		return client
+	}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && isInternalIP(ip) {
+				return errInternalWebhook
+			}
+			return nil
 		},
-		log: log,
 	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	client.Transport = transport
+	return client
 }
 
+// errInternalWebhook is returned when a webhook would connect to an internal
+// address.
+var errInternalWebhook = errors.New("webhook resolves to an internal address; set allow_internal_webhook to allow it")
+
 // Send delivers a webhook payload to the configured endpoint. It silently
 // returns nil when no webhook URL is configured, when the message has already
-// been sent (dedup), or when filters exclude the message.
+// been sent (dedup), or when filters exclude the message. While the endpoint
+// is failing and the circuit breaker is open it returns ErrCircuitOpen
+// without trying, and forgets the message ID so that the message is not
+// taken for a duplicate if it is sent again; connection errors and 5xx
+// responses count as failures.
 func (w *WebhookSender) Send(payload *WebhookPayload) error {
 	if w.url == "" {
 		return nil
@@ -79,46 +255,129 @@ func (w *WebhookSender) Send(payload *WebhookPayload) error {
 		return nil
 	}
 
-	// Record this message ID.
+	// Record this message ID, evicting the oldest beyond the cap.
 	w.seen[payload.MessageID] = time.Now()
+	w.order = append(w.order, payload.MessageID)
+	w.cleanupSeenLocked()
 	w.mu.Unlock()
 
-	// Apply filters.
-	if w.filters.DMOnly && payload.ChatType == "group" {
-		w.log.Debug("webhook skipping group message (dm_only)", "message_id", payload.MessageID)
+	if reason := w.filterReason(payload); reason != "" {
+		w.log.Debug("webhook skipping message", "reason", reason, "message_id", payload.MessageID)
 		return nil
 	}
+
+	_, err := w.post(payload)
+	if errors.Is(err, ErrCircuitOpen) {
+		// Never tried: let a redelivery of the message through.
+		w.mu.Lock()
+		delete(w.seen, payload.MessageID)
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// Replay delivers payload again, for messages a consumer lost. Unlike Send
+// it bypasses deduplication and reports what happened: ErrWebhookFiltered
+// when the filters exclude the message, and an error for a non-2xx answer.
+func (w *WebhookSender) Replay(payload *WebhookPayload) error {
+	if w.url == "" {
+		return ErrNoWebhook
+	}
+	if reason := w.filterReason(payload); reason != "" {
+		return fmt.Errorf("%w: %s", ErrWebhookFiltered, reason)
+	}
+
+	status, err := w.post(payload)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("webhook answered HTTP %d", status)
+	}
+	return nil
+}
+
+// Errors returned by Replay.
+var (
+	ErrNoWebhook       = errors.New("no webhook URL is configured")
+	ErrWebhookFiltered = errors.New("excluded by the webhook filters")
+)
+
+// filterReason returns why the filters exclude payload, or "" if they let
+// it through.
+func (w *WebhookSender) filterReason(payload *WebhookPayload) string {
+	if w.filters.DMOnly && payload.ChatType == "group" {
+		return "dm_only"
+	}
 	for _, ignored := range w.filters.IgnoreGroups {
 		if payload.From == ignored || payload.GroupName == ignored {
-			w.log.Debug("webhook skipping ignored group", "group", ignored, "message_id", payload.MessageID)
-			return nil
+			return "ignored group " + ignored
 		}
 	}
+	if len(w.filters.Labels) > 0 && !hasAnyLabel(payload.Labels, w.filters.Labels) {
+		return "chat has none of the webhook labels"
+	}
+	if hasAnyLabel(payload.Labels, w.filters.IgnoreLabels) {
+		return "chat has an ignored label"
+	}
+	if w.filters.IgnoreMuted && payload.Muted {
+		return "chat is muted"
+	}
+	return ""
+}
 
-	// Marshal payload to JSON.
+// post sends payload to the endpoint through the circuit breaker, with the
+// configured method and content type, and returns the HTTP status of the
+// answer.
+func (w *WebhookSender) post(payload *WebhookPayload) (int, error) {
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("webhook marshal payload: %w", err)
+		return 0, fmt.Errorf("webhook marshal payload: %w", err)
+	}
+	req, err := http.NewRequest(w.method, w.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", w.contentType)
+
+	if !w.breaker.allow() {
+		return 0, ErrCircuitOpen
 	}
 
-	// POST to the configured URL.
-	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	resp, err := w.client.Do(req)
 	if err != nil {
+		w.breaker.done(false)
 		w.log.Error("webhook delivery failed", "error", err, "message_id", payload.MessageID)
-		return fmt.Errorf("webhook POST: %w", err)
+		return 0, fmt.Errorf("webhook %s: %w", w.method, err)
 	}
 	defer resp.Body.Close()
+	w.breaker.done(resp.StatusCode < 500)
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		w.log.Info("webhook delivered", "status", resp.StatusCode, "message_id", payload.MessageID)
 	} else {
 		w.log.Warn("webhook non-2xx response", "status", resp.StatusCode, "message_id", payload.MessageID)
 	}
+	return resp.StatusCode, nil
+}
 
-	return nil
+// Configured reports whether a webhook URL is set.
+func (w *WebhookSender) Configured() bool {
+	return w.url != ""
+}
+
+// SetEventBus makes the sender's circuit breaker publish its state changes
+// on bus as EventCircuit events. It must be called before the first Send.
+func (w *WebhookSender) SetEventBus(bus *EventBus) {
+	w.breaker.events = bus
+}
+
+// Circuit returns the state of the sender's circuit breaker.
+func (w *WebhookSender) Circuit() CircuitState {
+	return w.breaker.snapshot()
 }
 
-// CleanupSeen removes deduplication entries older than seenTTL. It is safe for
+// CleanupSeen removes deduplication entries older than the TTL. It is safe for
 // concurrent use. Send() already calls this internally, but it can also be
 // called externally if desired.
 func (w *WebhookSender) CleanupSeen() {
@@ -127,13 +386,35 @@ func (w *WebhookSender) CleanupSeen() {
 	w.cleanupSeenLocked()
 }
 
-// cleanupSeenLocked removes stale entries from the seen map. The caller MUST
+// cleanupSeenLocked removes entries older than the TTL and, while the map
+// exceeds its cap, the oldest remaining ones. Entries are appended to
+// w.order in time order, so only its head needs inspecting. The caller MUST
 // hold w.mu.
 func (w *WebhookSender) cleanupSeenLocked() {
-	cutoff := time.Now().Add(-seenTTL)
-	for id, t := range w.seen {
-		if t.Before(cutoff) {
-			delete(w.seen, id)
+	cutoff := time.Now().Add(-w.seenTTL)
+	n := 0
+	for n < len(w.order) {
+		id := w.order[n]
+		if len(w.seen) <= w.seenMax && !w.seen[id].Before(cutoff) {
+			break
+		}
+		delete(w.seen, id)
+		n++
+	}
+	// Evicted IDs stay in the backing array until append next grows it,
+	// which bounds the waste to the slice's capacity.
+	w.order = w.order[n:]
+}
+
+// hasAnyLabel reports whether labels contains any of want. Labels are
+// compared case-insensitively.
+func hasAnyLabel(labels, want []string) bool {
+	for _, l := range labels {
+		for _, w := range want {
+			if strings.EqualFold(l, strings.TrimSpace(w)) {
+				return true
+			}
 		}
 	}
+	return false
 }
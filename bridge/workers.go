@@ -0,0 +1,89 @@
+package bridge
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// eventQueueSize is the number of events each worker buffers before
+// dispatching blocks, holding back whatsmeow until the worker catches up.
+const eventQueueSize = 256
+
+// EventWorkers is a fixed pool of goroutines that process incoming messages
+// off whatsmeow's event goroutine, so that a slow group info lookup or media
+// download does not stall every event behind it. Each chat is pinned to one
+// worker by a hash of its JID: a chat's events are handled in the order they
+// arrived, and a slow one only holds back the chats sharing its worker.
+//
+// The handler returns, and whatsmeow acknowledges the message, as soon as
+// the task is queued, so a queued message is only processed if the pool is
+// drained with Close before the bridge exits.
+//
+// A nil *EventWorkers runs tasks on the calling goroutine.
+type EventWorkers struct {
+	mu     sync.RWMutex
+	closed bool
+	shards []chan func()
+	wg     sync.WaitGroup
+}
+
+// NewEventWorkers starts n workers. With n < 1 it returns nil, so that
+// events are processed synchronously as before.
+func NewEventWorkers(n int) *EventWorkers {
+	if n < 1 {
+		return nil
+	}
+	w := &EventWorkers{shards: make([]chan func(), n)}
+	for i := range w.shards {
+		ch := make(chan func(), eventQueueSize)
+		w.shards[i] = ch
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for task := range ch {
+				task()
+			}
+		}()
+	}
+	return w
+}
+
+// Dispatch queues task on the worker that owns key, a chat JID. Once the
+// pool is closed, or when it is nil, task runs immediately instead.
+func (w *EventWorkers) Dispatch(key string, task func()) {
+	if w == nil {
+		task()
+		return
+	}
+
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		task()
+		return
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	w.shards[h.Sum32()%uint32(len(w.shards))] <- task
+	w.mu.RUnlock()
+}
+
+// Close stops accepting tasks and waits for the queued ones to finish. Tasks
+// dispatched meanwhile run on the dispatching goroutine, so none are lost.
+func (w *EventWorkers) Close() {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	for _, ch := range w.shards {
+		close(ch)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
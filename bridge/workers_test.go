@@ -0,0 +1,44 @@
+package bridge
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventWorkersCloseDrains(t *testing.T) {
+	w := NewEventWorkers(2)
+
+	var mu sync.Mutex
+	perChat := map[string][]int{}
+	for i := 0; i < 200; i++ {
+		chat := fmt.Sprintf("chat%d", i%5)
+		w.Dispatch(chat, func() {
+			time.Sleep(time.Millisecond / 10)
+			mu.Lock()
+			perChat[chat] = append(perChat[chat], i)
+			mu.Unlock()
+		})
+	}
+	w.Close()
+
+	total := 0
+	for chat, got := range perChat {
+		total += len(got)
+		for j := 1; j < len(got); j++ {
+			if got[j] < got[j-1] {
+				t.Fatalf("%s: tasks ran out of order: %v", chat, got)
+			}
+		}
+	}
+	if total != 200 {
+		t.Fatalf("%d tasks ran before Close returned, want 200", total)
+	}
+
+	ran := false
+	w.Dispatch("chat0", func() { ran = true })
+	if !ran {
+		t.Fatal("task dispatched after Close did not run synchronously")
+	}
+}
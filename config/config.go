@@ -17,34 +17,176 @@ import (
 type WebhookFilters struct {
 	DMOnly       bool     `yaml:"dm_only"`
 	IgnoreGroups []string `yaml:"ignore_groups"`
+	Labels       []string `yaml:"labels"`        // only forward chats with one of these labels
+	IgnoreLabels []string `yaml:"ignore_labels"` // never forward chats with these labels
+	IgnoreMuted  bool     `yaml:"ignore_muted"`  // never forward chats muted on WhatsApp
+}
+
+// WebhookBreaker configures the circuit breaker that stops webhook
+// deliveries while the endpoint is down.
+type WebhookBreaker struct {
+	Threshold int      `yaml:"failure_threshold"` // consecutive failures that open the circuit
+	Cooldown  Duration `yaml:"cooldown"`          // how long it stays open before a probe
+}
+
+// MediaURLs configures signed media URLs, which let webhook consumers on
+// other hosts fetch a message's media from GET /media/{id}.
+type MediaURLs struct {
+	Secret  string   `yaml:"secret"`   // HMAC key; setting it enables signed URLs
+	BaseURL string   `yaml:"base_url"` // the bridge's address as seen by consumers
+	TTL     Duration `yaml:"ttl"`      // how long a URL stays valid
+}
+
+// WebhookDedup bounds the in-memory set of message IDs used to suppress
+// duplicate webhooks.
+type WebhookDedup struct {
+	TTL        Duration `yaml:"ttl"`         // how long a message ID is remembered
+	MaxEntries int      `yaml:"max_entries"` // oldest IDs are evicted beyond this
 }
 
 // AgentConfig controls the OpenClaw agent integration. When enabled, incoming
 // messages trigger an agent via shell command or HTTP POST.
 type AgentConfig struct {
-	Enabled       bool     `yaml:"enabled"`
-	Mode          string   `yaml:"mode"`           // "command" or "http"
-	Command       string   `yaml:"command"`        // shell command template (command mode)
-	HTTPURL       string   `yaml:"http_url"`       // endpoint to POST to (http mode)
-	ReplyEndpoint string   `yaml:"reply_endpoint"` // bridge reply URL sent to agent
-	SystemPrompt  string   `yaml:"system_prompt"`  // custom system prompt for the agent personality
-	IgnoreFromMe  bool     `yaml:"ignore_from_me"`
-	DMOnly        bool     `yaml:"dm_only"`
-	Timeout       Duration `yaml:"timeout"`
-	Allowlist     []string `yaml:"allowlist"`      // only respond to these JIDs/numbers (empty = all)
-	Blocklist     []string `yaml:"blocklist"`      // never respond to these JIDs/numbers
+	Enabled         bool     `yaml:"enabled"`
+	Mode            string   `yaml:"mode"`              // "command" or "http"
+	Command         string   `yaml:"command"`           // shell command template (command mode)
+	CommandShell    string   `yaml:"command_shell"`     // interpreter and flags command runs with, e.g. "bash -c"
+	CommandArgs     []string `yaml:"command_args"`      // argv template run without a shell, instead of command
+	StaticCommand   bool     `yaml:"static_command"`    // run the command as written; message fields come from OC_WA_* variables
+	ReplyWithOutput bool     `yaml:"reply_with_output"` // send the command's stdout to the chat as the reply
+	ErrorReply      string   `yaml:"error_reply"`       // sent to the chat when the command fails (empty = nothing)
+	HTTPURL         string   `yaml:"http_url"`          // endpoint to POST to (http mode)
+	ReplyEndpoint   string   `yaml:"reply_endpoint"`    // bridge reply URL sent to agent
+	ReplyToken      string   `yaml:"reply_token"`       // bearer token POST /agent/reply requires (empty = none)
+	SystemPrompt    string   `yaml:"system_prompt"`     // custom system prompt for the agent personality
+	IgnoreFromMe    bool     `yaml:"ignore_from_me"`
+	DMOnly          bool     `yaml:"dm_only"`
+	Timeout         Duration `yaml:"timeout"`         // default for command_timeout and http_timeout
+	CommandTimeout  Duration `yaml:"command_timeout"` // command mode execution limit
+	HTTPTimeout     Duration `yaml:"http_timeout"`    // http mode request limit
+	Allowlist       []string `yaml:"allowlist"`       // only respond to these JIDs/numbers (empty = all)
+	Blocklist       []string `yaml:"blocklist"`       // never respond to these JIDs/numbers
+	Labels          []string `yaml:"labels"`          // only respond in chats with one of these labels (empty = all)
+	IgnoreLabels    []string `yaml:"ignore_labels"`   // never respond in chats with these labels
+	IgnoreMuted     bool     `yaml:"ignore_muted"`    // never respond in chats muted on WhatsApp
+
+	MediaInlineMaxBytes int64             `yaml:"media_inline_max_bytes"`  // inline media as base64 up to this size (0 = never)
+	HTTPHeaders         map[string]string `yaml:"http_headers"`            // extra headers on http mode requests, e.g. Authorization
+	TypingRefresh       Duration          `yaml:"typing_refresh_interval"` // re-send "typing…" while the agent runs (0 = once)
+}
+
+// CommandTimeoutOrDefault returns CommandTimeout, falling back to Timeout
+// when unset.
+func (a AgentConfig) CommandTimeoutOrDefault() time.Duration {
+	if a.CommandTimeout.Duration > 0 {
+		return a.CommandTimeout.Duration
+	}
+	return a.Timeout.Duration
+}
+
+// HTTPTimeoutOrDefault returns HTTPTimeout, falling back to Timeout when
+// unset.
+func (a AgentConfig) HTTPTimeoutOrDefault() time.Duration {
+	if a.HTTPTimeout.Duration > 0 {
+		return a.HTTPTimeout.Duration
+	}
+	return a.Timeout.Duration
+}
+
+// RetentionConfig controls the background janitor that cleans up local data.
+type RetentionConfig struct {
+	Interval      Duration `yaml:"interval"`         // how often the janitor runs (0 = never)
+	MediaGCMinAge Duration `yaml:"media_gc_min_age"` // unreferenced media younger than this is kept
+}
+
+// APIConfig configures the HTTP API.
+type APIConfig struct {
+	CORS           CORSConfig      `yaml:"cors"`
+	RateLimit      RateLimitConfig `yaml:"rate_limit"`
+	MaxBodyBytes   int64           `yaml:"max_body_bytes"`   // largest request body, except uploads (0 = unlimited)
+	MaxUploadBytes int64           `yaml:"max_upload_bytes"` // largest multipart upload, e.g. to /send/file (0 = unlimited)
+	Compression    bool            `yaml:"compression"`      // gzip JSON, export and HTML responses for clients that accept it
+}
+
+// RateLimitConfig limits how often each client IP may call the API.
+type RateLimitConfig struct {
+	Send            RateLimit `yaml:"send"`             // /send/*, /reply and /agent/reply
+	Read            RateLimit `yaml:"read"`             // all other GET requests
+	ExemptLocalhost bool      `yaml:"exempt_localhost"` // do not limit requests from 127.0.0.1 and ::1
+	TrustedProxies  []string  `yaml:"trusted_proxies"`  // proxies whose X-Real-IP/X-Forwarded-For name the client (IPs or CIDRs)
+}
+
+// RateLimit is a token bucket allowing PerMinute requests a minute on
+// average, in bursts of up to Burst.
+type RateLimit struct {
+	PerMinute int `yaml:"per_minute"` // 0 = unlimited
+	Burst     int `yaml:"burst"`      // 0 = per_minute
+}
+
+// CORSConfig controls which browser origins may call the API. With no
+// origins every origin may, without credentials.
+type CORSConfig struct {
+	Origins          []string `yaml:"origins"`           // allowed origins, e.g. https://dash.example.com (empty = any)
+	AllowCredentials bool     `yaml:"allow_credentials"` // allow cookies and auth headers from the listed origins
+	Headers          []string `yaml:"headers"`           // allowed request headers (empty = Content-Type, Authorization)
+	MaxAge           Duration `yaml:"max_age"`           // how long browsers may cache preflight results (0 = their default)
+}
+
+// TypingConfig sets how long the typing indicator shows before a send with
+// simulate_typing: per_char for each character, bounded by min and max.
+type TypingConfig struct {
+	PerChar Duration `yaml:"per_char"`
+	Min     Duration `yaml:"min"`
+	Max     Duration `yaml:"max"` // 0 = unbounded
+}
+
+// MaintenanceConfig controls periodic database upkeep.
+type MaintenanceConfig struct {
+	CheckpointInterval Duration `yaml:"checkpoint_interval"`   // WAL checkpoint frequency (0 = never)
+	VacuumWindow       string   `yaml:"vacuum_window"`         // daily local window for vacuuming, e.g. "03:00-05:00" (empty = never)
+	FullVacuumMaxBytes int64    `yaml:"full_vacuum_max_bytes"` // largest database converted by a scheduled full VACUUM (0 = unlimited)
 }
 
 // Config holds all application configuration values.
 type Config struct {
-	Port               int            `yaml:"port"`
-	DataDir            string         `yaml:"data_dir"`
-	WebhookURL         string         `yaml:"webhook_url"`
-	WebhookFilters     WebhookFilters `yaml:"webhook_filters"`
-	AutoReconnect      bool           `yaml:"auto_reconnect"`
-	ReconnectInterval  Duration       `yaml:"reconnect_interval"`
-	LogLevel           string         `yaml:"log_level"`
-	Agent              AgentConfig    `yaml:"agent"`
+	Port              int               `yaml:"port"`
+	DataDir           string            `yaml:"data_dir"`
+	DirMode           Mode              `yaml:"dir_mode"`  // permissions of directories in data_dir (default 0700)
+	FileMode          Mode              `yaml:"file_mode"` // permissions of files in data_dir (default 0600)
+	WebhookURL        string            `yaml:"webhook_url"`
+	AllowInternalHook bool              `yaml:"allow_internal_webhook"` // allow a loopback or link-local webhook_url
+	WebhookMethod     string            `yaml:"webhook_method"`         // POST, PUT or PATCH (empty = POST)
+	WebhookType       string            `yaml:"webhook_content_type"`   // Content-Type of webhook requests (empty = application/json)
+	WebhookFilters    WebhookFilters    `yaml:"webhook_filters"`
+	WebhookDedup      WebhookDedup      `yaml:"webhook_dedup"`
+	WebhookBreaker    WebhookBreaker    `yaml:"webhook_breaker"`
+	MediaURLs         MediaURLs         `yaml:"media_urls"`
+	AutoReconnect     bool              `yaml:"auto_reconnect"`
+	ReconnectInterval Duration          `yaml:"reconnect_interval"`
+	LogLevel          string            `yaml:"log_level"`
+	LogMessageEvents  string            `yaml:"log_message_events"`    // level of the per-message "message processed" log (default info)
+	MediaDownloadMode string            `yaml:"media_download_mode"`   // "eager" or "lazy"
+	ReadReceipts      string            `yaml:"read_receipts"`         // "never", "on_receive" or "on_agent_reply"
+	OrderedDelivery   bool              `yaml:"ordered_delivery"`      // per-chat serial webhook/agent delivery
+	EventWorkers      int               `yaml:"event_workers"`         // goroutines processing incoming messages (0 = on the event goroutine)
+	GroupInfoTTL      Duration          `yaml:"group_info_ttl"`        // reuse fetched group info this long (0 = fetch per message)
+	BlankRevoked      bool              `yaml:"blank_revoked_content"` // clear content of messages deleted for everyone
+	SkipSystem        bool              `yaml:"skip_system_messages"`  // do not store chat notifications as system messages
+	Interactive       bool              `yaml:"interactive_messages"`  // allow sending button and list messages (best effort)
+	APIDocs           bool              `yaml:"api_docs"`              // serve Swagger UI at /docs (loads it from a CDN)
+	MaxMessageLength  int               `yaml:"max_message_length"`    // split longer outgoing texts into several messages (0 = never)
+	DryRun            bool              `yaml:"dry_run"`               // log sends instead of delivering them
+	SimulatedTyping   TypingConfig      `yaml:"simulated_typing"`      // timing of sends with simulate_typing
+	CountryCode       string            `yaml:"default_country_code"`  // calling code prepended to national phone numbers (empty = none)
+	EncryptionKey     string            `yaml:"encryption_key"`        // encrypt message text at rest (32 bytes, hex or base64)
+	EncryptionKeyFile string            `yaml:"encryption_key_file"`   // read encryption_key from this file instead
+	SessionKey        string            `yaml:"session_key"`           // encrypt the WhatsApp session store at rest (32 bytes, hex or base64)
+	SessionPrevKey    string            `yaml:"session_previous_key"`  // former session_key, while rotating it
+	AdminToken        string            `yaml:"admin_token"`           // bearer token the /admin endpoints require (empty = localhost only)
+	Agent             AgentConfig       `yaml:"agent"`
+	Retention         RetentionConfig   `yaml:"retention"`
+	Maintenance       MaintenanceConfig `yaml:"maintenance"`
+	API               APIConfig         `yaml:"api"`
 }
 
 // Duration is a wrapper around time.Duration that supports YAML unmarshalling
@@ -72,6 +214,40 @@ func (d Duration) MarshalYAML() (interface{}, error) {
 	return d.Duration.String(), nil
 }
 
+// Mode is a wrapper around os.FileMode that supports YAML unmarshalling from
+// octal permissions like "0700" or 0700.
+type Mode struct {
+	os.FileMode
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Mode.
+func (m *Mode) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := ParseMode(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Mode.
+func (m Mode) MarshalYAML() (interface{}, error) {
+	return fmt.Sprintf("%04o", uint32(m.FileMode)), nil
+}
+
+// ParseMode parses octal permission bits, such as "0750" or "750".
+func ParseMode(s string) (Mode, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || n > 0o777 {
+		return Mode{}, fmt.Errorf("invalid permissions %q: want octal like 0700", s)
+	}
+	return Mode{os.FileMode(n)}, nil
+}
+
 // defaults returns a Config populated with sensible default values.
 func defaults() *Config {
 	homeDir, err := os.UserHomeDir()
@@ -81,17 +257,42 @@ func defaults() *Config {
 	return &Config{
 		Port:              8555,
 		DataDir:           filepath.Join(homeDir, ".openclaw-whatsapp"),
+		DirMode:           Mode{0o700},
+		FileMode:          Mode{0o600},
 		WebhookURL:        "",
+		WebhookMethod:     "POST",
+		WebhookType:       "application/json",
 		WebhookFilters:    WebhookFilters{},
+		WebhookDedup:      WebhookDedup{TTL: Duration{5 * time.Minute}, MaxEntries: 10000},
+		WebhookBreaker:    WebhookBreaker{Threshold: 5, Cooldown: Duration{30 * time.Second}},
+		MediaURLs:         MediaURLs{TTL: Duration{24 * time.Hour}},
 		AutoReconnect:     true,
 		ReconnectInterval: Duration{30 * time.Second},
 		LogLevel:          "info",
+		LogMessageEvents:  "info",
+		MediaDownloadMode: "eager",
+		ReadReceipts:      "never",
+		MaxMessageLength:  4096,
+		EventWorkers:      4,
+		GroupInfoTTL:      Duration{time.Hour},
+		SimulatedTyping:   TypingConfig{PerChar: Duration{50 * time.Millisecond}, Min: Duration{time.Second}, Max: Duration{10 * time.Second}},
+		API:               APIConfig{MaxBodyBytes: 1 << 20, MaxUploadBytes: 100 << 20, Compression: true},
 		Agent: AgentConfig{
-			Enabled:      false,
-			Mode:         "command",
-			IgnoreFromMe: true,
-			DMOnly:       false,
-			Timeout:      Duration{30 * time.Second},
+			Enabled:       false,
+			Mode:          "command",
+			CommandShell:  "sh -c",
+			IgnoreFromMe:  true,
+			DMOnly:        false,
+			Timeout:       Duration{30 * time.Second},
+			TypingRefresh: Duration{8 * time.Second},
+		},
+		Retention: RetentionConfig{
+			Interval:      Duration{24 * time.Hour},
+			MediaGCMinAge: Duration{time.Hour},
+		},
+		Maintenance: MaintenanceConfig{
+			CheckpointInterval: Duration{10 * time.Minute},
+			FullVacuumMaxBytes: 1 << 30,
 		},
 	}
 }
@@ -115,9 +316,23 @@ func Load(path string) (*Config, error) {
 	}
 
 	applyEnvOverrides(cfg)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// validate rejects settings that would otherwise be silently treated as
+// their default.
+func (c *Config) validate() error {
+	switch c.MediaDownloadMode {
+	case "", "eager", "lazy":
+	default:
+		return fmt.Errorf("invalid media_download_mode %q: want eager or lazy", c.MediaDownloadMode)
+	}
+	return nil
+}
+
 // applyEnvOverrides applies OC_WA_* environment variable overrides to cfg.
 func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OC_WA_PORT"); v != "" {
@@ -128,12 +343,172 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OC_WA_DATA_DIR"); v != "" {
 		cfg.DataDir = v
 	}
+	if v := os.Getenv("OC_WA_DIR_MODE"); v != "" {
+		if m, err := ParseMode(v); err == nil {
+			cfg.DirMode = m
+		}
+	}
+	if v := os.Getenv("OC_WA_FILE_MODE"); v != "" {
+		if m, err := ParseMode(v); err == nil {
+			cfg.FileMode = m
+		}
+	}
 	if v := os.Getenv("OC_WA_WEBHOOK_URL"); v != "" {
 		cfg.WebhookURL = v
 	}
+	if v := os.Getenv("OC_WA_ALLOW_INTERNAL_WEBHOOK"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.AllowInternalHook = true
+		case "false", "0", "no":
+			cfg.AllowInternalHook = false
+		}
+	}
+	if v := os.Getenv("OC_WA_WEBHOOK_METHOD"); v != "" {
+		cfg.WebhookMethod = v
+	}
+	if v := os.Getenv("OC_WA_WEBHOOK_CONTENT_TYPE"); v != "" {
+		cfg.WebhookType = v
+	}
+	if v := os.Getenv("OC_WA_WEBHOOK_DEDUP_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.WebhookDedup.TTL = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_WEBHOOK_DEDUP_MAX_ENTRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.WebhookDedup.MaxEntries = n
+		}
+	}
+	if v := os.Getenv("OC_WA_WEBHOOK_BREAKER_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.WebhookBreaker.Threshold = n
+		}
+	}
+	if v := os.Getenv("OC_WA_WEBHOOK_BREAKER_COOLDOWN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.WebhookBreaker.Cooldown = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_MEDIA_URL_SECRET"); v != "" {
+		cfg.MediaURLs.Secret = v
+	}
+	if v := os.Getenv("OC_WA_MEDIA_URL_BASE"); v != "" {
+		cfg.MediaURLs.BaseURL = v
+	}
+	if v := os.Getenv("OC_WA_MEDIA_URL_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.MediaURLs.TTL = Duration{d}
+		}
+	}
 	if v := os.Getenv("OC_WA_LOG_LEVEL"); v != "" {
 		cfg.LogLevel = v
 	}
+	if v := os.Getenv("OC_WA_LOG_MESSAGE_EVENTS"); v != "" {
+		cfg.LogMessageEvents = v
+	}
+	if v := os.Getenv("OC_WA_MEDIA_DOWNLOAD_MODE"); v != "" {
+		cfg.MediaDownloadMode = v
+	}
+	if v := os.Getenv("OC_WA_READ_RECEIPTS"); v != "" {
+		cfg.ReadReceipts = v
+	}
+	if v := os.Getenv("OC_WA_BLANK_REVOKED_CONTENT"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.BlankRevoked = true
+		case "false", "0", "no":
+			cfg.BlankRevoked = false
+		}
+	}
+	if v := os.Getenv("OC_WA_MAX_MESSAGE_LENGTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxMessageLength = n
+		}
+	}
+	if v := os.Getenv("OC_WA_DRY_RUN"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.DryRun = true
+		case "false", "0", "no":
+			cfg.DryRun = false
+		}
+	}
+	if v := os.Getenv("OC_WA_DEFAULT_COUNTRY_CODE"); v != "" {
+		cfg.CountryCode = v
+	}
+	if v := os.Getenv("OC_WA_ENCRYPTION_KEY"); v != "" {
+		cfg.EncryptionKey = v
+	}
+	if v := os.Getenv("OC_WA_ENCRYPTION_KEY_FILE"); v != "" {
+		cfg.EncryptionKeyFile = v
+	}
+	if v := os.Getenv("OC_WA_SESSION_KEY"); v != "" {
+		cfg.SessionKey = v
+	}
+	if v := os.Getenv("OC_WA_SESSION_PREVIOUS_KEY"); v != "" {
+		cfg.SessionPrevKey = v
+	}
+	if v := os.Getenv("OC_WA_ADMIN_TOKEN"); v != "" {
+		cfg.AdminToken = v
+	}
+	if v := os.Getenv("OC_WA_INTERACTIVE_MESSAGES"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.Interactive = true
+		case "false", "0", "no":
+			cfg.Interactive = false
+		}
+	}
+	if v := os.Getenv("OC_WA_API_DOCS"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.APIDocs = true
+		case "false", "0", "no":
+			cfg.APIDocs = false
+		}
+	}
+	if v := os.Getenv("OC_WA_SKIP_SYSTEM_MESSAGES"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.SkipSystem = true
+		case "false", "0", "no":
+			cfg.SkipSystem = false
+		}
+	}
+	if v := os.Getenv("OC_WA_ORDERED_DELIVERY"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.OrderedDelivery = true
+		case "false", "0", "no":
+			cfg.OrderedDelivery = false
+		}
+	}
+	if v := os.Getenv("OC_WA_EVENT_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.EventWorkers = n
+		}
+	}
+	if v := os.Getenv("OC_WA_TYPING_PER_CHAR"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SimulatedTyping.PerChar = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_TYPING_MIN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SimulatedTyping.Min = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_TYPING_MAX"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.SimulatedTyping.Max = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_GROUP_INFO_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.GroupInfoTTL = Duration{d}
+		}
+	}
 	if v := os.Getenv("OC_WA_RECONNECT_INTERVAL"); v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
 			cfg.ReconnectInterval = Duration{d}
@@ -148,6 +523,31 @@ func applyEnvOverrides(cfg *Config) {
 		}
 	}
 
+	if v := os.Getenv("OC_WA_RETENTION_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Retention.Interval = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_MEDIA_GC_MIN_AGE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Retention.MediaGCMinAge = Duration{d}
+		}
+	}
+
+	if v := os.Getenv("OC_WA_CHECKPOINT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Maintenance.CheckpointInterval = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_VACUUM_WINDOW"); v != "" {
+		cfg.Maintenance.VacuumWindow = v
+	}
+	if v := os.Getenv("OC_WA_FULL_VACUUM_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Maintenance.FullVacuumMaxBytes = n
+		}
+	}
+
 	// Agent overrides
 	if v := os.Getenv("OC_WA_AGENT_ENABLED"); v != "" {
 		switch strings.ToLower(v) {
@@ -163,17 +563,62 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OC_WA_AGENT_COMMAND"); v != "" {
 		cfg.Agent.Command = v
 	}
+	if v := os.Getenv("OC_WA_AGENT_COMMAND_SHELL"); v != "" {
+		cfg.Agent.CommandShell = v
+	}
+	if v := os.Getenv("OC_WA_AGENT_STATIC_COMMAND"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.Agent.StaticCommand = true
+		case "false", "0", "no":
+			cfg.Agent.StaticCommand = false
+		}
+	}
+	if v := os.Getenv("OC_WA_AGENT_REPLY_WITH_OUTPUT"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.Agent.ReplyWithOutput = true
+		case "false", "0", "no":
+			cfg.Agent.ReplyWithOutput = false
+		}
+	}
+	if v := os.Getenv("OC_WA_AGENT_ERROR_REPLY"); v != "" {
+		cfg.Agent.ErrorReply = v
+	}
 	if v := os.Getenv("OC_WA_AGENT_HTTP_URL"); v != "" {
 		cfg.Agent.HTTPURL = v
 	}
 	if v := os.Getenv("OC_WA_AGENT_REPLY_ENDPOINT"); v != "" {
 		cfg.Agent.ReplyEndpoint = v
 	}
+	if v := os.Getenv("OC_WA_AGENT_REPLY_TOKEN"); v != "" {
+		cfg.Agent.ReplyToken = v
+	}
 	if v := os.Getenv("OC_WA_AGENT_TIMEOUT"); v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
 			cfg.Agent.Timeout = Duration{d}
 		}
 	}
+	if v := os.Getenv("OC_WA_AGENT_COMMAND_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Agent.CommandTimeout = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_AGENT_HTTP_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Agent.HTTPTimeout = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_AGENT_TYPING_REFRESH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Agent.TypingRefresh = Duration{d}
+		}
+	}
+	if v := os.Getenv("OC_WA_AGENT_MEDIA_INLINE_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Agent.MediaInlineMaxBytes = n
+		}
+	}
 	if v := os.Getenv("OC_WA_AGENT_SYSTEM_PROMPT"); v != "" {
 		cfg.Agent.SystemPrompt = v
 	}
@@ -189,17 +634,101 @@ func applyEnvOverrides(cfg *Config) {
 			cfg.Agent.Blocklist[i] = strings.TrimSpace(cfg.Agent.Blocklist[i])
 		}
 	}
+	if v := os.Getenv("OC_WA_CORS_ORIGINS"); v != "" {
+		cfg.API.CORS.Origins = strings.Split(v, ",")
+		for i := range cfg.API.CORS.Origins {
+			cfg.API.CORS.Origins[i] = strings.TrimSpace(cfg.API.CORS.Origins[i])
+		}
+	}
+	if v := os.Getenv("OC_WA_CORS_ALLOW_CREDENTIALS"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.API.CORS.AllowCredentials = true
+		case "false", "0", "no":
+			cfg.API.CORS.AllowCredentials = false
+		}
+	}
+	if v := os.Getenv("OC_WA_RATE_LIMIT_SEND"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.API.RateLimit.Send.PerMinute = n
+		}
+	}
+	if v := os.Getenv("OC_WA_RATE_LIMIT_READ"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.API.RateLimit.Read.PerMinute = n
+		}
+	}
+	if v := os.Getenv("OC_WA_MAX_BODY_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.API.MaxBodyBytes = n
+		}
+	}
+	if v := os.Getenv("OC_WA_MAX_UPLOAD_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.API.MaxUploadBytes = n
+		}
+	}
+	if v := os.Getenv("OC_WA_API_COMPRESSION"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.API.Compression = true
+		case "false", "0", "no":
+			cfg.API.Compression = false
+		}
+	}
+	if v := os.Getenv("OC_WA_TRUSTED_PROXIES"); v != "" {
+		cfg.API.RateLimit.TrustedProxies = strings.Split(v, ",")
+		for i := range cfg.API.RateLimit.TrustedProxies {
+			cfg.API.RateLimit.TrustedProxies[i] = strings.TrimSpace(cfg.API.RateLimit.TrustedProxies[i])
+		}
+	}
+	if v := os.Getenv("OC_WA_RATE_LIMIT_EXEMPT_LOCALHOST"); v != "" {
+		switch strings.ToLower(v) {
+		case "true", "1", "yes":
+			cfg.API.RateLimit.ExemptLocalhost = true
+		case "false", "0", "no":
+			cfg.API.RateLimit.ExemptLocalhost = false
+		}
+	}
+}
+
+// ReadEncryptionKey returns the configured message encryption key as given,
+// reading it from EncryptionKeyFile if that is set. It returns "" when
+// encryption is not configured.
+func (c *Config) ReadEncryptionKey() (string, error) {
+	if c.EncryptionKeyFile == "" {
+		return c.EncryptionKey, nil
+	}
+	if c.EncryptionKey != "" {
+		return "", fmt.Errorf("encryption_key and encryption_key_file are both set")
+	}
+	data, err := os.ReadFile(c.EncryptionKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("reading encryption key file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
 }
 
 // EnsureDataDir creates the DataDir and its media subdirectory if they
-// do not already exist.
+// do not already exist, and gives both DirMode, tightening directories
+// created by earlier versions with wider permissions.
 func (c *Config) EnsureDataDir() error {
-	if err := os.MkdirAll(c.DataDir, 0o755); err != nil {
-		return fmt.Errorf("creating data dir %s: %w", c.DataDir, err)
-	}
 	mediaDir := filepath.Join(c.DataDir, "media")
-	if err := os.MkdirAll(mediaDir, 0o755); err != nil {
-		return fmt.Errorf("creating media dir %s: %w", mediaDir, err)
+	for _, dir := range []string{c.DataDir, mediaDir} {
+		if err := os.MkdirAll(dir, c.DirMode.FileMode); err != nil {
+			return fmt.Errorf("creating data dir %s: %w", dir, err)
+		}
+		if err := os.Chmod(dir, c.DirMode.FileMode); err != nil {
+			return fmt.Errorf("setting permissions of %s: %w", dir, err)
+		}
 	}
 	return nil
 }
+
+// ApplyUmask sets the process umask so that files and directories created
+// without explicit permissions, such as the SQLite databases and backups,
+// get no permission bits beyond DirMode and FileMode. It does nothing on
+// platforms without a umask.
+func (c *Config) ApplyUmask() {
+	setUmask(0o777 &^ int(c.DirMode.FileMode|c.FileMode.FileMode))
+}
@@ -0,0 +1,9 @@
+//go:build unix
+
+package config
+
+import "syscall"
+
+func setUmask(mask int) {
+	syscall.Umask(mask)
+}
@@ -3,10 +3,13 @@ module github.com/openclaw/whatsapp
 go 1.25.6
 
 require (
+	github.com/HugoSmits86/nativewebp v1.2.1
 	github.com/go-chi/chi/v5 v5.2.5
+	github.com/pion/opus v0.1.0
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/cobra v1.10.2
 	go.mau.fi/whatsmeow v0.0.0-20260219150138-7ae702b1eed4
+	golang.org/x/image v0.24.0
 	google.golang.org/protobuf v1.36.11
 	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.37.1
@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -22,6 +26,10 @@ import (
 
 var version = "v0.2.0"
 
+// pidFile is the name of the file in the data directory holding the PID of
+// the running bridge, for the stop command.
+const pidFile = "openclaw-whatsapp.pid"
+
 func main() {
 	root := &cobra.Command{
 		Use:   "openclaw-whatsapp",
@@ -65,16 +73,95 @@ func main() {
 	sendCmd.Flags().StringVar(&sendAddr, "addr", "http://localhost:8555", "Bridge HTTP address")
 	root.AddCommand(sendCmd)
 
+	// --- export command ------------------------------------------------------
+	var (
+		exportAddr   string
+		exportFormat string
+		exportMedia  bool
+		exportOut    string
+	)
+	exportCmd := &cobra.Command{
+		Use:   "export [chat-jid]",
+		Short: "Export a chat as JSON lines, CSV, or WhatsApp-style text",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExport(exportAddr, args[0], exportFormat, exportMedia, exportOut)
+		},
+	}
+	exportCmd.Flags().StringVar(&exportAddr, "addr", "http://localhost:8555", "Bridge HTTP address")
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "txt", "Export format: jsonl, csv, or txt")
+	exportCmd.Flags().BoolVar(&exportMedia, "media", false, "Bundle the export and referenced media files into a zip")
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "Output file (default: stdout)")
+	root.AddCommand(exportCmd)
+
+	// --- backup / restore commands -------------------------------------------
+	var (
+		backupConfig, backupOut string
+		backupMedia             bool
+	)
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Archive the session and message databases (safe while the bridge runs)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBackup(backupConfig, backupOut, backupMedia)
+		},
+	}
+	backupCmd.Flags().StringVarP(&backupConfig, "config", "c", "config.yaml", "Path to config file")
+	backupCmd.Flags().StringVarP(&backupOut, "out", "o", "", "Backup file to create: a .tar.gz archive, or a .db file for a message database snapshot only")
+	backupCmd.Flags().BoolVar(&backupMedia, "media", false, "Include the media files in the archive")
+	backupCmd.MarkFlagRequired("out")
+	root.AddCommand(backupCmd)
+
+	var restoreConfig, restoreIn, restoreAddr string
+	restoreCmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a backup archive or message database snapshot (bridge must be stopped)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRestore(restoreConfig, restoreIn, restoreAddr)
+		},
+	}
+	restoreCmd.Flags().StringVarP(&restoreConfig, "config", "c", "config.yaml", "Path to config file")
+	restoreCmd.Flags().StringVarP(&restoreIn, "in", "i", "", "Backup file to restore")
+	restoreCmd.Flags().StringVar(&restoreAddr, "addr", "", "Bridge HTTP address, checked to make sure it is stopped (default: localhost on the configured port)")
+	restoreCmd.MarkFlagRequired("in")
+	root.AddCommand(restoreCmd)
+
+	// --- gc-media command ----------------------------------------------------
+	var (
+		gcConfig string
+		gcMinAge time.Duration
+	)
+	gcMediaCmd := &cobra.Command{
+		Use:   "gc-media",
+		Short: "Delete media files no stored message references",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var minAge *time.Duration
+			if cmd.Flags().Changed("min-age") {
+				minAge = &gcMinAge
+			}
+			return runGCMedia(gcConfig, minAge)
+		},
+	}
+	gcMediaCmd.Flags().StringVarP(&gcConfig, "config", "c", "config.yaml", "Path to config file")
+	gcMediaCmd.Flags().DurationVar(&gcMinAge, "min-age", 0, "Keep files modified more recently than this (default: retention.media_gc_min_age)")
+	root.AddCommand(gcMediaCmd)
+
 	// --- stop command --------------------------------------------------------
-	var stopAddr string
+	var (
+		stopConfig  string
+		stopAddr    string
+		stopTimeout time.Duration
+	)
 	stopCmd := &cobra.Command{
 		Use:   "stop",
-		Short: "Stop the bridge (sends shutdown signal)",
+		Short: "Stop the bridge gracefully and wait for it to exit",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runStop(stopAddr)
+			return runStop(stopConfig, stopAddr, stopTimeout)
 		},
 	}
-	stopCmd.Flags().StringVar(&stopAddr, "addr", "http://localhost:8555", "Bridge HTTP address")
+	stopCmd.Flags().StringVarP(&stopConfig, "config", "c", "config.yaml", "Path to config file, for admin_token and the PID file in data_dir")
+	stopCmd.Flags().StringVar(&stopAddr, "addr", "", "Bridge HTTP address (default: localhost on the configured port)")
+	stopCmd.Flags().DurationVar(&stopTimeout, "timeout", 20*time.Second, "How long to wait for the bridge to exit")
 	root.AddCommand(stopCmd)
 
 	// --- version command -----------------------------------------------------
@@ -99,69 +186,154 @@ func runStart(configPath string) error {
 		return fmt.Errorf("load config: %w", err)
 	}
 
+	cfg.ApplyUmask()
 	if err := cfg.EnsureDataDir(); err != nil {
 		return fmt.Errorf("ensure data dir: %w", err)
 	}
 
 	// 2. Setup logger
-	var logLevel slog.Level
-	switch cfg.LogLevel {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelInfo
-	}
-	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: parseLogLevel(cfg.LogLevel)}))
 	slog.SetDefault(log)
 
 	log.Info("starting openclaw-whatsapp", "version", version, "port", cfg.Port, "data_dir", cfg.DataDir)
 
 	// 3. Open message store
-	dbPath := filepath.Join(cfg.DataDir, "messages.db")
-	msgStore, err := store.NewMessageStore(dbPath)
+	msgStore, encrypted, err := openMessageStore(cfg)
 	if err != nil {
-		return fmt.Errorf("open message store: %w", err)
+		return err
 	}
 	defer msgStore.Close()
+	if encrypted {
+		log.Info("message encryption enabled; full-text search is off and text search scans messages")
+	}
 
 	// 4. Create bridge client
-	client, err := bridge.NewClient(cfg.DataDir, log)
+	sessionKeys, err := loadSessionKeys(cfg)
+	if err != nil {
+		return err
+	}
+	client, err := bridge.NewClient(cfg.DataDir, sessionKeys, log)
 	if err != nil {
 		return fmt.Errorf("create bridge client: %w", err)
 	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			log.Error("failed to close session store", "error", err)
+		}
+	}()
+	client.SetMaxTextLength(cfg.MaxMessageLength)
+	client.SetFileModes(cfg.DirMode.FileMode, cfg.FileMode.FileMode)
+	client.SetGroupInfoTTL(cfg.GroupInfoTTL.Duration)
+	client.SetDryRun(cfg.DryRun)
+	if cfg.CountryCode != "" {
+		cc, err := bridge.ValidateCountryCode(cfg.CountryCode)
+		if err != nil {
+			return fmt.Errorf("default_country_code: %w", err)
+		}
+		client.SetDefaultCountryCode(cc)
+	}
+	if cfg.DryRun {
+		log.Warn("dry run mode: messages are logged, not sent")
+	}
+	if cfg.API.CORS.AllowCredentials && len(cfg.API.CORS.Origins) == 0 {
+		log.Warn("api.cors.allow_credentials has no effect without api.cors.origins")
+	}
 
 	// 5. Create webhook sender
 	webhookFilters := bridge.WebhookFilters{
 		DMOnly:       cfg.WebhookFilters.DMOnly,
 		IgnoreGroups: cfg.WebhookFilters.IgnoreGroups,
+		Labels:       cfg.WebhookFilters.Labels,
+		IgnoreLabels: cfg.WebhookFilters.IgnoreLabels,
+		IgnoreMuted:  cfg.WebhookFilters.IgnoreMuted,
+	}
+	webhookDedup := bridge.DedupOptions{
+		TTL:        cfg.WebhookDedup.TTL.Duration,
+		MaxEntries: cfg.WebhookDedup.MaxEntries,
+	}
+	webhookBreaker := bridge.BreakerOptions{
+		Threshold: cfg.WebhookBreaker.Threshold,
+		Cooldown:  cfg.WebhookBreaker.Cooldown.Duration,
+	}
+	webhookRequest := bridge.RequestOptions{
+		Method:      cfg.WebhookMethod,
+		ContentType: cfg.WebhookType,
+	}
+	webhook, err := bridge.NewWebhookSender(cfg.WebhookURL, cfg.AllowInternalHook, webhookRequest, webhookFilters, webhookDedup, webhookBreaker, log)
+	if err != nil {
+		return fmt.Errorf("create webhook sender: %w", err)
+	}
+	webhook.SetEventBus(client.Events())
+
+	// 5a. Read receipts go out either as messages are stored or once the
+	// agent has handled them.
+	var receiveReceipts, agentReceipts *bridge.ReadReceipts
+	switch cfg.ReadReceipts {
+	case "", bridge.ReadReceiptsNever:
+	case bridge.ReadReceiptsOnReceive:
+		receiveReceipts = bridge.NewReadReceipts(client, log)
+	case bridge.ReadReceiptsOnAgentReply:
+		agentReceipts = bridge.NewReadReceipts(client, log)
+	default:
+		return fmt.Errorf("invalid read_receipts %q: want never, on_receive or on_agent_reply", cfg.ReadReceipts)
 	}
-	webhook := bridge.NewWebhookSender(cfg.WebhookURL, webhookFilters, log)
 
 	// 5b. Create agent trigger
-	agent := bridge.NewAgentTrigger(
-		cfg.Agent.Enabled,
-		cfg.Agent.Mode,
-		cfg.Agent.Command,
-		cfg.Agent.HTTPURL,
-		cfg.Agent.ReplyEndpoint,
-		cfg.Agent.SystemPrompt,
-		cfg.Agent.IgnoreFromMe,
-		cfg.Agent.DMOnly,
-		cfg.Agent.Allowlist,
-		cfg.Agent.Blocklist,
-		cfg.Agent.Timeout.Duration,
-		log,
-	)
+	if cfg.Agent.Command != "" && len(cfg.Agent.CommandArgs) > 0 {
+		return fmt.Errorf("agent.command and agent.command_args are mutually exclusive")
+	}
+	if err := bridge.CheckCommandShell(strings.Fields(cfg.Agent.CommandShell), cfg.Agent.Command, cfg.Agent.StaticCommand); err != nil {
+		return fmt.Errorf("agent: %w", err)
+	}
+	agent := bridge.NewAgentTrigger(bridge.AgentOptions{
+		Enabled:             cfg.Agent.Enabled,
+		Mode:                cfg.Agent.Mode,
+		Command:             cfg.Agent.Command,
+		CommandShell:        strings.Fields(cfg.Agent.CommandShell),
+		CommandArgs:         cfg.Agent.CommandArgs,
+		StaticCommand:       cfg.Agent.StaticCommand,
+		ReplyWithOutput:     cfg.Agent.ReplyWithOutput,
+		ErrorReply:          cfg.Agent.ErrorReply,
+		HTTPURL:             cfg.Agent.HTTPURL,
+		ReplyEndpoint:       cfg.Agent.ReplyEndpoint,
+		SystemPrompt:        cfg.Agent.SystemPrompt,
+		IgnoreFromMe:        cfg.Agent.IgnoreFromMe,
+		DMOnly:              cfg.Agent.DMOnly,
+		Allowlist:           cfg.Agent.Allowlist,
+		Blocklist:           cfg.Agent.Blocklist,
+		Labels:              cfg.Agent.Labels,
+		IgnoreLabels:        cfg.Agent.IgnoreLabels,
+		IgnoreMuted:         cfg.Agent.IgnoreMuted,
+		CommandTimeout:      cfg.Agent.CommandTimeoutOrDefault(),
+		HTTPTimeout:         cfg.Agent.HTTPTimeoutOrDefault(),
+		MediaInlineMaxBytes: cfg.Agent.MediaInlineMaxBytes,
+		HTTPHeaders:         cfg.Agent.HTTPHeaders,
+		TypingRefresh:       cfg.Agent.TypingRefresh.Duration,
+		Store:               msgStore,
+		ReadReceipts:        agentReceipts,
+	}, log)
 	if cfg.Agent.Enabled {
 		log.Info("agent mode enabled", "mode", cfg.Agent.Mode)
 	}
 
 	// 6. Wire event handler
-	handler := bridge.MakeEventHandler(client, msgStore, webhook, agent, log)
+	var mediaSigner *bridge.MediaSigner
+	if cfg.MediaURLs.Secret != "" {
+		mediaSigner = bridge.NewMediaSigner(cfg.MediaURLs.Secret, cfg.MediaURLs.BaseURL, cfg.MediaURLs.TTL.Duration)
+	}
+	workers := bridge.NewEventWorkers(cfg.EventWorkers)
+	defer workers.Close()
+	handlerOpts := bridge.HandlerOptions{
+		MediaDownloadMode:  cfg.MediaDownloadMode,
+		OrderedDelivery:    cfg.OrderedDelivery,
+		BlankRevoked:       cfg.BlankRevoked,
+		SkipSystemMessages: cfg.SkipSystem,
+		MediaSigner:        mediaSigner,
+		Workers:            workers,
+		MessageLogLevel:    parseLogLevel(cfg.LogMessageEvents),
+		ReadReceipts:       receiveReceipts,
+	}
+	handler := bridge.MakeEventHandler(client, msgStore, webhook, agent, handlerOpts, log)
 	client.SetEventHandler(handler)
 
 	// 7. Connect to WhatsApp
@@ -177,14 +349,72 @@ func runStart(configPath string) error {
 		bridge.StartReconnectLoop(ctx, client, cfg.ReconnectInterval.Duration, log)
 	}
 
+	// 8b. Start janitor
+	bridge.StartJanitor(ctx, client, msgStore, bridge.JanitorOptions{
+		Interval:      cfg.Retention.Interval.Duration,
+		MediaGCMinAge: cfg.Retention.MediaGCMinAge.Duration,
+	}, log)
+
+	// 8c. Start database maintenance
+	vacuumWindow, err := store.ParseMaintenanceWindow(cfg.Maintenance.VacuumWindow)
+	if err != nil {
+		return fmt.Errorf("maintenance config: %w", err)
+	}
+	msgStore.StartMaintenance(ctx, store.MaintenanceOptions{
+		CheckpointInterval: cfg.Maintenance.CheckpointInterval.Duration,
+		VacuumWindow:       vacuumWindow,
+		FullVacuumMaxBytes: cfg.Maintenance.FullVacuumMaxBytes,
+	}, log)
+
 	// 9. Start HTTP server
+	trustedProxies, err := api.ParseTrustedProxies(cfg.API.RateLimit.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("api.rate_limit: %w", err)
+	}
+	shutdownReq := make(chan struct{})
+	var shutdownOnce sync.Once
 	srv := &http.Server{
 		Addr: fmt.Sprintf(":%d", cfg.Port),
 		Handler: api.NewRouter(&api.Server{
 			Client:  client,
 			Store:   msgStore,
+			Webhook: webhook,
 			Log:     log,
 			Version: version,
+			DataDir: cfg.DataDir,
+
+			MediaGCMinAge: cfg.Retention.MediaGCMinAge.Duration,
+			BlankRevoked:  cfg.BlankRevoked,
+			Interactive:   cfg.Interactive,
+			APIDocs:       cfg.APIDocs,
+			Typing: bridge.TypingOptions{
+				PerChar: cfg.SimulatedTyping.PerChar.Duration,
+				Min:     cfg.SimulatedTyping.Min.Duration,
+				Max:     cfg.SimulatedTyping.Max.Duration,
+				Refresh: cfg.Agent.TypingRefresh.Duration,
+			},
+
+			AgentReplyToken: cfg.Agent.ReplyToken,
+			AdminToken:      cfg.AdminToken,
+			MediaSigner:     mediaSigner,
+			Shutdown:        func() { shutdownOnce.Do(func() { close(shutdownReq) }) },
+			CORS: api.CORSOptions{
+				Origins:          cfg.API.CORS.Origins,
+				AllowCredentials: cfg.API.CORS.AllowCredentials,
+				Headers:          cfg.API.CORS.Headers,
+				MaxAge:           cfg.API.CORS.MaxAge.Duration,
+			},
+			RateLimits: api.RateLimits{
+				Send:            api.RateLimit(cfg.API.RateLimit.Send),
+				Read:            api.RateLimit(cfg.API.RateLimit.Read),
+				ExemptLocalhost: cfg.API.RateLimit.ExemptLocalhost,
+				TrustedProxies:  trustedProxies,
+			},
+			BodyLimits: api.BodyLimits{
+				Body:   cfg.API.MaxBodyBytes,
+				Upload: cfg.API.MaxUploadBytes,
+			},
+			Compress: cfg.API.Compression,
 		}),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 60 * time.Second,
@@ -199,16 +429,38 @@ func runStart(configPath string) error {
 		}
 	}()
 
+	pidPath := filepath.Join(cfg.DataDir, pidFile)
+	if err := os.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		log.Warn("failed to write PID file", "error", err, "path", pidPath)
+	} else {
+		defer os.Remove(pidPath)
+	}
+
 	log.Info("bridge is running", "qr_url", fmt.Sprintf("http://localhost:%d/qr", cfg.Port))
 
-	// 10. Wait for shutdown signal
+	// 10. Wait for a shutdown signal or POST /admin/shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case <-shutdownReq:
+	}
 
 	log.Info("shutting down...")
 	cancel()
+	// WhatsApp considers queued messages delivered already, so finish them
+	// while the connection, receipts and typed sends are still up.
+	log.Info("draining event queue")
+	workers.Close()
+	receiveReceipts.Close()
+	agentReceipts.Close()
+	// Send the messages still showing their typing indicator while the
+	// connection is up.
+	client.FinishTypedSends()
 	client.Disconnect()
+	// End the /events streams, which would otherwise keep srv.Shutdown
+	// waiting until its timeout.
+	client.Events().Close()
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
@@ -250,9 +502,308 @@ func runSend(addr, to, message string) error {
 	return nil
 }
 
-// runStop is a placeholder — in practice you'd signal via PID file or an admin endpoint.
-func runStop(addr string) error {
-	fmt.Println("To stop the bridge, send SIGTERM to the running process.")
-	fmt.Println("For example: kill $(pgrep openclaw-whatsapp)")
+// runExport downloads a chat export from the bridge HTTP API to out, or to
+// stdout when out is empty.
+func runExport(addr, jid, format string, withMedia bool, out string) error {
+	q := url.Values{}
+	q.Set("format", format)
+	if withMedia {
+		q.Set("media", "true")
+	}
+	resp, err := http.Get(addr + "/chats/" + url.PathEscape(jid) + "/export?" + q.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to reach bridge at %s: %w", addr, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("export failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
 	return nil
 }
+
+// runBackup archives the session and message databases configured in
+// configPath, and the media files with withMedia, to out. An out ending in
+// .db gets a snapshot of the message database alone, as earlier versions
+// wrote.
+func runBackup(configPath, out string, withMedia bool) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	cfg.ApplyUmask()
+
+	if strings.HasSuffix(out, ".db") {
+		if withMedia {
+			return fmt.Errorf("--media needs a .tar.gz archive, not a .db snapshot")
+		}
+		if err := store.BackupDatabase(filepath.Join(cfg.DataDir, "messages.db"), out); err != nil {
+			return err
+		}
+		fmt.Printf("Backup written to %s\n", out)
+		return nil
+	}
+
+	m, err := bridge.WriteBackupArchive(cfg.DataDir, out, version, withMedia)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup written to %s (schema version %d, %d databases, %d media files)\n",
+		out, m.SchemaVersion, len(m.Files), m.MediaFiles)
+	return nil
+}
+
+// runRestore restores the backup at in into the configured data directory:
+// an archive written by backup, or a bare message database snapshot. It
+// refuses to run while a bridge answers at addr, by default the configured
+// port on this host.
+func runRestore(configPath, in, addr string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	cfg.ApplyUmask()
+	if addr == "" {
+		addr = localAddr(cfg)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	if resp, err := client.Get(addr + "/status"); err == nil {
+		resp.Body.Close()
+		return fmt.Errorf("bridge is running at %s; stop it before restoring", addr)
+	}
+
+	archive, err := bridge.IsBackupArchive(in)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if !archive {
+		dbPath := filepath.Join(cfg.DataDir, "messages.db")
+		schema, err := store.RestoreDatabase(in, dbPath)
+		if err != nil {
+			return err
+		}
+		// A snapshot does not say where its media lived; keep the names.
+		if _, err := store.RebaseMediaPaths(dbPath, "", filepath.Join(cfg.DataDir, "media")); err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		fmt.Printf("Restored %s (schema version %d); the previous database was kept as messages.db.pre-restore\n", in, schema)
+		return nil
+	}
+
+	if err := cfg.EnsureDataDir(); err != nil {
+		return fmt.Errorf("ensure data dir: %w", err)
+	}
+	m, err := bridge.RestoreBackupArchive(in, cfg.DataDir, cfg.DirMode.FileMode, cfg.FileMode.FileMode)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s, written by %s (schema version %d, %d media files); replaced databases were kept with a .pre-restore suffix\n",
+		in, m.Version, m.SchemaVersion, m.MediaFiles)
+	if m.SessionEncrypted && cfg.SessionKey == "" && cfg.SessionPrevKey == "" {
+		fmt.Println("The restored session store is encrypted; set session_key to the key of the original host before starting")
+	}
+	return nil
+}
+
+// parseLogLevel maps a configured level name (debug, info, warn or error) to
+// a slog level. Anything else selects info.
+func parseLogLevel(name string) slog.Level {
+	switch name {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// openMessageStore opens the configured message database with its
+// encryption key, if any, and reports whether it is encrypted.
+func openMessageStore(cfg *config.Config) (*store.MessageStore, bool, error) {
+	keyText, err := cfg.ReadEncryptionKey()
+	if err != nil {
+		return nil, false, fmt.Errorf("load encryption key: %w", err)
+	}
+	var encKey []byte
+	if keyText != "" {
+		if encKey, err = store.ParseEncryptionKey(keyText); err != nil {
+			return nil, false, fmt.Errorf("load encryption key: %w", err)
+		}
+	}
+	msgStore, err := store.NewMessageStore(filepath.Join(cfg.DataDir, "messages.db"), encKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("open message store: %w", err)
+	}
+	return msgStore, encKey != nil, nil
+}
+
+// loadSessionKeys parses the configured session store encryption keys.
+func loadSessionKeys(cfg *config.Config) (bridge.SessionKeys, error) {
+	var keys bridge.SessionKeys
+	var err error
+	if cfg.SessionKey != "" {
+		if keys.Key, err = store.ParseEncryptionKey(cfg.SessionKey); err != nil {
+			return keys, fmt.Errorf("session_key: %w", err)
+		}
+	}
+	if cfg.SessionPrevKey != "" {
+		if keys.Previous, err = store.ParseEncryptionKey(cfg.SessionPrevKey); err != nil {
+			return keys, fmt.Errorf("session_previous_key: %w", err)
+		}
+	}
+	return keys, nil
+}
+
+// runGCMedia deletes media files no stored message references. It works on
+// the data directory directly, so the bridge may be running or stopped. A nil
+// minAge selects the configured retention.media_gc_min_age.
+func runGCMedia(configPath string, minAge *time.Duration) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	age := cfg.Retention.MediaGCMinAge.Duration
+	if minAge != nil {
+		age = *minAge
+	}
+
+	msgStore, _, err := openMessageStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer msgStore.Close()
+
+	res, err := bridge.CollectMediaGarbage(filepath.Join(cfg.DataDir, "media"), msgStore, age, slog.Default())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Scanned %d files, removed %d (%d bytes reclaimed)\n", res.Scanned, res.Removed, res.ReclaimedBytes)
+	return nil
+}
+
+// runStop asks the bridge at addr to shut down through POST /admin/shutdown,
+// falling back to SIGTERM to the PID in the data directory when the request
+// fails, and waits up to timeout for the process to exit.
+func runStop(configPath, addr string, timeout time.Duration) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	if addr == "" {
+		addr = localAddr(cfg)
+	}
+	proc := runningProcess(filepath.Join(cfg.DataDir, pidFile))
+
+	if err := requestShutdown(addr, cfg.AdminToken); err != nil {
+		if proc == nil {
+			return err
+		}
+		fmt.Printf("%v; sending SIGTERM to PID %d\n", err, proc.Pid)
+		if err := proc.Signal(syscall.SIGTERM); err != nil {
+			return fmt.Errorf("signal PID %d: %w", proc.Pid, err)
+		}
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var running bool
+		if proc != nil {
+			running = proc.Signal(syscall.Signal(0)) == nil
+		} else if resp, err := client.Get(addr + "/status"); err == nil {
+			resp.Body.Close()
+			running = true
+		}
+		if !running {
+			fmt.Println("Bridge stopped")
+			return nil
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return fmt.Errorf("bridge still running after %s", timeout)
+}
+
+// requestShutdown calls POST /admin/shutdown on the bridge at addr.
+func requestShutdown(addr, token string) error {
+	req, err := http.NewRequest(http.MethodPost, addr+"/admin/shutdown", nil)
+	if err != nil {
+		return fmt.Errorf("shutdown request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach bridge at %s: %w", addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("shutdown request failed: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// localAddr returns the address of the bridge cfg configures on this host.
+func localAddr(cfg *config.Config) string {
+	return fmt.Sprintf("http://localhost:%d", cfg.Port)
+}
+
+// runningProcess returns the process whose PID is in the file at path, or
+// nil if there is no such file, the process has exited, or the PID now
+// belongs to another program.
+func runningProcess(path string) *os.Process {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return nil
+	}
+	if !isThisBinary(pid) {
+		return nil
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil || proc.Signal(syscall.Signal(0)) != nil {
+		return nil
+	}
+	return proc
+}
+
+// isThisBinary reports whether process pid runs the same executable as this
+// process, so that a stale PID file reused by another program is not
+// signalled. It reads /proc and reports false where there is none.
+func isThisBinary(pid int) bool {
+	self, err := os.Executable()
+	if err != nil {
+		return false
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return false
+	}
+	// An executable replaced since the process started shows as deleted.
+	exe = strings.TrimSuffix(exe, " (deleted)")
+	return filepath.Base(exe) == filepath.Base(self)
+}
@@ -0,0 +1,21 @@
+package store
+
+import "fmt"
+
+// Agent processing states recorded per message.
+const (
+	AgentTriggered = "triggered"
+	AgentSucceeded = "succeeded"
+	AgentFailed    = "failed"
+	AgentSkipped   = "skipped"
+)
+
+// SetAgentStatus records the agent's handling of a message. detail carries the
+// skip reason or failure message and may be empty.
+func (s *MessageStore) SetAgentStatus(id, status, detail string) error {
+	if _, err := s.db.Exec(`UPDATE messages SET agent_status = ?, agent_detail = ? WHERE id = ?`,
+		status, detail, id); err != nil {
+		return fmt.Errorf("set agent status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Backup writes a consistent snapshot of the database to dst, which must not
+// exist. It uses VACUUM INTO, which reads inside a single transaction, so it
+// is safe while messages are being written and yields a compacted copy.
+func (s *MessageStore) Backup(dst string) error {
+	return vacuumInto(s.db, dst)
+}
+
+// BackupDatabase snapshots the message database at dbPath to dst without
+// opening it as a MessageStore. It may run while the bridge is writing.
+func BackupDatabase(dbPath, dst string) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", dbPath))
+	if err != nil {
+		return fmt.Errorf("backup: open database: %w", err)
+	}
+	defer db.Close()
+	return vacuumInto(db, dst)
+}
+
+func vacuumInto(db *sql.DB, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("backup: %s already exists", dst)
+	}
+	if _, err := db.Exec(`VACUUM INTO ?`, dst); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+// VerifyBackup checks that path holds a message database this build can
+// open, and returns its schema version. Backups written by a newer version
+// of the bridge are rejected.
+func VerifyBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, fmt.Errorf("verify backup: %w", err)
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return 0, fmt.Errorf("verify backup: %w", err)
+	}
+	defer db.Close()
+
+	var ok string
+	if err := db.QueryRow(`PRAGMA quick_check`).Scan(&ok); err != nil {
+		return 0, fmt.Errorf("verify backup: %w", err)
+	}
+	if ok != "ok" {
+		return 0, fmt.Errorf("verify backup: integrity check failed: %s", ok)
+	}
+
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages'`).
+		Scan(&tables); err != nil {
+		return 0, fmt.Errorf("verify backup: %w", err)
+	}
+	if tables == 0 {
+		return 0, errors.New("verify backup: not a message database")
+	}
+
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("verify backup: read schema version: %w", err)
+	}
+	if version > len(dataMigrations) {
+		return version, fmt.Errorf("verify backup: schema version %d is newer than this build supports (%d)",
+			version, len(dataMigrations))
+	}
+	return version, nil
+}
+
+// RestoreDatabase replaces the message database at dbPath with the backup at
+// src after verifying it. The bridge must not be running. The database being
+// replaced is kept as dbPath + ".pre-restore". It returns the backup's
+// schema version; older backups are brought up to date by the usual
+// migrations on the next start.
+func RestoreDatabase(src, dbPath string) (int, error) {
+	version, err := VerifyBackup(src)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := dbPath + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		return 0, fmt.Errorf("restore: %w", err)
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		// Fold the WAL into the old database before setting it aside.
+		if err := checkpointFile(dbPath); err != nil {
+			os.Remove(tmp)
+			return 0, fmt.Errorf("restore: %w", err)
+		}
+		if err := os.Rename(dbPath, dbPath+".pre-restore"); err != nil {
+			os.Remove(tmp)
+			return 0, fmt.Errorf("restore: %w", err)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("restore: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return 0, fmt.Errorf("restore: %w", err)
+	}
+	return version, nil
+}
+
+// checkpointFile merges the WAL of the database at path into the main file.
+func checkpointFile(path string) error {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// copyFile copies src to dst, which is created private to the user as it
+// holds a message database.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// RebaseMediaPaths rewrites the media paths in the message database at
+// dbPath, which must not be in use, so that they point into newDir. Paths
+// under oldDir keep their place relative to it; with oldDir unknown ("") or
+// for paths outside it, only the file name is kept, as media files are
+// stored flat. It returns the number of rows changed.
+func RebaseMediaPaths(dbPath, oldDir, newDir string) (int, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", dbPath))
+	if err != nil {
+		return 0, fmt.Errorf("rebase media paths: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("rebase media paths: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT DISTINCT media_path FROM messages WHERE media_path != ''`)
+	if err != nil {
+		return 0, fmt.Errorf("rebase media paths: %w", err)
+	}
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("rebase media paths: %w", err)
+		}
+		paths = append(paths, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rebase media paths: %w", err)
+	}
+
+	changed := 0
+	for _, p := range paths {
+		rel := filepath.Base(p)
+		if oldDir != "" {
+			if r, err := filepath.Rel(oldDir, p); err == nil && filepath.IsLocal(r) {
+				rel = r
+			}
+		}
+		np := filepath.Join(newDir, rel)
+		if np == p {
+			continue
+		}
+		res, err := tx.Exec(`UPDATE messages SET media_path = ? WHERE media_path = ?`, np, p)
+		if err != nil {
+			return 0, fmt.Errorf("rebase media paths: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		changed += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("rebase media paths: %w", err)
+	}
+	return changed, nil
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreDatabaseIsPrivate(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "messages.db")
+	s, err := NewMessageStore(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	// A backup handed over by someone else may be world-readable.
+	if err := os.Chmod(src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, "restored.db")
+	if _, err := RestoreDatabase(src, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("restored database has mode %04o, want 0600", mode)
+	}
+}
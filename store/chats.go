@@ -0,0 +1,291 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Chat represents a conversation summary for listing chats.
+type Chat struct {
+	JID          string `json:"jid"`
+	Name         string `json:"name"`
+	LastMessage  string `json:"last_message"`
+	LastTime     int64  `json:"last_time"`
+	IsGroup      bool   `json:"is_group"`
+	IsNewsletter bool   `json:"is_newsletter"` // a followed WhatsApp Channel
+	UnreadCount  int    `json:"unread_count"`
+	Archived     bool   `json:"archived"`
+	MutedUntil   int64  `json:"muted_until,omitempty"` // unix seconds; -1 = muted indefinitely
+	Pinned       bool   `json:"pinned"`
+	AgentPaused  bool   `json:"agent_paused"`
+
+	// Labels are local tags such as "lead" or "support", populated by
+	// LoadChatLabels.
+	Labels []string `json:"labels,omitempty"`
+
+	// LatestNote is the text of the most recent operator note.
+	LatestNote string `json:"latest_note,omitempty"`
+}
+
+const createChatsTable = `
+CREATE TABLE IF NOT EXISTS chats (
+    jid TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    is_group INTEGER NOT NULL DEFAULT 0,
+    last_message TEXT NOT NULL DEFAULT '',
+    last_ts INTEGER NOT NULL DEFAULT 0,
+    archived INTEGER NOT NULL DEFAULT 0,
+    muted_until INTEGER NOT NULL DEFAULT 0,
+    pinned INTEGER NOT NULL DEFAULT 0,
+    agent_paused INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_chats_recent ON chats(last_ts DESC, jid);
+DROP INDEX IF EXISTS idx_chats_last_ts;
+`
+
+// upsertChat creates or refreshes the chat summary row for msg. The last
+// message only moves forward in time, so out-of-order inserts (e.g. history
+// backfill) never replace a newer preview. The name is sealed like the
+// preview, as for a DM it is the sender name of a message.
+func (s *MessageStore) upsertChat(tx *sql.Tx, msg *Message) error {
+	const query = `
+		INSERT INTO chats (jid, name, is_group, last_message, last_ts)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(jid) DO UPDATE SET
+			name = CASE WHEN excluded.name != '' THEN excluded.name ELSE chats.name END,
+			is_group = excluded.is_group,
+			last_message = CASE WHEN excluded.last_ts >= chats.last_ts
+				THEN excluded.last_message ELSE chats.last_message END,
+			last_ts = MAX(chats.last_ts, excluded.last_ts)
+	`
+
+	if _, err := tx.Exec(query,
+		msg.ChatJID,
+		s.crypt.seal(chatName(msg)),
+		boolToInt(msg.IsGroup),
+		s.crypt.seal(msg.Content),
+		msg.Timestamp,
+	); err != nil {
+		return fmt.Errorf("upsert chat: %w", err)
+	}
+	return nil
+}
+
+// chatName derives the display name of a chat from one of its messages: the
+// group subject for groups, or the sender's push name for DMs. Our own
+// messages in a DM say nothing about the other party's name.
+func chatName(msg *Message) string {
+	if msg.IsGroup {
+		return msg.GroupName
+	}
+	if msg.IsFromMe {
+		return ""
+	}
+	return msg.SenderName
+}
+
+// ChatFilter narrows GetChats; zero fields match every chat.
+type ChatFilter struct {
+	Label    string // chats carrying this label
+	Archived *bool  // archived or unarchived chats only
+}
+
+// GetChats returns a list of chats with their most recent message, ordered by
+// the last message timestamp (newest first), and the cursor for the
+// following page (empty when there are no more chats), restricted to the
+// chats matching f. Pages are selected by page.Cursor when set, or by
+// page.Offset otherwise.
+func (s *MessageStore) GetChats(page Page, f ChatFilter) ([]Chat, string, error) {
+	query, args, err := chatsQuery(page, f)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("get chats: %w", err)
+	}
+	defer rows.Close()
+
+	var chats []Chat
+	for rows.Next() {
+		c, err := s.scanChat(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		chats = append(chats, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("iterate chat rows: %w", err)
+	}
+
+	var next string
+	if len(chats) > page.Limit {
+		chats = chats[:page.Limit]
+		if page.Limit > 0 {
+			last := chats[len(chats)-1]
+			next = EncodeCursor(last.LastTime, last.JID)
+		}
+	}
+	return chats, next, nil
+}
+
+// GetChat returns the summary of one chat, or nil if the chat is unknown.
+func (s *MessageStore) GetChat(chatJID string) (*Chat, error) {
+	rows, err := s.db.Query(`SELECT `+chatColumns+` FROM chats WHERE jid = ?`, chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("get chat: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return s.scanChat(rows)
+}
+
+// chatColumns are the columns scanChat reads, in order.
+const chatColumns = `
+	jid, CASE WHEN name = '' THEN jid ELSE name END, last_message, last_ts,
+	is_group, archived, muted_until, pinned, agent_paused,
+	COALESCE((
+	    SELECT note FROM chat_notes WHERE chat_jid = chats.jid
+	    ORDER BY created_at DESC, id DESC LIMIT 1
+	), '')`
+
+// scanChat reads the chatColumns of the current row.
+func (s *MessageStore) scanChat(rows *sql.Rows) (*Chat, error) {
+	var c Chat
+	var isGroup, archived, pinned, agentPaused int
+	if err := rows.Scan(&c.JID, &c.Name, &c.LastMessage, &c.LastTime,
+		&isGroup, &archived, &c.MutedUntil, &pinned, &agentPaused, &c.LatestNote); err != nil {
+		return nil, fmt.Errorf("scan chat row: %w", err)
+	}
+	if err := s.crypt.openAll(&c.Name, &c.LastMessage); err != nil {
+		return nil, fmt.Errorf("chat %s: %w", c.JID, err)
+	}
+	c.Name = SanitizeText(c.Name)
+	c.LastMessage = SanitizeText(c.LastMessage)
+	c.IsGroup = isGroup != 0
+	c.IsNewsletter = strings.HasSuffix(c.JID, "@newsletter")
+	c.Archived = archived != 0
+	c.Pinned = pinned != 0
+	c.AgentPaused = agentPaused != 0
+	return &c, nil
+}
+
+// chatsQuery returns the GetChats query and its arguments. It fetches one
+// row more than page.Limit, to learn whether another page exists.
+func chatsQuery(page Page, f ChatFilter) (string, []interface{}, error) {
+	where := `1 = 1`
+	var args []interface{}
+	if f.Label != "" {
+		where = `jid IN (SELECT chat_jid FROM chat_labels WHERE label = ?)`
+		args = append(args, strings.ToLower(strings.TrimSpace(f.Label)))
+	}
+	if f.Archived != nil {
+		where += ` AND archived = ?`
+		args = append(args, boolToInt(*f.Archived))
+	}
+	offset := page.Offset
+	if page.Cursor != "" {
+		ts, jid, err := DecodeCursor(page.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		where += ` AND (last_ts < ? OR (last_ts = ? AND jid > ?))`
+		args = append(args, ts, ts, jid)
+		offset = 0
+	}
+
+	query := `
+		SELECT ` + chatColumns + `
+		FROM chats
+		WHERE ` + where + `
+		ORDER BY last_ts DESC, jid
+		LIMIT ? OFFSET ?
+	`
+	return query, append(args, page.Limit+1, offset), nil
+}
+
+// SetChatArchived records whether a chat is archived. Archiving also unpins
+// the chat, as it does on the phone.
+func (s *MessageStore) SetChatArchived(chatJID string, archived bool) error {
+	return s.setChatState(chatJID, "archived",
+		`archived = excluded.archived,
+		 pinned = CASE WHEN excluded.archived = 1 THEN 0 ELSE chats.pinned END`,
+		boolToInt(archived))
+}
+
+// SetChatPinned records whether a chat is pinned to the top of the list.
+func (s *MessageStore) SetChatPinned(chatJID string, pinned bool) error {
+	return s.setChatState(chatJID, "pinned", `pinned = excluded.pinned`, boolToInt(pinned))
+}
+
+// SetChatMutedUntil records until when a chat is muted, in unix seconds:
+// 0 when it is not muted and -1 when it is muted indefinitely.
+func (s *MessageStore) SetChatMutedUntil(chatJID string, mutedUntil int64) error {
+	return s.setChatState(chatJID, "muted_until", `muted_until = excluded.muted_until`, mutedUntil)
+}
+
+// IsChatMuted reports whether a chat is muted at now, indefinitely or
+// until a later time. Unknown chats are not muted.
+func (s *MessageStore) IsChatMuted(chatJID string, now time.Time) (bool, error) {
+	var until int64
+	err := s.db.QueryRow(`SELECT muted_until FROM chats WHERE jid = ?`, chatJID).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get chat muted: %w", err)
+	}
+	return until == -1 || until > now.Unix(), nil
+}
+
+// setChatState sets column of a chat's row to value, applying update when
+// the row exists. A chat without messages gets a row of its own.
+func (s *MessageStore) setChatState(chatJID, column, update string, value interface{}) error {
+	query := `
+		INSERT INTO chats (jid, is_group, ` + column + `) VALUES (?, ?, ?)
+		ON CONFLICT(jid) DO UPDATE SET ` + update
+	if _, err := s.db.Exec(query, chatJID, boolToInt(strings.HasSuffix(chatJID, "@g.us")), value); err != nil {
+		return fmt.Errorf("set chat %s: %w", column, err)
+	}
+	return nil
+}
+
+// backfillChats populates the chats table from existing messages. It runs
+// once, for databases created before the chats table existed, and copies
+// names and previews as they are stored: sealed if the messages are, or in
+// plaintext for setupEncryption to seal later.
+func backfillChats(tx *sql.Tx) error {
+	const query = `
+		INSERT OR IGNORE INTO chats (jid, name, is_group, last_message, last_ts)
+		SELECT
+			m.chat_jid,
+			CASE WHEN m.is_group = 1 THEN m.group_name
+			     ELSE COALESCE((
+			         SELECT n.sender_name FROM messages n
+			         WHERE n.chat_jid = m.chat_jid AND n.is_from_me = 0 AND n.sender_name != ''
+			         ORDER BY n.timestamp DESC LIMIT 1
+			     ), '')
+			END,
+			m.is_group,
+			m.content,
+			m.timestamp
+		FROM messages m
+		INNER JOIN (
+			SELECT chat_jid, MAX(timestamp) AS max_ts
+			FROM messages
+			GROUP BY chat_jid
+		) latest ON m.chat_jid = latest.chat_jid AND m.timestamp = latest.max_ts
+		GROUP BY m.chat_jid
+	`
+
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("backfill chats: %w", err)
+	}
+	return nil
+}
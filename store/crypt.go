@@ -0,0 +1,289 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EncryptionKeySize is the length in bytes of a message encryption key
+// (AES-256).
+const EncryptionKeySize = 32
+
+// encPrefix marks an encrypted column value: the prefix is followed by the
+// base64 of the nonce and the AES-GCM ciphertext. Values without it are
+// plaintext.
+const encPrefix = "enc1:"
+
+// keyCheckPlaintext is sealed with the key when encryption is enabled, so
+// that later opens can tell a wrong key from a right one.
+const keyCheckPlaintext = "openclaw-whatsapp"
+
+var (
+	// ErrEncryptionKeyRequired is returned when opening an encrypted
+	// database without a key.
+	ErrEncryptionKeyRequired = errors.New("message database is encrypted; an encryption key is required")
+
+	// ErrWrongEncryptionKey is returned when opening an encrypted database
+	// with a key other than the one it was encrypted with.
+	ErrWrongEncryptionKey = errors.New("wrong encryption key for message database")
+)
+
+const createStoreMetaTable = `
+CREATE TABLE IF NOT EXISTS store_meta (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+`
+
+const dropFTSTriggers = `
+DROP TRIGGER IF EXISTS messages_ai;
+DROP TRIGGER IF EXISTS messages_au;
+`
+
+// ParseEncryptionKey decodes a message encryption key given as 64 hex digits
+// or as base64, as printed by `openssl rand -hex 32` or
+// `openssl rand -base64 32`.
+func ParseEncryptionKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(s); err == nil && len(key) == EncryptionKeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == EncryptionKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes, hex or base64 encoded", EncryptionKeySize)
+}
+
+// sealer encrypts and decrypts column values with AES-GCM, using a random
+// nonce per value. A nil *sealer leaves values as they are.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func newSealer(key []byte) (*sealer, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes", EncryptionKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key: %w", err)
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// seal encrypts v. Empty values stay empty, so that checks such as
+// sender_name != ” keep working on encrypted columns.
+func (c *sealer) seal(v string) string {
+	if c == nil || v == "" {
+		return v
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("store: read random nonce: %v", err))
+	}
+	return encPrefix + base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(v), nil))
+}
+
+// open decrypts a value produced by seal. Plaintext values, such as those
+// written before encryption was enabled, are returned unchanged.
+func (c *sealer) open(v string) (string, error) {
+	if c == nil || !strings.HasPrefix(v, encPrefix) {
+		return v, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(v[len(encPrefix):])
+	if err != nil || len(data) < c.aead.NonceSize() {
+		return "", errors.New("decrypt: malformed value")
+	}
+	n := c.aead.NonceSize()
+	plain, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt: %w", err)
+	}
+	return string(plain), nil
+}
+
+// openAll decrypts the values vs point to in place.
+func (c *sealer) openAll(vs ...*string) error {
+	for _, v := range vs {
+		plain, err := c.open(*v)
+		if err != nil {
+			return err
+		}
+		*v = plain
+	}
+	return nil
+}
+
+// setupEncryption checks key against the database and, the first time a key
+// is used, encrypts the existing rows. It reports whether rows were
+// encrypted, in which case plaintext may linger in free pages until the
+// next VACUUM.
+//
+// The full-text index cannot work on ciphertext, so in encrypted mode it is
+// emptied and its triggers are dropped; SearchMessages falls back to
+// scanning decrypted rows.
+func setupEncryption(db *sql.DB, key []byte) (*sealer, bool, error) {
+	var check string
+	err := db.QueryRow(`SELECT value FROM store_meta WHERE key = 'encryption_check'`).Scan(&check)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("read encryption state: %w", err)
+	}
+	encrypted := err == nil
+
+	if key == nil {
+		if encrypted {
+			return nil, false, ErrEncryptionKeyRequired
+		}
+		return nil, false, nil
+	}
+
+	c, err := newSealer(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if encrypted {
+		if plain, err := c.open(check); err != nil || plain != keyCheckPlaintext {
+			return nil, false, ErrWrongEncryptionKey
+		}
+		// The schema statements recreate the triggers on every open.
+		if _, err := db.Exec(dropFTSTriggers); err != nil {
+			return nil, false, fmt.Errorf("drop search triggers: %w", err)
+		}
+		// Chat names were kept in plaintext by earlier versions.
+		if err := sealPlaintext(db, c, "chats", "jid", "name"); err != nil {
+			return nil, false, fmt.Errorf("encrypt chat names: %w", err)
+		}
+		return c, false, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("enable encryption: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(dropFTSTriggers); err != nil {
+		return nil, false, fmt.Errorf("enable encryption: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('delete-all')`); err != nil {
+		return nil, false, fmt.Errorf("enable encryption: %w", err)
+	}
+	for _, col := range []struct{ table, key, columns string }{
+		{"messages", "rowid", "content, sender_name"},
+		{"message_edits", "id", "previous_content"},
+		{"chats", "jid", "name, last_message"},
+	} {
+		if err := sealColumns(tx, c, col.table, col.key, strings.Split(col.columns, ", ")); err != nil {
+			return nil, false, fmt.Errorf("enable encryption: %s: %w", col.table, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO store_meta (key, value) VALUES ('encryption_check', ?)`,
+		c.seal(keyCheckPlaintext)); err != nil {
+		return nil, false, fmt.Errorf("enable encryption: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("enable encryption: commit: %w", err)
+	}
+	return c, true, nil
+}
+
+// sealPlaintext encrypts the values of col in table, identified by keyCol,
+// that are not encrypted yet.
+func sealPlaintext(db *sql.DB, c *sealer, table, keyCol, col string) error {
+	rows, err := db.Query(`SELECT `+keyCol+`, `+col+` FROM `+table+
+		` WHERE `+col+` != '' AND substr(`+col+`, 1, ?) != ?`, len(encPrefix), encPrefix)
+	if err != nil {
+		return err
+	}
+	plain := make(map[string]string)
+	for rows.Next() {
+		var key, v string
+		if err := rows.Scan(&key, &v); err != nil {
+			rows.Close()
+			return err
+		}
+		plain[key] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(plain) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for key, v := range plain {
+		if _, err := tx.Exec(`UPDATE `+table+` SET `+col+` = ? WHERE `+keyCol+` = ?`, c.seal(v), key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sealColumns encrypts the non-empty values of cols in every row of table,
+// identified by keyCol.
+func sealColumns(tx *sql.Tx, c *sealer, table, keyCol string, cols []string) error {
+	rows, err := tx.Query(`SELECT ` + keyCol + `, ` + strings.Join(cols, ", ") + ` FROM ` + table)
+	if err != nil {
+		return err
+	}
+	type row struct {
+		key  interface{}
+		vals []string
+	}
+	var all []row
+	for rows.Next() {
+		r := row{vals: make([]string, len(cols))}
+		dest := []interface{}{&r.key}
+		for i := range r.vals {
+			dest = append(dest, &r.vals[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	set := make([]string, len(cols))
+	for i, col := range cols {
+		set[i] = col + ` = ?`
+	}
+	stmt, err := tx.Prepare(`UPDATE ` + table + ` SET ` + strings.Join(set, ", ") + ` WHERE ` + keyCol + ` = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range all {
+		args := make([]interface{}, 0, len(cols)+1)
+		for _, v := range r.vals {
+			args = append(args, c.seal(v))
+		}
+		if _, err := stmt.Exec(append(args, r.key)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, EncryptionKeySize)
+	for _, s := range []string{hex.EncodeToString(key), base64.StdEncoding.EncodeToString(key), " " + hex.EncodeToString(key) + "\n"} {
+		if got, err := ParseEncryptionKey(s); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("ParseEncryptionKey(%q) = %x, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "abcd", hex.EncodeToString(key[:16]), "not a key at all"} {
+		if _, err := ParseEncryptionKey(s); err == nil {
+			t.Errorf("ParseEncryptionKey(%q) succeeded", s)
+		}
+	}
+}
+
+func TestEncryptionAtRest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	key := bytes.Repeat([]byte{5}, EncryptionKeySize)
+
+	// Messages stored before encryption is enabled are sealed on the first
+	// open with a key.
+	plain, err := NewMessageStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	save := func(s *MessageStore, m *Message) {
+		t.Helper()
+		m.SenderJID, m.MsgType = m.ChatJID, "text"
+		if err := s.SaveMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(plain, &Message{ID: "M1", ChatJID: "1@s.whatsapp.net", SenderName: "Alice", Content: "Invoice attached", Timestamp: 100})
+	plain.Close()
+
+	s, err := NewMessageStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	save(s, &Message{ID: "M2", ChatJID: "1@s.whatsapp.net", SenderName: "Bob", Content: "thanks for the invoice", Timestamp: 200})
+	save(s, &Message{ID: "M3", ChatJID: "2@s.whatsapp.net", SenderName: "Invoice Desk", Content: "hello", Timestamp: 300})
+	save(s, &Message{ID: "M4", ChatJID: "2@s.whatsapp.net", SenderName: "Carol", Content: "lunch?", Timestamp: 400})
+
+	rows, err := s.db.Query(`SELECT content, sender_name FROM messages`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var content, sender string
+		if err := rows.Scan(&content, &sender); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(content, encPrefix) || !strings.HasPrefix(sender, encPrefix) {
+			t.Errorf("stored in plaintext: %q, %q", content, sender)
+		}
+	}
+	rows.Close()
+	if names := chatNames(t, s); names != "1@s.whatsapp.net=Bob,2@s.whatsapp.net=Carol" {
+		t.Errorf("chat names %s", names)
+	}
+	assertSealed(t, s, `SELECT name FROM chats`)
+	var indexed int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages_fts WHERE messages_fts MATCH 'invoice OR lunch'`).Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 0 {
+		t.Errorf("full-text index matches %d rows of an encrypted store, want 0", indexed)
+	}
+
+	// Search falls back to scanning decrypted rows: case-insensitive, over
+	// content and sender name, newest first, paged with the full total.
+	tests := []struct {
+		p     SearchParams
+		ids   string
+		total int
+	}{
+		{SearchParams{Query: "INVOICE", Limit: 10}, "M3,M2,M1", 3},
+		{SearchParams{Query: "invoice", Limit: 1, Offset: 1}, "M2", 3},
+		{SearchParams{Query: "invoice", ChatJID: "1@s.whatsapp.net", Limit: 10}, "M2,M1", 2},
+		{SearchParams{Query: "nothing", Limit: 10}, "", 0},
+	}
+	for _, tt := range tests {
+		msgs, total, err := s.SearchMessages(tt.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, m := range msgs {
+			ids = append(ids, m.ID)
+		}
+		if strings.Join(ids, ",") != tt.ids || total != tt.total {
+			t.Errorf("search %+v = %v (total %d), want %s (total %d)", tt.p, ids, total, tt.ids, tt.total)
+		}
+	}
+
+	// Chat names left in plaintext by earlier versions are sealed on open.
+	if _, err := s.db.Exec(`UPDATE chats SET name = 'Carol' WHERE jid = '2@s.whatsapp.net'`); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if s, err = NewMessageStore(path, key); err != nil {
+		t.Fatal(err)
+	}
+	assertSealed(t, s, `SELECT name FROM chats`)
+	if names := chatNames(t, s); names != "1@s.whatsapp.net=Bob,2@s.whatsapp.net=Carol" {
+		t.Errorf("chat names after reopening %s", names)
+	}
+	s.Close()
+
+	if _, err := NewMessageStore(path, nil); !errors.Is(err, ErrEncryptionKeyRequired) {
+		t.Errorf("open without the key: %v, want ErrEncryptionKeyRequired", err)
+	}
+	if _, err := NewMessageStore(path, bytes.Repeat([]byte{6}, EncryptionKeySize)); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Errorf("open with another key: %v, want ErrWrongEncryptionKey", err)
+	}
+}
+
+// chatNames lists the chats of s as jid=name, in JID order.
+func chatNames(t *testing.T, s *MessageStore) string {
+	t.Helper()
+	chats, _, err := s.GetChats(Page{Limit: 10}, ChatFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, c := range chats {
+		out = append(out, c.JID+"="+c.Name)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ",")
+}
+
+// assertSealed fails unless every non-empty value query returns is
+// encrypted.
+func assertSealed(t *testing.T, s *MessageStore, query string) {
+	t.Helper()
+	rows, err := s.db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v != "" && !strings.HasPrefix(v, encPrefix) {
+			t.Errorf("%s: stored in plaintext: %q", query, v)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects a page of a listing: either the rows after Cursor, or the
+// rows after skipping Offset. Message listings also take the cursor's sort
+// keys as BeforeTS and BeforeID, for callers that keep the last row rather
+// than the cursor; BeforeTS alone selects rows older than that second.
+type Page struct {
+	Limit    int
+	Offset   int
+	Cursor   string
+	BeforeTS int64  // unix seconds, exclusive
+	BeforeID string // with BeforeTS, also takes rows of that second ordered before this ID
+}
+
+// EncodeCursor builds an opaque cursor pointing just past the row with the
+// given sort keys.
+func EncodeCursor(ts int64, id string) string {
+	raw := strconv.FormatInt(ts, 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor recovers the sort keys from a cursor built by EncodeCursor.
+func DecodeCursor(cursor string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	tsPart, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return 0, "", ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return ts, id, nil
+}
@@ -1,10 +1,17 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"path/filepath"
 	"strings"
 
+	// modernc.org/sqlite compiles SQLite with FTS5 on every platform it
+	// supports, so unlike with the cgo driver, whose FTS5 depended on the
+	// sqlite_fts5 build tag, there is no build without it to fall back
+	// from. TestFTS5Available fails should that ever change.
 	_ "modernc.org/sqlite"
 )
 
@@ -21,21 +28,100 @@ type Message struct {
 	IsFromMe   bool   `json:"is_from_me"`
 	IsGroup    bool   `json:"is_group"`
 	GroupName  string `json:"group_name,omitempty"`
+
+	// Media download metadata, kept so that media can be re-fetched from
+	// WhatsApp's servers after a failed or deferred download.
+	MediaKey        []byte `json:"-"`
+	MediaDirectPath string `json:"-"`
+	MediaEncSHA256  []byte `json:"-"`
+	MediaSHA256     []byte `json:"-"`
+
+	// Media file metadata. MediaHash is MediaSHA256 in hex, for spotting
+	// duplicate files; dimensions are only known for images and videos,
+	// and the duration, in seconds, for audio and videos. Sizes, dimensions
+	// and durations WhatsApp did not send are nil, null in JSON.
+	MediaMimetype string `json:"media_mime,omitempty"`
+	MediaLength   *int64 `json:"media_size"`
+	MediaHash     string `json:"media_sha256,omitempty"`
+	MediaWidth    *int   `json:"media_width"`
+	MediaHeight   *int   `json:"media_height"`
+	MediaDuration *int   `json:"media_duration"`
+
+	// Delivery state of our own messages (unix seconds, 0 = not yet).
+	// Status is one of the Status* constants; Error says why a failed send
+	// failed. Both are empty for incoming messages.
+	DeliveredAt int64  `json:"delivered_at,omitempty"`
+	ReadAt      int64  `json:"read_at,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	// DryRun marks a message sent in dry-run mode: it never left the
+	// bridge and its ID is made up.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Starred is local review state; it is never synced to WhatsApp.
+	Starred bool `json:"starred"`
+
+	// Revoked is set once the message was deleted for everyone. Depending on
+	// configuration its content may have been blanked.
+	Revoked bool `json:"revoked"`
+
+	// Agent handling of the message: triggered, succeeded, failed or skipped,
+	// with the skip reason or error in AgentDetail. Empty if the agent never
+	// saw the message.
+	AgentStatus string `json:"agent_status,omitempty"`
+	AgentDetail string `json:"agent_detail,omitempty"`
+
+	// EditCount is the number of times the content was edited; Edits holds
+	// the superseded versions, populated on request.
+	EditCount int    `json:"edit_count,omitempty"`
+	Edits     []Edit `json:"edits,omitempty"`
+
+	// SelectedID is the button or list row ID a button_reply or list_reply
+	// message selected.
+	SelectedID string `json:"selected_id,omitempty"`
+
+	// SenderPlatform is the kind of device an incoming message was sent
+	// from (android, ios, web or desktop), when it could be told.
+	SenderPlatform string `json:"sender_platform,omitempty"`
+
+	// QuotedID is the ID of the message this one replies to; Quoted holds
+	// that message, populated on request when it is stored.
+	QuotedID string         `json:"quoted_id,omitempty"`
+	Quoted   *QuotedMessage `json:"quoted,omitempty"`
+
+	// Per-participant receipts for group messages, populated on request.
+	Receipts []Receipt `json:"receipts,omitempty"`
+
+	// Aggregated reactions (emoji -> count), populated by LoadReactions.
+	Reactions  map[string]int `json:"reactions,omitempty"`
+	MyReaction string         `json:"my_reaction,omitempty"`
+
+	// Reactors lists who reacted with what, populated on request.
+	Reactors []Reaction `json:"reactors,omitempty"`
+}
+
+// QuotedMessage is the message a reply quotes, as shown in its quote bubble.
+type QuotedMessage struct {
+	ID         string `json:"id"`
+	SenderJID  string `json:"sender_jid"`
+	SenderName string `json:"sender_name,omitempty"`
+	Content    string `json:"content"`
+	MsgType    string `json:"msg_type"`
+	Timestamp  int64  `json:"timestamp"`
 }
 
-// Chat represents a conversation summary for listing chats.
-type Chat struct {
-	JID         string `json:"jid"`
-	Name        string `json:"name"`
-	LastMessage string `json:"last_message"`
-	LastTime    int64  `json:"last_time"`
-	IsGroup     bool   `json:"is_group"`
-	UnreadCount int    `json:"unread_count"`
+// HasMediaKeys reports whether the message carries enough metadata to
+// download its media from WhatsApp.
+func (m *Message) HasMediaKeys() bool {
+	return len(m.MediaKey) > 0 && m.MediaDirectPath != ""
 }
 
 // MessageStore manages SQLite storage for WhatsApp messages.
 type MessageStore struct {
-	db *sql.DB
+	db    *sql.DB
+	path  string
+	crypt *sealer // nil unless content encryption is enabled
 }
 
 const createMessagesTable = `
@@ -70,16 +156,52 @@ CREATE TRIGGER IF NOT EXISTS messages_ai AFTER INSERT ON messages BEGIN
 END;
 `
 
+// messageColumns lists the message columns in the order scanMessages expects.
+const messageColumns = `id, chat_jid, sender_jid, sender_name, content, msg_type, media_path,
+		timestamp, is_from_me, is_group, group_name,
+		media_key, media_direct_path, media_enc_sha256, media_sha256, media_mimetype, media_length,
+		delivered_at, read_at, starred, agent_status, agent_detail, edit_count, revoked,
+		selected_id, media_width, media_height, status, error, dry_run,
+		sender_platform, quoted_id, media_duration`
+
+// createIndexes covers the listing orders, (timestamp, id) within a chat or
+// across chats, so that pages are read straight off an index; see
+// TestQueryPlans. Indexes superseded by wider ones are dropped.
 const createIndexes = `
 CREATE INDEX IF NOT EXISTS idx_messages_chat_jid ON messages(chat_jid);
-CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
+CREATE INDEX IF NOT EXISTS idx_messages_ts_id ON messages(timestamp, id);
+CREATE INDEX IF NOT EXISTS idx_messages_chat_ts_id ON messages(chat_jid, timestamp, id);
+CREATE INDEX IF NOT EXISTS idx_messages_msg_type ON messages(msg_type);
+CREATE INDEX IF NOT EXISTS idx_messages_chat_type_ts ON messages(chat_jid, msg_type, timestamp, id);
+DROP INDEX IF EXISTS idx_messages_timestamp;
+DROP INDEX IF EXISTS idx_messages_chat_type;
+`
+
+// createMigratedIndexes covers columns added by messageMigrations, so it must
+// run after them.
+const createMigratedIndexes = `
+CREATE INDEX IF NOT EXISTS idx_messages_starred_ts_id ON messages(timestamp, id) WHERE starred = 1;
+DROP INDEX IF EXISTS idx_messages_starred;
+CREATE INDEX IF NOT EXISTS idx_messages_agent_pending ON messages(id) WHERE agent_status = 'triggered';
+CREATE INDEX IF NOT EXISTS idx_messages_failed ON messages(timestamp) WHERE status = 'failed';
 `
 
 // NewMessageStore opens (or creates) the SQLite database at dbPath, initialises
 // the schema (messages table, FTS5 virtual table, sync trigger), and returns a
 // ready-to-use MessageStore.
-func NewMessageStore(dbPath string) (*MessageStore, error) {
-	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=5000", dbPath)
+//
+// With a key, message text and sender names are encrypted at rest (see
+// setupEncryption); rows stored before are encrypted on the first such open.
+// A database once opened with a key cannot be opened without it.
+func NewMessageStore(dbPath string, key []byte) (*MessageStore, error) {
+	// modernc.org/sqlite applies pragmas given as _pragma=name(value) to every
+	// pooled connection. busy_timeout comes first so that switching to WAL
+	// waits for other connections instead of failing with SQLITE_BUSY, and
+	// transactions take the write lock up front (BEGIN IMMEDIATE) so that
+	// concurrent writers wait on the busy timeout rather than deadlock.
+	// auto_vacuum only takes effect on new databases; existing ones are
+	// converted by their first Maintain(true).
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=auto_vacuum(INCREMENTAL)&_pragma=journal_mode(WAL)&_txlock=immediate", dbPath)
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
@@ -96,7 +218,16 @@ func NewMessageStore(dbPath string) (*MessageStore, error) {
 		createMessagesTable,
 		createFTSTable,
 		createFTSTrigger,
+		createFTSUpdateTrigger,
 		createIndexes,
+		createChatsTable,
+		createReactionsTable,
+		createGroupReceiptsTable,
+		createMessageEditsTable,
+		createGroupParticipantsTable,
+		createChatLabelsTable,
+		createChatNotesTable,
+		createStoreMetaTable,
 	} {
 		if _, err := db.Exec(stmt); err != nil {
 			db.Close()
@@ -104,129 +235,508 @@ func NewMessageStore(dbPath string) (*MessageStore, error) {
 		}
 	}
 
-	return &MessageStore{db: db}, nil
+	if err := addMissingColumns(db, "messages", messageMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addMissingColumns(db, "reactions", reactionMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addMissingColumns(db, "group_participants", participantMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(createMigratedIndexes); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("exec schema statement: %w", err)
+	}
+	if err := runDataMigrations(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := backfillMediaMetadata(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	crypt, sealed, err := setupEncryption(db, key)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &MessageStore{db: db, path: dbPath, crypt: crypt}
+	if sealed {
+		// Drop the plaintext left in free pages and the WAL.
+		if _, err := db.Exec(`VACUUM`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("vacuum after enabling encryption: %w", err)
+		}
+		if err := s.Checkpoint(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
-// SaveMessage inserts a message into the database. If a message with the same
-// ID already exists the insert is silently ignored (deduplication).
-func (s *MessageStore) SaveMessage(msg *Message) error {
-	const query = `
-		INSERT OR IGNORE INTO messages
-			(id, chat_jid, sender_jid, sender_name, content, msg_type, media_path, timestamp, is_from_me, is_group, group_name)
-		VALUES
-			(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+// column describes a column added to an existing table after its initial
+// creation.
+type column struct {
+	name string
+	def  string
+}
 
-	_, err := s.db.Exec(query,
+// messageMigrations are columns added to the messages table after the initial
+// schema. They are applied with ALTER TABLE when missing.
+var messageMigrations = []column{
+	{"media_key", "BLOB"},
+	{"media_direct_path", "TEXT NOT NULL DEFAULT ''"},
+	{"media_enc_sha256", "BLOB"},
+	{"media_sha256", "BLOB"},
+	{"media_mimetype", "TEXT NOT NULL DEFAULT ''"},
+	{"media_length", "INTEGER NOT NULL DEFAULT 0"},
+	{"delivered_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"read_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"starred", "INTEGER NOT NULL DEFAULT 0"},
+	{"agent_status", "TEXT NOT NULL DEFAULT ''"},
+	{"agent_detail", "TEXT NOT NULL DEFAULT ''"},
+	{"edit_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"revoked", "INTEGER NOT NULL DEFAULT 0"},
+	{"selected_id", "TEXT NOT NULL DEFAULT ''"},
+	{"media_width", "INTEGER NOT NULL DEFAULT 0"},
+	{"media_height", "INTEGER NOT NULL DEFAULT 0"},
+	{"status", "TEXT NOT NULL DEFAULT ''"},
+	{"error", "TEXT NOT NULL DEFAULT ''"},
+	{"dry_run", "INTEGER NOT NULL DEFAULT 0"},
+	{"sender_platform", "TEXT NOT NULL DEFAULT ''"},
+	{"quoted_id", "TEXT NOT NULL DEFAULT ''"},
+	{"media_duration", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// addMissingColumns adds any columns from cols that do not yet exist on table.
+func addMissingColumns(db *sql.DB, table string, cols []column) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("read %s schema: %w", table, err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan %s schema: %w", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate %s schema: %w", table, err)
+	}
+
+	for _, c := range cols {
+		if existing[c.name] {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, c.name, c.def)
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, c.name, err)
+		}
+	}
+	return nil
+}
+
+const insertMessage = `
+	INSERT OR IGNORE INTO messages
+		(id, chat_jid, sender_jid, sender_name, content, msg_type, media_path, timestamp, is_from_me, is_group, group_name,
+		 media_key, media_direct_path, media_enc_sha256, media_sha256, media_mimetype, media_length,
+		 selected_id, media_width, media_height, status, error, dry_run, sender_platform, quoted_id, media_duration)
+	VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// insertArgs returns the insertMessage arguments for msg. Our own messages
+// saved without a status are taken to have been sent.
+func (s *MessageStore) insertArgs(msg *Message) []interface{} {
+	if msg.IsFromMe && msg.Status == "" {
+		msg.Status = StatusSent
+	}
+	return []interface{}{
 		msg.ID,
 		msg.ChatJID,
 		msg.SenderJID,
-		msg.SenderName,
-		msg.Content,
+		s.crypt.seal(msg.SenderName),
+		s.crypt.seal(msg.Content),
 		msg.MsgType,
 		msg.MediaPath,
 		msg.Timestamp,
 		boolToInt(msg.IsFromMe),
 		boolToInt(msg.IsGroup),
 		msg.GroupName,
-	)
+		msg.MediaKey,
+		msg.MediaDirectPath,
+		msg.MediaEncSHA256,
+		msg.MediaSHA256,
+		msg.MediaMimetype,
+		storedValue(msg.MediaLength),
+		msg.SelectedID,
+		storedValue(msg.MediaWidth),
+		storedValue(msg.MediaHeight),
+		msg.Status,
+		msg.Error,
+		boolToInt(msg.DryRun),
+		msg.SenderPlatform,
+		msg.QuotedID,
+		storedValue(msg.MediaDuration),
+	}
+}
+
+// SaveMessage inserts a message into the database. If a message with the same
+// ID already exists the insert is silently ignored (deduplication). The chat
+// summary row is updated in the same transaction.
+func (s *MessageStore) SaveMessage(msg *Message) error {
+	sanitizeMessage(msg)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("save message: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(insertMessage, s.insertArgs(msg)...)
 	if err != nil {
 		return fmt.Errorf("save message: %w", err)
 	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		if err := s.upsertChat(tx, msg); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save message: commit: %w", err)
+	}
 	return nil
 }
 
-// GetMessages returns messages for a given chat, ordered by timestamp
-// descending (newest first). Use limit and offset for pagination.
-func (s *MessageStore) GetMessages(chatJID string, limit, offset int) ([]Message, error) {
-	const query = `
-		SELECT id, chat_jid, sender_jid, sender_name, content, msg_type, media_path,
-		       timestamp, is_from_me, is_group, group_name
-		FROM messages
-		WHERE chat_jid = ?
-		ORDER BY timestamp DESC
-		LIMIT ? OFFSET ?
-	`
+// SaveMessages inserts many messages in a single transaction with the same
+// deduplication as SaveMessage, and returns how many were new. It is meant
+// for bulk ingestion such as history sync, where committing row by row is
+// orders of magnitude slower. Either all messages are saved or none are.
+func (s *MessageStore) SaveMessages(msgs []*Message) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("save messages: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(insertMessage)
+	if err != nil {
+		return 0, fmt.Errorf("save messages: prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, msg := range msgs {
+		sanitizeMessage(msg)
+		res, err := stmt.Exec(s.insertArgs(msg)...)
+		if err != nil {
+			return 0, fmt.Errorf("save messages: %s: %w", msg.ID, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			inserted++
+			if err := s.upsertChat(tx, msg); err != nil {
+				return 0, err
+			}
+		}
+	}
 
-	rows, err := s.db.Query(query, chatJID, limit, offset)
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("save messages: commit: %w", err)
+	}
+	return inserted, nil
+}
+
+// GetMessageByID returns the message with the given ID, or nil if no such
+// message exists.
+func (s *MessageStore) GetMessageByID(id string) (*Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE id = ?`
+
+	rows, err := s.db.Query(query, id)
 	if err != nil {
-		return nil, fmt.Errorf("get messages: %w", err)
+		return nil, fmt.Errorf("get message: %w", err)
 	}
 	defer rows.Close()
 
-	return scanMessages(rows)
+	msgs, err := s.scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	return &msgs[0], nil
 }
 
-// SearchMessages performs a full-text search across message content and sender
-// names using the FTS5 index. Results are ranked by relevance.
-func (s *MessageStore) SearchMessages(query string, limit int) ([]Message, error) {
-	// Escape any double quotes in the query to avoid FTS5 syntax errors.
-	escaped := strings.ReplaceAll(query, `"`, `""`)
-	ftsQuery := fmt.Sprintf(`"%s"`, escaped)
+// LoadQuoted fills m.Quoted with the message m replies to, if that message
+// is stored.
+func (s *MessageStore) LoadQuoted(m *Message) error {
+	if m.QuotedID == "" {
+		return nil
+	}
+	q, err := s.GetMessageByID(m.QuotedID)
+	if err != nil || q == nil {
+		return err
+	}
+	m.Quoted = &QuotedMessage{
+		ID:         q.ID,
+		SenderJID:  q.SenderJID,
+		SenderName: q.SenderName,
+		Content:    q.Content,
+		MsgType:    q.MsgType,
+		Timestamp:  q.Timestamp,
+	}
+	return nil
+}
 
-	const q = `
-		SELECT m.id, m.chat_jid, m.sender_jid, m.sender_name, m.content, m.msg_type,
-		       m.media_path, m.timestamp, m.is_from_me, m.is_group, m.group_name
-		FROM messages m
-		JOIN messages_fts fts ON m.rowid = fts.rowid
-		WHERE messages_fts MATCH ?
-		ORDER BY rank
-		LIMIT ?
-	`
+// GetOldestMessage returns the earliest stored message of a chat, or nil if
+// the chat has none.
+func (s *MessageStore) GetOldestMessage(chatJID string) (*Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE chat_jid = ? ORDER BY timestamp ASC, id ASC LIMIT 1`
 
-	rows, err := s.db.Query(q, ftsQuery, limit)
+	rows, err := s.db.Query(query, chatJID)
 	if err != nil {
-		return nil, fmt.Errorf("search messages: %w", err)
+		return nil, fmt.Errorf("get oldest message: %w", err)
 	}
 	defer rows.Close()
 
-	return scanMessages(rows)
-}
-
-// GetChats returns a list of distinct chats with their most recent message,
-// ordered by the last message timestamp (newest first).
-func (s *MessageStore) GetChats(limit int) ([]Chat, error) {
-	const query = `
-		SELECT
-			m.chat_jid,
-			COALESCE(
-				CASE WHEN m.is_group = 1 THEN m.group_name ELSE m.sender_name END,
-				m.chat_jid
-			) AS name,
-			m.content AS last_message,
-			m.timestamp AS last_time,
-			m.is_group
-		FROM messages m
-		INNER JOIN (
-			SELECT chat_jid, MAX(timestamp) AS max_ts
-			FROM messages
-			GROUP BY chat_jid
-		) latest ON m.chat_jid = latest.chat_jid AND m.timestamp = latest.max_ts
-		ORDER BY m.timestamp DESC
-		LIMIT ?
-	`
+	msgs, err := s.scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	return &msgs[0], nil
+}
+
+// GetLatestMessage returns the most recent stored message of a chat, or nil
+// if the chat has none.
+func (s *MessageStore) GetLatestMessage(chatJID string) (*Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE chat_jid = ? ORDER BY timestamp DESC, id DESC LIMIT 1`
 
-	rows, err := s.db.Query(query, limit)
+	rows, err := s.db.Query(query, chatJID)
 	if err != nil {
-		return nil, fmt.Errorf("get chats: %w", err)
+		return nil, fmt.Errorf("get latest message: %w", err)
 	}
 	defer rows.Close()
 
-	var chats []Chat
+	msgs, err := s.scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	return &msgs[0], nil
+}
+
+// UpdateMediaPath sets the on-disk media path for a stored message.
+func (s *MessageStore) UpdateMediaPath(id, mediaPath string) error {
+	if _, err := s.db.Exec(`UPDATE messages SET media_path = ? WHERE id = ?`, mediaPath, id); err != nil {
+		return fmt.Errorf("update media path: %w", err)
+	}
+	return nil
+}
+
+// ListReferencedMedia returns the set of media paths referenced by stored
+// messages.
+func (s *MessageStore) ListReferencedMedia() (map[string]bool, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT media_path FROM messages WHERE media_path != ''`)
+	if err != nil {
+		return nil, fmt.Errorf("list referenced media: %w", err)
+	}
+	defer rows.Close()
+
+	paths := make(map[string]bool)
 	for rows.Next() {
-		var c Chat
-		var isGroup int
-		if err := rows.Scan(&c.JID, &c.Name, &c.LastMessage, &c.LastTime, &isGroup); err != nil {
-			return nil, fmt.Errorf("scan chat row: %w", err)
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("scan media path: %w", err)
 		}
-		c.IsGroup = isGroup != 0
-		chats = append(chats, c)
+		paths[filepath.Clean(p)] = true
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate chat rows: %w", err)
+		return nil, fmt.Errorf("list referenced media: %w", err)
 	}
+	return paths, nil
+}
+
+// MessageFilter narrows a message listing. Zero values do not filter.
+type MessageFilter struct {
+	MsgType string
+	MinSize int64  // media size in bytes, inclusive
+	MaxSize int64  // media size in bytes, inclusive
+	Status  string // send status of our own messages
+}
 
-	return chats, nil
+// where returns the SQL conditions and arguments selecting f in chatJID, or
+// in all chats when chatJID is empty.
+func (f MessageFilter) where(chatJID string) (string, []interface{}) {
+	where := `1 = 1`
+	var args []interface{}
+	if chatJID != "" {
+		where = `chat_jid = ?`
+		args = append(args, chatJID)
+	}
+	if f.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, f.Status)
+	}
+	if f.MsgType != "" {
+		where += ` AND msg_type = ?`
+		args = append(args, f.MsgType)
+	}
+	if f.MinSize > 0 {
+		where += ` AND media_length >= ?`
+		args = append(args, f.MinSize)
+	}
+	if f.MaxSize > 0 {
+		where += ` AND media_length <= ?`
+		args = append(args, f.MaxSize)
+	}
+	return where, args
+}
+
+// GetMessages returns messages for a given chat (or all chats) matching f, ordered by
+// timestamp descending (newest first), and the cursor for the following page
+// (empty when there are no more messages). Pages are selected by page.Cursor
+// or page.BeforeTS and page.BeforeID when set, or by page.Offset otherwise;
+// cursors are stable while new messages arrive and stay fast at any depth,
+// so they are preferred.
+func (s *MessageStore) GetMessages(chatJID string, f MessageFilter, page Page) ([]Message, string, error) {
+	query, args, err := f.listQuery(chatJID, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("get messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs, err := s.scanMessages(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(msgs) > page.Limit {
+		msgs = msgs[:page.Limit]
+		if page.Limit > 0 {
+			last := msgs[len(msgs)-1]
+			next = EncodeCursor(last.Timestamp, last.ID)
+		}
+	}
+	return msgs, next, nil
+}
+
+// listQuery returns the GetMessages query and its arguments. It fetches one
+// row more than page.Limit, to learn whether another page exists.
+func (f MessageFilter) listQuery(chatJID string, page Page) (string, []interface{}, error) {
+	where, args := f.where(chatJID)
+	offset := page.Offset
+
+	if page.Cursor != "" {
+		ts, id, err := DecodeCursor(page.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		page.BeforeTS, page.BeforeID = ts, id
+	}
+	switch {
+	case page.BeforeID != "":
+		where += ` AND (timestamp, id) < (?, ?)`
+		args = append(args, page.BeforeTS, page.BeforeID)
+		offset = 0
+	case page.BeforeTS > 0:
+		where += ` AND timestamp < ?`
+		args = append(args, page.BeforeTS)
+		offset = 0
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE ` + where + `
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+	return query, append(args, page.Limit+1, offset), nil
+}
+
+// CountMessages returns the number of messages of a chat matching f. Plain
+// and type-filtered counts are answered from the chat indexes.
+func (s *MessageStore) CountMessages(chatJID string, f MessageFilter) (int, error) {
+	where, args := f.where(chatJID)
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE `+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count messages: %w", err)
+	}
+	return n, nil
+}
+
+// SetStarred flags or unflags a message for review. It returns false if no
+// message with the given ID exists.
+func (s *MessageStore) SetStarred(id string, starred bool) (bool, error) {
+	res, err := s.db.Exec(`UPDATE messages SET starred = ? WHERE id = ?`, boolToInt(starred), id)
+	if err != nil {
+		return false, fmt.Errorf("set starred: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("set starred: %w", err)
+	}
+	return n > 0, nil
+}
+
+// starredQuery lists starred messages newest first. The ID breaks ties, so
+// that pages neither skip nor repeat messages sent in the same second.
+const starredQuery = `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE starred = 1
+	ORDER BY timestamp DESC, id DESC
+	LIMIT ? OFFSET ?
+`
+
+// GetStarredMessages returns starred messages across all chats, newest first.
+func (s *MessageStore) GetStarredMessages(limit, offset int) ([]Message, error) {
+	rows, err := s.db.Query(starredQuery, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("get starred messages: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanMessages(rows)
+}
+
+// Ping checks that the database can be reached.
+func (s *MessageStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
 }
 
 // Close closes the underlying database connection.
@@ -243,20 +753,23 @@ func boolToInt(b bool) int {
 	return 0
 }
 
-func scanMessages(rows *sql.Rows) ([]Message, error) {
+// prefixColumns qualifies each column in a comma-separated list with the
+// given table alias.
+func prefixColumns(alias, cols string) string {
+	parts := strings.Split(cols, ",")
+	for i, p := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *MessageStore) scanMessages(rows *sql.Rows) ([]Message, error) {
 	var msgs []Message
 	for rows.Next() {
-		var m Message
-		var isFromMe, isGroup int
-		if err := rows.Scan(
-			&m.ID, &m.ChatJID, &m.SenderJID, &m.SenderName,
-			&m.Content, &m.MsgType, &m.MediaPath,
-			&m.Timestamp, &isFromMe, &isGroup, &m.GroupName,
-		); err != nil {
-			return nil, fmt.Errorf("scan message row: %w", err)
+		m, err := s.scanMessage(rows)
+		if err != nil {
+			return nil, err
 		}
-		m.IsFromMe = isFromMe != 0
-		m.IsGroup = isGroup != 0
 		msgs = append(msgs, m)
 	}
 	if err := rows.Err(); err != nil {
@@ -264,3 +777,60 @@ func scanMessages(rows *sql.Rows) ([]Message, error) {
 	}
 	return msgs, nil
 }
+
+// knownValue returns a media metadata column as read, or nil for the 0 the
+// column holds when the value is unknown.
+func knownValue[T int | int64](v T) *T {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// storedValue returns the media metadata column value for v: 0 when it is
+// unknown.
+func storedValue[T int | int64](v *T) T {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// scanMessage scans the current row, selected with messageColumns.
+func (s *MessageStore) scanMessage(rows *sql.Rows) (Message, error) {
+	var m Message
+	var isFromMe, isGroup, starred, revoked, dryRun int
+	var length int64
+	var width, height, duration int
+	if err := rows.Scan(
+		&m.ID, &m.ChatJID, &m.SenderJID, &m.SenderName,
+		&m.Content, &m.MsgType, &m.MediaPath,
+		&m.Timestamp, &isFromMe, &isGroup, &m.GroupName,
+		&m.MediaKey, &m.MediaDirectPath, &m.MediaEncSHA256, &m.MediaSHA256,
+		&m.MediaMimetype, &length,
+		&m.DeliveredAt, &m.ReadAt, &starred,
+		&m.AgentStatus, &m.AgentDetail, &m.EditCount, &revoked,
+		&m.SelectedID, &width, &height, &m.Status, &m.Error, &dryRun,
+		&m.SenderPlatform, &m.QuotedID, &duration,
+	); err != nil {
+		return Message{}, fmt.Errorf("scan message row: %w", err)
+	}
+	if err := s.crypt.openAll(&m.SenderName, &m.Content); err != nil {
+		return Message{}, fmt.Errorf("message %s: %w", m.ID, err)
+	}
+	m.IsFromMe = isFromMe != 0
+	m.IsGroup = isGroup != 0
+	m.Starred = starred != 0
+	m.Revoked = revoked != 0
+	m.DryRun = dryRun != 0
+	m.MediaLength = knownValue(length)
+	m.MediaWidth, m.MediaHeight = knownValue(width), knownValue(height)
+	m.MediaDuration = knownValue(duration)
+	if len(m.MediaSHA256) > 0 {
+		m.MediaHash = hex.EncodeToString(m.MediaSHA256)
+	}
+	// Rows stored before content was sanitized on write may still hold
+	// malformed text.
+	sanitizeMessage(&m)
+	return m, nil
+}
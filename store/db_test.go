@@ -0,0 +1,285 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStorePragmas checks that the DSN's pragmas reach every pooled
+// connection, not just the first.
+func TestStorePragmas(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		conn, err := s.db.Conn(ctx) // held, so each iteration opens another
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		var mode string
+		var timeout int
+		if err := conn.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, `PRAGMA busy_timeout`).Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if mode != "wal" || timeout != 5000 {
+			t.Errorf("connection %d: journal_mode %q, busy_timeout %d; want wal, 5000", i, mode, timeout)
+		}
+	}
+}
+
+// TestConcurrentWriters checks that writers on separate connections wait
+// for each other, and readers for them, instead of failing with
+// SQLITE_BUSY.
+func TestConcurrentWriters(t *testing.T) {
+	s := newTestStore(t)
+	var writers, readers sync.WaitGroup
+	errs := make(chan error, 16)
+	done := make(chan struct{})
+	for w := 0; w < 8; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			batch := make([]*Message, 50)
+			for i := range batch {
+				batch[i] = &Message{
+					ID: fmt.Sprintf("W%dM%d", w, i), ChatJID: benchChatJID(w), SenderJID: benchChatJID(w),
+					Content: "hello", MsgType: "text", Timestamp: int64(i),
+				}
+			}
+			for _, m := range batch[:25] {
+				if err := s.SaveMessage(m); err != nil {
+					errs <- err
+					return
+				}
+			}
+			if _, err := s.SaveMessages(batch[25:]); err != nil {
+				errs <- err
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+			for {
+				// Paced like API requests; back-to-back queries on a single
+				// CPU would starve the writers past the busy timeout.
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Millisecond):
+				}
+				if _, _, err := s.GetMessages(benchChatJID(r), MessageFilter{}, Page{Limit: 20}); err != nil {
+					errs <- err
+					return
+				}
+				if _, _, err := s.SearchMessages(SearchParams{Query: "hello", Limit: 20}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(r)
+	}
+	writers.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		if strings.Contains(err.Error(), "SQLITE_BUSY") || strings.Contains(err.Error(), "database is locked") {
+			t.Errorf("busy: %v", err)
+		} else {
+			t.Error(err)
+		}
+	}
+
+	_, total, err := s.SearchMessages(SearchParams{Query: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 8*50 {
+		t.Errorf("search found %d messages, want %d", total, 8*50)
+	}
+}
+
+// TestFTS5Available guards the full-text search, which needs SQLite built
+// with FTS5; see the driver import in db.go.
+func TestFTS5Available(t *testing.T) {
+	s := newTestStore(t)
+	var used bool
+	if err := s.db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&used); err != nil {
+		t.Fatal(err)
+	}
+	if !used {
+		t.Fatal("SQLite is built without FTS5")
+	}
+}
+
+func TestSaveMessagesDeduplicates(t *testing.T) {
+	s := newTestStore(t)
+	msg := func(id string) *Message {
+		return &Message{ID: id, ChatJID: "1@s.whatsapp.net", SenderJID: "1@s.whatsapp.net", Content: "hi", MsgType: "text", Timestamp: 1}
+	}
+	if err := s.SaveMessage(msg("A")); err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.SaveMessages([]*Message{msg("A"), msg("B"), msg("C"), msg("B")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("SaveMessages inserted %d, want 2", n)
+	}
+}
+
+func TestGetMessagesBefore(t *testing.T) {
+	s := newTestStore(t)
+	const chat = "1@s.whatsapp.net"
+	// Two messages share each second, so before_id decides within it.
+	for i, id := range []string{"A", "B", "C", "D"} {
+		msg := &Message{ID: id, ChatJID: chat, SenderJID: chat, Content: "hi", MsgType: "text", Timestamp: int64(10 + i/2)}
+		if err := s.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(page Page) string {
+		t.Helper()
+		msgs, _, err := s.GetMessages(chat, MessageFilter{}, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		for _, m := range msgs {
+			got += m.ID
+		}
+		return got
+	}
+	for _, c := range []struct {
+		page Page
+		want string
+	}{
+		{Page{Limit: 10, BeforeTS: 11}, "BA"},
+		{Page{Limit: 10, BeforeTS: 11, BeforeID: "D"}, "CBA"},
+		{Page{Limit: 10, BeforeTS: 11, BeforeID: "D", Offset: 2}, "CBA"},
+		{Page{Limit: 10, Cursor: EncodeCursor(11, "D")}, "CBA"},
+	} {
+		if got := ids(c.page); got != c.want {
+			t.Errorf("%+v: got %s, want %s", c.page, got, c.want)
+		}
+	}
+}
+
+func TestUnknownMediaMetadataIsNull(t *testing.T) {
+	s := newTestStore(t)
+	const chat = "1@s.whatsapp.net"
+	width, height := 640, 480
+	for _, m := range []*Message{
+		{ID: "IMG", ChatJID: chat, SenderJID: chat, MsgType: "image", Timestamp: 1, MediaWidth: &width, MediaHeight: &height},
+		{ID: "TXT", ChatJID: chat, SenderJID: chat, MsgType: "text", Content: "hi", Timestamp: 2},
+	} {
+		if err := s.SaveMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	img, err := s.GetMessageByID("IMG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.MediaWidth == nil || *img.MediaWidth != 640 || img.MediaHeight == nil || *img.MediaHeight != 480 {
+		t.Errorf("dimensions = %v x %v, want 640 x 480", img.MediaWidth, img.MediaHeight)
+	}
+	if img.MediaLength != nil || img.MediaDuration != nil {
+		t.Errorf("unknown size %v and duration %v, want nil", img.MediaLength, img.MediaDuration)
+	}
+
+	txt, err := s.GetMessageByID("TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"media_size", "media_width", "media_height", "media_duration"} {
+		if !strings.Contains(string(data), `"`+field+`":null`) {
+			t.Errorf("%s is not null in %s", field, data)
+		}
+	}
+}
+
+// BenchmarkSaveMessages compares saving a batch of messages in one
+// transaction with saving them one at a time.
+func BenchmarkSaveMessages(b *testing.B) {
+	const batch = 1000
+	msgs := func(round int) []*Message {
+		out := make([]*Message, batch)
+		for i := range out {
+			out[i] = &Message{
+				ID:        fmt.Sprintf("BENCH%06d%04d", round, i),
+				ChatJID:   benchChatJID(i % 20),
+				SenderJID: benchChatJID(i % 20),
+				Content:   "hello thanks meeting tomorrow",
+				MsgType:   "text",
+				Timestamp: int64(round*batch + i),
+			}
+		}
+		return out
+	}
+
+	b.Run("Batch", func(b *testing.B) {
+		s := newTestStore(b)
+		for i := 0; i < b.N; i++ {
+			if _, err := s.SaveMessages(msgs(i)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("OneByOne", func(b *testing.B) {
+		s := newTestStore(b)
+		for i := 0; i < b.N; i++ {
+			for _, m := range msgs(i) {
+				if err := s.SaveMessage(m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestGetStarredMessagesPagesTies(t *testing.T) {
+	s := newTestStore(t)
+	const chat = "1@s.whatsapp.net"
+	// All in the same second, so only the ID orders them.
+	for _, id := range []string{"B", "D", "A", "C"} {
+		msg := &Message{ID: id, ChatJID: chat, SenderJID: chat, Content: "hi", MsgType: "text", Timestamp: 10}
+		if err := s.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.SetStarred(id, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for offset := 0; offset < 4; offset++ {
+		msgs, err := s.GetStarredMessages(1, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range msgs {
+			got = append(got, m.ID)
+		}
+	}
+	if strings.Join(got, "") != "DCBA" {
+		t.Errorf("pages hold %v, want D C B A", got)
+	}
+}
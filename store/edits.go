@@ -0,0 +1,121 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Edit is one superseded version of a message's content.
+type Edit struct {
+	PreviousContent string `json:"previous_content"`
+	EditedAt        int64  `json:"edited_at"` // unix seconds
+}
+
+const createMessageEditsTable = `
+CREATE TABLE IF NOT EXISTS message_edits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id TEXT NOT NULL,
+    previous_content TEXT NOT NULL,
+    edited_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(message_id, edited_at);
+`
+
+// createFTSUpdateTrigger keeps the FTS index in line with edited content so
+// that search matches the current text only.
+const createFTSUpdateTrigger = `
+CREATE TRIGGER IF NOT EXISTS messages_au AFTER UPDATE OF content, sender_name ON messages BEGIN
+    INSERT INTO messages_fts(messages_fts, rowid, content, sender_name)
+    VALUES ('delete', old.rowid, old.content, old.sender_name);
+    INSERT INTO messages_fts(rowid, content, sender_name)
+    VALUES (new.rowid, new.content, new.sender_name);
+END;
+`
+
+// EditMessage replaces the content of a stored message, recording the
+// previous content in its edit history. It reports whether the message
+// exists; an edit that leaves the content unchanged is not recorded.
+func (s *MessageStore) EditMessage(id, content string, editedAt int64) (bool, error) {
+	content = SanitizeText(content)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("edit message: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous, chatJID string
+	var ts int64
+	err = tx.QueryRow(`SELECT content, chat_jid, timestamp FROM messages WHERE id = ?`, id).
+		Scan(&previous, &chatJID, &ts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("edit message: %w", err)
+	}
+	if err := s.crypt.openAll(&previous); err != nil {
+		return false, fmt.Errorf("edit message: %w", err)
+	}
+	if previous == content {
+		return true, nil
+	}
+
+	if _, err := tx.Exec(`INSERT INTO message_edits (message_id, previous_content, edited_at) VALUES (?, ?, ?)`,
+		id, s.crypt.seal(previous), editedAt); err != nil {
+		return false, fmt.Errorf("record edit: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE messages SET content = ?, edit_count = edit_count + 1 WHERE id = ?`,
+		s.crypt.seal(content), id); err != nil {
+		return false, fmt.Errorf("edit message: %w", err)
+	}
+	// Keep the chat preview current when the latest message is edited. The
+	// preview is compared decrypted, as the same text encrypts differently
+	// every time.
+	var preview string
+	err = tx.QueryRow(`SELECT last_message FROM chats WHERE jid = ? AND last_ts = ?`, chatJID, ts).Scan(&preview)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("edit message: read chat: %w", err)
+	}
+	if err == nil {
+		if err := s.crypt.openAll(&preview); err != nil {
+			return false, fmt.Errorf("edit message: read chat: %w", err)
+		}
+		if preview == previous {
+			if _, err := tx.Exec(`UPDATE chats SET last_message = ? WHERE jid = ?`,
+				s.crypt.seal(content), chatJID); err != nil {
+				return false, fmt.Errorf("edit message: update chat: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("edit message: commit: %w", err)
+	}
+	return true, nil
+}
+
+// GetEdits returns the edit history of a message, oldest first.
+func (s *MessageStore) GetEdits(messageID string) ([]Edit, error) {
+	rows, err := s.db.Query(`
+		SELECT previous_content, edited_at FROM message_edits
+		WHERE message_id = ?
+		ORDER BY edited_at, id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("get edits: %w", err)
+	}
+	defer rows.Close()
+
+	var edits []Edit
+	for rows.Next() {
+		var e Edit
+		if err := rows.Scan(&e.PreviousContent, &e.EditedAt); err != nil {
+			return nil, fmt.Errorf("scan edit row: %w", err)
+		}
+		if err := s.crypt.openAll(&e.PreviousContent); err != nil {
+			return nil, fmt.Errorf("edit of %s: %w", messageID, err)
+		}
+		edits = append(edits, e)
+	}
+	return edits, rows.Err()
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEditMessage(t *testing.T) {
+	for _, key := range [][]byte{nil, bytes.Repeat([]byte{3}, 32)} {
+		name := "plaintext"
+		if key != nil {
+			name = "encrypted"
+		}
+		t.Run(name, func(t *testing.T) {
+			s, err := NewMessageStore(filepath.Join(t.TempDir(), "messages.db"), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			testEditMessage(t, s)
+		})
+	}
+}
+
+func testEditMessage(t *testing.T, s *MessageStore) {
+	const chat = "1@s.whatsapp.net"
+	if err := s.SaveMessage(&Message{ID: "M1", ChatJID: chat, SenderJID: chat, Content: "see you at noon", MsgType: "text", Timestamp: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, content := range []string{"see you at one", "see you at one", "see you at two"} {
+		found, err := s.EditMessage("M1", content, int64(200+i))
+		if err != nil || !found {
+			t.Fatalf("EditMessage(%q) = %v, %v", content, found, err)
+		}
+	}
+	if found, err := s.EditMessage("M2", "x", 300); err != nil || found {
+		t.Errorf("EditMessage of an unknown message = %v, %v; want false", found, err)
+	}
+
+	m, err := s.GetMessageByID("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Content != "see you at two" || m.EditCount != 2 {
+		t.Errorf("content %q, edit count %d; want the last edit, 2", m.Content, m.EditCount)
+	}
+	edits, err := s.GetEdits("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Edit{{"see you at noon", 200}, {"see you at one", 202}}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("edits %+v, want %+v (an unchanged edit is not recorded)", edits, want)
+	}
+
+	// Search matches the current text only.
+	for query, hits := range map[string]int{"two": 1, "noon": 0} {
+		found, _, err := s.SearchMessages(SearchParams{Query: query, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != hits {
+			t.Errorf("search %q found %d messages, want %d", query, len(found), hits)
+		}
+	}
+
+	// The chat preview follows the edited latest message.
+	chats, _, err := s.GetChats(Page{Limit: 10}, ChatFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chats) != 1 || chats[0].LastMessage != "see you at two" {
+		t.Errorf("chats %+v, want the edited preview", chats)
+	}
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats accepted by ExportChat.
+const (
+	ExportJSONL = "jsonl" // one JSON message object per line
+	ExportCSV   = "csv"
+	ExportTXT   = "txt" // WhatsApp's own "DD/MM/YYYY, HH:MM - Name: message" layout
+)
+
+// ValidExportFormat reports whether format is supported by ExportChat.
+func ValidExportFormat(format string) bool {
+	switch format {
+	case ExportJSONL, ExportCSV, ExportTXT:
+		return true
+	}
+	return false
+}
+
+// ExportChat streams every message of a chat to w in timestamp order, one row
+// at a time, so arbitrarily large chats are exported without being loaded
+// into memory.
+func (s *MessageStore) ExportChat(jid, format string, w io.Writer) error {
+	return s.exportChat(jid, format, w, false)
+}
+
+// ExportChatZip writes a zip archive to w containing the chat export (as
+// chat.<format>) and a media/ directory with every media file the chat
+// references that still exists on disk. Media lines in the export refer to
+// the archived file names.
+func (s *MessageStore) ExportChatZip(jid, format string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	chatFile, err := zw.Create("chat." + format)
+	if err != nil {
+		return fmt.Errorf("export zip: %w", err)
+	}
+	if err := s.exportChat(jid, format, chatFile, true); err != nil {
+		return err
+	}
+
+	paths, err := s.chatMediaPaths(jid)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := addFileToZip(zw, p, "media/"+filepath.Base(p)); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("export zip: %w", err)
+	}
+	return nil
+}
+
+func (s *MessageStore) exportChat(jid, format string, w io.Writer, zipped bool) error {
+	var write func(m *Message) error
+	var flush func() error
+
+	switch format {
+	case ExportJSONL:
+		enc := json.NewEncoder(w)
+		write = func(m *Message) error { return enc.Encode(m) }
+
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "timestamp", "chat_jid", "sender_jid", "sender_name",
+			"is_from_me", "msg_type", "content", "media_path", "revoked"}); err != nil {
+			return fmt.Errorf("export csv: %w", err)
+		}
+		write = func(m *Message) error {
+			return cw.Write([]string{
+				m.ID,
+				time.Unix(m.Timestamp, 0).Format(time.RFC3339),
+				m.ChatJID,
+				m.SenderJID,
+				m.SenderName,
+				strconv.FormatBool(m.IsFromMe),
+				m.MsgType,
+				m.Content,
+				exportMediaRef(m, zipped),
+				strconv.FormatBool(m.Revoked),
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+	case ExportTXT:
+		write = func(m *Message) error {
+			_, err := fmt.Fprintf(w, "%s - %s: %s\n",
+				time.Unix(m.Timestamp, 0).Format("02/01/2006, 15:04"),
+				exportSenderName(m),
+				exportText(m, zipped))
+			return err
+		}
+
+	default:
+		return fmt.Errorf("export: unsupported format %q", format)
+	}
+
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE chat_jid = ? ORDER BY timestamp ASC, id ASC`
+	rows, err := s.db.Query(query, jid)
+	if err != nil {
+		return fmt.Errorf("export chat: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := s.scanMessage(rows)
+		if err != nil {
+			return err
+		}
+		if err := write(&m); err != nil {
+			return fmt.Errorf("export chat: write: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("export chat: %w", err)
+	}
+
+	if flush != nil {
+		if err := flush(); err != nil {
+			return fmt.Errorf("export chat: flush: %w", err)
+		}
+	}
+	return nil
+}
+
+// chatMediaPaths returns the distinct media files referenced by a chat.
+func (s *MessageStore) chatMediaPaths(jid string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT media_path FROM messages WHERE chat_jid = ? AND media_path != ''`, jid)
+	if err != nil {
+		return nil, fmt.Errorf("list chat media: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("scan chat media: %w", err)
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// addFileToZip copies the file at path into zw under name. Missing files are
+// skipped: media may have been cleaned up since the message was stored.
+func addFileToZip(zw *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("export media %s: %w", path, err)
+	}
+	defer f.Close()
+
+	dst, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("export media %s: %w", path, err)
+	}
+	if _, err := io.Copy(dst, f); err != nil {
+		return fmt.Errorf("export media %s: %w", path, err)
+	}
+	return nil
+}
+
+// exportSenderName is the display name of a message's author in text exports.
+func exportSenderName(m *Message) string {
+	switch {
+	case m.IsFromMe:
+		return "You"
+	case m.SenderName != "":
+		return m.SenderName
+	default:
+		user, _, _ := strings.Cut(m.SenderJID, "@")
+		return user
+	}
+}
+
+// exportMediaRef is the media reference written for a message: the archived
+// file name inside a zip export, or the on-disk path otherwise and for files
+// missing from the archive.
+func exportMediaRef(m *Message, zipped bool) string {
+	if m.MediaPath == "" || !zipped || !mediaFileExists(m.MediaPath) {
+		return m.MediaPath
+	}
+	return "media/" + filepath.Base(m.MediaPath)
+}
+
+// mediaFileExists reports whether a referenced media file is still on disk,
+// and so ends up in a zip export.
+func mediaFileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// exportText renders a message body for text exports the way WhatsApp does,
+// noting attached or omitted media.
+func exportText(m *Message, zipped bool) string {
+	if m.Revoked {
+		if m.IsFromMe {
+			return "You deleted this message"
+		}
+		return "This message was deleted"
+	}
+
+	text := strings.ReplaceAll(m.Content, "\r\n", "\n")
+	if m.MediaPath == "" {
+		if m.Content == "" && m.MsgType != "text" {
+			return "<Media omitted>"
+		}
+		return text
+	}
+
+	note := "<Media omitted>"
+	if zipped && mediaFileExists(m.MediaPath) {
+		note = filepath.Base(m.MediaPath) + " (file attached)"
+	}
+	if text == "" {
+		return note
+	}
+	return note + "\n" + text
+}
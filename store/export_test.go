@@ -0,0 +1,54 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportChatZipNotesOnlyArchivedMedia(t *testing.T) {
+	s := newTestStore(t)
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept.jpg")
+	if err := os.WriteFile(kept, []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const chat = "1@s.whatsapp.net"
+	for i, path := range []string{kept, filepath.Join(dir, "gone.jpg")} {
+		msg := &Message{ID: string(rune('A' + i)), ChatJID: chat, SenderJID: chat, MsgType: "image", MediaPath: path, Timestamp: int64(i + 1)}
+		if err := s.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportChatZip(chat, ExportTXT, &buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("chat.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines: %q", len(lines), data)
+	}
+	if !strings.HasSuffix(lines[0], ": kept.jpg (file attached)") {
+		t.Errorf("archived media: %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], ": <Media omitted>") {
+		t.Errorf("missing media: %q", lines[1])
+	}
+}
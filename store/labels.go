@@ -0,0 +1,129 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLabelLength is the longest chat label accepted, in characters.
+const MaxLabelLength = 50
+
+const createChatLabelsTable = `
+CREATE TABLE IF NOT EXISTS chat_labels (
+    chat_jid TEXT NOT NULL,
+    label TEXT NOT NULL,
+    PRIMARY KEY (chat_jid, label)
+);
+CREATE INDEX IF NOT EXISTS idx_chat_labels_label ON chat_labels(label);
+`
+
+// NormalizeLabels trims and lowercases labels, drops duplicates and sorts
+// them. Labels are local to the bridge and never synced to WhatsApp.
+func NormalizeLabels(labels []string) ([]string, error) {
+	seen := make(map[string]bool, len(labels))
+	out := make([]string, 0, len(labels))
+	for _, l := range labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		switch {
+		case l == "":
+			return nil, fmt.Errorf("labels must not be empty")
+		case utf8.RuneCountInString(l) > MaxLabelLength:
+			return nil, fmt.Errorf("label %q is longer than %d characters", l, MaxLabelLength)
+		case seen[l]:
+			continue
+		}
+		seen[l] = true
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// SetChatLabels replaces the labels of a chat and returns the stored set.
+// An empty list removes all labels.
+func (s *MessageStore) SetChatLabels(chatJID string, labels []string) ([]string, error) {
+	labels, err := NormalizeLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("set chat labels: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chat_labels WHERE chat_jid = ?`, chatJID); err != nil {
+		return nil, fmt.Errorf("set chat labels: %w", err)
+	}
+	for _, l := range labels {
+		if _, err := tx.Exec(`INSERT INTO chat_labels (chat_jid, label) VALUES (?, ?)`, chatJID, l); err != nil {
+			return nil, fmt.Errorf("set chat labels: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("set chat labels: commit: %w", err)
+	}
+	return labels, nil
+}
+
+// GetChatLabels returns the labels of a chat, sorted.
+func (s *MessageStore) GetChatLabels(chatJID string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT label FROM chat_labels WHERE chat_jid = ? ORDER BY label`, chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("get chat labels: %w", err)
+	}
+	defer rows.Close()
+
+	var labels []string
+	for rows.Next() {
+		var l string
+		if err := rows.Scan(&l); err != nil {
+			return nil, fmt.Errorf("scan chat label: %w", err)
+		}
+		labels = append(labels, l)
+	}
+	return labels, rows.Err()
+}
+
+// LoadChatLabels fills in the Labels field of each chat in chats with a
+// single query.
+func (s *MessageStore) LoadChatLabels(chats []Chat) error {
+	if len(chats) == 0 {
+		return nil
+	}
+
+	index := make(map[string]*Chat, len(chats))
+	args := make([]interface{}, 0, len(chats))
+	for i := range chats {
+		index[chats[i].JID] = &chats[i]
+		args = append(args, chats[i].JID)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT chat_jid, label FROM chat_labels
+		WHERE chat_jid IN (`+placeholders(len(args))+`)
+		ORDER BY chat_jid, label
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("load chat labels: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var jid, label string
+		if err := rows.Scan(&jid, &label); err != nil {
+			return fmt.Errorf("scan chat label: %w", err)
+		}
+		if c := index[jid]; c != nil {
+			c.Labels = append(c.Labels, label)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate chat labels: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// vacuumChunkPages is the number of free pages released per incremental
+// vacuum step. Each step holds the write lock only briefly, so SaveMessage
+// waits well within its busy timeout.
+const vacuumChunkPages = 1000
+
+// DBSizes captures the on-disk footprint of the database.
+type DBSizes struct {
+	DBBytes       int64 `json:"db_bytes"`
+	WALBytes      int64 `json:"wal_bytes"`
+	FreelistPages int64 `json:"freelist_pages"`
+}
+
+// MaintenanceReport describes one maintenance run.
+type MaintenanceReport struct {
+	Before     DBSizes `json:"before"`
+	After      DBSizes `json:"after"`
+	Vacuumed   bool    `json:"vacuumed"`
+	FullVacuum bool    `json:"full_vacuum,omitempty"` // one-off conversion to incremental auto_vacuum
+
+	// FullVacuumSkipped is set when the conversion was due but the
+	// database was larger than the caller allowed it to be.
+	FullVacuumSkipped bool  `json:"full_vacuum_skipped,omitempty"`
+	DurationMS        int64 `json:"duration_ms"`
+}
+
+// Maintain checkpoints the WAL, truncating it to zero bytes, refreshes query
+// planner statistics and, if vacuum is set, returns free pages to the
+// filesystem. Databases created before
+// incremental auto_vacuum was enabled need one full VACUUM to convert, which
+// blocks writers while it runs; afterwards vacuuming proceeds in small
+// incremental steps. The full VACUUM is skipped for databases larger than
+// fullVacuumMax bytes, unless it is 0. Cancelling ctx interrupts the
+// vacuum, leaving the database as it was before the current step.
+func (s *MessageStore) Maintain(ctx context.Context, vacuum bool, fullVacuumMax int64) (*MaintenanceReport, error) {
+	start := time.Now()
+	rep := &MaintenanceReport{}
+
+	var err error
+	if rep.Before, err = s.sizes(); err != nil {
+		return nil, err
+	}
+
+	if vacuum {
+		var autoVacuum int
+		if err := s.db.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&autoVacuum); err != nil {
+			return nil, fmt.Errorf("read auto_vacuum: %w", err)
+		}
+		switch {
+		case autoVacuum == 2: // INCREMENTAL
+			if err := s.incrementalVacuum(ctx); err != nil {
+				return nil, err
+			}
+			rep.Vacuumed = true
+		case fullVacuumMax > 0 && rep.Before.DBBytes > fullVacuumMax:
+			rep.FullVacuumSkipped = true
+		default:
+			if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+				return nil, fmt.Errorf("vacuum: %w", err)
+			}
+			rep.FullVacuum = true
+			rep.Vacuumed = true
+		}
+	}
+
+	if err := s.Checkpoint(); err != nil {
+		return nil, err
+	}
+	// Refresh the statistics the query planner picks indexes by.
+	if _, err := s.db.Exec(`PRAGMA optimize`); err != nil {
+		return nil, fmt.Errorf("optimize: %w", err)
+	}
+
+	if rep.After, err = s.sizes(); err != nil {
+		return nil, err
+	}
+	rep.DurationMS = time.Since(start).Milliseconds()
+	return rep, nil
+}
+
+// Checkpoint copies the WAL into the database file and truncates it.
+func (s *MessageStore) Checkpoint() error {
+	var busy, logFrames, checkpointed int
+	if err := s.db.QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("wal checkpoint: %w", err)
+	}
+	return nil
+}
+
+// incrementalVacuum releases free pages in chunks until none remain or ctx
+// is cancelled.
+func (s *MessageStore) incrementalVacuum(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("incremental vacuum: %w", err)
+		}
+		var free int64
+		if err := s.db.QueryRowContext(ctx, `PRAGMA freelist_count`).Scan(&free); err != nil {
+			return fmt.Errorf("read freelist: %w", err)
+		}
+		if free == 0 {
+			return nil
+		}
+
+		// incremental_vacuum frees one page per step, so the statement must
+		// be drained rather than executed once.
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`PRAGMA incremental_vacuum(%d)`, vacuumChunkPages))
+		if err != nil {
+			return fmt.Errorf("incremental vacuum: %w", err)
+		}
+		for rows.Next() {
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("incremental vacuum: %w", err)
+		}
+	}
+}
+
+func (s *MessageStore) sizes() (DBSizes, error) {
+	sz := DBSizes{
+		DBBytes:  fileSize(s.path),
+		WALBytes: fileSize(s.path + "-wal"),
+	}
+	if err := s.db.QueryRow(`PRAGMA freelist_count`).Scan(&sz.FreelistPages); err != nil {
+		return sz, fmt.Errorf("read freelist: %w", err)
+	}
+	return sz, nil
+}
+
+// MaintenanceWindow is a daily local-time window, such as 03:00-05:00, in
+// which vacuuming is allowed. It may wrap past midnight.
+type MaintenanceWindow struct {
+	Start, End time.Duration // offsets from midnight
+}
+
+// ParseMaintenanceWindow parses a "HH:MM-HH:MM" window. An empty string
+// yields the zero window, which never matches.
+func ParseMaintenanceWindow(s string) (MaintenanceWindow, error) {
+	if s == "" {
+		return MaintenanceWindow{}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: want HH:MM-HH:MM", s)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	return MaintenanceWindow{
+		Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		End:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+	}, nil
+}
+
+// Contains reports whether t falls inside the window.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	if w.Start == w.End {
+		return false
+	}
+	h, m, _ := t.Clock()
+	off := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+	if w.Start < w.End {
+		return off >= w.Start && off < w.End
+	}
+	return off >= w.Start || off < w.End
+}
+
+// MaintenanceOptions configures the background maintenance scheduler.
+type MaintenanceOptions struct {
+	CheckpointInterval time.Duration // zero disables the scheduler
+	VacuumWindow       MaintenanceWindow
+
+	// FullVacuumMaxBytes is the largest database the scheduler converts
+	// with a full VACUUM, which blocks writes for as long as it takes to
+	// rewrite the file. Larger ones are left for POST /admin/db/maintenance
+	// and a warning is logged. Zero means no limit.
+	FullVacuumMaxBytes int64
+}
+
+// StartMaintenance launches a background goroutine that checkpoints the WAL
+// every CheckpointInterval and vacuums at most once a day inside
+// VacuumWindow. It stops when ctx is cancelled, interrupting a vacuum in
+// progress.
+func (s *MessageStore) StartMaintenance(ctx context.Context, opts MaintenanceOptions, log *slog.Logger) {
+	if opts.CheckpointInterval <= 0 {
+		return
+	}
+	go s.maintenanceLoop(ctx, opts, log)
+}
+
+func (s *MessageStore) maintenanceLoop(ctx context.Context, opts MaintenanceOptions, log *slog.Logger) {
+	ticker := time.NewTicker(opts.CheckpointInterval)
+	defer ticker.Stop()
+
+	var lastVacuum time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("db maintenance stopped")
+			return
+		case now := <-ticker.C:
+			vacuum := opts.VacuumWindow.Contains(now) && now.Sub(lastVacuum) > 20*time.Hour
+			rep, err := s.Maintain(ctx, vacuum, opts.FullVacuumMaxBytes)
+			if ctx.Err() != nil {
+				log.Info("db maintenance stopped")
+				return
+			}
+			if err != nil {
+				log.Error("db maintenance failed", "error", err)
+				continue
+			}
+			switch {
+			case rep.FullVacuumSkipped:
+				lastVacuum = now
+				log.Warn("db needs a full vacuum to enable incremental vacuuming, but is larger than maintenance.full_vacuum_max_bytes; run POST /admin/db/maintenance?vacuum=true when writes may be blocked",
+					"db_bytes", rep.Before.DBBytes, "full_vacuum_max_bytes", opts.FullVacuumMaxBytes)
+			case vacuum:
+				lastVacuum = now
+				log.Info("db vacuum completed", "db_bytes_before", rep.Before.DBBytes,
+					"db_bytes_after", rep.After.DBBytes, "full_vacuum", rep.FullVacuum, "duration_ms", rep.DurationMS)
+			default:
+				log.Debug("wal checkpoint completed", "wal_bytes_before", rep.Before.WALBytes)
+			}
+		}
+	}
+}
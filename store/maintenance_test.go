@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// legacyAutoVacuum turns incremental auto_vacuum off, as on databases
+// created by older versions. The connection then asks for incremental
+// again, as every connection NewMessageStore opens does.
+func legacyAutoVacuum(t *testing.T, s *MessageStore) {
+	t.Helper()
+	s.db.SetMaxOpenConns(1)
+	for _, q := range []string{`PRAGMA auto_vacuum = NONE`, `VACUUM`, `PRAGMA auto_vacuum = INCREMENTAL`} {
+		if _, err := s.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaintainBoundsFullVacuum(t *testing.T) {
+	s := newTestStore(t)
+	if err := seedMessages(s, 200, 4); err != nil {
+		t.Fatal(err)
+	}
+	legacyAutoVacuum(t, s)
+
+	rep, err := s.Maintain(context.Background(), true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.FullVacuumSkipped || rep.FullVacuum || rep.Vacuumed {
+		t.Fatalf("over the limit: %+v", rep)
+	}
+
+	rep, err = s.Maintain(context.Background(), true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.FullVacuum || rep.FullVacuumSkipped {
+		t.Fatalf("without a limit: %+v", rep)
+	}
+	var mode int
+	if err := s.db.QueryRow(`PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != 2 {
+		t.Fatalf("auto_vacuum = %d after the full vacuum, want 2 (incremental)", mode)
+	}
+}
+
+func TestMaintainCancelled(t *testing.T) {
+	s := newTestStore(t)
+	legacyAutoVacuum(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Maintain(ctx, true, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled maintenance returned %v", err)
+	}
+}
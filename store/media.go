@@ -0,0 +1,189 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// mediaFileInfo is the metadata recovered from a media file on disk.
+type mediaFileInfo struct {
+	size          int64
+	sha256        []byte
+	mimetype      string
+	width, height int
+}
+
+// inspectMediaFile hashes and sizes the file at path, derives its MIME type
+// from the extension, and reads the dimensions of JPEG, PNG and GIF images.
+func inspectMediaFile(path string) (*mediaFileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	info := &mediaFileInfo{
+		size:     n,
+		sha256:   h.Sum(nil),
+		mimetype: mime.TypeByExtension(filepath.Ext(path)),
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		if cfg, _, err := image.DecodeConfig(f); err == nil {
+			info.width, info.height = cfg.Width, cfg.Height
+		}
+	}
+	return info, nil
+}
+
+// mediaBackfillBatch is the number of messages backfillMediaMetadata
+// inspects per transaction.
+const mediaBackfillBatch = 200
+
+// mediaBackfillKey is the store_meta key that marks a media metadata
+// backfill as pending. Its value is the rowid of the last message inspected,
+// so that a backfill interrupted by a restart resumes where it stopped.
+const mediaBackfillKey = "media_backfill_rowid"
+
+// scheduleMediaBackfill only records that the media metadata of older
+// messages needs filling in. Hashing every media file inside the migration
+// transaction would hold the write lock for as long as that takes, so
+// backfillMediaMetadata does the work afterwards, in batches.
+func scheduleMediaBackfill(tx *sql.Tx) error {
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO store_meta (key, value) VALUES (?, '0')`, mediaBackfillKey); err != nil {
+		return fmt.Errorf("schedule media metadata backfill: %w", err)
+	}
+	return nil
+}
+
+// backfillMediaMetadata fills in size, hash, MIME type and image dimensions
+// for messages stored before that metadata was recorded, from their media
+// files, when scheduleMediaBackfill asked for it. Files are read outside
+// any transaction, and each batch of messages is updated in a transaction
+// of its own. It is best effort: files that no longer exist are skipped,
+// and values already known are kept.
+func backfillMediaMetadata(db *sql.DB) error {
+	for {
+		done, err := backfillMediaBatch(db)
+		if err != nil {
+			return fmt.Errorf("backfill media metadata: %w", err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// backfillMediaBatch backfills the next batch of messages and reports
+// whether the backfill is complete.
+func backfillMediaBatch(db *sql.DB) (bool, error) {
+	var after int64
+	err := db.QueryRow(`SELECT value FROM store_meta WHERE key = ?`, mediaBackfillKey).Scan(&after)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := db.Query(`
+		SELECT rowid, id, media_path FROM messages
+		WHERE rowid > ? AND media_path != ''
+		  AND (media_length = 0 OR media_sha256 IS NULL OR media_mimetype = '')
+		ORDER BY rowid
+		LIMIT ?
+	`, after, mediaBackfillBatch)
+	if err != nil {
+		return false, err
+	}
+	type target struct {
+		rowid    int64
+		id, path string
+		info     *mediaFileInfo
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.rowid, &t.id, &t.path); err != nil {
+			rows.Close()
+			return false, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for i := range targets {
+		targets[i].info, _ = inspectMediaFile(targets[i].path)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	for _, t := range targets {
+		if t.info == nil {
+			continue
+		}
+		if _, err := tx.Exec(`
+			UPDATE messages SET
+				media_length = CASE WHEN media_length = 0 THEN ? ELSE media_length END,
+				media_sha256 = COALESCE(media_sha256, ?),
+				media_mimetype = CASE WHEN media_mimetype = '' THEN ? ELSE media_mimetype END,
+				media_width = CASE WHEN media_width = 0 THEN ? ELSE media_width END,
+				media_height = CASE WHEN media_height = 0 THEN ? ELSE media_height END
+			WHERE id = ?
+		`, t.info.size, t.info.sha256, t.info.mimetype, t.info.width, t.info.height, t.id); err != nil {
+			return false, err
+		}
+	}
+
+	done := len(targets) < mediaBackfillBatch
+	if done {
+		_, err = tx.Exec(`DELETE FROM store_meta WHERE key = ?`, mediaBackfillKey)
+	} else {
+		_, err = tx.Exec(`UPDATE store_meta SET value = ? WHERE key = ?`, targets[len(targets)-1].rowid, mediaBackfillKey)
+	}
+	if err != nil {
+		return false, err
+	}
+	return done, tx.Commit()
+}
+
+// removeUnreferencedMedia deletes the media file at path once no stored
+// message refers to it any more. Files shared by several messages are kept
+// until the last reference goes. A missing file is not an error.
+func (s *MessageStore) removeUnreferencedMedia(path string) error {
+	if path == "" {
+		return nil
+	}
+	var refs int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE media_path = ?`, path).Scan(&refs); err != nil {
+		return fmt.Errorf("count media references: %w", err)
+	}
+	if refs > 0 {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove media file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackfillMediaMetadataInBatches(t *testing.T) {
+	s := newTestStore(t)
+	file := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(file, []byte("not really a photo"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 2*mediaBackfillBatch + 10
+	for i := 0; i < n; i++ {
+		path := file
+		if i == 5 {
+			path = filepath.Join(t.TempDir(), "gone.jpg")
+		}
+		msg := &Message{ID: fmt.Sprintf("M%d", i), ChatJID: "1@s.whatsapp.net", SenderJID: "1@s.whatsapp.net",
+			MsgType: "image", MediaPath: path, Timestamp: int64(i)}
+		if err := s.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.db.Exec(`INSERT INTO store_meta (key, value) VALUES (?, '0')`, mediaBackfillKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backfillMediaMetadata(s.db); err != nil {
+		t.Fatal(err)
+	}
+
+	var filled, missing int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE media_length = 18 AND media_mimetype = 'image/png'`).Scan(&filled); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE media_length = 0`).Scan(&missing); err != nil {
+		t.Fatal(err)
+	}
+	if filled != n-1 || missing != 1 {
+		t.Fatalf("filled %d and left %d, want %d and 1", filled, missing, n-1)
+	}
+	var v string
+	if err := s.db.QueryRow(`SELECT value FROM store_meta WHERE key = ?`, mediaBackfillKey).Scan(&v); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("backfill still pending: %q, %v", v, err)
+	}
+}
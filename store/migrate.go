@@ -0,0 +1,44 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// dataMigrations are one-time data transformations, applied in order and
+// tracked with SQLite's user_version pragma. Entry i brings the database to
+// version i+1. Append only; never reorder or remove entries.
+var dataMigrations = []func(tx *sql.Tx) error{
+	backfillChats,
+	scheduleMediaBackfill,
+	backfillSendStatus,
+	backfillReactionMillis,
+}
+
+// runDataMigrations applies any data migrations newer than the database's
+// recorded version, each in its own transaction.
+func runDataMigrations(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := version; i < len(dataMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("migration %d: begin: %w", i+1, err)
+		}
+		if err := dataMigrations[i](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: set version: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: commit: %w", i+1, err)
+		}
+	}
+	return nil
+}
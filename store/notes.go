@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrNoteNotFound is returned when a chat note does not exist.
+var ErrNoteNotFound = errors.New("note not found")
+
+// Note is an internal operator note on a chat. Notes are local to the bridge
+// and never sent to WhatsApp.
+type Note struct {
+	ID        int64  `json:"id"`
+	ChatJID   string `json:"chat_jid"`
+	Note      string `json:"note"`
+	Author    string `json:"author,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at,omitempty"` // 0 until edited
+}
+
+// Notes live apart from messages, so deleting or pruning messages never
+// touches them.
+const createChatNotesTable = `
+CREATE TABLE IF NOT EXISTS chat_notes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_jid TEXT NOT NULL,
+    note TEXT NOT NULL,
+    author TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_chat_notes_chat ON chat_notes(chat_jid, created_at);
+`
+
+// AddChatNote stores a new note on a chat, created at ts (unix seconds).
+func (s *MessageStore) AddChatNote(chatJID, note, author string, ts int64) (*Note, error) {
+	note, author = SanitizeText(note), SanitizeText(author)
+	res, err := s.db.Exec(`
+		INSERT INTO chat_notes (chat_jid, note, author, created_at) VALUES (?, ?, ?, ?)
+	`, chatJID, note, author, ts)
+	if err != nil {
+		return nil, fmt.Errorf("add chat note: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("add chat note: %w", err)
+	}
+	return &Note{ID: id, ChatJID: chatJID, Note: note, Author: author, CreatedAt: ts}, nil
+}
+
+// GetChatNotes returns the notes of a chat, oldest first.
+func (s *MessageStore) GetChatNotes(chatJID string) ([]Note, error) {
+	rows, err := s.db.Query(`
+		SELECT id, chat_jid, note, author, created_at, updated_at
+		FROM chat_notes
+		WHERE chat_jid = ?
+		ORDER BY created_at, id
+	`, chatJID)
+	if err != nil {
+		return nil, fmt.Errorf("get chat notes: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.ChatJID, &n.Note, &n.Author, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan chat note: %w", err)
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// UpdateChatNote replaces the text of a note of a chat, edited at ts. It
+// returns ErrNoteNotFound if the chat has no such note.
+func (s *MessageStore) UpdateChatNote(chatJID string, id int64, note string, ts int64) (*Note, error) {
+	var n Note
+	err := s.db.QueryRow(`
+		UPDATE chat_notes SET note = ?, updated_at = ?
+		WHERE id = ? AND chat_jid = ?
+		RETURNING id, chat_jid, note, author, created_at, updated_at
+	`, SanitizeText(note), ts, id, chatJID).Scan(&n.ID, &n.ChatJID, &n.Note, &n.Author, &n.CreatedAt, &n.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update chat note: %w", err)
+	}
+	return &n, nil
+}
+
+// DeleteChatNote removes a note of a chat. It returns ErrNoteNotFound if the
+// chat has no such note.
+func (s *MessageStore) DeleteChatNote(chatJID string, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM chat_notes WHERE id = ? AND chat_jid = ?`, id, chatJID)
+	if err != nil {
+		return fmt.Errorf("delete chat note: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoteNotFound
+	}
+	return nil
+}
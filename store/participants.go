@@ -0,0 +1,184 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Participant is a member, or former member, of a group.
+type Participant struct {
+	GroupJID       string `json:"group_jid"`
+	ParticipantJID string `json:"participant_jid"`
+	IsAdmin        bool   `json:"is_admin"`
+	AddedAt        int64  `json:"added_at"`             // unix seconds; when first seen for snapshots
+	RemovedAt      int64  `json:"removed_at,omitempty"` // 0 while still a member
+
+	// Partial is set on members known only from join, leave or admin
+	// changes, before a full snapshot of the group was recorded: the list
+	// may be missing members who never changed.
+	Partial bool `json:"partial,omitempty"`
+}
+
+const createGroupParticipantsTable = `
+CREATE TABLE IF NOT EXISTS group_participants (
+    group_jid TEXT NOT NULL,
+    participant_jid TEXT NOT NULL,
+    is_admin INTEGER NOT NULL DEFAULT 0,
+    added_at INTEGER NOT NULL DEFAULT 0,
+    removed_at INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (group_jid, participant_jid)
+);
+`
+
+// participantMigrations are columns added to the group_participants table
+// after the initial schema.
+var participantMigrations = []column{
+	{"partial", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// HasGroupSnapshot reports whether a full membership snapshot of a group has
+// been recorded, rather than only changes to it.
+func (s *MessageStore) HasGroupSnapshot(groupJID string) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM group_participants WHERE group_jid = ? AND partial = 0`, groupJID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("check group participants: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ReplaceGroupParticipants records a full membership snapshot of a group
+// taken at ts (unix seconds). Listed participants become current members,
+// keeping their original added_at if they already were; current members
+// missing from the snapshot are marked removed at ts.
+func (s *MessageStore) ReplaceGroupParticipants(groupJID string, participants []Participant, ts int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("replace group participants: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Mark everyone removed, then revive the members in the snapshot. Rows
+	// from changes alone become complete.
+	if _, err := tx.Exec(`
+		UPDATE group_participants
+		SET removed_at = CASE WHEN removed_at = 0 THEN ?1 ELSE removed_at END, partial = 0
+		WHERE group_jid = ?2
+	`, ts, groupJID); err != nil {
+		return fmt.Errorf("replace group participants: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO group_participants (group_jid, participant_jid, is_admin, added_at, removed_at)
+		VALUES (?1, ?2, ?3, ?4, 0)
+		ON CONFLICT(group_jid, participant_jid) DO UPDATE SET
+			is_admin = excluded.is_admin,
+			added_at = CASE WHEN removed_at = ?4 THEN added_at ELSE excluded.added_at END,
+			removed_at = 0
+	`)
+	if err != nil {
+		return fmt.Errorf("replace group participants: prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range participants {
+		if _, err := stmt.Exec(groupJID, p.ParticipantJID, boolToInt(p.IsAdmin), ts); err != nil {
+			return fmt.Errorf("replace group participants: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("replace group participants: commit: %w", err)
+	}
+	return nil
+}
+
+// AddGroupParticipants records participants joining a group at ts. Members
+// who had left before are re-added with the new time. Without a snapshot of
+// the group the new rows are marked partial.
+func (s *MessageStore) AddGroupParticipants(groupJID string, participantJIDs []string, ts int64) error {
+	return s.execForParticipants(`
+		INSERT INTO group_participants (group_jid, participant_jid, added_at, partial)
+		VALUES (?1, ?2, ?3, NOT EXISTS (
+			SELECT 1 FROM group_participants WHERE group_jid = ?1 AND partial = 0
+		))
+		ON CONFLICT(group_jid, participant_jid) DO UPDATE SET
+			added_at = CASE WHEN removed_at = 0 THEN added_at ELSE excluded.added_at END,
+			is_admin = CASE WHEN removed_at = 0 THEN is_admin ELSE 0 END,
+			removed_at = 0
+	`, groupJID, participantJIDs, ts)
+}
+
+// RemoveGroupParticipants records participants leaving a group at ts.
+func (s *MessageStore) RemoveGroupParticipants(groupJID string, participantJIDs []string, ts int64) error {
+	return s.execForParticipants(`
+		UPDATE group_participants SET removed_at = ?3, is_admin = 0
+		WHERE group_jid = ?1 AND participant_jid = ?2 AND removed_at = 0
+	`, groupJID, participantJIDs, ts)
+}
+
+// SetGroupAdmins promotes or demotes current members of a group.
+func (s *MessageStore) SetGroupAdmins(groupJID string, participantJIDs []string, isAdmin bool) error {
+	return s.execForParticipants(`
+		UPDATE group_participants SET is_admin = ?3
+		WHERE group_jid = ?1 AND participant_jid = ?2 AND removed_at = 0
+	`, groupJID, participantJIDs, boolToInt(isAdmin))
+}
+
+// execForParticipants runs query once per participant in one transaction,
+// binding ?1 to the group, ?2 to the participant and ?3 to arg.
+func (s *MessageStore) execForParticipants(query, groupJID string, participantJIDs []string, arg interface{}) error {
+	if len(participantJIDs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("update group participants: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, jid := range participantJIDs {
+		if _, err := tx.Exec(query, groupJID, jid, arg); err != nil {
+			return fmt.Errorf("update group participants: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("update group participants: commit: %w", err)
+	}
+	return nil
+}
+
+// GetGroupParticipants returns the current members of a group, admins first,
+// or every participant ever recorded when includeRemoved is set.
+func (s *MessageStore) GetGroupParticipants(groupJID string, includeRemoved bool) ([]Participant, error) {
+	where := []string{`group_jid = ?`}
+	if !includeRemoved {
+		where = append(where, `removed_at = 0`)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT group_jid, participant_jid, is_admin, added_at, removed_at, partial
+		FROM group_participants
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY removed_at != 0, is_admin DESC, participant_jid
+	`, groupJID)
+	if err != nil {
+		return nil, fmt.Errorf("get group participants: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Participant
+	for rows.Next() {
+		var p Participant
+		var isAdmin, partial int
+		if err := rows.Scan(&p.GroupJID, &p.ParticipantJID, &isAdmin, &p.AddedAt, &p.RemovedAt, &partial); err != nil {
+			return nil, fmt.Errorf("scan group participant: %w", err)
+		}
+		p.IsAdmin = isAdmin != 0
+		p.Partial = partial != 0
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
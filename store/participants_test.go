@@ -0,0 +1,50 @@
+package store
+
+import "testing"
+
+func TestPartialGroupParticipants(t *testing.T) {
+	s := newTestStore(t)
+	const group = "1@g.us"
+
+	if err := s.AddGroupParticipants(group, []string{"a@s.whatsapp.net"}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if known, err := s.HasGroupSnapshot(group); err != nil || known {
+		t.Fatalf("HasGroupSnapshot after a join only = %v, %v", known, err)
+	}
+	ps, err := s.GetGroupParticipants(group, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || !ps[0].Partial {
+		t.Fatalf("got %+v, want one partial member", ps)
+	}
+
+	snapshot := []Participant{{ParticipantJID: "a@s.whatsapp.net"}, {ParticipantJID: "b@s.whatsapp.net", IsAdmin: true}}
+	if err := s.ReplaceGroupParticipants(group, snapshot, 20); err != nil {
+		t.Fatal(err)
+	}
+	if known, err := s.HasGroupSnapshot(group); err != nil || !known {
+		t.Fatalf("HasGroupSnapshot after a snapshot = %v, %v", known, err)
+	}
+
+	// Later joins are complete rows.
+	if err := s.AddGroupParticipants(group, []string{"c@s.whatsapp.net"}, 30); err != nil {
+		t.Fatal(err)
+	}
+	ps, err = s.GetGroupParticipants(group, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 3 {
+		t.Fatalf("got %d members, want 3", len(ps))
+	}
+	for _, p := range ps {
+		if p.Partial {
+			t.Errorf("%s still partial", p.ParticipantJID)
+		}
+		if p.ParticipantJID == "a@s.whatsapp.net" && p.AddedAt != 10 {
+			t.Errorf("a added_at = %d, want 10 kept from the join", p.AddedAt)
+		}
+	}
+}
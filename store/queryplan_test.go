@@ -0,0 +1,210 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestQueryPlans explains the listing queries that run on every page load:
+// a chat's messages (first page, next page and filtered by type), messages
+// across all chats, starred messages and the chat list. Each must be answered from an index
+// in order, or it slows down linearly as the store grows. The plans are
+// checked without planner statistics, as on a database maintenance never
+// ran on, and with them.
+func TestQueryPlans(t *testing.T) {
+	s := newTestStore(t)
+	if err := seedMessages(s, 2000, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	type hotQuery struct {
+		name  string
+		query string
+		args  []interface{}
+	}
+	var queries []hotQuery
+	for _, q := range []struct {
+		name    string
+		chatJID string
+		filter  MessageFilter
+		page    Page
+	}{
+		{"chat messages", "x@s.whatsapp.net", MessageFilter{}, Page{Limit: 50}},
+		{"chat messages, next page", "x@s.whatsapp.net", MessageFilter{}, Page{Limit: 50, Cursor: EncodeCursor(1, "x")}},
+		{"chat messages before a time", "x@s.whatsapp.net", MessageFilter{}, Page{Limit: 50, BeforeTS: 1}},
+		{"chat messages by type", "x@s.whatsapp.net", MessageFilter{MsgType: "image"}, Page{Limit: 50}},
+		{"all messages", "", MessageFilter{}, Page{Limit: 50}},
+	} {
+		query, args, err := q.filter.listQuery(q.chatJID, q.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queries = append(queries, hotQuery{q.name, query, args})
+	}
+	query, args, err := chatsQuery(Page{Limit: 50}, ChatFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries = append(queries, hotQuery{"chats", query, args})
+	queries = append(queries, hotQuery{"starred messages", starredQuery, []interface{}{50, 0}})
+
+	for _, stats := range []bool{false, true} {
+		if stats {
+			if _, err := s.db.Exec(`ANALYZE`); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, q := range queries {
+			steps, err := s.explain(q.query, q.args)
+			if err != nil {
+				t.Fatalf("explain %s: %v", q.name, err)
+			}
+			if problem := planProblem(steps); problem != "" {
+				t.Errorf("%s (statistics: %v) %s", q.name, stats, problem)
+			}
+		}
+	}
+}
+
+// explain returns the steps of SQLite's plan for query.
+func (s *MessageStore) explain(query string, args []interface{}) ([]string, error) {
+	rows, err := s.db.Query(`EXPLAIN QUERY PLAN `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			return nil, err
+		}
+		steps = append(steps, detail)
+	}
+	return steps, rows.Err()
+}
+
+// planProblem returns why the plan steps will not scale, or "".
+func planProblem(steps []string) string {
+	for _, step := range steps {
+		switch {
+		case strings.Contains(step, "TEMP B-TREE"):
+			return "sorts rows: " + step
+		case strings.HasPrefix(step, "SCAN ") && !strings.Contains(step, " USING "):
+			return "scans the table: " + step
+		}
+	}
+	return ""
+}
+
+// BenchmarkHotQueries times the listing and search queries on a store with
+// a busy chat holding a tenth of the messages.
+func BenchmarkHotQueries(b *testing.B) {
+	s := newTestStore(b)
+	const messages = 100000
+	if err := seedMessages(s, messages, 1000); err != nil {
+		b.Fatal(err)
+	}
+	busyChat := benchChatJID(0)
+	deep := EncodeCursor(time.Now().Unix()-messages/2, "~")
+
+	for _, q := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"ChatMessages", func() error {
+			_, _, err := s.GetMessages(busyChat, MessageFilter{}, Page{Limit: 50})
+			return err
+		}},
+		{"ChatMessagesDeepPage", func() error {
+			_, _, err := s.GetMessages(busyChat, MessageFilter{}, Page{Limit: 50, Cursor: deep})
+			return err
+		}},
+		{"ChatImages", func() error {
+			_, _, err := s.GetMessages(busyChat, MessageFilter{MsgType: "image"}, Page{Limit: 50})
+			return err
+		}},
+		{"Chats", func() error {
+			_, _, err := s.GetChats(Page{Limit: 50}, ChatFilter{})
+			return err
+		}},
+		{"Search", func() error {
+			_, _, err := s.SearchMessages(SearchParams{Query: "invoice", Limit: 50})
+			return err
+		}},
+	} {
+		b.Run(q.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := q.fn(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newTestStore opens an empty message store in a temporary directory.
+func newTestStore(tb testing.TB) *MessageStore {
+	tb.Helper()
+	s, err := NewMessageStore(filepath.Join(tb.TempDir(), "messages.db"), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close() })
+	return s
+}
+
+var benchWords = strings.Fields(`hello thanks meeting tomorrow invoice order delivery
+	price photo call later today morning evening address payment refund ticket
+	support weekend office project update question answer coffee lunch travel`)
+
+// seedMessages saves n synthetic messages spread over chats, a tenth of
+// them in the first chat, one a second up to now.
+func seedMessages(s *MessageStore, n, chats int) error {
+	rng := rand.New(rand.NewSource(1))
+	now := time.Now().Unix()
+
+	batch := make([]*Message, 0, 5000)
+	for i := 0; i < n; i++ {
+		chat := 0
+		if chats > 1 && rng.Intn(10) != 0 {
+			chat = 1 + rng.Intn(chats-1)
+		}
+		msgType := "text"
+		if rng.Intn(10) == 0 {
+			msgType = "image"
+		}
+		words := make([]string, 3+rng.Intn(10))
+		for j := range words {
+			words[j] = benchWords[rng.Intn(len(benchWords))]
+		}
+		jid := benchChatJID(chat)
+		batch = append(batch, &Message{
+			ID:         fmt.Sprintf("BENCH%09d", i),
+			ChatJID:    jid,
+			SenderJID:  jid,
+			SenderName: fmt.Sprintf("Contact %d", chat),
+			Content:    strings.Join(words, " "),
+			MsgType:    msgType,
+			Timestamp:  now - int64(n-i),
+			IsFromMe:   rng.Intn(3) == 0,
+		})
+		if len(batch) == cap(batch) || i == n-1 {
+			if _, err := s.SaveMessages(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return nil
+}
+
+func benchChatJID(i int) string {
+	return fmt.Sprintf("%d@s.whatsapp.net", 15550000000+i)
+}
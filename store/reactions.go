@@ -0,0 +1,176 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Reaction is a single emoji reaction by one participant on a message.
+type Reaction struct {
+	MessageID   string `json:"message_id"`
+	ReactorJID  string `json:"reactor_jid"`
+	Emoji       string `json:"emoji"`
+	Timestamp   int64  `json:"timestamp"`    // unix seconds
+	TimestampMS int64  `json:"timestamp_ms"` // unix milliseconds, which order a reactor's reactions
+	IsFromMe    bool   `json:"is_from_me"`
+}
+
+const createReactionsTable = `
+CREATE TABLE IF NOT EXISTS reactions (
+    message_id TEXT NOT NULL,
+    reactor_jid TEXT NOT NULL,
+    emoji TEXT NOT NULL,
+    ts INTEGER NOT NULL,
+    is_from_me INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, reactor_jid)
+);
+CREATE INDEX IF NOT EXISTS idx_reactions_reactor ON reactions(reactor_jid);
+`
+
+// reactionMigrations are columns added to the reactions table after the
+// initial schema.
+var reactionMigrations = []column{
+	{"ts_ms", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// SaveReaction records r, replacing any earlier reaction by the same reactor
+// on the same message. Reactions are ordered by TimestampMS, or Timestamp if
+// that is unset, and one older than the stored reaction is ignored so that
+// out-of-order delivery cannot resurrect a stale emoji. Two reactions in the
+// same millisecond are settled the same way whatever order they arrive in:
+// a withdrawal wins, otherwise the emoji that sorts first. An empty Emoji
+// records a withdrawn reaction, which is kept so that it too wins over
+// older reactions delivered after it.
+func (s *MessageStore) SaveReaction(r *Reaction) error {
+	const query = `
+		INSERT INTO reactions (message_id, reactor_jid, emoji, ts, ts_ms, is_from_me)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(message_id, reactor_jid) DO UPDATE SET
+			emoji = excluded.emoji,
+			ts = excluded.ts,
+			ts_ms = excluded.ts_ms,
+			is_from_me = excluded.is_from_me
+		WHERE excluded.ts_ms > reactions.ts_ms
+			OR (excluded.ts_ms = reactions.ts_ms AND excluded.emoji < reactions.emoji)
+	`
+
+	if r.TimestampMS == 0 {
+		r.TimestampMS = r.Timestamp * 1000
+	}
+	r.Timestamp = r.TimestampMS / 1000
+	if _, err := s.db.Exec(query, r.MessageID, r.ReactorJID, r.Emoji, r.Timestamp, r.TimestampMS, boolToInt(r.IsFromMe)); err != nil {
+		return fmt.Errorf("save reaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveReaction records that reactorJID withdrew their reaction on
+// messageID at tsMS (unix milliseconds), unless a newer reaction of theirs
+// is already stored.
+func (s *MessageStore) RemoveReaction(messageID, reactorJID string, tsMS int64, isFromMe bool) error {
+	return s.SaveReaction(&Reaction{MessageID: messageID, ReactorJID: reactorJID, TimestampMS: tsMS, IsFromMe: isFromMe})
+}
+
+// GetReactionsForMessage returns all current reactions on a message, oldest
+// first.
+func (s *MessageStore) GetReactionsForMessage(messageID string) ([]Reaction, error) {
+	const query = `
+		SELECT message_id, reactor_jid, emoji, ts, ts_ms, is_from_me
+		FROM reactions
+		WHERE message_id = ? AND emoji != ''
+		ORDER BY ts_ms, reactor_jid
+	`
+
+	rows, err := s.db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("get reactions: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []Reaction
+	for rows.Next() {
+		var r Reaction
+		var isFromMe int
+		if err := rows.Scan(&r.MessageID, &r.ReactorJID, &r.Emoji, &r.Timestamp, &r.TimestampMS, &isFromMe); err != nil {
+			return nil, fmt.Errorf("scan reaction row: %w", err)
+		}
+		r.IsFromMe = isFromMe != 0
+		reactions = append(reactions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate reaction rows: %w", err)
+	}
+	return reactions, nil
+}
+
+// LoadReactions fills in the aggregated Reactions and MyReaction fields of
+// each message in msgs with a single query.
+func (s *MessageStore) LoadReactions(msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	index := make(map[string]*Message, len(msgs))
+	args := make([]interface{}, 0, len(msgs))
+	for i := range msgs {
+		index[msgs[i].ID] = &msgs[i]
+		args = append(args, msgs[i].ID)
+	}
+
+	query := `
+		SELECT message_id, emoji, COUNT(*), MAX(is_from_me)
+		FROM reactions
+		WHERE message_id IN (` + placeholders(len(args)) + `) AND emoji != ''
+		GROUP BY message_id, emoji
+	`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("load reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id, emoji string
+			count     int
+			mine      int
+		)
+		if err := rows.Scan(&id, &emoji, &count, &mine); err != nil {
+			return fmt.Errorf("scan reaction summary: %w", err)
+		}
+		m := index[id]
+		if m == nil {
+			continue
+		}
+		if m.Reactions == nil {
+			m.Reactions = make(map[string]int)
+		}
+		m.Reactions[emoji] = count
+		if mine != 0 {
+			m.MyReaction = emoji
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate reaction summaries: %w", err)
+	}
+	return nil
+}
+
+// backfillReactionMillis gives reactions stored with second precision a
+// millisecond timestamp, at the start of their second.
+func backfillReactionMillis(tx *sql.Tx) error {
+	if _, err := tx.Exec(`UPDATE reactions SET ts_ms = ts * 1000 WHERE ts_ms = 0`); err != nil {
+		return fmt.Errorf("backfill reaction timestamps: %w", err)
+	}
+	return nil
+}
+
+// placeholders returns n comma-separated SQL bind placeholders.
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
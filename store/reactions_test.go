@@ -0,0 +1,155 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadReactionsAggregates(t *testing.T) {
+	s := newTestStore(t)
+	for _, r := range []Reaction{
+		{MessageID: "M1", ReactorJID: "a@s.whatsapp.net", Emoji: "👍", Timestamp: 10},
+		{MessageID: "M1", ReactorJID: "b@s.whatsapp.net", Emoji: "👍", Timestamp: 11},
+		{MessageID: "M1", ReactorJID: "me@s.whatsapp.net", Emoji: "❤️", Timestamp: 12, IsFromMe: true},
+		{MessageID: "M2", ReactorJID: "a@s.whatsapp.net", Emoji: "😂", Timestamp: 13},
+	} {
+		if err := s.SaveReaction(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b changes their reaction, a withdraws theirs on M2.
+	if err := s.SaveReaction(&Reaction{MessageID: "M1", ReactorJID: "b@s.whatsapp.net", Emoji: "😮", Timestamp: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveReaction("M2", "a@s.whatsapp.net", 21_000, false); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := []Message{{ID: "M1"}, {ID: "M2"}, {ID: "M3"}}
+	if err := s.LoadReactions(msgs); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"👍": 1, "❤️": 1, "😮": 1}; !reflect.DeepEqual(msgs[0].Reactions, want) {
+		t.Errorf("M1 reactions %v, want %v", msgs[0].Reactions, want)
+	}
+	if msgs[0].MyReaction != "❤️" {
+		t.Errorf("M1 my reaction %q, want ❤️", msgs[0].MyReaction)
+	}
+	if msgs[1].Reactions != nil || msgs[2].Reactions != nil {
+		t.Errorf("reactions on M2 %v, M3 %v, want none", msgs[1].Reactions, msgs[2].Reactions)
+	}
+}
+
+func TestSaveReactionIgnoresOlder(t *testing.T) {
+	s := newTestStore(t)
+	save := func(emoji string, ts int64) {
+		t.Helper()
+		if err := s.SaveReaction(&Reaction{MessageID: "M1", ReactorJID: "a@s.whatsapp.net", Emoji: emoji, Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("👍", 20)
+	save("😂", 10) // delivered late
+	save("", 5)   // a withdrawal older than the current reaction
+
+	got, err := s.GetReactionsForMessage("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Emoji != "👍" {
+		t.Fatalf("reactions %+v, want only 👍", got)
+	}
+
+	save("", 30)
+	if got, err = s.GetReactionsForMessage("M1"); err != nil || len(got) != 0 {
+		t.Fatalf("reactions after withdrawal %+v (%v), want none", got, err)
+	}
+	save("👍", 25) // the reaction it withdrew, delivered late
+	if got, err = s.GetReactionsForMessage("M1"); err != nil || len(got) != 0 {
+		t.Fatalf("withdrawn reaction came back: %+v (%v)", got, err)
+	}
+}
+
+func TestSaveReactionOrdering(t *testing.T) {
+	// Each case applies the same reactions in every order and expects the
+	// same winner.
+	tests := []struct {
+		name      string
+		reactions []Reaction
+		want      string
+	}{
+		{
+			name: "milliseconds within one second",
+			reactions: []Reaction{
+				{Emoji: "👍", TimestampMS: 10_100},
+				{Emoji: "😂", TimestampMS: 10_900},
+			},
+			want: "😂",
+		},
+		{
+			name: "withdrawal within the same second",
+			reactions: []Reaction{
+				{Emoji: "👍", TimestampMS: 10_100},
+				{Emoji: "", TimestampMS: 10_200},
+			},
+			want: "",
+		},
+		{
+			name: "withdrawal wins a tie",
+			reactions: []Reaction{
+				{Emoji: "👍", TimestampMS: 10_100},
+				{Emoji: "", TimestampMS: 10_100},
+			},
+			want: "",
+		},
+		{
+			name: "tie between emojis",
+			reactions: []Reaction{
+				{Emoji: "😂", TimestampMS: 10_100},
+				{Emoji: "👍", TimestampMS: 10_100},
+				{Emoji: "❤️", TimestampMS: 10_100},
+			},
+			want: "❤️",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, order := range permutations(len(tt.reactions)) {
+				s := newTestStore(t)
+				for _, i := range order {
+					r := tt.reactions[i]
+					r.MessageID, r.ReactorJID = "M1", "a@s.whatsapp.net"
+					if err := s.SaveReaction(&r); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, err := s.GetReactionsForMessage("M1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				emoji := ""
+				if len(got) > 0 {
+					emoji = got[0].Emoji
+				}
+				if emoji != tt.want {
+					t.Errorf("order %v: reaction %q, want %q", order, emoji, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// permutations returns every ordering of 0..n-1.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var out [][]int
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			q := append(append(append([]int{}, p[:i]...), n-1), p[i:]...)
+			out = append(out, q)
+		}
+	}
+	return out
+}
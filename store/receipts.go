@@ -0,0 +1,134 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Receipt kinds accepted by UpdateReceipt.
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+)
+
+// Send statuses of our own messages. Receipts only move a status forward,
+// from sent to delivered to read; a failed message was never sent and keeps
+// its status.
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+	StatusFailed    = "failed"
+)
+
+// Receipt is the delivery state of a message for one group participant.
+type Receipt struct {
+	MessageID      string `json:"message_id"`
+	ParticipantJID string `json:"participant_jid"`
+	DeliveredAt    int64  `json:"delivered_at,omitempty"`
+	ReadAt         int64  `json:"read_at,omitempty"`
+}
+
+const createGroupReceiptsTable = `
+CREATE TABLE IF NOT EXISTS group_receipts (
+    message_id TEXT NOT NULL,
+    participant_jid TEXT NOT NULL,
+    delivered_at INTEGER NOT NULL DEFAULT 0,
+    read_at INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, participant_jid)
+);
+`
+
+// UpdateReceipt records a delivery or read receipt for messageID at ts (unix
+// seconds). For groups the per-participant state is kept in group_receipts;
+// the message row itself always carries the earliest delivered/read time seen
+// from anyone. A read implies delivery. Earlier timestamps are never
+// overwritten. The message's send status advances to match.
+func (s *MessageStore) UpdateReceipt(messageID, participantJID, kind string, ts int64, isGroup bool) error {
+	var setCols, setStatus string
+	switch kind {
+	case ReceiptDelivered:
+		setCols = `delivered_at = CASE WHEN delivered_at = 0 THEN ?1 ELSE delivered_at END`
+		setStatus = `status = CASE WHEN status = 'sent' THEN 'delivered' ELSE status END`
+	case ReceiptRead:
+		setCols = `delivered_at = CASE WHEN delivered_at = 0 THEN ?1 ELSE delivered_at END,
+			read_at = CASE WHEN read_at = 0 THEN ?1 ELSE read_at END`
+		setStatus = `status = CASE WHEN status IN ('sent', 'delivered') THEN 'read' ELSE status END`
+	default:
+		return fmt.Errorf("update receipt: unknown receipt kind %q", kind)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("update receipt: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE messages SET `+setCols+`, `+setStatus+` WHERE id = ?2`, ts, messageID); err != nil {
+		return fmt.Errorf("update receipt: %w", err)
+	}
+
+	if isGroup {
+		if _, err := tx.Exec(`
+			INSERT INTO group_receipts (message_id, participant_jid) VALUES (?, ?)
+			ON CONFLICT(message_id, participant_jid) DO NOTHING
+		`, messageID, participantJID); err != nil {
+			return fmt.Errorf("update group receipt: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE group_receipts SET `+setCols+` WHERE message_id = ?2 AND participant_jid = ?3`,
+			ts, messageID, participantJID); err != nil {
+			return fmt.Errorf("update group receipt: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("update receipt: commit: %w", err)
+	}
+	return nil
+}
+
+// GetReceipts returns the per-participant receipts recorded for a group
+// message.
+func (s *MessageStore) GetReceipts(messageID string) ([]Receipt, error) {
+	const query = `
+		SELECT message_id, participant_jid, delivered_at, read_at
+		FROM group_receipts
+		WHERE message_id = ?
+		ORDER BY participant_jid
+	`
+
+	rows, err := s.db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("get receipts: %w", err)
+	}
+	defer rows.Close()
+
+	var receipts []Receipt
+	for rows.Next() {
+		var r Receipt
+		if err := rows.Scan(&r.MessageID, &r.ParticipantJID, &r.DeliveredAt, &r.ReadAt); err != nil {
+			return nil, fmt.Errorf("scan receipt row: %w", err)
+		}
+		receipts = append(receipts, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate receipt rows: %w", err)
+	}
+	return receipts, nil
+}
+
+// backfillSendStatus derives the send status of our own messages stored
+// before it was recorded from their receipt timestamps.
+func backfillSendStatus(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+		UPDATE messages SET status = CASE
+			WHEN read_at > 0 THEN 'read'
+			WHEN delivered_at > 0 THEN 'delivered'
+			ELSE 'sent'
+		END
+		WHERE is_from_me = 1 AND status = ''
+	`); err != nil {
+		return fmt.Errorf("backfill send status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// RevokedPreview replaces the chat preview when the latest message of a chat
+// is deleted for everyone.
+const RevokedPreview = "[deleted]"
+
+// RevokeMessage marks a message as deleted for everyone. If blank is set the
+// content is cleared as well, which also drops it from the search index, and
+// the media file and download keys are removed. It reports whether the
+// message exists.
+func (s *MessageStore) RevokeMessage(id string, blank bool) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("revoke message: begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var chatJID, mediaPath string
+	var ts int64
+	err = tx.QueryRow(`SELECT chat_jid, timestamp, media_path FROM messages WHERE id = ?`, id).Scan(&chatJID, &ts, &mediaPath)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("revoke message: %w", err)
+	}
+
+	query := `UPDATE messages SET revoked = 1 WHERE id = ?`
+	if blank {
+		query = `UPDATE messages SET revoked = 1, content = '', media_path = '',
+			media_key = NULL, media_direct_path = '' WHERE id = ?`
+	}
+	if _, err := tx.Exec(query, id); err != nil {
+		return false, fmt.Errorf("revoke message: %w", err)
+	}
+	// If this was the chat's latest message, stop previewing its text.
+	if _, err := tx.Exec(`UPDATE chats SET last_message = ? WHERE jid = ? AND last_ts = ?`,
+		RevokedPreview, chatJID, ts); err != nil {
+		return false, fmt.Errorf("revoke message: update chat: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("revoke message: commit: %w", err)
+	}
+	if blank {
+		if err := s.removeUnreferencedMedia(mediaPath); err != nil {
+			return true, fmt.Errorf("revoke message: %w", err)
+		}
+	}
+	return true, nil
+}
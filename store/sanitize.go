@@ -0,0 +1,43 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SanitizeText replaces invalid UTF-8 sequences with U+FFFD and strips
+// control characters other than newline, carriage return and tab, so that
+// malformed message text cannot break JSON output or FTS indexing.
+func SanitizeText(s string) string {
+	if utf8.ValidString(s) && strings.IndexFunc(s, isStrippedControl) < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r == utf8.RuneError && size == 1 {
+			b.WriteRune(utf8.RuneError)
+			continue
+		}
+		if isStrippedControl(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isStrippedControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+}
+
+// sanitizeMessage cleans the free-text fields of m in place.
+func sanitizeMessage(m *Message) {
+	m.SenderName = SanitizeText(m.SenderName)
+	m.Content = SanitizeText(m.Content)
+	m.GroupName = SanitizeText(m.GroupName)
+}
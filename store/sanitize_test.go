@@ -0,0 +1,52 @@
+package store
+
+import "testing"
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "hello, world", "hello, world"},
+		{"emoji and accents", "café 👋🏽", "café 👋🏽"},
+		{"newlines and tabs kept", "a\nb\r\nc\td", "a\nb\r\nc\td"},
+		{"control characters stripped", "a\x00b\x07c\x1bd\x7fe", "abcde"},
+		{"C1 control stripped", "a\u0085b", "ab"},
+		{"invalid byte replaced", "a\xffb", "a�b"},
+		{"truncated sequence replaced", "a\xe2\x82", "a��"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeText(tt.in); got != tt.want {
+				t.Errorf("SanitizeText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveMessageSanitizes(t *testing.T) {
+	s := newTestStore(t)
+	err := s.SaveMessage(&Message{
+		ID: "M1", ChatJID: "1@s.whatsapp.net", SenderJID: "1@s.whatsapp.net",
+		SenderName: "Bob\x00", Content: "hi\xff there\x1b", MsgType: "text", Timestamp: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.GetMessageByID("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SenderName != "Bob" || m.Content != "hi� there" {
+		t.Errorf("stored sender %q, content %q", m.SenderName, m.Content)
+	}
+
+	// The sanitized text is searchable.
+	found, _, err := s.SearchMessages(SearchParams{Query: "there", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Errorf("search found %d messages, want 1", len(found))
+	}
+}
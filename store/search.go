@@ -0,0 +1,165 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SearchParams selects messages for SearchMessages. Every field is optional;
+// zero values do not filter.
+type SearchParams struct {
+	Query     string // free-text FTS5 query over content and sender name
+	ChatJID   string
+	SenderJID string // full JID, or a bare number matching any server
+	MsgType   string
+	After     int64 // unix seconds, exclusive
+	Before    int64 // unix seconds, exclusive
+	IsGroup   *bool
+	Limit     int
+	Offset    int
+
+	// IncludeRevoked returns messages deleted for everyone, which are
+	// excluded by default.
+	IncludeRevoked bool
+}
+
+// SearchMessages returns messages matching p together with the total number
+// of matches ignoring Limit and Offset. With a text query the FTS5 index is
+// used and results are ranked by relevance; without one the filters run
+// against the messages table and results are ordered newest first.
+//
+// When content is encrypted there is no index: a text query decrypts every
+// message passing the other filters and keeps those containing the query,
+// case-insensitively, newest first. This is much slower on large stores.
+func (s *MessageStore) SearchMessages(p SearchParams) ([]Message, int, error) {
+	var (
+		from  string
+		where []string
+		args  []interface{}
+		order string
+	)
+
+	scan := p.Query != "" && s.crypt != nil
+	if p.Query != "" && !scan {
+		// Escape any double quotes in the query to avoid FTS5 syntax errors.
+		escaped := strings.ReplaceAll(p.Query, `"`, `""`)
+		from = `messages m JOIN messages_fts fts ON m.rowid = fts.rowid`
+		where = append(where, `messages_fts MATCH ?`)
+		args = append(args, fmt.Sprintf(`"%s"`, escaped))
+		order = `rank`
+	} else {
+		from = `messages m`
+		order = `m.timestamp DESC, m.id DESC`
+	}
+
+	if p.ChatJID != "" {
+		where = append(where, `m.chat_jid = ?`)
+		args = append(args, p.ChatJID)
+	}
+	if p.SenderJID != "" {
+		if strings.Contains(p.SenderJID, "@") {
+			where = append(where, `m.sender_jid = ?`)
+			args = append(args, p.SenderJID)
+		} else {
+			where = append(where, `m.sender_jid LIKE ? || '@%' ESCAPE '\'`)
+			args = append(args, escapeLike(strings.TrimPrefix(p.SenderJID, "+")))
+		}
+	}
+	if p.MsgType != "" {
+		where = append(where, `m.msg_type = ?`)
+		args = append(args, p.MsgType)
+	}
+	if p.After > 0 {
+		where = append(where, `m.timestamp > ?`)
+		args = append(args, p.After)
+	}
+	if p.Before > 0 {
+		where = append(where, `m.timestamp < ?`)
+		args = append(args, p.Before)
+	}
+	if p.IsGroup != nil {
+		where = append(where, `m.is_group = ?`)
+		args = append(args, boolToInt(*p.IsGroup))
+	}
+	if !p.IncludeRevoked {
+		where = append(where, `m.revoked = 0`)
+	}
+
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = "WHERE " + strings.Join(where, " AND ")
+	}
+	if scan {
+		return s.scanSearch(p, whereClause, args)
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM ` + from + ` ` + whereClause
+	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count search results: %w", err)
+	}
+
+	query := `
+		SELECT ` + prefixColumns("m", messageColumns) + `
+		FROM ` + from + `
+		` + whereClause + `
+		ORDER BY ` + order + `
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.db.Query(query, append(args, p.Limit, p.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs, err := s.scanMessages(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return msgs, total, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, for use with
+// ESCAPE '\', so that s only matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// scanSearch answers a text query over encrypted content by decrypting the
+// messages selected by whereClause and matching them in Go.
+func (s *MessageStore) scanSearch(p SearchParams, whereClause string, args []interface{}) ([]Message, int, error) {
+	query := `
+		SELECT ` + prefixColumns("m", messageColumns) + `
+		FROM messages m
+		` + whereClause + `
+		ORDER BY m.timestamp DESC, m.id DESC
+	`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search messages: %w", err)
+	}
+	defer rows.Close()
+
+	needle := strings.ToLower(p.Query)
+	var msgs []Message
+	total := 0
+	for rows.Next() {
+		m, err := s.scanMessage(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !strings.Contains(strings.ToLower(m.Content), needle) &&
+			!strings.Contains(strings.ToLower(m.SenderName), needle) {
+			continue
+		}
+		if total >= p.Offset && len(msgs) < p.Limit {
+			msgs = append(msgs, m)
+		}
+		total++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("search messages: %w", err)
+	}
+	return msgs, total, nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchMessagesFilters(t *testing.T) {
+	s := newTestStore(t)
+	const chat = "1@s.whatsapp.net"
+	for _, m := range []*Message{
+		{ID: "B", SenderJID: "15551234@s.whatsapp.net", Timestamp: 10},
+		{ID: "C", SenderJID: "15551234@s.whatsapp.net", Timestamp: 10},
+		{ID: "A", SenderJID: "15551234@lid", Timestamp: 10},
+		{ID: "D", SenderJID: "15551234@s.whatsapp.net", Timestamp: 9},
+		{ID: "E", SenderJID: "1555x234@s.whatsapp.net", Timestamp: 11},
+	} {
+		m.ChatJID, m.Content, m.MsgType = chat, "hi", "text"
+		if err := s.SaveMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(p SearchParams) string {
+		t.Helper()
+		msgs, _, err := s.SearchMessages(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range msgs {
+			got = append(got, m.ID)
+		}
+		return strings.Join(got, "")
+	}
+
+	// Newest first, the ID breaking ties within a second.
+	if got := ids(SearchParams{ChatJID: chat, Limit: 10}); got != "ECBAD" {
+		t.Errorf("chat: got %s, want ECBAD", got)
+	}
+	if got := ids(SearchParams{SenderJID: "+15551234", Limit: 10}); got != "CBAD" {
+		t.Errorf("number: got %s, want CBAD", got)
+	}
+	// LIKE wildcards in a number match only themselves.
+	for _, sender := range []string{"1555_234", "1555%", "%"} {
+		if got := ids(SearchParams{SenderJID: sender, Limit: 10}); got != "" {
+			t.Errorf("sender %q: got %s, want nothing", sender, got)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"fmt"
+	"os"
+)
+
+// Stats summarises the size and contents of the message store.
+type Stats struct {
+	TotalMessages   int64            `json:"total_messages"`
+	MessagesByType  map[string]int64 `json:"messages_by_type"`
+	TopChats        []ChatCount      `json:"top_chats"`
+	OldestTimestamp int64            `json:"oldest_timestamp,omitempty"`
+	NewestTimestamp int64            `json:"newest_timestamp,omitempty"`
+	AgentPending    int64            `json:"agent_pending"` // messages with agent_status "triggered"
+	DBSize          int64            `json:"db_size_bytes"`
+	WALSize         int64            `json:"wal_size_bytes"`
+}
+
+// ChatCount is the number of stored messages in one chat.
+type ChatCount struct {
+	ChatJID  string `json:"chat_jid"`
+	Messages int64  `json:"messages"`
+}
+
+// Stats gathers message counts and database file sizes. topChats bounds the
+// number of chats listed in TopChats.
+func (s *MessageStore) Stats(topChats int) (*Stats, error) {
+	st := &Stats{MessagesByType: make(map[string]int64), TopChats: []ChatCount{}}
+
+	var oldest, newest *int64
+	if err := s.db.QueryRow(`SELECT COUNT(*), MIN(timestamp), MAX(timestamp) FROM messages`).
+		Scan(&st.TotalMessages, &oldest, &newest); err != nil {
+		return nil, fmt.Errorf("count messages: %w", err)
+	}
+	if oldest != nil {
+		st.OldestTimestamp = *oldest
+	}
+	if newest != nil {
+		st.NewestTimestamp = *newest
+	}
+
+	rows, err := s.db.Query(`SELECT msg_type, COUNT(*) FROM messages GROUP BY msg_type`)
+	if err != nil {
+		return nil, fmt.Errorf("count messages by type: %w", err)
+	}
+	for rows.Next() {
+		var msgType string
+		var n int64
+		if err := rows.Scan(&msgType, &n); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan type count: %w", err)
+		}
+		st.MessagesByType[msgType] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("count messages by type: %w", err)
+	}
+
+	rows, err = s.db.Query(`
+		SELECT chat_jid, COUNT(*) AS n FROM messages
+		GROUP BY chat_jid
+		ORDER BY n DESC, chat_jid
+		LIMIT ?`, topChats)
+	if err != nil {
+		return nil, fmt.Errorf("count messages by chat: %w", err)
+	}
+	for rows.Next() {
+		var c ChatCount
+		if err := rows.Scan(&c.ChatJID, &c.Messages); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan chat count: %w", err)
+		}
+		st.TopChats = append(st.TopChats, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("count messages by chat: %w", err)
+	}
+
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE agent_status = 'triggered'`).
+		Scan(&st.AgentPending); err != nil {
+		return nil, fmt.Errorf("count pending agent runs: %w", err)
+	}
+
+	st.DBSize = fileSize(s.path)
+	st.WALSize = fileSize(s.path + "-wal")
+	return st, nil
+}
+
+// fileSize returns the size of the file at path, or 0 if it does not exist.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// ChatStats summarises the messages stored for one chat.
+type ChatStats struct {
+	ChatJID        string           `json:"chat_jid"`
+	TotalMessages  int64            `json:"total_messages"`
+	MessagesByType map[string]int64 `json:"messages_by_type"`
+	FromMe         int64            `json:"from_me"`
+	FromThem       int64            `json:"from_them"`
+	FirstTimestamp int64            `json:"first_timestamp,omitempty"`
+	LastTimestamp  int64            `json:"last_timestamp,omitempty"`
+	MediaFiles     int64            `json:"media_files"`
+	MediaBytes     int64            `json:"media_bytes"` // size on disk of the chat's downloaded media
+}
+
+// GetChatStats returns message counts, activity range and media usage for a
+// chat. It returns nil if the chat has no stored messages.
+func (s *MessageStore) GetChatStats(jid string) (*ChatStats, error) {
+	st := &ChatStats{ChatJID: jid, MessagesByType: make(map[string]int64)}
+
+	var first, last *int64
+	if err := s.db.QueryRow(`
+		SELECT COUNT(*), MIN(timestamp), MAX(timestamp), COALESCE(SUM(is_from_me), 0)
+		FROM messages WHERE chat_jid = ?`, jid).
+		Scan(&st.TotalMessages, &first, &last, &st.FromMe); err != nil {
+		return nil, fmt.Errorf("chat stats: %w", err)
+	}
+	if st.TotalMessages == 0 {
+		return nil, nil
+	}
+	st.FirstTimestamp, st.LastTimestamp = *first, *last
+	st.FromThem = st.TotalMessages - st.FromMe
+
+	rows, err := s.db.Query(`SELECT msg_type, COUNT(*) FROM messages WHERE chat_jid = ? GROUP BY msg_type`, jid)
+	if err != nil {
+		return nil, fmt.Errorf("chat stats by type: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msgType string
+		var n int64
+		if err := rows.Scan(&msgType, &n); err != nil {
+			return nil, fmt.Errorf("scan type count: %w", err)
+		}
+		st.MessagesByType[msgType] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("chat stats by type: %w", err)
+	}
+
+	paths, err := s.chatMediaPaths(jid)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			st.MediaFiles++
+			st.MediaBytes += info.Size()
+		}
+	}
+	return st, nil
+}
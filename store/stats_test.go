@@ -0,0 +1,52 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetChatStats(t *testing.T) {
+	s := newTestStore(t)
+	media := filepath.Join(t.TempDir(), "M3.jpg")
+	if err := os.WriteFile(media, make([]byte, 1234), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const chat = "1@s.whatsapp.net"
+	for _, m := range []*Message{
+		{ID: "M1", ChatJID: chat, MsgType: "text", Timestamp: 100},
+		{ID: "M2", ChatJID: chat, MsgType: "text", Timestamp: 300, IsFromMe: true},
+		{ID: "M3", ChatJID: chat, MsgType: "image", Timestamp: 200, MediaPath: media},
+		{ID: "M4", ChatJID: chat, MsgType: "image", Timestamp: 250, MediaPath: filepath.Join(filepath.Dir(media), "gone.jpg")},
+		{ID: "M5", ChatJID: "2@s.whatsapp.net", MsgType: "text", Timestamp: 50},
+	} {
+		m.SenderJID = m.ChatJID
+		if err := s.SaveMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.GetChatStats(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ChatStats{
+		ChatJID:        chat,
+		TotalMessages:  4,
+		MessagesByType: map[string]int64{"text": 2, "image": 2},
+		FromMe:         1,
+		FromThem:       3,
+		FirstTimestamp: 100,
+		LastTimestamp:  300,
+		MediaFiles:     1, // the other file is no longer on disk
+		MediaBytes:     1234,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChatStats = %+v\nwant %+v", got, want)
+	}
+
+	if got, err := s.GetChatStats("3@s.whatsapp.net"); err != nil || got != nil {
+		t.Errorf("stats of an unknown chat = %+v, %v; want nil", got, err)
+	}
+}
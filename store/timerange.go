@@ -0,0 +1,104 @@
+package store
+
+import (
+	"fmt"
+)
+
+// MaxRangeLimit caps the number of messages GetMessagesByTime returns in
+// one page.
+const MaxRangeLimit = 1000
+
+// TimeRange selects messages by time, across all chats unless ChatJID is
+// set. Zero values do not filter.
+type TimeRange struct {
+	After     int64 // unix seconds, exclusive
+	Before    int64 // unix seconds, exclusive
+	ChatJID   string
+	MsgType   string
+	IsGroup   *bool
+	Ascending bool // oldest first; newest first otherwise
+}
+
+// GetMessagesByTime calls fn for up to limit messages of all chats in tr, in
+// timestamp order, and returns the cursor for the following page (empty when
+// there are no more messages). Rows are handed to fn as they are read rather
+// than collected, so large pages need little memory. limit is capped at
+// MaxRangeLimit, which also applies when limit is not positive. Reactions,
+// receipts and edits are not loaded.
+func (s *MessageStore) GetMessagesByTime(tr TimeRange, cursor string, limit int, fn func(*Message) error) (string, error) {
+	if limit <= 0 || limit > MaxRangeLimit {
+		limit = MaxRangeLimit
+	}
+
+	where := `1 = 1`
+	var args []interface{}
+	if tr.After > 0 {
+		where += ` AND timestamp > ?`
+		args = append(args, tr.After)
+	}
+	if tr.Before > 0 {
+		where += ` AND timestamp < ?`
+		args = append(args, tr.Before)
+	}
+	if tr.ChatJID != "" {
+		where += ` AND chat_jid = ?`
+		args = append(args, tr.ChatJID)
+	}
+	if tr.MsgType != "" {
+		where += ` AND msg_type = ?`
+		args = append(args, tr.MsgType)
+	}
+	if tr.IsGroup != nil {
+		where += ` AND is_group = ?`
+		args = append(args, boolToInt(*tr.IsGroup))
+	}
+
+	order, cmp := `DESC`, `<`
+	if tr.Ascending {
+		order, cmp = `ASC`, `>`
+	}
+	if cursor != "" {
+		ts, id, err := DecodeCursor(cursor)
+		if err != nil {
+			return "", err
+		}
+		where += ` AND (timestamp, id) ` + cmp + ` (?, ?)`
+		args = append(args, ts, id)
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE ` + where + `
+		ORDER BY timestamp ` + order + `, id ` + order + `
+		LIMIT ?
+	`
+
+	// Read one extra row to learn whether another page exists.
+	rows, err := s.db.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return "", fmt.Errorf("get messages by time: %w", err)
+	}
+	defer rows.Close()
+
+	var last Message
+	n := 0
+	for rows.Next() {
+		if n == limit {
+			return EncodeCursor(last.Timestamp, last.ID), nil
+		}
+		m, err := s.scanMessage(rows)
+		if err != nil {
+			return "", err
+		}
+		if err := fn(&m); err != nil {
+			return "", err
+		}
+		last = m
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("get messages by time: %w", err)
+	}
+	return "", nil
+}